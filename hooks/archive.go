@@ -0,0 +1,529 @@
+package hooks
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/list"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	courseArchiveManifestName = "manifest.json"
+	courseArchiveFormat       = "elesson-course"
+	// version of the archive layout, increased on incompatible changes
+	courseArchiveVersion = 1
+	// limit of the extracted archive, which holds the videos of every lesson
+	courseArchiveMaxSize = cartridgeMaxSize
+	// limit of the manifest, which holds the content of every lesson
+	courseArchiveMaxManifestSize = 100 << 20
+)
+
+var ErrCourseArchiveInvalid = errors.New("invalid course archive")
+
+// courseArchiveCollections are the collections of the records of a course
+// archive, in the order they're imported.
+var courseArchiveCollections = []string{"courses", "lessons", "lesson_faqs", "lesson_resources"}
+
+// courseArchiveManifest is the manifest.json of a course archive. Records are
+// stored by field name, with their original id. Relations to other records of
+// the archive keep the original ids, while the relations to the users and
+// organizations of the instance are left out. File fields hold the stored
+// file names, with the files under files/{collection}/{id}/.
+type courseArchiveManifest struct {
+	Format     string           `json:"format"`
+	Version    int              `json:"version"`
+	ExportedAt types.DateTime   `json:"exported_at"`
+	Course     map[string]any   `json:"course"`
+	Lessons    []map[string]any `json:"lessons"`
+	FAQs       []map[string]any `json:"lesson_faqs"`
+	Resources  []map[string]any `json:"lesson_resources"`
+}
+
+// records returns the records of the archive by collection name.
+func (m *courseArchiveManifest) records() map[string][]map[string]any {
+	return map[string][]map[string]any{
+		"courses":          {m.Course},
+		"lessons":          m.Lessons,
+		"lesson_faqs":      m.FAQs,
+		"lesson_resources": m.Resources,
+	}
+}
+
+// CourseArchive is a parsed course archive.
+type CourseArchive struct {
+	Version    int
+	ExportedAt types.DateTime
+
+	manifest courseArchiveManifest
+	files    map[string]*zip.File
+}
+
+// CourseArchiveImport is the result of a course archive import.
+type CourseArchiveImport struct {
+	Course    *core.Record `json:"course"`
+	Lessons   int          `json:"lessons"`
+	FAQs      int          `json:"lesson_faqs"`
+	Resources int          `json:"lesson_resources"`
+	// fields of the archive missing from the collections of this instance
+	Ignored []string `json:"ignored"`
+}
+
+func courseArchiveInvalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrCourseArchiveInvalid, fmt.Sprintf(format, args...))
+}
+
+func courseArchiveFilePath(collection, id, name string) string {
+	return "files/" + collection + "/" + id + "/" + name
+}
+
+// isStoredFileName reports whether a file name of an archive can be stored as is.
+func isStoredFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// storedFileRef returns the record id and file name of a file URL of the instance.
+func storedFileRef(value string) (recordID, name string, ok bool) {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return "", "", false
+	}
+
+	segments := strings.Split(strings.TrimPrefix(parsed.Path, "/"), "/")
+	if len(segments) != 5 || segments[0] != "api" || segments[1] != "files" {
+		return "", "", false
+	}
+	return segments[3], segments[4], true
+}
+
+// remapFileURLs rewrites the file URLs of HTML content referring to copied
+// records, which keep their stored file names, to the files of the copies.
+// remap returns the collection and id of the copy of a record.
+func remapFileURLs(content string, remap func(recordID string) (collectionID, copyID string, ok bool)) (string, error) {
+	nodes, err := parseHTMLFragment(content)
+	if err != nil {
+		return "", err
+	}
+
+	rewriteHTMLURLs(nodes, func(value string) (string, bool) {
+		recordID, name, ok := storedFileRef(value)
+		if !ok {
+			return "", false
+		}
+		collectionID, copyID, ok := remap(recordID)
+		if !ok {
+			return "", false
+		}
+
+		rewritten := "/api/files/" + collectionID + "/" + copyID + "/" + name
+		if parsed, _ := url.Parse(value); parsed.RawQuery != "" {
+			rewritten += "?" + parsed.RawQuery
+		}
+		return rewritten, true
+	})
+
+	return renderHTMLNodes(nodes)
+}
+
+// ExportCourseArchive writes a course, with its lessons, their FAQs and
+// resources and every stored file, as a course archive.
+func (cs *CourseService) ExportCourseArchive(course *core.Record, w io.Writer) error {
+	lessons, err := cs.app.FindRecordsByFilter("lessons", "course = {:course}", "created", 0, 0, dbx.Params{"course": course.Id})
+	if err != nil {
+		return fmt.Errorf("failed to find lessons: %w", err)
+	}
+
+	manifest := courseArchiveManifest{
+		Format:     courseArchiveFormat,
+		Version:    courseArchiveVersion,
+		ExportedAt: types.NowDateTime(),
+		Lessons:    []map[string]any{},
+		FAQs:       []map[string]any{},
+		Resources:  []map[string]any{},
+	}
+	records := []*core.Record{course}
+	records = append(records, lessons...)
+	for _, lesson := range lessons {
+		faqs, err := findLessonFAQs(cs.app, lesson.Id)
+		if err != nil {
+			return fmt.Errorf("failed to find the FAQs of lesson %q: %w", lesson.GetString("title"), err)
+		}
+		resources, err := findLessonResources(cs.app, lesson.Id)
+		if err != nil {
+			return fmt.Errorf("failed to find the resources of lesson %q: %w", lesson.GetString("title"), err)
+		}
+		records = append(records, faqs...)
+		records = append(records, resources...)
+	}
+
+	fsys, err := cs.app.NewFilesystem()
+	if err != nil {
+		return err
+	}
+	defer fsys.Close()
+
+	archive := zip.NewWriter(w)
+	// FAQs and resources shared by several lessons are exported once
+	exported := map[string]bool{}
+
+	for _, record := range records {
+		if exported[record.Id] {
+			continue
+		}
+		exported[record.Id] = true
+
+		data := map[string]any{"id": record.Id}
+		for _, field := range record.Collection().Fields {
+			name := field.GetName()
+			switch field := field.(type) {
+			case *core.RelationField:
+				related, err := cs.app.FindCachedCollectionByNameOrId(field.CollectionId)
+				if err != nil || !slices.Contains(courseArchiveCollections, related.Name) {
+					continue
+				}
+			case *core.FileField:
+				for _, storedName := range record.GetStringSlice(name) {
+					if err := copyRecordFile(archive, fsys, record, storedName); err != nil {
+						return err
+					}
+				}
+			case *core.PasswordField:
+				continue
+			}
+			if name != "id" {
+				data[name] = record.Get(name)
+			}
+		}
+
+		switch record.Collection().Name {
+		case "courses":
+			manifest.Course = data
+		case "lessons":
+			manifest.Lessons = append(manifest.Lessons, data)
+		case "lesson_faqs":
+			manifest.FAQs = append(manifest.FAQs, data)
+		case "lesson_resources":
+			manifest.Resources = append(manifest.Resources, data)
+		}
+	}
+
+	writer, err := archive.Create(courseArchiveManifestName)
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", courseArchiveManifestName, err)
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", courseArchiveManifestName, err)
+	}
+
+	return archive.Close()
+}
+
+// copyRecordFile adds a stored file of a record to a course archive.
+func copyRecordFile(archive *zip.Writer, fsys *filesystem.System, record *core.Record, storedName string) error {
+	reader, err := fsys.GetReader(record.BaseFilesPath() + "/" + storedName)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", storedName, err)
+	}
+	defer reader.Close()
+
+	name := courseArchiveFilePath(record.Collection().Name, record.Id, storedName)
+	writer, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	if _, err := io.Copy(writer, reader); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", storedName, err)
+	}
+	return nil
+}
+
+// ParseCourseArchive validates a course archive and reads its manifest.
+func ParseCourseArchive(r io.ReaderAt, size int64) (*CourseArchive, error) {
+	files, err := packageArchiveFiles(r, size, courseArchiveMaxSize)
+	if err != nil {
+		return nil, courseArchiveInvalid("%v", err)
+	}
+
+	archive := &CourseArchive{files: map[string]*zip.File{}}
+	for _, file := range files {
+		archive.files[file.Name] = file
+	}
+
+	manifestFile, ok := archive.files[courseArchiveManifestName]
+	if !ok {
+		return nil, courseArchiveInvalid("missing %s", courseArchiveManifestName)
+	}
+	if manifestFile.UncompressedSize64 > courseArchiveMaxManifestSize {
+		return nil, courseArchiveInvalid("%s exceeds %d bytes", courseArchiveManifestName, courseArchiveMaxManifestSize)
+	}
+	reader, err := manifestFile.Open()
+	if err != nil {
+		return nil, courseArchiveInvalid("failed to open %s", courseArchiveManifestName)
+	}
+	defer reader.Close()
+	if err := json.NewDecoder(reader).Decode(&archive.manifest); err != nil {
+		return nil, courseArchiveInvalid("malformed %s: %v", courseArchiveManifestName, err)
+	}
+
+	manifest := archive.manifest
+	if manifest.Format != courseArchiveFormat {
+		return nil, courseArchiveInvalid("not an eLesson course archive")
+	}
+	if manifest.Version < 1 || manifest.Version > courseArchiveVersion {
+		return nil, courseArchiveInvalid("unsupported archive version %d (up to %d is supported)", manifest.Version, courseArchiveVersion)
+	}
+	if manifest.Course == nil {
+		return nil, courseArchiveInvalid("missing course")
+	}
+	archive.Version = manifest.Version
+	archive.ExportedAt = manifest.ExportedAt
+
+	ids := map[string]bool{}
+	for _, collection := range courseArchiveCollections {
+		for _, data := range manifest.records()[collection] {
+			id, _ := data["id"].(string)
+			if id == "" || ids[id] {
+				return nil, courseArchiveInvalid("missing or duplicated %s id %q", collection, id)
+			}
+			ids[id] = true
+		}
+	}
+
+	return archive, nil
+}
+
+// file returns a stored file of an archived record, keeping its stored name,
+// which is unique within the record.
+func (a *CourseArchive) file(collection, id, name string) (*filesystem.File, error) {
+	file, ok := a.files[courseArchiveFilePath(collection, id, name)]
+	if !isStoredFileName(name) || !ok {
+		return nil, courseArchiveInvalid("missing file %s of %s %s", name, collection, id)
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", file.Name, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file.Name, err)
+	}
+
+	stored, err := filesystem.NewFileFromBytes(content, name)
+	if err != nil {
+		return nil, courseArchiveInvalid("%s: %v", file.Name, err)
+	}
+	stored.Name = name
+	return stored, nil
+}
+
+// ImportCourseArchive creates a course of an organization, with new ids, from
+// a course archive. The course isn't assigned to anyone unless it's assigned
+// to everyone, as the users differ between instances.
+func (cs *CourseService) ImportCourseArchive(archive *CourseArchive, organizationID string) (*CourseArchiveImport, error) {
+	result := &CourseArchiveImport{Ignored: []string{}}
+	records := archive.manifest.records()
+
+	// the new id of every archived record, to remap the relations and file URLs
+	ids := map[string]string{}
+	for _, collection := range courseArchiveCollections {
+		for _, data := range records[collection] {
+			ids[data["id"].(string)] = core.GenerateDefaultRandomId()
+		}
+	}
+	collectionIDs := map[string]string{}
+
+	// file URLs refer to the new record id, the stored file names are kept
+	remap := func(recordID string) (string, string, bool) {
+		return collectionIDs[recordID], ids[recordID], ids[recordID] != "" && collectionIDs[recordID] != ""
+	}
+
+	err := cs.app.RunInTransaction(func(txApp core.App) error {
+		collections := map[string]*core.Collection{}
+		for _, name := range courseArchiveCollections {
+			collection, err := txApp.FindCollectionByNameOrId(name)
+			if err != nil {
+				return fmt.Errorf("failed to find %s collection: %w", name, err)
+			}
+			collections[name] = collection
+			for _, data := range records[name] {
+				collectionIDs[data["id"].(string)] = collection.Id
+			}
+		}
+
+		for _, name := range courseArchiveCollections {
+			collection := collections[name]
+
+			for _, data := range records[name] {
+				oldID := data["id"].(string)
+				record := core.NewRecord(collection)
+				record.Set("id", ids[oldID])
+
+				keys := make([]string, 0, len(data))
+				for key := range data {
+					keys = append(keys, key)
+				}
+				slices.Sort(keys)
+
+				for _, key := range keys {
+					value := data[key]
+					if key == "id" {
+						continue
+					}
+
+					switch collection.Fields.GetByName(key).(type) {
+					case nil:
+						if ignored := name + "." + key; !slices.Contains(result.Ignored, ignored) {
+							result.Ignored = append(result.Ignored, ignored)
+						}
+					case *core.RelationField:
+						related := []string{}
+						for _, id := range list.ToUniqueStringSlice(value) {
+							if ids[id] != "" {
+								related = append(related, ids[id])
+							}
+						}
+						record.Set(key, related)
+					case *core.FileField:
+						files := []*filesystem.File{}
+						for _, storedName := range list.ToUniqueStringSlice(value) {
+							file, err := archive.file(name, oldID, storedName)
+							if err != nil {
+								return err
+							}
+							files = append(files, file)
+						}
+						record.Set(key, files)
+					case *core.AutodateField:
+						// keep the creation dates, the lessons are listed by them
+						if date, err := types.ParseDateTime(value); err == nil && !date.IsZero() {
+							record.SetRaw(key, date)
+						}
+					case *core.EditorField:
+						content, err := remapFileURLs(fmt.Sprint(value), remap)
+						if err != nil {
+							return fmt.Errorf("failed to remap the files of %s of %s %s: %w", key, name, oldID, err)
+						}
+						record.Set(key, content)
+					default:
+						record.Set(key, value)
+					}
+				}
+
+				if name == "courses" {
+					record.Set("organization", organizationID)
+				}
+
+				if err := txApp.Save(record); err != nil {
+					return fmt.Errorf("failed to save %s %s: %w", name, oldID, err)
+				}
+
+				switch name {
+				case "courses":
+					result.Course = record
+				case "lessons":
+					result.Lessons++
+				case "lesson_faqs":
+					result.FAQs++
+				case "lesson_resources":
+					result.Resources++
+				}
+			}
+		}
+
+		// assign the course to the users of its new organization
+		txService := cs.withApp(txApp)
+		assignees, err := txService.ProcessAssignToEveryone(result.Course)
+		if err != nil {
+			return err
+		}
+		for _, assignee := range assignees {
+			if err := txService.CreateProgressRecord(result.Course.Id, assignee, StatusNotStarted); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func bindArchiveRoutes(r *router.Router[*core.RequestEvent], courseService *CourseService) {
+	// download a course as a course archive, to import it into another instance
+	r.GET("/api/courses/{id}/archive", func(e *core.RequestEvent) error {
+		course, err := e.App.FindRecordById("courses", e.Request.PathValue("id"))
+		if err != nil {
+			return e.NotFoundError("", err)
+		}
+		if !CanManageCourse(e.Auth, course) {
+			return e.ForbiddenError("Only the admins of the course organization can export it.", nil)
+		}
+
+		e.Response.Header().Set("Content-Type", "application/zip")
+		e.Response.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+			"filename": course.GetString("title") + ".zip",
+		}))
+
+		// the archive is streamed, errors can only be logged once it started
+		if err := courseService.ExportCourseArchive(course, e.Response); err != nil {
+			e.App.Logger().Error("Failed to export the course archive", "course", course.Id, "error", err)
+		}
+		return nil
+	}).Bind(RequireRole(RoleOrgAdmin))
+
+	// create a course from a course archive, in the organization of the
+	// current user (superusers pick the organization)
+	r.POST("/api/courses/import/archive", func(e *core.RequestEvent) error {
+		files, err := e.FindUploadedFiles("file")
+		if err != nil || len(files) == 0 {
+			return e.BadRequestError("The archive file is required.", err)
+		}
+
+		archive, err := parsePackageFile(files[0], ParseCourseArchive)
+		if errors.Is(err, ErrCourseArchiveInvalid) {
+			return e.BadRequestError(err.Error(), nil)
+		}
+		if err != nil {
+			return e.InternalServerError("Failed to read the archive.", err)
+		}
+
+		organizationID := e.Auth.GetString("organization")
+		if e.Auth.IsSuperuser() {
+			organizationID = e.Request.FormValue("organization")
+		}
+
+		result, err := courseService.WithActor(requestActor(e)).ImportCourseArchive(archive, organizationID)
+		if errors.Is(err, ErrCourseArchiveInvalid) {
+			return e.BadRequestError(err.Error(), nil)
+		}
+		if err != nil {
+			return e.InternalServerError("Failed to import the archive.", err)
+		}
+
+		if err := apis.EnrichRecord(e, result.Course); err != nil {
+			return e.InternalServerError("", err)
+		}
+		return e.JSON(http.StatusOK, result)
+	}).Bind(RequireRole(RoleOrgAdmin), apis.BodyLimit(courseArchiveMaxSize))
+}
@@ -0,0 +1,276 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestCourseArchiveExportImport(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	course, lessons := createTestAuthoredCourse(t, app, courses)
+
+	var exported bytes.Buffer
+	if err := service.ExportCourseArchive(course, &exported); err != nil {
+		t.Fatalf("ExportCourseArchive failed: %v", err)
+	}
+
+	archive, err := ParseCourseArchive(bytes.NewReader(exported.Bytes()), int64(exported.Len()))
+	if err != nil {
+		t.Fatalf("ParseCourseArchive failed: %v", err)
+	}
+	if archive.Version != courseArchiveVersion || archive.ExportedAt.IsZero() {
+		t.Errorf("Unexpected archive version %d exported at %v", archive.Version, archive.ExportedAt)
+	}
+
+	// the new organization doesn't have the fields dropped since the export
+	lessonsCollection, _ := app.FindCollectionByNameOrId("lessons")
+	lessonsCollection.Fields.RemoveByName("summary")
+	if err := app.Save(lessonsCollection); err != nil {
+		t.Fatalf("Failed to update lessons collection: %v", err)
+	}
+
+	result, err := service.ImportCourseArchive(archive, testOrg2)
+	if err != nil {
+		t.Fatalf("ImportCourseArchive failed: %v", err)
+	}
+	imported := result.Course
+	if imported.Id == course.Id || imported.GetString("organization") != testOrg2 || imported.GetString("title") != "Forklift safety" ||
+		imported.GetString("description") != "Driving forklifts in the warehouse" {
+		t.Errorf("Unexpected imported course %v", imported.FieldsData())
+	}
+	if result.Lessons != 2 || result.FAQs != 1 || result.Resources != 1 || strings.Join(result.Ignored, ",") != "lessons.summary" {
+		t.Errorf("Unexpected import %+v", result)
+	}
+
+	importedLessons, err := app.FindRecordsByFilter("lessons", "course = {:course}", "created", 0, 0, dbx.Params{"course": imported.Id})
+	if err != nil || len(importedLessons) != 2 {
+		t.Fatalf("Expected 2 imported lessons, got %d %v", len(importedLessons), err)
+	}
+	basics := importedLessons[0]
+	original, err := app.FindRecordById("lessons", lessons[0].Id)
+	if err != nil {
+		t.Fatalf("Failed to find the original lesson: %v", err)
+	}
+	if basics.Id == original.Id || basics.GetString("title") != "Basics" || basics.GetString("created") != original.GetString("created") {
+		t.Errorf("Expected the lessons to keep their order, got %v", basics.FieldsData())
+	}
+	for _, field := range []string{"video", "thumbnail", "captions", "downloads"} {
+		if strings.Join(basics.GetStringSlice(field), ",") != strings.Join(lessons[0].GetStringSlice(field), ",") {
+			t.Errorf("Expected the %s files to keep their names, got %v", field, basics.GetStringSlice(field))
+		}
+	}
+
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		t.Fatalf("Failed to open the filesystem: %v", err)
+	}
+	defer fsys.Close()
+	reader, err := fsys.GetReader(basics.BaseFilesPath() + "/" + basics.GetStringSlice("downloads")[1])
+	if err != nil {
+		t.Fatalf("Expected the download to be stored: %v", err)
+	}
+	content, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(content) != "Check the brakes & the horn." {
+		t.Errorf("Unexpected download content %q", content)
+	}
+
+	diagramURL := lessonFileURL(basics, basics.GetStringSlice("downloads")[0])
+	if !strings.Contains(basics.GetString("content"), `src="`+diagramURL+`"`) {
+		t.Errorf("Expected the content to embed the imported diagram, got %q", basics.GetString("content"))
+	}
+
+	// the resource shared by both lessons is imported once
+	resources, err := findLessonResources(app, importedLessons[1].Id)
+	if err != nil || len(resources) != 1 ||
+		strings.Join(resources[0].GetStringSlice("lesson"), ",") != basics.Id+","+importedLessons[1].Id {
+		t.Errorf("Expected the resource of both imported lessons, got %d %v", len(resources), err)
+	}
+	if faqs, err := findLessonFAQs(app, basics.Id); err != nil || len(faqs) != 1 || faqs[0].GetString("question") != "Do I need a license?" {
+		t.Errorf("Expected the imported FAQ, got %d %v", len(faqs), err)
+	}
+
+	// the original course is left untouched
+	if original, err := findLessonResources(app, lessons[0].Id); err != nil || len(original) != 1 || original[0].Id == resources[0].Id {
+		t.Errorf("Expected the original resource to remain, got %d %v", len(original), err)
+	}
+}
+
+func TestParseCourseArchive(t *testing.T) {
+	invalid := map[string][]byte{
+		"not a zip":   []byte("archive"),
+		"no manifest": testScormZip(t, map[string]string{"files/readme.txt": "hi"}),
+		"other format": testScormZip(t, map[string]string{
+			"manifest.json": `{"format": "other", "version": 1, "course": {"id": "c1"}}`,
+		}),
+		"newer version": testScormZip(t, map[string]string{
+			"manifest.json": `{"format": "elesson-course", "version": 2, "course": {"id": "c1"}}`,
+		}),
+		"no course": testScormZip(t, map[string]string{
+			"manifest.json": `{"format": "elesson-course", "version": 1}`,
+		}),
+		"duplicated id": testScormZip(t, map[string]string{
+			"manifest.json": `{"format": "elesson-course", "version": 1, "course": {"id": "c1"}, "lessons": [{"id": "c1"}]}`,
+		}),
+	}
+	for name, content := range invalid {
+		if _, err := ParseCourseArchive(bytes.NewReader(content), int64(len(content))); !errors.Is(err, ErrCourseArchiveInvalid) {
+			t.Errorf("%s: expected ErrCourseArchiveInvalid, got %v", name, err)
+		}
+	}
+
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+	createTestCollections(t, app)
+
+	content := testScormZip(t, map[string]string{
+		"manifest.json": `{"format": "elesson-course", "version": 1, "course": {"id": "c1", "title": "Missing files"},
+			"lessons": [{"id": "l1", "course": "c1", "title": "Intro", "downloads": ["../../secret.txt"]}]}`,
+	})
+	archive, err := ParseCourseArchive(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("ParseCourseArchive failed: %v", err)
+	}
+	if _, err := service.ImportCourseArchive(archive, testOrg1); !errors.Is(err, ErrCourseArchiveInvalid) {
+		t.Errorf("Expected ErrCourseArchiveInvalid for a missing file, got %v", err)
+	}
+	if total, _ := app.CountRecords("courses"); total != 0 {
+		t.Errorf("Expected the failed import to be rolled back, got %d courses", total)
+	}
+}
+
+func TestCourseArchiveRoutes(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, users := createTestCollections(t, app)
+	course, _ := createTestAuthoredCourse(t, app, courses)
+
+	newUser := func(email, role, organization string) *core.Record {
+		user := core.NewRecord(users)
+		user.SetEmail(email)
+		user.SetPassword("1234567890")
+		user.Set("role", role)
+		user.Set("organization", organization)
+		if err := app.Save(user); err != nil {
+			t.Fatalf("Failed to save user: %v", err)
+		}
+		return user
+	}
+	instructor := newUser("instructor@example.com", RoleInstructor, testOrg1)
+	otherAdmin := newUser("admin2@example.com", RoleOrgAdmin, testOrg2)
+	course.Set("owner", instructor.Id)
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	bindArchiveRoutes(r, service)
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	send := func(user *core.Record, method, path string, body io.Reader, contentType string) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest(method, server.URL+path, body)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		token, err := user.NewAuthToken()
+		if err != nil {
+			t.Fatalf("Failed to create auth token: %v", err)
+		}
+		req.Header.Set("Authorization", token)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		return res
+	}
+
+	// archives move courses between instances, which is up to the admins
+	res := send(instructor, http.MethodGet, "/api/courses/"+course.Id+"/archive", nil, "")
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected instructors not to export archives, got %d", res.StatusCode)
+	}
+	res = send(otherAdmin, http.MethodGet, "/api/courses/"+course.Id+"/archive", nil, "")
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the admins of other organizations not to export the course, got %d", res.StatusCode)
+	}
+
+	superusers, err := app.FindCollectionByNameOrId(core.CollectionNameSuperusers)
+	if err != nil {
+		t.Fatalf("Failed to find superusers collection: %v", err)
+	}
+	superuser := core.NewRecord(superusers)
+	superuser.SetEmail("root@example.com")
+	superuser.SetPassword("1234567890")
+	if err := app.Save(superuser); err != nil {
+		t.Fatalf("Failed to save superuser: %v", err)
+	}
+
+	res = send(superuser, http.MethodGet, "/api/courses/"+course.Id+"/archive", nil, "")
+	exported, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.Contains(res.Header.Get("Content-Disposition"), `filename="Forklift safety.zip"`) {
+		t.Fatalf("Expected the archive, got %d %q", res.StatusCode, res.Header.Get("Content-Disposition"))
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "forklift.zip")
+	part.Write(exported)
+	form.WriteField("organization", testOrg1)
+	form.Close()
+
+	// org admins import into their own organization
+	res = send(otherAdmin, http.MethodPost, "/api/courses/import/archive", bytes.NewReader(body.Bytes()), form.FormDataContentType())
+	result := struct {
+		Course  map[string]any `json:"course"`
+		Lessons int            `json:"lessons"`
+	}{}
+	json.NewDecoder(res.Body).Decode(&result)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || result.Lessons != 2 || result.Course["organization"] != testOrg2 {
+		t.Errorf("Expected the admin to import the course into org2, got %d %+v", res.StatusCode, result)
+	}
+
+	res = send(instructor, http.MethodPost, "/api/courses/import/archive", bytes.NewReader(body.Bytes()), form.FormDataContentType())
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected instructors not to import archives, got %d", res.StatusCode)
+	}
+
+	res = send(otherAdmin, http.MethodPost, "/api/courses/import/archive", strings.NewReader("{}"), "application/json")
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without archive, got %d", res.StatusCode)
+	}
+}
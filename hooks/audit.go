@@ -0,0 +1,271 @@
+package hooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Audit log actions.
+const (
+	AuditProgressCreated        = "progress.created"
+	AuditProgressDeleted        = "progress.deleted"
+	AuditProgressStatusChanged  = "progress.status_changed"
+	AuditProgressReset          = "progress.reset"
+	AuditProgressChangeReverted = "progress.change_reverted"
+	AuditCourseAssigneeAdded    = "course.assignee_added"
+	AuditCourseAssigneeRemoved  = "course.assignee_removed"
+	AuditCourseAssigneesChanged = "course.assignees_changed"
+	AuditCourseAssignToEveryone = "course.assigned_to_everyone"
+	AuditCourseDuplicated       = "course.duplicated"
+	AuditEnrollmentRequested    = "enrollment.requested"
+	AuditEnrollmentApproved     = "enrollment.approved"
+	AuditEnrollmentRejected     = "enrollment.rejected"
+	AuditInviteRedeemed         = "invite.redeemed"
+	AuditInviteRevoked          = "invite.revoked"
+	AuditUserProvisioned        = "user.provisioned"
+	AuditUserDeactivated        = "user.deactivated"
+	AuditUserReactivated        = "user.reactivated"
+	AuditUserDeprovisioned      = "user.deprovisioned"
+	AuditGroupMembersChanged    = "group.members_changed"
+)
+
+// AuditKeyEnv names the environment variable holding the key of the audit log
+// hashes. It is kept out of the database, so that the entries can't be
+// rewritten with valid hashes by someone with write access to it.
+const AuditKeyEnv = "ELESSON_AUDIT_KEY"
+
+// auditKeyMinLength is the minimum length of the audit log key.
+const auditKeyMinLength = 32
+
+var (
+	ErrAuditLogTampered = errors.New("audit log has been tampered with")
+	ErrAuditKeyMissing  = fmt.Errorf("the %s environment variable must be set to a key of at least %d characters", AuditKeyEnv, auditKeyMinLength)
+)
+
+// AuditHead identifies the newest entry of the audit log. Recorded outside of
+// the database, it reveals the removal of the newest entries.
+type AuditHead struct {
+	Count int
+	Hash  string
+}
+
+// auditKey returns the key of the audit log hashes.
+func auditKey() ([]byte, error) {
+	key := os.Getenv(AuditKeyEnv)
+	if len(key) < auditKeyMinLength {
+		return nil, ErrAuditKeyMissing
+	}
+	return []byte(key), nil
+}
+
+// auditEntry is the canonical form of an audit log record used for hashing.
+type auditEntry struct {
+	Seq              int             `json:"seq"`
+	Action           string          `json:"action"`
+	Actor            string          `json:"actor"`
+	TargetCollection string          `json:"target_collection"`
+	TargetId         string          `json:"target_id"`
+	Data             json.RawMessage `json:"data"`
+	OccurredAt       string          `json:"occurred_at"`
+	PrevHash         string          `json:"prev_hash"`
+}
+
+// hash returns the hex encoded HMAC-SHA256 of the entry.
+func (entry auditEntry) hash(key []byte) (string, error) {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func auditEntryFromRecord(record *core.Record) auditEntry {
+	data := record.GetString("data")
+	if data == "" {
+		data = "null"
+	}
+
+	return auditEntry{
+		Seq:              record.GetInt("seq"),
+		Action:           record.GetString("action"),
+		Actor:            record.GetString("actor"),
+		TargetCollection: record.GetString("target_collection"),
+		TargetId:         record.GetString("target_id"),
+		Data:             json.RawMessage(data),
+		OccurredAt:       record.GetDateTime("occurred_at").String(),
+		PrevHash:         record.GetString("prev_hash"),
+	}
+}
+
+// WithActor returns a copy of the service that attributes its mutations to actorID.
+func (cs *CourseService) WithActor(actorID string) *CourseService {
+	clone := *cs
+	clone.actor = actorID
+	return &clone
+}
+
+// withApp returns a copy of the service bound to app (eg. a transaction).
+func (cs *CourseService) withApp(app core.App) *CourseService {
+	clone := *cs
+	clone.app = app
+	return &clone
+}
+
+// Audit appends a hash-chained entry to the audit log, keyed with the audit key.
+func (cs *CourseService) Audit(action, targetCollection, targetID string, data map[string]any) error {
+	rawData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to serialize audit data: %w", err)
+	}
+
+	key, err := auditKey()
+	if err != nil {
+		return err
+	}
+
+	return cs.app.RunInTransaction(func(txApp core.App) error {
+		auditCollection, err := txApp.FindCollectionByNameOrId("audit_log")
+		if err != nil {
+			return fmt.Errorf("failed to find audit_log collection: %w", err)
+		}
+
+		entry := auditEntry{
+			Seq:              1,
+			Action:           action,
+			Actor:            cs.actor,
+			TargetCollection: targetCollection,
+			TargetId:         targetID,
+			Data:             rawData,
+			OccurredAt:       types.NowDateTime().String(),
+		}
+
+		lastRecord := &core.Record{}
+		err = txApp.RecordQuery(auditCollection).
+			OrderBy("seq DESC").
+			Limit(1).
+			One(lastRecord)
+		if err == nil {
+			entry.Seq = lastRecord.GetInt("seq") + 1
+			entry.PrevHash = lastRecord.GetString("hash")
+		}
+
+		hash, err := entry.hash(key)
+		if err != nil {
+			return fmt.Errorf("failed to hash audit entry: %w", err)
+		}
+
+		record := core.NewRecord(auditCollection)
+		record.Set("seq", entry.Seq)
+		record.Set("action", entry.Action)
+		record.Set("actor", entry.Actor)
+		record.Set("target_collection", entry.TargetCollection)
+		record.Set("target_id", entry.TargetId)
+		record.Set("data", types.JSONRaw(entry.Data))
+		record.Set("occurred_at", entry.OccurredAt)
+		record.Set("prev_hash", entry.PrevHash)
+		record.Set("hash", hash)
+
+		if err := txApp.Save(record); err != nil {
+			return fmt.Errorf("failed to save audit entry: %w", err)
+		}
+		return nil
+	})
+}
+
+// VerifyAuditLog walks the audit log in order and checks the hash chain,
+// then that it still holds the recorded head (when its count isn't 0).
+// It returns the number of verified entries.
+func VerifyAuditLog(app core.App, recorded AuditHead) (int, error) {
+	key, err := auditKey()
+	if err != nil {
+		return 0, err
+	}
+
+	records, err := app.FindRecordsByFilter("audit_log", "", "seq", 0, 0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load audit log: %w", err)
+	}
+
+	prevHash := ""
+	for i, record := range records {
+		entry := auditEntryFromRecord(record)
+
+		if entry.Seq != i+1 {
+			return i, fmt.Errorf("%w: expected entry #%d, found #%d (%s)", ErrAuditLogTampered, i+1, entry.Seq, record.Id)
+		}
+
+		if entry.PrevHash != prevHash {
+			return i, fmt.Errorf("%w: entry #%d (%s) does not link to the previous entry", ErrAuditLogTampered, entry.Seq, record.Id)
+		}
+
+		hash, err := entry.hash(key)
+		if err != nil {
+			return i, fmt.Errorf("failed to hash audit entry #%d: %w", entry.Seq, err)
+		}
+
+		if !hmac.Equal([]byte(hash), []byte(record.GetString("hash"))) {
+			return i, fmt.Errorf("%w: entry #%d (%s) content does not match its hash", ErrAuditLogTampered, entry.Seq, record.Id)
+		}
+
+		prevHash = hash
+	}
+
+	if recorded.Count > 0 {
+		if recorded.Count > len(records) {
+			return len(records), fmt.Errorf("%w: the recorded head is entry #%d but the log ends at entry #%d", ErrAuditLogTampered, recorded.Count, len(records))
+		}
+		if hash := records[recorded.Count-1].GetString("hash"); hash != recorded.Hash {
+			return len(records), fmt.Errorf("%w: entry #%d does not match the recorded head", ErrAuditLogTampered, recorded.Count)
+		}
+	}
+
+	return len(records), nil
+}
+
+// FindAuditHead returns the newest entry of the audit log, to be recorded
+// outside of the database.
+func FindAuditHead(app core.App) (AuditHead, error) {
+	records, err := app.FindRecordsByFilter("audit_log", "", "-seq", 1, 0)
+	if err != nil {
+		return AuditHead{}, fmt.Errorf("failed to load audit log: %w", err)
+	}
+	if len(records) == 0 {
+		return AuditHead{}, nil
+	}
+	return AuditHead{Count: records[0].GetInt("seq"), Hash: records[0].GetString("hash")}, nil
+}
+
+// initAuditLogHooks makes the audit log append-only, even for superusers, and
+// reports a missing audit key.
+func initAuditLogHooks(app core.App) {
+	if _, err := auditKey(); err != nil {
+		app.Logger().Error("The audit log can't be written", "error", err)
+	}
+
+	app.OnRecordUpdate("audit_log").BindFunc(func(e *core.RecordEvent) error {
+		return errors.New("audit log entries cannot be modified")
+	})
+
+	app.OnRecordDelete("audit_log").BindFunc(func(e *core.RecordEvent) error {
+		return errors.New("audit log entries cannot be deleted")
+	})
+}
+
+// requestActor returns the id of the authenticated user or superuser of a request.
+func requestActor(e *core.RequestEvent) string {
+	if e.Auth == nil {
+		return ""
+	}
+	return e.Auth.Id
+}
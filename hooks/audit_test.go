@@ -0,0 +1,169 @@
+package hooks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+// TestMain sets the audit key, which the audit log can't be written without.
+func TestMain(m *testing.M) {
+	os.Setenv(AuditKeyEnv, "test-audit-key-0123456789abcdef0123456789")
+	os.Exit(m.Run())
+}
+
+func TestCourseService_Audit(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	createTestCollections(t, app)
+	initAuditLogHooks(app)
+
+	actions := []string{AuditCourseAssigneeAdded, AuditProgressCreated, AuditProgressStatusChanged}
+	for _, action := range actions {
+		err := service.WithActor("admin").Audit(action, "courses", "course1", map[string]any{"assignee": "user1"})
+		if err != nil {
+			t.Fatalf("Audit failed for %s: %v", action, err)
+		}
+	}
+
+	total, err := VerifyAuditLog(app, AuditHead{})
+	if err != nil {
+		t.Fatalf("Expected an intact audit log, got %v", err)
+	}
+	if total != len(actions) {
+		t.Errorf("Expected %d verified entries, got %d", len(actions), total)
+	}
+
+	entries, err := app.FindRecordsByFilter("audit_log", "", "seq", 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to load audit log: %v", err)
+	}
+
+	if entries[1].GetString("prev_hash") != entries[0].GetString("hash") {
+		t.Error("Expected the second entry to link to the first one")
+	}
+
+	if entries[0].GetString("actor") != "admin" {
+		t.Errorf("Expected actor %q, got %q", "admin", entries[0].GetString("actor"))
+	}
+
+	// the audit log is append-only through the app
+	entries[0].Set("actor", "someone else")
+	if err := app.Save(entries[0]); err == nil {
+		t.Error("Expected audit log updates to be rejected")
+	}
+
+	if err := app.Delete(entries[0]); err == nil {
+		t.Error("Expected audit log deletes to be rejected")
+	}
+}
+
+func TestVerifyAuditLog_DetectsTampering(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	createTestCollections(t, app)
+
+	for i := 0; i < 3; i++ {
+		if err := service.Audit(AuditProgressCreated, "progress", "progress1", nil); err != nil {
+			t.Fatalf("Audit failed: %v", err)
+		}
+	}
+
+	// simulate a change made directly in the database
+	_, err := app.DB().NewQuery("UPDATE audit_log SET actor = 'intruder' WHERE seq = 2").Execute()
+	if err != nil {
+		t.Fatalf("Failed to tamper with audit log: %v", err)
+	}
+
+	total, err := VerifyAuditLog(app, AuditHead{})
+	if !errors.Is(err, ErrAuditLogTampered) {
+		t.Fatalf("Expected ErrAuditLogTampered, got %v", err)
+	}
+	if total != 1 {
+		t.Errorf("Expected 1 valid entry before the tampered one, got %d", total)
+	}
+}
+
+func TestVerifyAuditLog_DetectsRehashedEntries(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	createTestCollections(t, app)
+
+	for i := 0; i < 3; i++ {
+		if err := service.Audit(AuditProgressCreated, "progress", "progress1", nil); err != nil {
+			t.Fatalf("Audit failed: %v", err)
+		}
+	}
+
+	// rewrite an entry and the chain after it without the key
+	entries, err := app.FindRecordsByFilter("audit_log", "", "seq", 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to load audit log: %v", err)
+	}
+	prevHash := entries[0].GetString("hash")
+	for _, record := range entries[1:] {
+		entry := auditEntryFromRecord(record)
+		entry.Actor = "intruder"
+		entry.PrevHash = prevHash
+		payload, _ := json.Marshal(entry)
+		sum := sha256.Sum256(payload)
+		prevHash = hex.EncodeToString(sum[:])
+
+		_, err := app.DB().NewQuery("UPDATE audit_log SET actor = 'intruder', prev_hash = {:prev}, hash = {:hash} WHERE id = {:id}").
+			Bind(map[string]any{"prev": entry.PrevHash, "hash": prevHash, "id": record.Id}).
+			Execute()
+		if err != nil {
+			t.Fatalf("Failed to tamper with audit log: %v", err)
+		}
+	}
+
+	if total, err := VerifyAuditLog(app, AuditHead{}); !errors.Is(err, ErrAuditLogTampered) || total != 1 {
+		t.Fatalf("Expected the rehashed entry #2 to be detected, got %d %v", total, err)
+	}
+}
+
+func TestVerifyAuditLog_DetectsRemovedHead(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	createTestCollections(t, app)
+
+	for i := 0; i < 3; i++ {
+		if err := service.Audit(AuditProgressCreated, "progress", "progress1", nil); err != nil {
+			t.Fatalf("Audit failed: %v", err)
+		}
+	}
+
+	head, err := FindAuditHead(app)
+	if err != nil || head.Count != 3 || head.Hash == "" {
+		t.Fatalf("Expected the third entry as head, got %+v (%v)", head, err)
+	}
+	if _, err := VerifyAuditLog(app, head); err != nil {
+		t.Fatalf("Expected the log to match its head, got %v", err)
+	}
+
+	// newer entries don't invalidate a recorded head
+	if err := service.Audit(AuditProgressDeleted, "progress", "progress1", nil); err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	if _, err := VerifyAuditLog(app, head); err != nil {
+		t.Errorf("Expected the log to still hold the recorded head, got %v", err)
+	}
+
+	// dropping the newest entries leaves a consistent chain, but not the head
+	if _, err := app.DB().NewQuery("DELETE FROM audit_log WHERE seq >= 3").Execute(); err != nil {
+		t.Fatalf("Failed to tamper with audit log: %v", err)
+	}
+	if _, err := VerifyAuditLog(app, AuditHead{}); err != nil {
+		t.Fatalf("Expected the truncated chain to be consistent, got %v", err)
+	}
+	if _, err := VerifyAuditLog(app, head); !errors.Is(err, ErrAuditLogTampered) {
+		t.Errorf("Expected the removed head to be detected, got %v", err)
+	}
+}
@@ -0,0 +1,590 @@
+package hooks
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// bookImageTypes are the media types of the images bundled in the books, by
+// extension. Other files are linked to the instance.
+var bookImageTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".svg":  "image/svg+xml",
+}
+
+// courseBook is a course rendered for offline reading, as an EPUB or a
+// printable HTML page.
+type courseBook struct {
+	Title       string
+	Description string
+	Lessons     []courseBookLesson
+	// the lesson images bundled in the book
+	images []courseBookImage
+}
+
+// courseBookLesson is a lesson of a book.
+type courseBookLesson struct {
+	// the identifier of the lesson in the book, naming its EPUB chapter and
+	// its anchor in the printable page
+	ID        string
+	Title     string
+	Summary   string
+	Thumbnail string
+	Content   template.HTML
+	FAQs      []CartridgeFAQ
+	Resources []cartridgePageLink
+	Downloads []cartridgePageLink
+}
+
+// courseBookImage is a stored lesson image, with its path in the book.
+type courseBookImage struct {
+	lesson     *core.Record
+	storedName string
+	Path       string
+	MediaType  string
+}
+
+// bookLessonTemplate renders a lesson, as well-formed XHTML for the EPUB chapters.
+var bookLessonTemplate = template.Must(template.New("lesson").Parse(`<section class="lesson" id="{{.ID}}">
+<h1>{{.Title}}</h1>
+{{- if .Summary}}
+<p class="summary">{{.Summary}}</p>
+{{- end}}
+{{- if .Thumbnail}}
+<img class="thumbnail" src="{{.Thumbnail}}" alt=""/>
+{{- end}}
+<div class="content">{{.Content}}</div>
+{{- if .FAQs}}
+<h2>FAQ</h2>
+<dl class="faqs">
+{{- range .FAQs}}
+<dt>{{.Question}}</dt>
+<dd>{{.Answer}}</dd>
+{{- end}}
+</dl>
+{{- end}}
+{{- if .Resources}}
+<h2>Resources</h2>
+<ul class="resources">
+{{- range .Resources}}
+<li><a href="{{.Href}}">{{.Name}}</a></li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .Downloads}}
+<h2>Downloads</h2>
+<ul class="downloads">
+{{- range .Downloads}}
+<li><a href="{{.Href}}">{{.Name}}</a></li>
+{{- end}}
+</ul>
+{{- end}}
+</section>`))
+
+// bookStyle is the style sheet of the books.
+const bookStyle = `body { font-family: Georgia, serif; line-height: 1.5; margin: 0 auto; max-width: 45em; padding: 0 1em; }
+h1, h2, h3 { font-family: Helvetica, Arial, sans-serif; line-height: 1.2; }
+img { max-width: 100%; height: auto; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #999; padding: 0.25em 0.5em; }
+.summary { font-style: italic; }
+.thumbnail { display: block; margin: 1em 0; }
+.faqs dt { font-weight: bold; margin-top: 0.5em; }
+.media::before { content: "\25B6  "; }
+@media print {
+  body { max-width: none; }
+  .lesson { break-before: page; }
+  a[href^="http"]::after { content: " (" attr(href) ")"; font-size: 0.8em; }
+}
+`
+
+var bookPrintableTemplate = template.Must(template.Must(bookLessonTemplate.Clone()).New("printable").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8"/>
+<title>{{.Title}}</title>
+<style>{{.Style}}</style>
+</head>
+<body>
+<header class="cover">
+<h1>{{.Title}}</h1>
+{{- if .Description}}
+<p class="description">{{.Description}}</p>
+{{- end}}
+<nav>
+<ol>
+{{- range .Lessons}}
+<li><a href="#{{.ID}}">{{.Title}}</a></li>
+{{- end}}
+</ol>
+</nav>
+</header>
+{{- range .Lessons}}
+{{template "lesson" .}}
+{{- end}}
+</body>
+</html>
+`))
+
+var bookChapterTemplate = template.Must(template.Must(bookLessonTemplate.Clone()).New("chapter").Parse(`<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head>
+<meta charset="utf-8"/>
+<title>{{.Title}}</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+{{template "lesson" .}}
+</body>
+</html>
+`))
+
+var bookNavTemplate = template.Must(template.New("nav").Parse(`<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head>
+<meta charset="utf-8"/>
+<title>{{.Title}}</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+<nav epub:type="toc" id="toc">
+<h1>{{.Title}}</h1>
+<ol>
+{{- range .Lessons}}
+<li><a href="{{.ID}}.xhtml">{{.Title}}</a></li>
+{{- end}}
+</ol>
+</nav>
+</body>
+</html>
+`))
+
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="EPUB/package.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+// epubPackage is the package document of an EPUB 3.
+type epubPackage struct {
+	XMLName          xml.Name `xml:"package"`
+	Namespace        string   `xml:"xmlns,attr"`
+	Version          string   `xml:"version,attr"`
+	UniqueIdentifier string   `xml:"unique-identifier,attr"`
+	Metadata         struct {
+		DublinCore  string `xml:"xmlns:dc,attr"`
+		Identifier  epubIdentifier
+		Title       string `xml:"dc:title"`
+		Language    string `xml:"dc:language"`
+		Description string `xml:"dc:description,omitempty"`
+		Modified    epubMeta
+	} `xml:"metadata"`
+	Manifest []epubItem    `xml:"manifest>item"`
+	Spine    []epubItemRef `xml:"spine>itemref"`
+}
+
+type epubIdentifier struct {
+	XMLName xml.Name `xml:"dc:identifier"`
+	ID      string   `xml:"id,attr"`
+	Value   string   `xml:",chardata"`
+}
+
+type epubMeta struct {
+	XMLName  xml.Name `xml:"meta"`
+	Property string   `xml:"property,attr"`
+	Value    string   `xml:",chardata"`
+}
+
+type epubItem struct {
+	ID         string `xml:"id,attr"`
+	Href       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr,omitempty"`
+}
+
+type epubItemRef struct {
+	IDRef string `xml:"idref,attr"`
+}
+
+// xmlInvalidChars drops the control characters XML documents can't hold.
+func xmlInvalidChars(r rune) rune {
+	if r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0xfffe || r == 0xffff {
+		return -1
+	}
+	return r
+}
+
+// buildCourseBook renders the lessons of a course, with their FAQs and
+// resources, for offline reading. The lesson images are bundled in the book,
+// the other lesson files, the videos and the embeds are linked to the
+// instance or to their site.
+func (cs *CourseService) buildCourseBook(course *core.Record) (*courseBook, error) {
+	lessons, err := cs.app.FindRecordsByFilter("lessons", "course = {:course}", "created", 0, 0, dbx.Params{"course": course.Id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find lessons: %w", err)
+	}
+
+	appURL := strings.TrimSuffix(cs.app.Settings().Meta.AppURL, "/")
+	book := &courseBook{Title: course.GetString("title"), Description: course.GetString("description")}
+
+	for i, lesson := range lessons {
+		id := fmt.Sprintf("lesson_%d", i+1)
+		title := lesson.GetString("title")
+		item := courseBookLesson{ID: id, Title: title, Summary: lesson.GetString("summary")}
+
+		// the bundled images of the lesson, by stored name
+		used := map[string]bool{}
+		images := map[string]string{}
+		fileURL := func(storedName string) string {
+			if mediaType, ok := bookImageTypes[strings.ToLower(path.Ext(storedName))]; ok {
+				if images[storedName] == "" {
+					images[storedName] = "images/" + id + "/" + exportFileName(storedName, used)
+					book.images = append(book.images, courseBookImage{
+						lesson:     lesson,
+						storedName: storedName,
+						Path:       images[storedName],
+						MediaType:  mediaType,
+					})
+				}
+				return images[storedName]
+			}
+			return appURL + lessonFileURL(lesson, storedName)
+		}
+
+		if thumbnail := lesson.GetString("thumbnail"); thumbnail != "" {
+			item.Thumbnail = fileURL(thumbnail)
+		}
+
+		nodes, err := parseHTMLFragment(lesson.GetString("content"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the content of lesson %q: %w", title, err)
+		}
+		root := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+		for _, node := range nodes {
+			root.AppendChild(node)
+		}
+		walkHTML(root, linkBookMedia)
+		nodes = htmlChildren(root)
+		rewriteHTMLURLs(nodes, func(value string) (string, bool) {
+			if storedName, ok := lessonFileName(lesson, value); ok && slices.Contains(lessonFiles(lesson), storedName) {
+				return fileURL(storedName), true
+			}
+			if strings.HasPrefix(value, "/") && !strings.HasPrefix(value, "//") {
+				return appURL + value, true
+			}
+			return "", false
+		})
+		content, err := renderHTMLNodes(nodes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render the content of lesson %q: %w", title, err)
+		}
+		// no embeds are left, the policy only matters to them
+		if content, err = SanitizeContent(content, ContentPolicy{}); err != nil {
+			return nil, fmt.Errorf("failed to sanitize the content of lesson %q: %w", title, err)
+		}
+		item.Content = template.HTML(strings.Map(xmlInvalidChars, content))
+
+		if video := lesson.GetString("video"); video != "" {
+			item.Downloads = append(item.Downloads, cartridgePageLink{Name: "Video", Href: appURL + lessonFileURL(lesson, video)})
+		}
+		for _, storedName := range lesson.GetStringSlice("downloads") {
+			item.Downloads = append(item.Downloads, cartridgePageLink{
+				Name: exportFileName(storedName, map[string]bool{}),
+				Href: appURL + lessonFileURL(lesson, storedName),
+			})
+		}
+
+		faqs, err := findLessonFAQs(cs.app, lesson.Id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the FAQs of lesson %q: %w", title, err)
+		}
+		for _, faq := range faqs {
+			item.FAQs = append(item.FAQs, CartridgeFAQ{Question: faq.GetString("question"), Answer: faq.GetString("answer")})
+		}
+
+		resources, err := findLessonResources(cs.app, lesson.Id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the resources of lesson %q: %w", title, err)
+		}
+		for _, resource := range resources {
+			name := resource.GetString("name")
+			if name == "" {
+				name = resource.GetString("link")
+			}
+			item.Resources = append(item.Resources, cartridgePageLink{Name: name, Href: resource.GetString("link")})
+		}
+
+		book.Lessons = append(book.Lessons, item)
+	}
+
+	return book, nil
+}
+
+// lessonFiles returns the names of the stored files of a lesson.
+func lessonFiles(lesson *core.Record) []string {
+	files := lesson.GetStringSlice("downloads")
+	for _, field := range lessonMediaFields {
+		if name := lesson.GetString(field); name != "" {
+			files = append(files, name)
+		}
+	}
+	return files
+}
+
+// linkBookMedia replaces the embeds, videos and audios of lesson content,
+// which books can't play, with links to them.
+func linkBookMedia(node *html.Node) {
+	for child := node.FirstChild; child != nil; {
+		next := child.NextSibling
+
+		if child.Type == html.ElementNode && (child.DataAtom == atom.Iframe || child.DataAtom == atom.Video || child.DataAtom == atom.Audio) {
+			src := htmlAttr(child, "src")
+			if source := findHTMLElement(child, htmlElementNamed(atom.Source)); src == "" && source != nil {
+				src = htmlAttr(source, "src")
+			}
+
+			if src != "" {
+				text := htmlAttr(child, "title")
+				if text == "" {
+					text = src
+				}
+				link := &html.Node{Type: html.ElementNode, Data: "a", DataAtom: atom.A, Attr: []html.Attribute{
+					{Key: "class", Val: "media"},
+					{Key: "href", Val: src},
+				}}
+				link.AppendChild(&html.Node{Type: html.TextNode, Data: text})
+				node.InsertBefore(link, child)
+			}
+			node.RemoveChild(child)
+		}
+
+		child = next
+	}
+}
+
+// writeBookImages copies the images of a book to a zip, under dir.
+func writeBookImages(archive *zip.Writer, fsys *filesystem.System, book *courseBook, dir string) error {
+	for _, image := range book.images {
+		reader, err := fsys.GetReader(image.lesson.BaseFilesPath() + "/" + image.storedName)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", image.storedName, err)
+		}
+
+		writer, err := archive.Create(dir + image.Path)
+		if err == nil {
+			_, err = io.Copy(writer, reader)
+		}
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %w", image.storedName, err)
+		}
+	}
+	return nil
+}
+
+// writeZipFile adds a file to a zip.
+func writeZipFile(archive *zip.Writer, name string, content []byte) error {
+	writer, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	_, err = writer.Write(content)
+	return err
+}
+
+// ExportCourseEPUB writes a course as an EPUB 3 book, with a chapter per
+// lesson holding its summary, content, FAQs and resource links.
+func (cs *CourseService) ExportCourseEPUB(course *core.Record, w io.Writer) error {
+	book, err := cs.buildCourseBook(course)
+	if err != nil {
+		return err
+	}
+
+	fsys, err := cs.app.NewFilesystem()
+	if err != nil {
+		return err
+	}
+	defer fsys.Close()
+
+	archive := zip.NewWriter(w)
+
+	// the mimetype comes first, uncompressed, for readers to identify the book
+	mimetype, err := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return fmt.Errorf("failed to add mimetype: %w", err)
+	}
+	if _, err := io.WriteString(mimetype, "application/epub+zip"); err != nil {
+		return err
+	}
+	if err := writeZipFile(archive, "META-INF/container.xml", []byte(epubContainer)); err != nil {
+		return err
+	}
+
+	pkg := epubPackage{Namespace: "http://www.idpf.org/2007/opf", Version: "3.0", UniqueIdentifier: "course"}
+	pkg.Metadata.DublinCore = "http://purl.org/dc/elements/1.1/"
+	pkg.Metadata.Identifier = epubIdentifier{ID: "course", Value: "urn:elesson:course:" + course.Id}
+	pkg.Metadata.Title = book.Title
+	pkg.Metadata.Language = "en"
+	pkg.Metadata.Description = book.Description
+	pkg.Metadata.Modified = epubMeta{Property: "dcterms:modified", Value: course.GetDateTime("updated").Time().UTC().Format(time.RFC3339)}
+	if course.GetDateTime("updated").IsZero() {
+		pkg.Metadata.Modified.Value = time.Now().UTC().Format(time.RFC3339)
+	}
+	pkg.Manifest = []epubItem{
+		{ID: "nav", Href: "nav.xhtml", MediaType: "application/xhtml+xml", Properties: "nav"},
+		{ID: "style", Href: "style.css", MediaType: "text/css"},
+	}
+
+	// the XHTML documents start with the XML declaration, which templates would escape
+	var content bytes.Buffer
+	content.WriteString(xml.Header)
+	if err := bookNavTemplate.Execute(&content, book); err != nil {
+		return fmt.Errorf("failed to render nav.xhtml: %w", err)
+	}
+	if err := writeZipFile(archive, "EPUB/nav.xhtml", content.Bytes()); err != nil {
+		return err
+	}
+	if err := writeZipFile(archive, "EPUB/style.css", []byte(bookStyle)); err != nil {
+		return err
+	}
+
+	for _, lesson := range book.Lessons {
+		content.Reset()
+		content.WriteString(xml.Header)
+		if err := bookChapterTemplate.Execute(&content, lesson); err != nil {
+			return fmt.Errorf("failed to render lesson %q: %w", lesson.Title, err)
+		}
+		if err := writeZipFile(archive, "EPUB/"+lesson.ID+".xhtml", content.Bytes()); err != nil {
+			return err
+		}
+		pkg.Manifest = append(pkg.Manifest, epubItem{ID: lesson.ID, Href: lesson.ID + ".xhtml", MediaType: "application/xhtml+xml"})
+		pkg.Spine = append(pkg.Spine, epubItemRef{IDRef: lesson.ID})
+	}
+
+	if err := writeBookImages(archive, fsys, book, "EPUB/"); err != nil {
+		return err
+	}
+	for i, image := range book.images {
+		pkg.Manifest = append(pkg.Manifest, epubItem{ID: fmt.Sprintf("image_%d", i+1), Href: image.Path, MediaType: image.MediaType})
+	}
+
+	opf, err := xml.MarshalIndent(pkg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode package.opf: %w", err)
+	}
+	if err := writeZipFile(archive, "EPUB/package.opf", append([]byte(xml.Header), opf...)); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// ExportCoursePrintable writes a course as a zip holding a standalone HTML
+// page with all its lessons, one per printed page, and their images.
+func (cs *CourseService) ExportCoursePrintable(course *core.Record, w io.Writer) error {
+	book, err := cs.buildCourseBook(course)
+	if err != nil {
+		return err
+	}
+
+	fsys, err := cs.app.NewFilesystem()
+	if err != nil {
+		return err
+	}
+	defer fsys.Close()
+
+	var content bytes.Buffer
+	err = bookPrintableTemplate.Execute(&content, struct {
+		*courseBook
+		Style template.CSS
+	}{book, template.CSS(bookStyle)})
+	if err != nil {
+		return fmt.Errorf("failed to render index.html: %w", err)
+	}
+
+	archive := zip.NewWriter(w)
+	if err := writeZipFile(archive, "index.html", content.Bytes()); err != nil {
+		return err
+	}
+	if err := writeBookImages(archive, fsys, book, ""); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func bindBookRoutes(r *router.Router[*core.RequestEvent], courseService *CourseService) {
+	// courseBookAccess returns the course of the request, for its assignees and managers
+	courseBookAccess := func(e *core.RequestEvent) (*core.Record, error) {
+		course, err := e.App.FindRecordById("courses", e.Request.PathValue("id"))
+		if err != nil {
+			return nil, e.NotFoundError("", err)
+		}
+
+		assigned := slices.Contains(course.GetStringSlice("assignees"), e.Auth.Id) &&
+			course.GetString("organization") == e.Auth.GetString("organization")
+		if !assigned && !CanManageCourse(e.Auth, course) {
+			return nil, e.NotFoundError("", nil)
+		}
+		return course, nil
+	}
+
+	// download a course as an EPUB book
+	r.GET("/api/courses/{id}/epub", func(e *core.RequestEvent) error {
+		course, err := courseBookAccess(e)
+		if err != nil {
+			return err
+		}
+
+		e.Response.Header().Set("Content-Type", "application/epub+zip")
+		e.Response.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+			"filename": course.GetString("title") + ".epub",
+		}))
+
+		// the book is streamed, errors can only be logged once it started
+		if err := courseService.ExportCourseEPUB(course, e.Response); err != nil {
+			e.App.Logger().Error("Failed to export the course EPUB", "course", course.Id, "error", err)
+		}
+		return nil
+	}).Bind(apis.RequireAuth())
+
+	// download a course as a printable HTML page, zipped with its images
+	r.GET("/api/courses/{id}/printable", func(e *core.RequestEvent) error {
+		course, err := courseBookAccess(e)
+		if err != nil {
+			return err
+		}
+
+		e.Response.Header().Set("Content-Type", "application/zip")
+		e.Response.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+			"filename": course.GetString("title") + " (printable).zip",
+		}))
+
+		if err := courseService.ExportCoursePrintable(course, e.Response); err != nil {
+			e.App.Logger().Error("Failed to export the printable course", "course", course.Id, "error", err)
+		}
+		return nil
+	}).Bind(apis.RequireAuth())
+}
@@ -0,0 +1,252 @@
+package hooks
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// readTestZip returns the files of a zip by name, in order.
+func readTestZip(t *testing.T, content []byte) ([]string, map[string]string) {
+	t.Helper()
+
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("Failed to open the zip: %v", err)
+	}
+	names := []string{}
+	files := map[string]string{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", file.Name, err)
+		}
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+		names = append(names, file.Name)
+		files[file.Name] = string(data)
+	}
+	return names, files
+}
+
+func TestCourseService_ExportCourseEPUB(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	course, lessons := createTestAuthoredCourse(t, app, courses)
+	app.Settings().Meta.AppURL = "https://learn.example.com"
+
+	advanced := lessons[1]
+	advanced.Set("content", `<h2>Reversing</h2><p>Look behind you.<br>Then reverse&nbsp;slowly.</p>`+
+		`<iframe src="https://www.youtube.com/embed/abc" title="Reversing video"></iframe><a href="/courses/1">Next</a>`)
+	if err := app.Save(advanced); err != nil {
+		t.Fatalf("Failed to save lesson: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := service.ExportCourseEPUB(course, &buf); err != nil {
+		t.Fatalf("ExportCourseEPUB failed: %v", err)
+	}
+
+	archive, _ := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if first := archive.File[0]; first.Name != "mimetype" || first.Method != zip.Store {
+		t.Errorf("Expected the mimetype to come first uncompressed, got %s", first.Name)
+	}
+
+	_, files := readTestZip(t, buf.Bytes())
+	if files["mimetype"] != "application/epub+zip" || !strings.Contains(files["META-INF/container.xml"], `full-path="EPUB/package.opf"`) {
+		t.Errorf("Unexpected mimetype or container %q", files["mimetype"])
+	}
+
+	for name, content := range files {
+		if !strings.HasSuffix(name, ".xhtml") && !strings.HasSuffix(name, ".opf") {
+			continue
+		}
+		if !strings.HasPrefix(content, "<?xml ") {
+			t.Errorf("Expected %s to start with the XML declaration, got %.40q", name, content)
+		}
+		decoder := xml.NewDecoder(strings.NewReader(content))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("Expected %s to be well-formed: %v\n%s", name, err, content)
+			}
+		}
+	}
+
+	opf := files["EPUB/package.opf"]
+	for _, expected := range []string{
+		`<dc:title>Forklift safety</dc:title>`,
+		`<item id="lesson_1" href="lesson_1.xhtml" media-type="application/xhtml+xml"></item>`,
+		`<item id="image_1" href="images/lesson_1/cover.png" media-type="image/png"></item>`,
+		`<item id="image_2" href="images/lesson_1/diagram.png" media-type="image/png"></item>`,
+		`<itemref idref="lesson_2"></itemref>`,
+	} {
+		if !strings.Contains(opf, expected) {
+			t.Errorf("Expected the package to contain %s, got\n%s", expected, opf)
+		}
+	}
+	if files["EPUB/images/lesson_1/diagram.png"] != string(testPNG(t)) {
+		t.Errorf("Expected the content image to be bundled")
+	}
+	if !strings.Contains(files["EPUB/nav.xhtml"], `<a href="lesson_2.xhtml">Advanced &lt;maneuvers&gt;</a>`) {
+		t.Errorf("Expected the table of contents to list the lessons, got\n%s", files["EPUB/nav.xhtml"])
+	}
+
+	basics := files["EPUB/lesson_1.xhtml"]
+	for _, expected := range []string{
+		`<p class="summary">What every driver must know</p>`,
+		`<img class="thumbnail" src="images/lesson_1/cover.png" alt=""/>`,
+		`<img src="images/lesson_1/diagram.png" alt="Diagram"/>`,
+		`<dt>Do I need a license?</dt>`,
+		`<a href="https://example.com/handbook.pdf">Safety handbook</a>`,
+		`<a href="https://learn.example.com` + lessonFileURL(lessons[0], lessons[0].GetString("video")) + `">Video</a>`,
+		`>checklist.txt</a>`,
+	} {
+		if !strings.Contains(basics, expected) {
+			t.Errorf("Expected the first chapter to contain %s, got\n%s", expected, basics)
+		}
+	}
+
+	reversing := files["EPUB/lesson_2.xhtml"]
+	for _, expected := range []string{
+		`<h1>Advanced &lt;maneuvers&gt;</h1>`,
+		"<p>Look behind you.<br/>Then reverse slowly.</p>",
+		`<a class="media" href="https://www.youtube.com/embed/abc" target="_blank" rel="noopener noreferrer">Reversing video</a>`,
+		`<a href="https://learn.example.com/courses/1"`,
+	} {
+		if !strings.Contains(reversing, expected) {
+			t.Errorf("Expected the second chapter to contain %s, got\n%s", expected, reversing)
+		}
+	}
+	if strings.Contains(reversing, "<iframe") {
+		t.Errorf("Expected the embeds to be replaced with links")
+	}
+}
+
+func TestCourseService_ExportCoursePrintable(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	course, _ := createTestAuthoredCourse(t, app, courses)
+
+	var buf bytes.Buffer
+	if err := service.ExportCoursePrintable(course, &buf); err != nil {
+		t.Fatalf("ExportCoursePrintable failed: %v", err)
+	}
+
+	names, files := readTestZip(t, buf.Bytes())
+	if len(names) != 3 || names[0] != "index.html" || files["images/lesson_1/diagram.png"] != string(testPNG(t)) {
+		t.Fatalf("Expected the page and its images, got %v", names)
+	}
+
+	page := files["index.html"]
+	for _, expected := range []string{
+		`<p class="description">Driving forklifts in the warehouse</p>`,
+		`<li><a href="#lesson_2">Advanced &lt;maneuvers&gt;</a></li>`,
+		`<section class="lesson" id="lesson_1">`,
+		`<img src="images/lesson_1/diagram.png" alt="Diagram"/>`,
+		`<dd>Yes, a valid operator license.</dd>`,
+		`.lesson { break-before: page; }`,
+	} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("Expected the page to contain %s, got\n%s", expected, page)
+		}
+	}
+	if strings.Count(page, "Safety handbook") != 2 {
+		t.Errorf("Expected the shared resource to be listed in both lessons")
+	}
+}
+
+func TestBookRoutes(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, users := createTestCollections(t, app)
+	course, _ := createTestAuthoredCourse(t, app, courses)
+
+	newUser := func(email, role, organization string) *core.Record {
+		user := core.NewRecord(users)
+		user.SetEmail(email)
+		user.SetPassword("1234567890")
+		user.Set("role", role)
+		user.Set("organization", organization)
+		if err := app.Save(user); err != nil {
+			t.Fatalf("Failed to save user: %v", err)
+		}
+		return user
+	}
+	assignee := newUser("assignee@example.com", "", testOrg1)
+	learner := newUser("learner@example.com", "", testOrg1)
+	outsider := newUser("outsider@example.com", "", testOrg2)
+	course.Set("assignees", []string{assignee.Id, outsider.Id})
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	bindBookRoutes(r, service)
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(user *core.Record, path string) *http.Response {
+		t.Helper()
+
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		token, err := user.NewAuthToken()
+		if err != nil {
+			t.Fatalf("Failed to create auth token: %v", err)
+		}
+		req.Header.Set("Authorization", token)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		return res
+	}
+
+	for _, user := range []*core.Record{learner, outsider} {
+		res := get(user, "/api/courses/"+course.Id+"/epub")
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected %s not to download the course, got %d", user.Email(), res.StatusCode)
+		}
+	}
+
+	res := get(assignee, "/api/courses/"+course.Id+"/epub")
+	content, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/epub+zip" ||
+		!strings.Contains(res.Header.Get("Content-Disposition"), `filename="Forklift safety.epub"`) || !bytes.Contains(content, []byte("application/epub+zip")) {
+		t.Errorf("Expected the assignee to download the EPUB, got %d %q", res.StatusCode, res.Header.Get("Content-Disposition"))
+	}
+
+	res = get(assignee, "/api/courses/"+course.Id+"/printable")
+	content, _ = io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.Contains(res.Header.Get("Content-Disposition"), `filename="Forklift safety (printable).zip"`) {
+		t.Fatalf("Expected the assignee to download the printable course, got %d %q", res.StatusCode, res.Header.Get("Content-Disposition"))
+	}
+	if _, files := readTestZip(t, content); !strings.Contains(files["index.html"], "Forklift safety") {
+		t.Errorf("Expected the printable page in the download")
+	}
+}
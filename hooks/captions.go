@@ -0,0 +1,414 @@
+package hooks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// captionsMaxSize is the limit of the caption files read by the upload hook,
+// the one of the captions field applies to the converted file.
+const captionsMaxSize = 10 << 20
+
+var ErrCaptionsInvalid = errors.New("invalid captions")
+
+func captionsInvalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrCaptionsInvalid, fmt.Sprintf(format, args...))
+}
+
+var (
+	vttHeader = regexp.MustCompile(`^WEBVTT(?:[ \t].*)?$`)
+	vttTiming = regexp.MustCompile(`^((?:\d{2,}:)?\d{2}:\d{2}\.\d{3})[ \t]+-->[ \t]+((?:\d{2,}:)?\d{2}:\d{2}\.\d{3})(?:[ \t]+(.*))?$`)
+	srtTiming = regexp.MustCompile(`^(\d+:\d{2}:\d{2}[,.]\d{3})[ \t]*-->[ \t]*(\d+:\d{2}:\d{2}[,.]\d{3})(?:[ \t].*)?$`)
+	sbvTiming = regexp.MustCompile(`^(\d+:\d{2}:\d{2}\.\d{3}),(\d+:\d{2}:\d{2}\.\d{3})$`)
+
+	// the styling tags of SRT cues kept in WebVTT, the others (like font) are dropped
+	captionTag       = regexp.MustCompile(`^</?([a-zA-Z]+)[^<>]*>`)
+	captionEntity    = regexp.MustCompile(`^&(?:[a-zA-Z]+|#\d+|#[xX][0-9a-fA-F]+);`)
+	captionOverrides = regexp.MustCompile(`\{\\[^{}]*\}`)
+)
+
+// captionCue is a cue of a caption file.
+type captionCue struct {
+	ID         string
+	Start, End time.Duration
+	Settings   string
+	Text       []string
+	// the line of the cue timing, for the errors
+	line int
+}
+
+// ConvertCaptions validates a caption file and converts it to WebVTT. SubRip
+// (.srt) and SubViewer (.sbv) files are converted, WebVTT files are kept as
+// is. Files are read as UTF-8 or UTF-16 (with a byte order mark), falling back
+// to Windows-1252, and written in UTF-8 without byte order mark and with Unix
+// line endings.
+func ConvertCaptions(name string, content []byte) ([]byte, error) {
+	source, err := decodeCaptions(content)
+	if err != nil {
+		return nil, err
+	}
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\r", "\n")
+	lines := strings.Split(source, "\n")
+
+	if vttHeader.MatchString(lines[0]) {
+		if _, err := parseVTTCues(lines); err != nil {
+			return nil, err
+		}
+		return []byte(strings.TrimRight(source, "\n") + "\n"), nil
+	}
+
+	var cues []captionCue
+	switch ext := strings.ToLower(path.Ext(name)); {
+	case ext == ".srt":
+		cues, err = parseSRTCues(lines)
+	case ext == ".sbv", sbvTiming.MatchString(firstCaptionLine(lines)):
+		cues, err = parseSBVCues(lines)
+	case strings.Contains(source, "-->"):
+		cues, err = parseSRTCues(lines)
+	default:
+		return nil, captionsInvalid("only WebVTT (starting with WEBVTT), SRT and SBV captions are supported")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return renderVTT(cues), nil
+}
+
+// decodeCaptions returns the text of a caption file in its encoding.
+func decodeCaptions(content []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xef, 0xbb, 0xbf}):
+		content = content[3:]
+	case bytes.HasPrefix(content, []byte{0xff, 0xfe}), bytes.HasPrefix(content, []byte{0xfe, 0xff}):
+		decoded, err := unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder().Bytes(content)
+		if err != nil {
+			return "", captionsInvalid("invalid UTF-16 text: %v", err)
+		}
+		return string(decoded), nil
+	}
+
+	if !utf8.Valid(content) {
+		decoded, err := charmap.Windows1252.NewDecoder().Bytes(content)
+		if err != nil {
+			return "", captionsInvalid("unknown text encoding: %v", err)
+		}
+		return string(decoded), nil
+	}
+	return string(content), nil
+}
+
+// firstCaptionLine returns the first line of a caption file that is neither
+// blank nor a cue number.
+func firstCaptionLine(lines []string) string {
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if _, err := strconv.Atoi(line); line != "" && err != nil {
+			return line
+		}
+	}
+	return ""
+}
+
+// captionBlocks splits the lines of a caption file into blocks separated by
+// blank lines, calling fn with each block and the number of its first line.
+func captionBlocks(lines []string, start int, fn func(block []string, line int) error) error {
+	for i := start; i < len(lines); {
+		if strings.TrimSpace(lines[i]) == "" {
+			i++
+			continue
+		}
+		end := i
+		for end < len(lines) && strings.TrimSpace(lines[end]) != "" {
+			end++
+		}
+		if err := fn(lines[i:end], i+1); err != nil {
+			return err
+		}
+		i = end
+	}
+	return nil
+}
+
+// parseCaptionTime parses the [hours:]minutes:seconds.milliseconds of a cue timing.
+func parseCaptionTime(value string) (time.Duration, error) {
+	parts := strings.Split(strings.Replace(value, ",", ".", 1), ":")
+	if len(parts) == 2 {
+		parts = append([]string{"0"}, parts...)
+	}
+	hours, err1 := strconv.Atoi(parts[0])
+	minutes, err2 := strconv.Atoi(parts[1])
+	seconds, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil || minutes > 59 || seconds >= 60 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds*1000+0.5)*time.Millisecond, nil
+}
+
+// parseCaptionTiming parses the start and end of a cue, checking they're ordered.
+func parseCaptionTiming(cue *captionCue, start, end string, previous *captionCue) error {
+	var err error
+	if cue.Start, err = parseCaptionTime(start); err != nil {
+		return captionsInvalid("line %d: %v", cue.line, err)
+	}
+	if cue.End, err = parseCaptionTime(end); err != nil {
+		return captionsInvalid("line %d: %v", cue.line, err)
+	}
+	if cue.End <= cue.Start {
+		return captionsInvalid("line %d: the cue ends (%s) before it starts (%s)", cue.line, formatVTTTime(cue.End), formatVTTTime(cue.Start))
+	}
+	if previous != nil && cue.Start < previous.Start {
+		return captionsInvalid("line %d: the cue starts (%s) before the previous one (%s, line %d)",
+			cue.line, formatVTTTime(cue.Start), formatVTTTime(previous.Start), previous.line)
+	}
+	return nil
+}
+
+// parseVTTCues validates the cues of a WebVTT file. Comments, styles and
+// regions are skipped.
+func parseVTTCues(lines []string) ([]captionCue, error) {
+	// the header ends with the first blank line
+	start := 1
+	for start < len(lines) && strings.TrimSpace(lines[start]) != "" {
+		if strings.Contains(lines[start], "-->") {
+			return nil, captionsInvalid("line %d: the WEBVTT header must be followed by a blank line", start+1)
+		}
+		start++
+	}
+
+	cues := []captionCue{}
+	err := captionBlocks(lines, start, func(block []string, line int) error {
+		switch first := block[0]; {
+		case first == "NOTE" || strings.HasPrefix(first, "NOTE ") || strings.HasPrefix(first, "NOTE\t"),
+			first == "STYLE", first == "REGION":
+			return nil
+		}
+
+		cue := captionCue{line: line}
+		if !strings.Contains(block[0], "-->") {
+			cue.ID = block[0]
+			block = block[1:]
+			cue.line++
+		}
+		if len(block) == 0 {
+			return captionsInvalid("line %d: expected a cue timing after the cue identifier %q", line, cue.ID)
+		}
+
+		match := vttTiming.FindStringSubmatch(strings.TrimSpace(block[0]))
+		if match == nil {
+			return captionsInvalid("line %d: invalid cue timing %q, expected like 00:00:01.000 --> 00:00:04.000", cue.line, block[0])
+		}
+		var previous *captionCue
+		if len(cues) > 0 {
+			previous = &cues[len(cues)-1]
+		}
+		if err := parseCaptionTiming(&cue, match[1], match[2], previous); err != nil {
+			return err
+		}
+		cue.Settings = match[3]
+		cue.Text = block[1:]
+		// the text of a cue ends at the next line with a timing
+		for i, text := range cue.Text {
+			if strings.Contains(text, "-->") {
+				return captionsInvalid("line %d: the cue text must not contain \"-->\", is a blank line missing before the next cue?", cue.line+1+i)
+			}
+		}
+
+		cues = append(cues, cue)
+		return nil
+	})
+	return cues, err
+}
+
+// parseSRTCues parses the cues of a SubRip file.
+func parseSRTCues(lines []string) ([]captionCue, error) {
+	cues := []captionCue{}
+	err := captionBlocks(lines, 0, func(block []string, line int) error {
+		cue := captionCue{line: line}
+		if _, err := strconv.Atoi(strings.TrimSpace(block[0])); err == nil && !strings.Contains(block[0], "-->") {
+			block = block[1:]
+			cue.line++
+		}
+		if len(block) == 0 {
+			return captionsInvalid("line %d: expected a cue timing after the cue number", line)
+		}
+
+		match := srtTiming.FindStringSubmatch(strings.TrimSpace(block[0]))
+		if match == nil {
+			return captionsInvalid("line %d: invalid cue timing %q, expected like 00:00:01,000 --> 00:00:04,000", cue.line, block[0])
+		}
+		var previous *captionCue
+		if len(cues) > 0 {
+			previous = &cues[len(cues)-1]
+		}
+		if err := parseCaptionTiming(&cue, match[1], match[2], previous); err != nil {
+			return err
+		}
+		for _, text := range block[1:] {
+			cue.Text = append(cue.Text, vttCueText(text))
+		}
+
+		cues = append(cues, cue)
+		return nil
+	})
+	return cues, err
+}
+
+// parseSBVCues parses the cues of a SubViewer file, as exported by YouTube.
+func parseSBVCues(lines []string) ([]captionCue, error) {
+	cues := []captionCue{}
+	err := captionBlocks(lines, 0, func(block []string, line int) error {
+		cue := captionCue{line: line}
+
+		match := sbvTiming.FindStringSubmatch(strings.TrimSpace(block[0]))
+		if match == nil {
+			return captionsInvalid("line %d: invalid cue timing %q, expected like 0:00:01.000,0:00:04.000", line, block[0])
+		}
+		var previous *captionCue
+		if len(cues) > 0 {
+			previous = &cues[len(cues)-1]
+		}
+		if err := parseCaptionTiming(&cue, match[1], match[2], previous); err != nil {
+			return err
+		}
+		for _, text := range block[1:] {
+			cue.Text = append(cue.Text, vttCueText(text))
+		}
+
+		cues = append(cues, cue)
+		return nil
+	})
+	return cues, err
+}
+
+// vttCueText converts a line of SRT or SBV cue text to WebVTT, keeping the
+// bold, italic and underline tags and escaping the other markup.
+func vttCueText(text string) string {
+	text = captionOverrides.ReplaceAllString(strings.TrimSpace(text), "")
+
+	var builder strings.Builder
+	for i := 0; i < len(text); {
+		switch text[i] {
+		case '<':
+			if tag := captionTag.FindStringSubmatch(text[i:]); tag != nil {
+				switch name := strings.ToLower(tag[1]); name {
+				case "b", "i", "u":
+					if strings.HasPrefix(tag[0], "</") {
+						builder.WriteString("</" + name + ">")
+					} else {
+						builder.WriteString("<" + name + ">")
+					}
+				}
+				i += len(tag[0])
+				continue
+			}
+			builder.WriteString("&lt;")
+		case '>':
+			builder.WriteString("&gt;")
+		case '&':
+			if entity := captionEntity.FindString(text[i:]); entity != "" {
+				builder.WriteString(entity)
+				i += len(entity)
+				continue
+			}
+			builder.WriteString("&amp;")
+		default:
+			builder.WriteByte(text[i])
+		}
+		i++
+	}
+	return builder.String()
+}
+
+// formatVTTTime formats the time of a WebVTT cue timing.
+func formatVTTTime(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, d.Milliseconds()%1000)
+}
+
+// renderVTT writes cues as a WebVTT file.
+func renderVTT(cues []captionCue) []byte {
+	var builder strings.Builder
+	builder.WriteString("WEBVTT\n")
+	for _, cue := range cues {
+		builder.WriteString("\n")
+		if cue.ID != "" {
+			builder.WriteString(cue.ID + "\n")
+		}
+		builder.WriteString(formatVTTTime(cue.Start) + " --> " + formatVTTTime(cue.End))
+		if cue.Settings != "" {
+			builder.WriteString(" " + cue.Settings)
+		}
+		builder.WriteString("\n")
+		for _, text := range cue.Text {
+			builder.WriteString(text + "\n")
+		}
+	}
+	return []byte(builder.String())
+}
+
+// convertCaptionsFile converts an uploaded caption file to a WebVTT file.
+func convertCaptionsFile(file *filesystem.File) (*filesystem.File, error) {
+	reader, err := file.Reader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the captions: %w", err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(io.LimitReader(reader, captionsMaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the captions: %w", err)
+	}
+	if len(content) > captionsMaxSize {
+		return nil, captionsInvalid("the captions exceed %d bytes", captionsMaxSize)
+	}
+
+	converted, err := ConvertCaptions(file.OriginalName, content)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSuffix(file.OriginalName, path.Ext(file.OriginalName)) + ".vtt"
+	return filesystem.NewFileFromBytes(converted, name)
+}
+
+// initCaptionsHooks converts the caption files uploaded to lessons to WebVTT,
+// the format of the player, rejecting the malformed ones.
+func initCaptionsHooks(app core.App) {
+	convertCaptions := func(e *core.RecordRequestEvent) error {
+		files := e.Record.GetUnsavedFiles("captions")
+		if len(files) == 0 {
+			return e.Next()
+		}
+
+		captions, err := convertCaptionsFile(files[0])
+		if errors.Is(err, ErrCaptionsInvalid) {
+			return e.BadRequestError("Invalid captions.", validation.Errors{
+				"captions": validation.NewError("validation_invalid_captions", err.Error()),
+			})
+		}
+		if err != nil {
+			return e.InternalServerError("Failed to convert the captions.", err)
+		}
+		e.Record.Set("captions", captions)
+
+		return e.Next()
+	}
+	app.OnRecordCreateRequest("lessons").BindFunc(convertCaptions)
+	app.OnRecordUpdateRequest("lessons").BindFunc(convertCaptions)
+}
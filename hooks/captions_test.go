@@ -0,0 +1,206 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestConvertCaptions(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		file     string
+		content  string
+		expected string
+	}{
+		{
+			"srt",
+			"intro.srt",
+			"1\r\n00:00:01,000 --> 00:00:04,250\r\n<i>Check</i> the <font color=\"red\">brakes</font> & horn\r\n\r\n" +
+				"2\r\n00:00:05,000 --> 00:00:07,000 X1:10 X2:20\r\n{\\an8}Then <B>drive</B> -> slowly\r\n\r\n\r\n",
+			"WEBVTT\n\n00:00:01.000 --> 00:00:04.250\n<i>Check</i> the brakes &amp; horn\n\n" +
+				"00:00:05.000 --> 00:00:07.000\nThen <b>drive</b> -&gt; slowly\n",
+		},
+		{
+			"srt without extension",
+			"captions",
+			"1\n01:02:03.004 --> 01:02:05.000\nHello &amp; bye\n",
+			"WEBVTT\n\n01:02:03.004 --> 01:02:05.000\nHello &amp; bye\n",
+		},
+		{
+			"sbv",
+			"intro.sbv",
+			"0:00:01.000,0:00:02.500\nCheck the brakes\nand the horn\n\n0:00:03.000,0:00:04.000\n<i>Drive</i>\n",
+			"WEBVTT\n\n00:00:01.000 --> 00:00:02.500\nCheck the brakes\nand the horn\n\n00:00:03.000 --> 00:00:04.000\n<i>Drive</i>\n",
+		},
+		{
+			"arrows in the cue text",
+			"intro.sbv",
+			"0:00:01.000,0:00:02.000\nLeft --> right\n0:00:03.000,0:00:04.000\n",
+			"WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nLeft --&gt; right\n0:00:03.000,0:00:04.000\n",
+		},
+		{
+			"vtt",
+			"intro.vtt",
+			"\ufeffWEBVTT - Forklift\r\nKind: captions\r\n\r\nNOTE checked by the vendor\r\n\r\nintro\r\n00:01.000 --> 00:04.000 line:0 align:start\r\n<v Trainer>Check the brakes\r\n\r\n\r\n",
+			"WEBVTT - Forklift\nKind: captions\n\nNOTE checked by the vendor\n\nintro\n00:01.000 --> 00:04.000 line:0 align:start\n<v Trainer>Check the brakes\n",
+		},
+		{
+			"windows-1252",
+			"intro.srt",
+			"1\n00:00:01,000 --> 00:00:02,000\nCaf\xe9 \x93break\x94\n",
+			"WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nCafé “break”\n",
+		},
+		{
+			"utf-16",
+			"intro.srt",
+			string(utf16LE("1\r\n00:00:01,000 --> 00:00:02,000\r\nÜber\r\n")),
+			"WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nÜber\n",
+		},
+	}
+
+	for _, s := range scenarios {
+		converted, err := ConvertCaptions(s.file, []byte(s.content))
+		if err != nil {
+			t.Errorf("%s: ConvertCaptions failed: %v", s.name, err)
+			continue
+		}
+		if string(converted) != s.expected {
+			t.Errorf("%s: expected\n%q\ngot\n%q", s.name, s.expected, converted)
+		}
+	}
+
+	failures := []struct {
+		name    string
+		file    string
+		content string
+		message string
+	}{
+		{"unknown format", "intro.txt", "Check the brakes", "only WebVTT"},
+		{"srt timing", "intro.srt", "1\n00:00:01,000 --> 00:00:02,000\nA\n\n2\n00:00:03 --> 00:00:04,000\nB\n", `line 6: invalid cue timing "00:00:03 --> 00:00:04,000"`},
+		{"srt order", "intro.srt", "1\n00:00:05,000 --> 00:00:06,000\nA\n\n2\n00:00:03,000 --> 00:00:04,000\nB\n", "line 6: the cue starts (00:00:03.000) before the previous one (00:00:05.000, line 2)"},
+		{"srt times", "intro.srt", "1\n00:00:01,000 --> 00:61:00,000\nA\n", `line 2: invalid time "00:61:00,000"`},
+		{"sbv end", "intro.sbv", "0:00:04.000,0:00:01.000\nA\n", "line 1: the cue ends (00:00:01.000) before it starts (00:00:04.000)"},
+		{"vtt timing", "intro.vtt", "WEBVTT\n\n00:00:01,000 --> 00:00:02,000\nA\n", `line 3: invalid cue timing "00:00:01,000 --> 00:00:02,000"`},
+		{"vtt header", "intro.vtt", "WEBVTT\n00:00:01.000 --> 00:00:02.000\nA\n", "line 2: the WEBVTT header must be followed by a blank line"},
+		{"vtt identifier", "intro.vtt", "WEBVTT\n\nintro\n", `line 3: expected a cue timing after the cue identifier "intro"`},
+		{"vtt cue text", "intro.vtt", "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nA\nB --> C\n", `line 5: the cue text must not contain "-->"`},
+	}
+	for _, f := range failures {
+		_, err := ConvertCaptions(f.file, []byte(f.content))
+		if !errors.Is(err, ErrCaptionsInvalid) || !strings.Contains(err.Error(), f.message) {
+			t.Errorf("%s: expected an error with %q, got %v", f.name, f.message, err)
+		}
+	}
+}
+
+// utf16LE encodes text as UTF-16 with a little endian byte order mark.
+func utf16LE(text string) []byte {
+	encoded := []byte{0xff, 0xfe}
+	for _, r := range text {
+		encoded = append(encoded, byte(r), byte(r>>8))
+	}
+	return encoded
+}
+
+func TestInitCaptionsHooks(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	course, _ := createTestAuthoredCourse(t, app, courses)
+	initCaptionsHooks(app)
+
+	superusers, err := app.FindCollectionByNameOrId(core.CollectionNameSuperusers)
+	if err != nil {
+		t.Fatalf("Failed to find superusers collection: %v", err)
+	}
+	superuser := core.NewRecord(superusers)
+	superuser.SetEmail("admin@example.com")
+	superuser.SetPassword("1234567890")
+	if err := app.Save(superuser); err != nil {
+		t.Fatalf("Failed to save superuser: %v", err)
+	}
+	token, err := superuser.NewAuthToken()
+	if err != nil {
+		t.Fatalf("Failed to create auth token: %v", err)
+	}
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	upload := func(name, content string) (int, map[string]any) {
+		t.Helper()
+
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("course", course.Id)
+		form.WriteField("title", "Parking")
+		part, _ := form.CreateFormFile("captions", name)
+		io.WriteString(part, content)
+		form.Close()
+
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/collections/lessons/records", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.Header.Set("Authorization", token)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to create the lesson: %v", err)
+		}
+		defer res.Body.Close()
+
+		result := map[string]any{}
+		json.NewDecoder(res.Body).Decode(&result)
+		return res.StatusCode, result
+	}
+
+	status, result := upload("parking.srt", "1\r\n00:00:01,000 --> 00:00:02,000\r\nLower the forks\r\n")
+	captions, _ := result["captions"].(string)
+	if status != http.StatusOK || !strings.HasPrefix(captions, "parking_") || !strings.HasSuffix(captions, ".vtt") {
+		t.Fatalf("Expected the SRT captions to be converted, got %d %v", status, result)
+	}
+
+	lesson, err := app.FindRecordById("lessons", result["id"].(string))
+	if err != nil {
+		t.Fatalf("Failed to find the lesson: %v", err)
+	}
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		t.Fatalf("Failed to open the filesystem: %v", err)
+	}
+	defer fsys.Close()
+	reader, err := fsys.GetReader(lesson.BaseFilesPath() + "/" + captions)
+	if err != nil {
+		t.Fatalf("Failed to read the captions: %v", err)
+	}
+	content, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(content) != "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nLower the forks\n" {
+		t.Errorf("Unexpected captions %q", content)
+	}
+
+	status, result = upload("parking.srt", "1\n00:00:02,000 --> 00:00:01,000\nLower the forks\n")
+	data, _ := result["data"].(map[string]any)
+	field, _ := data["captions"].(map[string]any)
+	if status != http.StatusBadRequest || field["code"] != "validation_invalid_captions" ||
+		!strings.Contains(field["message"].(string), "line 2: the cue ends") {
+		t.Errorf("Expected the malformed captions to be rejected, got %d %v", status, result)
+	}
+}
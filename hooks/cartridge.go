@@ -0,0 +1,1044 @@
+package hooks
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/core/validators"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	cartridgeManifestName = "imsmanifest.xml"
+	// limit of the extracted cartridge, higher than the lesson packages as it
+	// holds the videos of every lesson
+	cartridgeMaxSize = 10 << 30
+	// limit of the manifest, pages and web links read from a cartridge
+	cartridgeMaxDocumentSize = 10 << 20
+
+	// exported cartridges follow Common Cartridge 1.3
+	cartridgeSchema           = "IMS Common Cartridge"
+	cartridgeSchemaVersion    = "1.3.0"
+	cartridgeNamespace        = "http://www.imsglobal.org/xsd/imsccv1p3/imscp_v1p1"
+	cartridgeLomNamespace     = "http://ltsc.ieee.org/xsd/imsccv1p3/LOM/manifest"
+	cartridgeWebLinkNamespace = "http://www.imsglobal.org/xsd/imsccv1p3/imswl_v1p3"
+	cartridgeWebContentType   = "webcontent"
+	cartridgeWebLinkType      = "imswl_xmlv1p3"
+	// web links of every Common Cartridge version
+	cartridgeWebLinkTypePrefix = "imswl_xmlv1p"
+	// token of the cartridge files in the pages exported by some LMSs
+	cartridgeFileBase = "$IMS-CC-FILEBASE$"
+)
+
+var ErrCartridgeInvalid = errors.New("invalid Common Cartridge")
+
+// lessonMediaFields are the single file fields of the lessons played or shown with their content.
+var lessonMediaFields = []string{"video", "thumbnail", "captions"}
+
+// storedFileSuffix matches the random suffix PocketBase adds to the names of the stored files.
+var storedFileSuffix = regexp.MustCompile(`^(.+)_[a-z0-9]{10}((?:\.[\w-]+)*)$`)
+
+// cartridgeManifest is the part of imsmanifest.xml mapped to a course. It is
+// used to write the manifest and to read the manifests of any Common
+// Cartridge version, as element names are matched regardless of their namespace.
+type cartridgeManifest struct {
+	XMLName    xml.Name `xml:"manifest"`
+	Namespace  string   `xml:"xmlns,attr,omitempty"`
+	Identifier string   `xml:"identifier,attr"`
+	Metadata   struct {
+		Schema        string       `xml:"schema"`
+		SchemaVersion string       `xml:"schemaversion"`
+		Lom           cartridgeLom `xml:"lom"`
+	} `xml:"metadata"`
+	Organizations []cartridgeOrganization `xml:"organizations>organization"`
+	Resources     []cartridgeResource     `xml:"resources>resource"`
+}
+
+type cartridgeLom struct {
+	Namespace   string `xml:"xmlns,attr,omitempty"`
+	Title       string `xml:"general>title>string"`
+	Description string `xml:"general>description>string,omitempty"`
+}
+
+type cartridgeOrganization struct {
+	Identifier string          `xml:"identifier,attr"`
+	Structure  string          `xml:"structure,attr,omitempty"`
+	Items      []cartridgeItem `xml:"item"`
+}
+
+type cartridgeItem struct {
+	Identifier    string          `xml:"identifier,attr"`
+	IdentifierRef string          `xml:"identifierref,attr,omitempty"`
+	Title         string          `xml:"title,omitempty"`
+	Items         []cartridgeItem `xml:"item"`
+}
+
+type cartridgeResource struct {
+	Identifier string          `xml:"identifier,attr"`
+	Type       string          `xml:"type,attr"`
+	Href       string          `xml:"href,attr,omitempty"`
+	Files      []cartridgeFile `xml:"file"`
+}
+
+type cartridgeFile struct {
+	Href string `xml:"href,attr"`
+}
+
+type cartridgeWebLink struct {
+	XMLName   xml.Name `xml:"webLink"`
+	Namespace string   `xml:"xmlns,attr,omitempty"`
+	Title     string   `xml:"title"`
+	URL       struct {
+		Href   string `xml:"href,attr"`
+		Target string `xml:"target,attr,omitempty"`
+	} `xml:"url"`
+}
+
+// Cartridge is the content of an IMS Common Cartridge that maps to a course.
+type Cartridge struct {
+	Title       string
+	Description string
+	Lessons     []*CartridgeLesson
+	// Skipped lists the items of the cartridge that have no equivalent in a
+	// course, like assessments or discussion topics.
+	Skipped []string
+
+	files map[string]*zip.File
+}
+
+// CartridgeLesson is a page of a cartridge with the FAQs and web links following it.
+// Its files are paths of the cartridge, and its content refers to the
+// downloads it embeds with cartridgeDownloadRef tokens.
+type CartridgeLesson struct {
+	Title     string
+	Summary   string
+	Content   string
+	Video     string
+	Thumbnail string
+	Captions  string
+	Downloads []string
+	FAQs      []CartridgeFAQ
+	Resources []CartridgeLink
+}
+
+type CartridgeFAQ struct {
+	Question string
+	Answer   string
+}
+
+type CartridgeLink struct {
+	Name string
+	URL  string
+}
+
+// CartridgeImport is the course created from a cartridge.
+type CartridgeImport struct {
+	Course  *core.Record `json:"course"`
+	Lessons int          `json:"lessons"`
+	Skipped []string     `json:"skipped"`
+}
+
+func cartridgeInvalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrCartridgeInvalid, fmt.Sprintf(format, args...))
+}
+
+// cartridgeDownloadRef is the placeholder of the i-th download of a lesson
+// in its content, until the URL of the stored file is known.
+func cartridgeDownloadRef(i int) string {
+	return fmt.Sprintf("$CARTRIDGE-DOWNLOAD-%d$", i)
+}
+
+// addDownload adds a file to the downloads of the lesson, returning its index.
+func (l *CartridgeLesson) addDownload(name string) int {
+	if i := slices.Index(l.Downloads, name); i >= 0 {
+		return i
+	}
+	l.Downloads = append(l.Downloads, name)
+	return len(l.Downloads) - 1
+}
+
+// ParseCartridge reads the course of an IMS Common Cartridge (1.0 to 1.3).
+//
+// The pages of the cartridge become lessons, with the FAQ pages and web links
+// that follow them, and the other files of the pages become their downloads.
+// The pages exported by eLesson also restore the summary, video, captions and
+// thumbnail of their lesson.
+func ParseCartridge(r io.ReaderAt, size int64) (*Cartridge, error) {
+	files, err := packageArchiveFiles(r, size, cartridgeMaxSize)
+	if err != nil {
+		return nil, cartridgeInvalid("%v", err)
+	}
+
+	cartridge := &Cartridge{files: make(map[string]*zip.File, len(files))}
+	for _, file := range files {
+		name, _ := packageFilePath(file.Name)
+		cartridge.files[name] = file
+	}
+
+	rawManifest, err := cartridge.read(cartridgeManifestName)
+	if err != nil {
+		return nil, cartridgeInvalid("missing %s at the root of the archive", cartridgeManifestName)
+	}
+
+	manifest := cartridgeManifest{}
+	if err := xml.Unmarshal(rawManifest, &manifest); err != nil {
+		return nil, cartridgeInvalid("malformed %s: %v", cartridgeManifestName, err)
+	}
+	if !strings.Contains(manifest.Metadata.Schema, "Common Cartridge") {
+		return nil, cartridgeInvalid("not a Common Cartridge manifest")
+	}
+
+	cartridge.Title = strings.TrimSpace(manifest.Metadata.Lom.Title)
+	cartridge.Description = strings.TrimSpace(manifest.Metadata.Lom.Description)
+
+	resources := make(map[string]cartridgeResource, len(manifest.Resources))
+	for _, resource := range manifest.Resources {
+		resources[resource.Identifier] = resource
+	}
+
+	var lesson *CartridgeLesson
+	var walk func(items []cartridgeItem) error
+	walk = func(items []cartridgeItem) error {
+		for _, item := range items {
+			title := strings.TrimSpace(item.Title)
+
+			if item.IdentifierRef != "" {
+				resource, ok := resources[item.IdentifierRef]
+				href := resource.Href
+				if href == "" && len(resource.Files) > 0 {
+					href = resource.Files[0].Href
+				}
+
+				switch {
+				case !ok || href == "":
+					cartridge.Skipped = append(cartridge.Skipped, title)
+				case resource.Type == cartridgeWebContentType && isHTMLPath(href):
+					parsed, err := cartridge.parsePage(title, href, lesson)
+					if err != nil {
+						return err
+					}
+					if parsed != lesson {
+						lesson = parsed
+						cartridge.Lessons = append(cartridge.Lessons, lesson)
+					}
+				case resource.Type == cartridgeWebContentType && lesson != nil:
+					if name, ok := cartridge.localFile("", href); ok {
+						lesson.addDownload(name)
+					}
+				case strings.HasPrefix(resource.Type, cartridgeWebLinkTypePrefix) && lesson != nil:
+					link, err := cartridge.parseWebLink(title, href)
+					if err != nil {
+						return err
+					}
+					lesson.Resources = append(lesson.Resources, link)
+				default:
+					cartridge.Skipped = append(cartridge.Skipped, title)
+				}
+			}
+
+			if err := walk(item.Items); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, organization := range manifest.Organizations {
+		if err := walk(organization.Items); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(cartridge.Lessons) == 0 {
+		return nil, cartridgeInvalid("no web content pages to import as lessons")
+	}
+
+	if cartridge.Title == "" {
+		cartridge.Title = cartridge.Lessons[0].Title
+	}
+
+	return cartridge, nil
+}
+
+// isHTMLPath reports whether a cartridge file is a web page.
+func isHTMLPath(name string) bool {
+	ext := strings.ToLower(path.Ext(strings.SplitN(name, "?", 2)[0]))
+	return ext == ".html" || ext == ".htm"
+}
+
+// read returns the content of a document of the cartridge.
+func (c *Cartridge) read(name string) ([]byte, error) {
+	file, ok := c.files[name]
+	if !ok {
+		return nil, fmt.Errorf("missing %s", name)
+	}
+	if file.UncompressedSize64 > cartridgeMaxDocumentSize {
+		return nil, fmt.Errorf("%s exceeds %d bytes", name, cartridgeMaxDocumentSize)
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(io.LimitReader(reader, cartridgeMaxDocumentSize))
+}
+
+// file returns a file of the cartridge, to be stored in a file field.
+func (c *Cartridge) file(name string) (*filesystem.File, error) {
+	file, ok := c.files[name]
+	if !ok {
+		return nil, fmt.Errorf("missing %s", name)
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	return filesystem.NewFileFromBytes(content, path.Base(name))
+}
+
+// localFile resolves a link of a page, in dir, to a file of the cartridge.
+func (c *Cartridge) localFile(dir, ref string) (string, bool) {
+	parsed, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" || parsed.Path == "" {
+		return "", false
+	}
+
+	candidates := []string{path.Join(dir, parsed.Path)}
+	if rest, ok := strings.CutPrefix(parsed.Path, cartridgeFileBase+"/"); ok {
+		candidates = []string{rest, "web_resources/" + rest}
+	} else if path.IsAbs(parsed.Path) {
+		return "", false
+	}
+
+	for _, candidate := range candidates {
+		if name, ok := packageFilePath(candidate); ok && c.files[name] != nil {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// parsePage reads a web content page of the cartridge. FAQ pages add their
+// questions to the current lesson, other pages start a new lesson.
+func (c *Cartridge) parsePage(title, href string, current *CartridgeLesson) (*CartridgeLesson, error) {
+	name, ok := packageFilePath(strings.SplitN(href, "?", 2)[0])
+	if !ok {
+		return nil, cartridgeInvalid("invalid page path %q", href)
+	}
+	content, err := c.read(name)
+	if err != nil {
+		return nil, cartridgeInvalid("unreadable page %q: %v", name, err)
+	}
+
+	document, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, cartridgeInvalid("malformed page %q: %v", name, err)
+	}
+	body := findHTMLElement(document, htmlElementNamed(atom.Body))
+	if body == nil {
+		return nil, cartridgeInvalid("malformed page %q", name)
+	}
+
+	if faqs := findHTMLElement(body, htmlElementWithClass("faqs")); faqs != nil && faqs.DataAtom == atom.Dl && current != nil {
+		var question string
+		for child := faqs.FirstChild; child != nil; child = child.NextSibling {
+			switch child.DataAtom {
+			case atom.Dt:
+				question = htmlText(child)
+			case atom.Dd:
+				if answer := htmlText(child); question != "" && answer != "" {
+					current.FAQs = append(current.FAQs, CartridgeFAQ{Question: question, Answer: answer})
+				}
+				question = ""
+			}
+		}
+		return current, nil
+	}
+
+	lesson := &CartridgeLesson{Title: title}
+	if lesson.Title == "" {
+		if element := findHTMLElement(document, htmlElementNamed(atom.Title)); element != nil {
+			lesson.Title = htmlText(element)
+		}
+	}
+	if lesson.Title == "" {
+		lesson.Title = strings.TrimSuffix(path.Base(name), path.Ext(name))
+	}
+
+	dir := path.Dir(name)
+	contentRoot := findHTMLElement(body, htmlElementWithClass("content"))
+	if contentRoot == nil {
+		contentRoot = body
+	}
+	// the media of the lesson are outside of its content in the pages of eLesson
+	outsideContent := func(match func(*html.Node) bool) func(*html.Node) bool {
+		return func(node *html.Node) bool {
+			if !match(node) {
+				return false
+			}
+			if contentRoot == body {
+				return true
+			}
+			for parent := node.Parent; parent != nil; parent = parent.Parent {
+				if parent == contentRoot {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	extracted := []*html.Node{}
+
+	if heading := findHTMLElement(body, outsideContent(htmlElementNamed(atom.H1))); heading != nil && htmlText(heading) == lesson.Title {
+		extracted = append(extracted, heading)
+	}
+
+	if summary := findHTMLElement(body, outsideContent(htmlElementWithClass("summary"))); summary != nil {
+		lesson.Summary = htmlText(summary)
+		extracted = append(extracted, summary)
+	}
+
+	if video := findHTMLElement(body, outsideContent(htmlElementNamed(atom.Video))); video != nil {
+		src := htmlAttr(video, "src")
+		if source := findHTMLElement(video, htmlElementNamed(atom.Source)); src == "" && source != nil {
+			src = htmlAttr(source, "src")
+		}
+		if videoName, ok := c.localFile(dir, src); ok {
+			lesson.Video = videoName
+			lesson.Thumbnail, _ = c.localFile(dir, htmlAttr(video, "poster"))
+
+			track := findHTMLElement(video, func(node *html.Node) bool {
+				kind := htmlAttr(node, "kind")
+				return node.DataAtom == atom.Track && (kind == "" || kind == "captions" || kind == "subtitles")
+			})
+			if track != nil {
+				lesson.Captions, _ = c.localFile(dir, htmlAttr(track, "src"))
+			}
+
+			extracted = append(extracted, video)
+		}
+	}
+
+	if thumbnail := findHTMLElement(body, outsideContent(htmlElementWithClass("thumbnail"))); thumbnail != nil && thumbnail.DataAtom == atom.Img {
+		if thumbnailName, ok := c.localFile(dir, htmlAttr(thumbnail, "src")); ok && lesson.Thumbnail == "" {
+			lesson.Thumbnail = thumbnailName
+			extracted = append(extracted, thumbnail)
+		}
+	}
+
+	if downloads := findHTMLElement(body, outsideContent(htmlElementWithClass("downloads"))); downloads != nil {
+		walkHTML(downloads, func(node *html.Node) {
+			if node.DataAtom == atom.A {
+				if downloadName, ok := c.localFile(dir, htmlAttr(node, "href")); ok {
+					lesson.addDownload(downloadName)
+				}
+			}
+		})
+		extracted = append(extracted, downloads)
+	}
+
+	for _, node := range extracted {
+		if node.Parent != nil {
+			node.Parent.RemoveChild(node)
+		}
+	}
+
+	// the files embedded or linked by the content become downloads of the lesson
+	nodes := htmlChildren(contentRoot)
+	rewriteHTMLURLs(nodes, func(value string) (string, bool) {
+		fileName, ok := c.localFile(dir, value)
+		if !ok {
+			return "", false
+		}
+		return cartridgeDownloadRef(lesson.addDownload(fileName)), true
+	})
+
+	rendered, err := renderHTMLNodes(nodes)
+	if err != nil {
+		return nil, cartridgeInvalid("malformed page %q: %v", name, err)
+	}
+	lesson.Content = strings.TrimSpace(rendered)
+
+	return lesson, nil
+}
+
+// parseWebLink reads a web link of the cartridge.
+func (c *Cartridge) parseWebLink(title, href string) (CartridgeLink, error) {
+	name, ok := packageFilePath(href)
+	if !ok {
+		return CartridgeLink{}, cartridgeInvalid("invalid web link path %q", href)
+	}
+	content, err := c.read(name)
+	if err != nil {
+		return CartridgeLink{}, cartridgeInvalid("unreadable web link %q: %v", name, err)
+	}
+
+	webLink := cartridgeWebLink{}
+	if err := xml.Unmarshal(content, &webLink); err != nil {
+		return CartridgeLink{}, cartridgeInvalid("malformed web link %q: %v", name, err)
+	}
+
+	parsed, err := url.Parse(strings.TrimSpace(webLink.URL.Href))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return CartridgeLink{}, cartridgeInvalid("web link %q must be an http(s) URL", name)
+	}
+
+	link := CartridgeLink{Name: strings.TrimSpace(webLink.Title), URL: parsed.String()}
+	if link.Name == "" {
+		link.Name = title
+	}
+	if link.Name == "" {
+		link.Name = parsed.Host
+	}
+	return link, nil
+}
+
+// lessonFileFits reports whether a file of a cartridge can be stored in a
+// file field of the lessons, following the validation of the field.
+func lessonFileFits(lessons *core.Collection, fieldName string, file *filesystem.File) bool {
+	field, ok := lessons.Fields.GetByName(fieldName).(*core.FileField)
+	if !ok {
+		return false
+	}
+
+	maxSize := field.MaxSize
+	if maxSize <= 0 {
+		maxSize = core.DefaultFileFieldMaxSize
+	}
+	if validators.UploadedFileSize(maxSize)(file) != nil {
+		return false
+	}
+
+	return len(field.MimeTypes) == 0 || validators.UploadedFileMimeType(field.MimeTypes)(file) == nil
+}
+
+// lessonFileURL returns the URL of a file of a lesson.
+func lessonFileURL(lesson *core.Record, name string) string {
+	return "/api/files/" + lesson.Collection().Id + "/" + lesson.Id + "/" + url.PathEscape(name)
+}
+
+// lessonFileName returns the name of the lesson file a URL refers to.
+func lessonFileName(lesson *core.Record, value string) (string, bool) {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return "", false
+	}
+
+	segments := strings.Split(strings.TrimPrefix(parsed.Path, "/"), "/")
+	if len(segments) != 5 || segments[0] != "api" || segments[1] != "files" || segments[3] != lesson.Id ||
+		(segments[2] != lesson.Collection().Id && segments[2] != lesson.Collection().Name) {
+		return "", false
+	}
+	return segments[4], true
+}
+
+// ImportCartridge creates a course of an organization from a cartridge.
+func (cs *CourseService) ImportCartridge(cartridge *Cartridge, organizationID, ownerID string) (*CartridgeImport, error) {
+	result := &CartridgeImport{Skipped: slices.Clone(cartridge.Skipped)}
+
+	err := cs.app.RunInTransaction(func(txApp core.App) error {
+		courses, err := txApp.FindCollectionByNameOrId("courses")
+		if err != nil {
+			return fmt.Errorf("failed to find courses collection: %w", err)
+		}
+		lessons, err := txApp.FindCollectionByNameOrId("lessons")
+		if err != nil {
+			return fmt.Errorf("failed to find lessons collection: %w", err)
+		}
+		faqs, err := txApp.FindCollectionByNameOrId("lesson_faqs")
+		if err != nil {
+			return fmt.Errorf("failed to find lesson_faqs collection: %w", err)
+		}
+		resources, err := txApp.FindCollectionByNameOrId("lesson_resources")
+		if err != nil {
+			return fmt.Errorf("failed to find lesson_resources collection: %w", err)
+		}
+
+		course := core.NewRecord(courses)
+		course.Set("title", cartridge.Title)
+		course.Set("description", cartridge.Description)
+		course.Set("organization", organizationID)
+		course.Set("owner", ownerID)
+		if err := txApp.Save(course); err != nil {
+			return fmt.Errorf("failed to save course: %w", err)
+		}
+
+		maxDownloads := 1
+		if field, ok := lessons.Fields.GetByName("downloads").(*core.FileField); ok && field.MaxSelect > 0 {
+			maxDownloads = field.MaxSelect
+		}
+
+		created := types.NowDateTime()
+		for i, item := range cartridge.Lessons {
+			lesson := core.NewRecord(lessons)
+			lesson.Set("id", core.GenerateDefaultRandomId())
+			lesson.Set("course", course.Id)
+			lesson.Set("title", item.Title)
+			lesson.Set("summary", item.Summary)
+			// lessons are listed by creation date
+			lesson.SetRaw("created", created.Add(time.Duration(i)*time.Millisecond))
+
+			// media the lesson fields don't accept become downloads
+			downloads := slices.Clone(item.Downloads)
+			media := map[string]string{"video": item.Video, "thumbnail": item.Thumbnail, "captions": item.Captions}
+			for _, field := range lessonMediaFields {
+				name := media[field]
+				if name == "" {
+					continue
+				}
+				file, err := cartridge.file(name)
+				if err != nil {
+					return err
+				}
+				if lessonFileFits(lessons, field, file) {
+					lesson.Set(field, file)
+				} else if !slices.Contains(downloads, name) {
+					downloads = append(downloads, name)
+				}
+			}
+
+			refs := make([]string, 0, len(item.Downloads)*2)
+			files := []*filesystem.File{}
+			for j, name := range downloads {
+				file, err := cartridge.file(name)
+				if err != nil {
+					return err
+				}
+
+				target := name
+				if len(files) < maxDownloads && lessonFileFits(lessons, "downloads", file) {
+					files = append(files, file)
+					target = lessonFileURL(lesson, file.Name)
+				} else {
+					result.Skipped = append(result.Skipped, item.Title+": "+name)
+				}
+				if j < len(item.Downloads) {
+					refs = append(refs, cartridgeDownloadRef(j), target)
+				}
+			}
+			lesson.Set("downloads", files)
+			lesson.Set("content", strings.NewReplacer(refs...).Replace(item.Content))
+
+			if err := txApp.Save(lesson); err != nil {
+				return fmt.Errorf("failed to save lesson %q: %w", item.Title, err)
+			}
+
+			for _, faq := range item.FAQs {
+				record := core.NewRecord(faqs)
+				record.Set("lesson", []string{lesson.Id})
+				record.Set("question", faq.Question)
+				record.Set("answer", faq.Answer)
+				if err := txApp.Save(record); err != nil {
+					return fmt.Errorf("failed to save FAQ of lesson %q: %w", item.Title, err)
+				}
+			}
+
+			for _, link := range item.Resources {
+				record := core.NewRecord(resources)
+				record.Set("lesson", []string{lesson.Id})
+				record.Set("name", link.Name)
+				record.Set("link", link.URL)
+				if err := txApp.Save(record); err != nil {
+					return fmt.Errorf("failed to save resource of lesson %q: %w", item.Title, err)
+				}
+			}
+		}
+
+		result.Course = course
+		result.Lessons = len(cartridge.Lessons)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// cartridgePage is a page of an exported cartridge.
+type cartridgePage struct {
+	Title     string
+	Summary   string
+	Content   template.HTML
+	Video     string
+	Thumbnail string
+	Captions  string
+	Downloads []cartridgePageLink
+	FAQs      []CartridgeFAQ
+}
+
+type cartridgePageLink struct {
+	Name string
+	Href string
+}
+
+var cartridgePageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{- if .Summary}}
+<p class="summary">{{.Summary}}</p>
+{{- end}}
+{{- if .Video}}
+<video controls src="{{.Video}}"{{if .Thumbnail}} poster="{{.Thumbnail}}"{{end}}>
+{{- if .Captions}}<track kind="captions" src="{{.Captions}}" default>{{end -}}
+</video>
+{{- else if .Thumbnail}}
+<img class="thumbnail" src="{{.Thumbnail}}" alt="">
+{{- end}}
+{{- if .FAQs}}
+<dl class="faqs">
+{{- range .FAQs}}
+<dt>{{.Question}}</dt>
+<dd>{{.Answer}}</dd>
+{{- end}}
+</dl>
+{{- else}}
+<div class="content">{{.Content}}</div>
+{{- end}}
+{{- if .Downloads}}
+<ul class="downloads">
+{{- range .Downloads}}
+<li><a href="{{.Href}}">{{.Name}}</a></li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
+
+// cartridgeWriter writes the files of a cartridge, keeping track of its manifest.
+type cartridgeWriter struct {
+	archive  *zip.Writer
+	fsys     *filesystem.System
+	manifest cartridgeManifest
+}
+
+// create adds a file to the cartridge.
+func (w *cartridgeWriter) create(name string, content []byte) error {
+	writer, err := w.archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	_, err = writer.Write(content)
+	return err
+}
+
+// copy adds a stored file of a record to the cartridge.
+func (w *cartridgeWriter) copy(record *core.Record, storedName, name string) error {
+	reader, err := w.fsys.GetReader(record.BaseFilesPath() + "/" + storedName)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", storedName, err)
+	}
+	defer reader.Close()
+
+	writer, err := w.archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	if _, err := io.Copy(writer, reader); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", storedName, err)
+	}
+	return nil
+}
+
+// addPage adds a web content page, with the files it embeds, to the cartridge.
+func (w *cartridgeWriter) addPage(identifier, name string, page cartridgePage, files []string) error {
+	var content bytes.Buffer
+	if err := cartridgePageTemplate.Execute(&content, page); err != nil {
+		return fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	if err := w.create(name, content.Bytes()); err != nil {
+		return err
+	}
+
+	resource := cartridgeResource{Identifier: identifier, Type: cartridgeWebContentType, Href: name}
+	for _, file := range append([]string{name}, files...) {
+		resource.Files = append(resource.Files, cartridgeFile{Href: file})
+	}
+	w.manifest.Resources = append(w.manifest.Resources, resource)
+	return nil
+}
+
+// addWebLink adds a web link to the cartridge.
+func (w *cartridgeWriter) addWebLink(identifier, name, title, link string) error {
+	webLink := cartridgeWebLink{Namespace: cartridgeWebLinkNamespace, Title: title}
+	webLink.URL.Href = link
+	webLink.URL.Target = "_blank"
+
+	content, err := xml.MarshalIndent(webLink, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	if err := w.create(name, append([]byte(xml.Header), content...)); err != nil {
+		return err
+	}
+
+	w.manifest.Resources = append(w.manifest.Resources, cartridgeResource{
+		Identifier: identifier,
+		Type:       cartridgeWebLinkType,
+		Files:      []cartridgeFile{{Href: name}},
+	})
+	return nil
+}
+
+// exportFileName returns the name of a stored file in an exported package,
+// without the random suffix of the storage and unique within used.
+func exportFileName(storedName string, used map[string]bool) string {
+	name := storedFileSuffix.ReplaceAllString(storedName, "$1$2")
+
+	base, ext := name, ""
+	if i := strings.Index(name, "."); i > 0 {
+		base, ext = name[:i], name[i:]
+	}
+	for n := 2; used[name]; n++ {
+		name = fmt.Sprintf("%s_%d%s", base, n, ext)
+	}
+
+	used[name] = true
+	return name
+}
+
+// findLessonFAQs returns the FAQs of a lesson.
+func findLessonFAQs(app core.App, lessonID string) ([]*core.Record, error) {
+	return app.FindRecordsByFilter("lesson_faqs", "lesson.id ?= {:lesson}", "created", 0, 0, dbx.Params{"lesson": lessonID})
+}
+
+// findLessonResources returns the resources of a lesson.
+func findLessonResources(app core.App, lessonID string) ([]*core.Record, error) {
+	return app.FindRecordsByFilter("lesson_resources", "lesson.id ?= {:lesson}", "created", 0, 0, dbx.Params{"lesson": lessonID})
+}
+
+// ExportCartridge writes a course, with its lessons and their files, FAQs
+// and resources, as an IMS Common Cartridge 1.3.
+//
+// Every lesson is exported as a folder with its page, its FAQ page and a web
+// link per resource. SCORM and cmi5 packages have no equivalent in a
+// cartridge and are left out.
+func (cs *CourseService) ExportCartridge(course *core.Record, w io.Writer) error {
+	lessons, err := cs.app.FindRecordsByFilter("lessons", "course = {:course}", "created", 0, 0, dbx.Params{"course": course.Id})
+	if err != nil {
+		return fmt.Errorf("failed to find lessons: %w", err)
+	}
+
+	fsys, err := cs.app.NewFilesystem()
+	if err != nil {
+		return err
+	}
+	defer fsys.Close()
+
+	writer := &cartridgeWriter{archive: zip.NewWriter(w), fsys: fsys}
+	writer.manifest.Namespace = cartridgeNamespace
+	writer.manifest.Identifier = "M_" + course.Id
+	writer.manifest.Metadata.Schema = cartridgeSchema
+	writer.manifest.Metadata.SchemaVersion = cartridgeSchemaVersion
+	writer.manifest.Metadata.Lom = cartridgeLom{
+		Namespace:   cartridgeLomNamespace,
+		Title:       course.GetString("title"),
+		Description: course.GetString("description"),
+	}
+
+	root := cartridgeItem{Identifier: "I_root"}
+
+	for i, lesson := range lessons {
+		dir := fmt.Sprintf("lesson_%d", i+1)
+		id := fmt.Sprintf("lesson_%d", i+1)
+		title := lesson.GetString("title")
+		folder := cartridgeItem{Identifier: "I_" + id, Title: title}
+
+		// the files of the lesson, by stored name, with their path relative to the page
+		used := map[string]bool{}
+		paths := map[string]string{}
+		files := []string{}
+		addFile := func(storedName, subdir string) (string, error) {
+			relative := subdir + "/" + exportFileName(storedName, used)
+			if err := writer.copy(lesson, storedName, dir+"/"+relative); err != nil {
+				return "", err
+			}
+			paths[storedName] = relative
+			files = append(files, dir+"/"+relative)
+			return relative, nil
+		}
+
+		page := cartridgePage{Title: title, Summary: lesson.GetString("summary")}
+		media := map[string]*string{"video": &page.Video, "thumbnail": &page.Thumbnail, "captions": &page.Captions}
+		for _, field := range lessonMediaFields {
+			if storedName := lesson.GetString(field); storedName != "" {
+				if *media[field], err = addFile(storedName, "media"); err != nil {
+					return err
+				}
+			}
+		}
+		for _, storedName := range lesson.GetStringSlice("downloads") {
+			relative, err := addFile(storedName, "downloads")
+			if err != nil {
+				return err
+			}
+			page.Downloads = append(page.Downloads, cartridgePageLink{Name: path.Base(relative), Href: relative})
+		}
+
+		// the content links to the files of the lesson within the cartridge
+		nodes, err := parseHTMLFragment(lesson.GetString("content"))
+		if err != nil {
+			return fmt.Errorf("failed to parse the content of lesson %q: %w", title, err)
+		}
+		rewriteHTMLURLs(nodes, func(value string) (string, bool) {
+			storedName, ok := lessonFileName(lesson, value)
+			if !ok || paths[storedName] == "" {
+				return "", false
+			}
+			return paths[storedName], true
+		})
+		content, err := renderHTMLNodes(nodes)
+		if err != nil {
+			return fmt.Errorf("failed to render the content of lesson %q: %w", title, err)
+		}
+		page.Content = template.HTML(content)
+
+		if err := writer.addPage("R_"+id, dir+"/index.html", page, files); err != nil {
+			return err
+		}
+		folder.Items = append(folder.Items, cartridgeItem{Identifier: "I_" + id + "_page", IdentifierRef: "R_" + id, Title: title})
+
+		faqs, err := findLessonFAQs(cs.app, lesson.Id)
+		if err != nil {
+			return fmt.Errorf("failed to find the FAQs of lesson %q: %w", title, err)
+		}
+		if len(faqs) > 0 {
+			faqPage := cartridgePage{Title: title + " - FAQ"}
+			for _, faq := range faqs {
+				faqPage.FAQs = append(faqPage.FAQs, CartridgeFAQ{Question: faq.GetString("question"), Answer: faq.GetString("answer")})
+			}
+			if err := writer.addPage("R_"+id+"_faqs", dir+"/faqs.html", faqPage, nil); err != nil {
+				return err
+			}
+			folder.Items = append(folder.Items, cartridgeItem{Identifier: "I_" + id + "_faqs", IdentifierRef: "R_" + id + "_faqs", Title: "FAQ"})
+		}
+
+		resources, err := findLessonResources(cs.app, lesson.Id)
+		if err != nil {
+			return fmt.Errorf("failed to find the resources of lesson %q: %w", title, err)
+		}
+		for j, resource := range resources {
+			linkID := fmt.Sprintf("%s_link_%d", id, j+1)
+			name := fmt.Sprintf("%s/links/link_%d.xml", dir, j+1)
+			if err := writer.addWebLink("R_"+linkID, name, resource.GetString("name"), resource.GetString("link")); err != nil {
+				return err
+			}
+			folder.Items = append(folder.Items, cartridgeItem{Identifier: "I_" + linkID, IdentifierRef: "R_" + linkID, Title: resource.GetString("name")})
+		}
+
+		root.Items = append(root.Items, folder)
+	}
+
+	writer.manifest.Organizations = []cartridgeOrganization{{
+		Identifier: "O_1",
+		Structure:  "rooted-hierarchy",
+		Items:      []cartridgeItem{root},
+	}}
+
+	manifest, err := xml.MarshalIndent(writer.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", cartridgeManifestName, err)
+	}
+	if err := writer.create(cartridgeManifestName, append([]byte(xml.Header), manifest...)); err != nil {
+		return err
+	}
+
+	return writer.archive.Close()
+}
+
+func bindCartridgeRoutes(r *router.Router[*core.RequestEvent], courseService *CourseService) {
+	// download a course as an IMS Common Cartridge
+	r.GET("/api/courses/{id}/cartridge", func(e *core.RequestEvent) error {
+		course, err := e.App.FindRecordById("courses", e.Request.PathValue("id"))
+		if err != nil {
+			return e.NotFoundError("", err)
+		}
+		if !CanManageCourse(e.Auth, course) {
+			return e.ForbiddenError("Only the course instructor can export it.", nil)
+		}
+
+		e.Response.Header().Set("Content-Type", "application/zip")
+		e.Response.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+			"filename": course.GetString("title") + ".imscc",
+		}))
+
+		// the cartridge is streamed, errors can only be logged once it started
+		if err := courseService.ExportCartridge(course, e.Response); err != nil {
+			e.App.Logger().Error("Failed to export the course cartridge", "course", course.Id, "error", err)
+		}
+		return nil
+	}).Bind(RequireRole(RoleInstructor, RoleOrgAdmin))
+
+	// create a course from an IMS Common Cartridge, in the organization of
+	// the current user (superusers pick the organization)
+	r.POST("/api/courses/import/cartridge", func(e *core.RequestEvent) error {
+		files, err := e.FindUploadedFiles("file")
+		if err != nil || len(files) == 0 {
+			return e.BadRequestError("The cartridge file is required.", err)
+		}
+
+		cartridge, err := parsePackageFile(files[0], ParseCartridge)
+		if errors.Is(err, ErrCartridgeInvalid) {
+			return e.BadRequestError(err.Error(), nil)
+		}
+		if err != nil {
+			return e.InternalServerError("Failed to read the cartridge.", err)
+		}
+
+		organizationID := e.Auth.GetString("organization")
+		if e.Auth.IsSuperuser() {
+			organizationID = e.Request.FormValue("organization")
+		}
+		ownerID := ""
+		if UserRole(e.Auth) == RoleInstructor {
+			ownerID = e.Auth.Id
+		}
+
+		result, err := courseService.ImportCartridge(cartridge, organizationID, ownerID)
+		if err != nil {
+			return e.InternalServerError("Failed to import the cartridge.", err)
+		}
+
+		if err := apis.EnrichRecord(e, result.Course); err != nil {
+			return e.InternalServerError("", err)
+		}
+		return e.JSON(http.StatusOK, result)
+	}).Bind(RequireRole(RoleInstructor, RoleOrgAdmin), apis.BodyLimit(cartridgeMaxSize))
+}
@@ -0,0 +1,412 @@
+package hooks
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// testPNG returns a 1x1 PNG image.
+func testPNG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("Failed to encode image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// testMP4 returns the header of an MP4 video.
+func testMP4() []byte {
+	return append([]byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"), make([]byte, 64)...)
+}
+
+func testFile(t *testing.T, content []byte, name string) *filesystem.File {
+	file, err := filesystem.NewFileFromBytes(content, name)
+	if err != nil {
+		t.Fatalf("Failed to create file %s: %v", name, err)
+	}
+	return file
+}
+
+// createTestAuthoredCourse creates a course with a lesson using every content field and a plain lesson.
+func createTestAuthoredCourse(t *testing.T, app *tests.TestApp, courses *core.Collection) (course *core.Record, lessons []*core.Record) {
+	course = core.NewRecord(courses)
+	course.Set("title", "Forklift safety")
+	course.Set("description", "Driving forklifts in the warehouse")
+	course.Set("organization", testOrg1)
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+
+	lessonsCollection, err := app.FindCollectionByNameOrId("lessons")
+	if err != nil {
+		t.Fatalf("Failed to find lessons collection: %v", err)
+	}
+
+	basics := core.NewRecord(lessonsCollection)
+	basics.Set("course", course.Id)
+	basics.Set("title", "Basics")
+	basics.Set("summary", "What every driver must know")
+	basics.Set("video", testFile(t, testMP4(), "intro.mp4"))
+	basics.Set("thumbnail", testFile(t, testPNG(t), "cover.png"))
+	basics.Set("captions", testFile(t, []byte("WEBVTT\n\n00:00.000 --> 00:01.000\nHello\n"), "intro.vtt"))
+	basics.Set("downloads", []*filesystem.File{
+		testFile(t, testPNG(t), "diagram.png"),
+		testFile(t, []byte("Check the brakes & the horn."), "checklist.txt"),
+	})
+	if err := app.Save(basics); err != nil {
+		t.Fatalf("Failed to save lesson: %v", err)
+	}
+
+	diagram := basics.GetStringSlice("downloads")[0]
+	basics.Set("content", `<p>Read the <a href="https://example.com/rules">rules</a>.</p><img src="`+
+		lessonFileURL(basics, diagram)+`" alt="Diagram">`)
+	if err := app.Save(basics); err != nil {
+		t.Fatalf("Failed to save lesson content: %v", err)
+	}
+
+	advanced := core.NewRecord(lessonsCollection)
+	advanced.Set("course", course.Id)
+	advanced.Set("title", "Advanced <maneuvers>")
+	advanced.Set("content", "<h2>Reversing</h2><p>Look behind you.</p>")
+	if err := app.Save(advanced); err != nil {
+		t.Fatalf("Failed to save lesson: %v", err)
+	}
+
+	faqs, err := app.FindCollectionByNameOrId("lesson_faqs")
+	if err != nil {
+		t.Fatalf("Failed to find lesson_faqs collection: %v", err)
+	}
+	faq := core.NewRecord(faqs)
+	faq.Set("lesson", []string{basics.Id})
+	faq.Set("question", "Do I need a license?")
+	faq.Set("answer", "Yes, a valid operator license.")
+	if err := app.Save(faq); err != nil {
+		t.Fatalf("Failed to save FAQ: %v", err)
+	}
+
+	resources, err := app.FindCollectionByNameOrId("lesson_resources")
+	if err != nil {
+		t.Fatalf("Failed to find lesson_resources collection: %v", err)
+	}
+	resource := core.NewRecord(resources)
+	resource.Set("lesson", []string{basics.Id, advanced.Id})
+	resource.Set("name", "Safety handbook")
+	resource.Set("link", "https://example.com/handbook.pdf")
+	if err := app.Save(resource); err != nil {
+		t.Fatalf("Failed to save resource: %v", err)
+	}
+
+	return course, []*core.Record{basics, advanced}
+}
+
+func TestCartridgeExportImport(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, users := createTestCollections(t, app)
+	course, _ := createTestAuthoredCourse(t, app, courses)
+
+	var exported bytes.Buffer
+	if err := service.ExportCartridge(course, &exported); err != nil {
+		t.Fatalf("ExportCartridge failed: %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(exported.Bytes()), int64(exported.Len()))
+	if err != nil {
+		t.Fatalf("Expected a zip archive: %v", err)
+	}
+	manifest := cartridgeManifest{}
+	for _, file := range archive.File {
+		if file.Name == cartridgeManifestName {
+			reader, _ := file.Open()
+			content, _ := io.ReadAll(reader)
+			reader.Close()
+			if err := xml.Unmarshal(content, &manifest); err != nil {
+				t.Fatalf("Invalid manifest: %v", err)
+			}
+		}
+	}
+	if manifest.Metadata.SchemaVersion != cartridgeSchemaVersion || manifest.Metadata.Lom.Title != "Forklift safety" || len(manifest.Resources) != 5 {
+		t.Errorf("Unexpected manifest %+v", manifest)
+	}
+
+	cartridge, err := ParseCartridge(bytes.NewReader(exported.Bytes()), int64(exported.Len()))
+	if err != nil {
+		t.Fatalf("ParseCartridge failed: %v", err)
+	}
+	if cartridge.Title != "Forklift safety" || cartridge.Description != "Driving forklifts in the warehouse" || len(cartridge.Lessons) != 2 || len(cartridge.Skipped) != 0 {
+		t.Fatalf("Unexpected cartridge %+v", cartridge)
+	}
+
+	basics, advanced := cartridge.Lessons[0], cartridge.Lessons[1]
+	if basics.Title != "Basics" || basics.Summary != "What every driver must know" ||
+		basics.Video != "lesson_1/media/intro.mp4" || basics.Thumbnail != "lesson_1/media/cover.png" || basics.Captions != "lesson_1/media/intro.vtt" ||
+		len(basics.Downloads) != 2 || basics.Downloads[0] != "lesson_1/downloads/diagram.png" ||
+		len(basics.FAQs) != 1 || basics.FAQs[0].Question != "Do I need a license?" ||
+		len(basics.Resources) != 1 || basics.Resources[0].URL != "https://example.com/handbook.pdf" {
+		t.Errorf("Unexpected first lesson %+v", basics)
+	}
+	if !strings.Contains(basics.Content, `src="`+cartridgeDownloadRef(0)+`"`) || !strings.Contains(basics.Content, `href="https://example.com/rules"`) {
+		t.Errorf("Expected the content to embed the diagram download, got %q", basics.Content)
+	}
+	if advanced.Title != "Advanced <maneuvers>" || advanced.Content != "<h2>Reversing</h2><p>Look behind you.</p>" || len(advanced.Resources) != 1 {
+		t.Errorf("Unexpected second lesson %+v", advanced)
+	}
+
+	owner := createTestUser(t, app, users, "owner@example.com", "")
+	result, err := service.ImportCartridge(cartridge, testOrg2, owner.Id)
+	if err != nil {
+		t.Fatalf("ImportCartridge failed: %v", err)
+	}
+	imported := result.Course
+	if result.Lessons != 2 || imported.Id == course.Id || imported.GetString("organization") != testOrg2 || imported.GetString("owner") != owner.Id ||
+		imported.GetString("title") != "Forklift safety" {
+		t.Errorf("Unexpected import %+v", result)
+	}
+
+	lessons, err := app.FindRecordsByFilter("lessons", "course = {:course}", "created", 0, 0, dbx.Params{"course": imported.Id})
+	if err != nil || len(lessons) != 2 {
+		t.Fatalf("Expected 2 imported lessons, got %d %v", len(lessons), err)
+	}
+	lesson := lessons[0]
+	downloads := lesson.GetStringSlice("downloads")
+	if lesson.GetString("title") != "Basics" || lesson.GetString("video") == "" || lesson.GetString("thumbnail") == "" ||
+		lesson.GetString("captions") == "" || len(downloads) != 2 || !strings.HasPrefix(downloads[0], "diagram_") {
+		t.Errorf("Unexpected imported lesson %v", lesson.FieldsData())
+	}
+	if !strings.Contains(lesson.GetString("content"), `src="`+lessonFileURL(lesson, downloads[0])+`"`) {
+		t.Errorf("Expected the content to embed the imported diagram, got %q", lesson.GetString("content"))
+	}
+	if lessons[1].GetString("title") != "Advanced <maneuvers>" {
+		t.Errorf("Expected the lessons to keep their order, got %q", lessons[1].GetString("title"))
+	}
+
+	if faqs, err := findLessonFAQs(app, lesson.Id); err != nil || len(faqs) != 1 || faqs[0].GetString("answer") != "Yes, a valid operator license." {
+		t.Errorf("Expected the imported FAQ, got %d %v", len(faqs), err)
+	}
+	if resources, err := findLessonResources(app, lessons[1].Id); err != nil || len(resources) != 1 || resources[0].GetString("name") != "Safety handbook" {
+		t.Errorf("Expected the imported resource, got %d %v", len(resources), err)
+	}
+}
+
+// testCartridge11 is a Common Cartridge 1.1 like the ones exported by other LMSs.
+var testCartridge11 = map[string]string{
+	"imsmanifest.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<manifest identifier="cctd0001" xmlns="http://www.imsglobal.org/xsd/imsccv1p1/imscp_v1p1" xmlns:lomimscc="http://ltsc.ieee.org/xsd/imsccv1p1/LOM/manifest">
+  <metadata>
+    <schema>IMS Common Cartridge</schema>
+    <schemaversion>1.1.0</schemaversion>
+    <lomimscc:lom>
+      <lomimscc:general>
+        <lomimscc:title><lomimscc:string language="en">Chemistry 101</lomimscc:string></lomimscc:title>
+      </lomimscc:general>
+    </lomimscc:lom>
+  </metadata>
+  <organizations>
+    <organization identifier="org" structure="rooted-hierarchy">
+      <item identifier="root">
+        <item identifier="week1">
+          <title>Week 1</title>
+          <item identifier="early_link" identifierref="link1"><title>Syllabus</title></item>
+          <item identifier="intro" identifierref="page1"><title>Introduction</title></item>
+          <item identifier="handout" identifierref="file1"><title>Handout</title></item>
+          <item identifier="reading" identifierref="link1"><title>Reading</title></item>
+          <item identifier="forum" identifierref="topic1"><title>Discuss the lab</title></item>
+        </item>
+      </item>
+    </organization>
+  </organizations>
+  <resources>
+    <resource identifier="page1" type="webcontent" href="wiki_content/introduction.html">
+      <file href="wiki_content/introduction.html"/>
+    </resource>
+    <resource identifier="file1" type="webcontent" href="web_resources/files/handout.pdf">
+      <file href="web_resources/files/handout.pdf"/>
+    </resource>
+    <resource identifier="link1" type="imswl_xmlv1p1">
+      <file href="links/reading.xml"/>
+    </resource>
+    <resource identifier="topic1" type="imsdt_xmlv1p1">
+      <file href="topics/lab.xml"/>
+    </resource>
+  </resources>
+</manifest>`,
+	"wiki_content/introduction.html": `<html><head><title>Introduction</title></head><body>
+<p>Welcome!</p><img src="$IMS-CC-FILEBASE$/images/atom%20model.png"><a href="../web_resources/files/handout.pdf">Handout</a><a href="missing.pdf">Missing</a>
+</body></html>`,
+	"web_resources/images/atom model.png": "png",
+	"web_resources/files/handout.pdf":     "%PDF-1.4",
+	"links/reading.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<webLink xmlns="http://www.imsglobal.org/xsd/imsccv1p1/imswl_v1p1"><title>Periodic table</title><url href="https://example.com/periodic"/></webLink>`,
+	"topics/lab.xml": `<topic/>`,
+}
+
+func TestParseCartridge(t *testing.T) {
+	content := testScormZip(t, testCartridge11)
+	cartridge, err := ParseCartridge(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("ParseCartridge failed: %v", err)
+	}
+
+	if cartridge.Title != "Chemistry 101" || len(cartridge.Lessons) != 1 {
+		t.Fatalf("Unexpected cartridge %+v", cartridge)
+	}
+	if len(cartridge.Skipped) != 2 || cartridge.Skipped[0] != "Syllabus" || cartridge.Skipped[1] != "Discuss the lab" {
+		t.Errorf("Expected the link before any page and the discussion to be skipped, got %v", cartridge.Skipped)
+	}
+
+	lesson := cartridge.Lessons[0]
+	if lesson.Title != "Introduction" || len(lesson.Resources) != 1 || lesson.Resources[0].Name != "Periodic table" {
+		t.Errorf("Unexpected lesson %+v", lesson)
+	}
+	expectedDownloads := []string{"web_resources/images/atom model.png", "web_resources/files/handout.pdf"}
+	if strings.Join(lesson.Downloads, ",") != strings.Join(expectedDownloads, ",") {
+		t.Errorf("Expected downloads %v, got %v", expectedDownloads, lesson.Downloads)
+	}
+	expectedContent := `<p>Welcome!</p><img src="` + cartridgeDownloadRef(0) + `"/><a href="` + cartridgeDownloadRef(1) + `">Handout</a><a href="missing.pdf">Missing</a>`
+	if lesson.Content != expectedContent {
+		t.Errorf("Expected content %q, got %q", expectedContent, lesson.Content)
+	}
+
+	invalid := map[string][]byte{
+		"not a zip": []byte("cartridge"),
+		"no manifest": testScormZip(t, map[string]string{
+			"index.html": "<p>hi</p>",
+		}),
+		"SCORM package": testScormZip(t, map[string]string{
+			"imsmanifest.xml": `<manifest><metadata><schema>ADL SCORM</schema></metadata></manifest>`,
+		}),
+		"no pages": testScormZip(t, map[string]string{
+			"imsmanifest.xml":   strings.Replace(testCartridge11["imsmanifest.xml"], `type="webcontent" href="wiki_content/introduction.html"`, `type="imsqti_xmlv1p2"`, 1),
+			"links/reading.xml": testCartridge11["links/reading.xml"],
+		}),
+	}
+	for name, content := range invalid {
+		if _, err := ParseCartridge(bytes.NewReader(content), int64(len(content))); !errors.Is(err, ErrCartridgeInvalid) {
+			t.Errorf("%s: expected ErrCartridgeInvalid, got %v", name, err)
+		}
+	}
+}
+
+func TestCartridgeRoutes(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, users := createTestCollections(t, app)
+	course, _ := createTestAuthoredCourse(t, app, courses)
+
+	instructor := core.NewRecord(users)
+	instructor.SetEmail("instructor@example.com")
+	instructor.SetPassword("1234567890")
+	instructor.Set("role", RoleInstructor)
+	instructor.Set("organization", testOrg1)
+	learner := core.NewRecord(users)
+	learner.SetEmail("learner@example.com")
+	learner.SetPassword("1234567890")
+	learner.Set("organization", testOrg1)
+	for _, user := range []*core.Record{instructor, learner} {
+		if err := app.Save(user); err != nil {
+			t.Fatalf("Failed to save user: %v", err)
+		}
+	}
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	bindCartridgeRoutes(r, service)
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	send := func(user *core.Record, method, path string, body io.Reader, contentType string) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest(method, server.URL+path, body)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		token, err := user.NewAuthToken()
+		if err != nil {
+			t.Fatalf("Failed to create auth token: %v", err)
+		}
+		req.Header.Set("Authorization", token)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		return res
+	}
+
+	res := send(learner, http.MethodGet, "/api/courses/"+course.Id+"/cartridge", nil, "")
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected learners not to export courses, got %d", res.StatusCode)
+	}
+
+	// the instructor doesn't own the course yet
+	res = send(instructor, http.MethodGet, "/api/courses/"+course.Id+"/cartridge", nil, "")
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected other instructors not to export the course, got %d", res.StatusCode)
+	}
+
+	course.Set("owner", instructor.Id)
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+	res = send(instructor, http.MethodGet, "/api/courses/"+course.Id+"/cartridge", nil, "")
+	exported, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.Contains(res.Header.Get("Content-Disposition"), `filename="Forklift safety.imscc"`) {
+		t.Fatalf("Expected the cartridge, got %d %q", res.StatusCode, res.Header.Get("Content-Disposition"))
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "forklift.imscc")
+	part.Write(exported)
+	form.Close()
+
+	res = send(instructor, http.MethodPost, "/api/courses/import/cartridge", &body, form.FormDataContentType())
+	result := struct {
+		Course  map[string]any `json:"course"`
+		Lessons int            `json:"lessons"`
+		Skipped []string       `json:"skipped"`
+	}{}
+	json.NewDecoder(res.Body).Decode(&result)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || result.Lessons != 2 || result.Course["owner"] != instructor.Id || result.Course["organization"] != testOrg1 {
+		t.Errorf("Expected the instructor to import the course, got %d %+v", res.StatusCode, result)
+	}
+
+	res = send(instructor, http.MethodPost, "/api/courses/import/cartridge", strings.NewReader("{}"), "application/json")
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without cartridge, got %d", res.StatusCode)
+	}
+}
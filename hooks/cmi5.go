@@ -0,0 +1,470 @@
+package hooks
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/google/uuid"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+// cmi5 launch modes of the AU sessions.
+const (
+	Cmi5LaunchModeNormal = "Normal"
+	Cmi5LaunchModeBrowse = "Browse"
+	Cmi5LaunchModeReview = "Review"
+)
+
+// cmi5 moveOn criteria of the assignable units.
+const (
+	Cmi5MoveOnPassed             = "Passed"
+	Cmi5MoveOnCompleted          = "Completed"
+	Cmi5MoveOnCompletedAndPassed = "CompletedAndPassed"
+	Cmi5MoveOnCompletedOrPassed  = "CompletedOrPassed"
+	Cmi5MoveOnNotApplicable      = "NotApplicable"
+)
+
+// cmi5 launch methods of the assignable units.
+const (
+	Cmi5LaunchMethodAnyWindow = "AnyWindow"
+	Cmi5LaunchMethodOwnWindow = "OwnWindow"
+)
+
+const (
+	cmi5StructureName = "cmi5.xml"
+	cmi5MaxAUs        = 1000
+	// AU sessions can authenticate to the LRS and get their files for this long
+	cmi5SessionTTL        = 24 * time.Hour
+	cmi5SessionStoreKey   = "elesson.cmi5Session"
+	cmi5LaunchDataStateID = "LMS.LaunchData"
+)
+
+var (
+	ErrCmi5InvalidPackage = errors.New("invalid cmi5 package")
+	ErrCmi5UnknownAU      = errors.New("unknown cmi5 assignable unit")
+	ErrCmi5NoOrganization = errors.New("cmi5 lessons require the course to belong to an organization")
+	ErrCmi5Rejected       = errors.New("statement rejected by the cmi5 session")
+)
+
+// cmi5Node is an element of a cmi5 course structure: the root, the course,
+// a block or an AU. Elements are matched regardless of their namespace.
+type cmi5Node struct {
+	XMLName          xml.Name
+	ID               string     `xml:"id,attr"`
+	MoveOn           string     `xml:"moveOn,attr"`
+	MasteryScore     string     `xml:"masteryScore,attr"`
+	LaunchMethod     string     `xml:"launchMethod,attr"`
+	Titles           []string   `xml:"title>langstring"`
+	URL              string     `xml:"url"`
+	LaunchParameters string     `xml:"launchParameters"`
+	Children         []cmi5Node `xml:",any"`
+}
+
+// Cmi5Structure is the validated course structure of a cmi5 lesson, stored
+// in its cmi5_structure field.
+type Cmi5Structure struct {
+	// ID is the publisher id of the cmi5 course.
+	ID     string      `json:"id"`
+	Title  string      `json:"title"`
+	Blocks []Cmi5Block `json:"blocks,omitempty"`
+	AUs    []Cmi5AU    `json:"aus"`
+}
+
+// Cmi5Block is a block of AUs, satisfied once all its AUs are.
+type Cmi5Block struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// Cmi5AU is an assignable unit of a cmi5 course.
+type Cmi5AU struct {
+	// ID is the publisher id of the AU.
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// URL is absolute, or relative to the package root.
+	URL              string   `json:"url"`
+	MoveOn           string   `json:"move_on"`
+	MasteryScore     *float64 `json:"mastery_score,omitempty"`
+	LaunchMethod     string   `json:"launch_method"`
+	LaunchParameters string   `json:"launch_parameters,omitempty"`
+	// Blocks are the ids of the enclosing blocks, outermost first.
+	Blocks []string `json:"blocks,omitempty"`
+}
+
+// Cmi5Package is a validated cmi5 package: a zip with cmi5.xml at its root,
+// or a course structure alone when the AUs are hosted elsewhere.
+type Cmi5Package struct {
+	Structure Cmi5Structure
+
+	files []*zip.File
+}
+
+func cmi5Invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrCmi5InvalidPackage, fmt.Sprintf(format, args...))
+}
+
+// ParseCmi5Package validates a cmi5 package or course structure.
+func ParseCmi5Package(r io.ReaderAt, size int64) (*Cmi5Package, error) {
+	signature := make([]byte, 4)
+	if _, err := r.ReadAt(signature, 0); err != nil && !errors.Is(err, io.EOF) {
+		return nil, cmi5Invalid("unreadable file")
+	}
+
+	pkg := &Cmi5Package{}
+	names := map[string]bool{}
+	var structureReader io.Reader
+
+	if bytes.Equal(signature, []byte("PK\x03\x04")) {
+		files, err := packageArchiveFiles(r, size, scormMaxSize)
+		if err != nil {
+			return nil, cmi5Invalid("%v", err)
+		}
+		pkg.files = files
+
+		for _, file := range files {
+			name, _ := packageFilePath(file.Name)
+			names[name] = true
+			if name == cmi5StructureName {
+				reader, err := file.Open()
+				if err != nil {
+					return nil, cmi5Invalid("unreadable %s", cmi5StructureName)
+				}
+				defer reader.Close()
+				structureReader = reader
+			}
+		}
+		if structureReader == nil {
+			return nil, cmi5Invalid("missing %s at the root of the archive", cmi5StructureName)
+		}
+	} else {
+		structureReader = io.NewSectionReader(r, 0, size)
+	}
+
+	root := cmi5Node{}
+	if err := xml.NewDecoder(io.LimitReader(structureReader, 10<<20)).Decode(&root); err != nil {
+		return nil, cmi5Invalid("malformed course structure: %v", err)
+	}
+	if root.XMLName.Local != "courseStructure" {
+		return nil, cmi5Invalid("not a cmi5 course structure")
+	}
+
+	ids := map[string]bool{}
+	var walk func(nodes []cmi5Node, blocks []string) error
+	walk = func(nodes []cmi5Node, blocks []string) error {
+		for _, node := range nodes {
+			switch node.XMLName.Local {
+			case "course":
+				if pkg.Structure.ID != "" || len(blocks) > 0 {
+					return cmi5Invalid("unexpected course element")
+				}
+				if !isXapiIRI(node.ID) {
+					return cmi5Invalid("the course id must be an IRI")
+				}
+				pkg.Structure.ID = node.ID
+				pkg.Structure.Title = cmi5Title(node)
+			case "block":
+				if !isXapiIRI(node.ID) || ids[node.ID] {
+					return cmi5Invalid("block ids must be unique IRIs, got %q", node.ID)
+				}
+				ids[node.ID] = true
+				pkg.Structure.Blocks = append(pkg.Structure.Blocks, Cmi5Block{ID: node.ID, Title: cmi5Title(node)})
+				if err := walk(node.Children, append(slices.Clone(blocks), node.ID)); err != nil {
+					return err
+				}
+			case "au":
+				if !isXapiIRI(node.ID) || ids[node.ID] {
+					return cmi5Invalid("AU ids must be unique IRIs, got %q", node.ID)
+				}
+				ids[node.ID] = true
+				au, err := cmi5ParseAU(node, names, pkg.files != nil)
+				if err != nil {
+					return err
+				}
+				au.Blocks = blocks
+				pkg.Structure.AUs = append(pkg.Structure.AUs, au)
+				if len(pkg.Structure.AUs) > cmi5MaxAUs {
+					return cmi5Invalid("more than %d AUs", cmi5MaxAUs)
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(root.Children, nil); err != nil {
+		return nil, err
+	}
+
+	if pkg.Structure.ID == "" {
+		return nil, cmi5Invalid("missing course element")
+	}
+	if len(pkg.Structure.AUs) == 0 {
+		return nil, cmi5Invalid("no AU")
+	}
+
+	return pkg, nil
+}
+
+// cmi5ParseAU validates an AU of a course structure. The relative URLs must
+// point to a file of the package.
+func cmi5ParseAU(node cmi5Node, names map[string]bool, packaged bool) (Cmi5AU, error) {
+	au := Cmi5AU{
+		ID:               node.ID,
+		Title:            cmi5Title(node),
+		URL:              strings.TrimSpace(node.URL),
+		MoveOn:           node.MoveOn,
+		LaunchMethod:     node.LaunchMethod,
+		LaunchParameters: strings.TrimSpace(node.LaunchParameters),
+	}
+
+	switch au.MoveOn {
+	case "":
+		au.MoveOn = Cmi5MoveOnNotApplicable
+	case Cmi5MoveOnPassed, Cmi5MoveOnCompleted, Cmi5MoveOnCompletedAndPassed, Cmi5MoveOnCompletedOrPassed, Cmi5MoveOnNotApplicable:
+	default:
+		return au, cmi5Invalid("invalid moveOn %q of the AU %s", au.MoveOn, au.ID)
+	}
+
+	switch au.LaunchMethod {
+	case "":
+		au.LaunchMethod = Cmi5LaunchMethodAnyWindow
+	case Cmi5LaunchMethodAnyWindow, Cmi5LaunchMethodOwnWindow:
+	default:
+		return au, cmi5Invalid("invalid launchMethod %q of the AU %s", au.LaunchMethod, au.ID)
+	}
+
+	if node.MasteryScore != "" {
+		score, err := strconv.ParseFloat(node.MasteryScore, 64)
+		if err != nil || score < 0 || score > 1 {
+			return au, cmi5Invalid("the masteryScore of the AU %s must be between 0 and 1", au.ID)
+		}
+		au.MasteryScore = &score
+	}
+
+	parsed, err := url.Parse(au.URL)
+	switch {
+	case au.URL == "" || err != nil:
+		return au, cmi5Invalid("invalid url of the AU %s", au.ID)
+	case parsed.IsAbs():
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return au, cmi5Invalid("invalid url of the AU %s", au.ID)
+		}
+	case !packaged:
+		return au, cmi5Invalid("the url of the AU %s must be absolute without a package", au.ID)
+	default:
+		name, ok := packageFilePath(parsed.Path)
+		if !ok || !names[name] {
+			return au, cmi5Invalid("the launch file %q of the AU %s is missing", parsed.Path, au.ID)
+		}
+	}
+
+	return au, nil
+}
+
+// cmi5Title returns the first title of a course structure element.
+func cmi5Title(node cmi5Node) string {
+	for _, title := range node.Titles {
+		if title = strings.TrimSpace(title); title != "" {
+			return title
+		}
+	}
+	return ""
+}
+
+// cmi5LessonStructure returns the course structure of a cmi5 lesson.
+func cmi5LessonStructure(lesson *core.Record) (Cmi5Structure, bool) {
+	structure := Cmi5Structure{}
+	if lesson.GetString("cmi5_package") == "" || lesson.UnmarshalJSONField("cmi5_structure", &structure) != nil {
+		return structure, false
+	}
+	return structure, len(structure.AUs) > 0
+}
+
+// findAU returns an AU of the course structure by its publisher id.
+func (s Cmi5Structure) findAU(id string) (Cmi5AU, bool) {
+	for _, au := range s.AUs {
+		if au.ID == id {
+			return au, true
+		}
+	}
+	return Cmi5AU{}, false
+}
+
+// cmi5FilesPath returns the storage dir of the files extracted from the
+// current cmi5 package of a lesson.
+func cmi5FilesPath(lesson *core.Record, packageName string) string {
+	return lesson.BaseFilesPath() + "/cmi5_" + packageName
+}
+
+// cmi5ActivityID returns the activity id eLesson assigns to an AU or block of
+// a lesson, derived from its publisher id so that it's stable across uploads.
+func cmi5ActivityID(app core.App, lessonID, kind, publisherID string) string {
+	return strings.TrimRight(app.Settings().Meta.AppURL, "/") + "/xapi/activities/lessons/" + lessonID + "/" + kind + "/" +
+		uuid.NewSHA1(uuid.NameSpaceURL, []byte(publisherID)).String()
+}
+
+// cmi5ContentURL returns the URL of a lesson package file within an AU session.
+func cmi5ContentURL(lessonID, sessionID, name string) string {
+	return "/api/cmi5/" + lessonID + "/content/" + sessionID + "/" + name
+}
+
+func initCmi5Hooks(app core.App) {
+	// validate uploaded packages, then extract them once the lesson is saved
+	prepareCmi5Lesson := func(e *core.RecordEvent) error {
+		// the stored lesson, the original of a record saved more than once is outdated
+		stored := e.Record.Original()
+		if !e.Record.IsNew() {
+			if latest, err := e.App.FindRecordById(e.Record.Collection(), e.Record.Id); err == nil {
+				stored = latest
+			}
+		}
+		oldPackage := stored.GetString("cmi5_package")
+
+		var pkg *Cmi5Package
+		if files := e.Record.GetUnsavedFiles("cmi5_package"); len(files) > 0 {
+			if e.Record.GetString("scorm_package") != "" {
+				return validation.Errors{
+					"cmi5_package": validation.NewError("validation_conflicting_package", "The lesson already has a SCORM package."),
+				}
+			}
+
+			var err error
+			pkg, err = parsePackageFile(files[0], ParseCmi5Package)
+			if errors.Is(err, ErrCmi5InvalidPackage) {
+				return validation.Errors{
+					"cmi5_package": validation.NewError("validation_invalid_cmi5_package", err.Error()),
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			e.Record.Set("cmi5_structure", pkg.Structure)
+		} else if e.Record.GetString("cmi5_package") == "" {
+			e.Record.Set("cmi5_structure", nil)
+		} else {
+			// the course structure always comes from the package
+			e.Record.Set("cmi5_structure", stored.Get("cmi5_structure"))
+		}
+
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		if pkg != nil && len(pkg.files) > 0 {
+			if err := extractPackageFiles(e.App, cmi5FilesPath(e.Record, e.Record.GetString("cmi5_package")), pkg.files); err != nil {
+				return fmt.Errorf("failed to extract the cmi5 package: %w", err)
+			}
+		}
+
+		if oldPackage != "" && oldPackage != e.Record.GetString("cmi5_package") {
+			deletePackageFiles(e.App, e.Record, cmi5FilesPath(e.Record, oldPackage))
+		}
+
+		return nil
+	}
+
+	app.OnRecordCreate("lessons").BindFunc(prepareCmi5Lesson)
+	app.OnRecordUpdate("lessons").BindFunc(prepareCmi5Lesson)
+}
+
+func bindCmi5Routes(r *router.Router[*core.RequestEvent], courseService *CourseService) {
+	// the AUs of a lesson and their status for the user
+	r.GET("/api/cmi5/{lesson}", func(e *core.RequestEvent) error {
+		lesson, _, assigned, err := lessonPackageAccess(e, "cmi5_package")
+		if err != nil {
+			return err
+		}
+
+		status, err := courseService.Cmi5LessonStatus(lesson, e.Auth.Id, !assigned)
+		if err != nil {
+			return e.InternalServerError("Failed to get the cmi5 lesson status.", err)
+		}
+
+		return e.JSON(http.StatusOK, status)
+	}).Bind(apis.RequireAuth())
+
+	// start an AU session, tracked for the course assignees and browsed by its managers
+	r.POST("/api/cmi5/{lesson}/launch", func(e *core.RequestEvent) error {
+		data := struct {
+			AU        string `json:"au"`
+			ReturnURL string `json:"return_url"`
+		}{}
+		if err := e.BindBody(&data); err != nil {
+			return e.BadRequestError("Failed to read request data.", err)
+		}
+
+		lesson, course, assigned, err := lessonPackageAccess(e, "cmi5_package")
+		if err != nil {
+			return err
+		}
+
+		if data.ReturnURL != "" {
+			if parsed, err := url.Parse(data.ReturnURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+				return e.BadRequestError("The return URL must be an http(s) URL.", nil)
+			}
+		}
+
+		launch, err := courseService.WithActor(e.Auth.Id).LaunchCmi5AU(lesson, course, e.Auth, data.AU, data.ReturnURL, !assigned)
+		switch {
+		case errors.Is(err, ErrCmi5UnknownAU):
+			return e.NotFoundError(err.Error(), nil)
+		case errors.Is(err, ErrCmi5NoOrganization):
+			return e.BadRequestError(err.Error(), nil)
+		case err != nil:
+			return e.InternalServerError("Failed to launch the cmi5 AU.", err)
+		}
+
+		return e.JSON(http.StatusOK, launch)
+	}).Bind(apis.RequireAuth())
+
+	// exchange the one-time fetch token of a session for its LRS auth token
+	r.POST("/api/cmi5/sessions/fetch/{token}", func(e *core.RequestEvent) error {
+		authToken, err := FetchCmi5AuthToken(e.App, e.Request.PathValue("token"))
+		if err != nil {
+			// the error format is defined by the cmi5 spec
+			code, text := "3", "General Application Error"
+			if errors.Is(err, ErrCmi5FetchUsed) {
+				code, text = "1", "Already in use"
+			}
+			return e.JSON(http.StatusForbidden, map[string]string{"error-code": code, "error-text": text})
+		}
+
+		return e.JSON(http.StatusOK, map[string]string{"auth-token": authToken})
+	})
+
+	// serve the extracted package files to a launched AU
+	r.GET("/api/cmi5/{lesson}/content/{session}/{path...}", func(e *core.RequestEvent) error {
+		name, ok := packageFilePath(e.Request.PathValue("path"))
+		if !ok {
+			return e.NotFoundError("", nil)
+		}
+
+		session, err := findCmi5Session(e.App, e.Request.PathValue("session"))
+		if err != nil {
+			return e.NotFoundError("", err)
+		}
+		registration, err := e.App.FindRecordById("cmi5_registrations", session.GetString("registration"))
+		if err != nil || registration.GetString("lesson") != e.Request.PathValue("lesson") {
+			return e.NotFoundError("", err)
+		}
+
+		lesson, err := e.App.FindRecordById("lessons", registration.GetString("lesson"))
+		if err != nil || lesson.GetString("cmi5_package") == "" {
+			return e.NotFoundError("", err)
+		}
+
+		return servePackageFile(e, cmi5FilesPath(lesson, lesson.GetString("cmi5_package")), name, "")
+	})
+}
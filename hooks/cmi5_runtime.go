@@ -0,0 +1,759 @@
+package hooks
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// cmi5 defined verbs, beyond the xAPI verbs eLesson emits.
+const (
+	Cmi5VerbInitialized = "http://adlnet.gov/expapi/verbs/initialized"
+	Cmi5VerbFailed      = "http://adlnet.gov/expapi/verbs/failed"
+	Cmi5VerbTerminated  = "http://adlnet.gov/expapi/verbs/terminated"
+	Cmi5VerbSatisfied   = "https://w3id.org/xapi/adl/verbs/satisfied"
+)
+
+const (
+	cmi5CategoryCmi5       = "https://w3id.org/xapi/cmi5/context/categories/cmi5"
+	cmi5CategoryMoveOn     = "https://w3id.org/xapi/cmi5/context/categories/moveon"
+	cmi5ExtensionPrefix    = "https://w3id.org/xapi/cmi5/context/extensions/"
+	cmi5ActivityTypePrefix = "https://w3id.org/xapi/cmi5/activitytype/"
+)
+
+var (
+	ErrCmi5FetchUsed      = errors.New("the cmi5 fetch URL was already used")
+	ErrCmi5FetchInvalid   = errors.New("invalid or expired cmi5 fetch URL")
+	ErrCmi5InvalidSession = errors.New("invalid or expired cmi5 session")
+)
+
+// Cmi5AUStatus is the outcome of an AU within a registration.
+type Cmi5AUStatus struct {
+	Completed bool     `json:"completed"`
+	Passed    bool     `json:"passed"`
+	Failed    bool     `json:"failed"`
+	Satisfied bool     `json:"satisfied"`
+	Score     *float64 `json:"score,omitempty"`
+}
+
+// Cmi5AUState is an AU of a lesson with its status for a learner.
+type Cmi5AUState struct {
+	ID           string `json:"id"`
+	Title        string `json:"title"`
+	MoveOn       string `json:"move_on"`
+	LaunchMethod string `json:"launch_method"`
+	Cmi5AUStatus
+}
+
+// Cmi5LessonStatus is the progress of a learner in a cmi5 lesson.
+type Cmi5LessonStatus struct {
+	Title        string        `json:"title"`
+	AUs          []Cmi5AUState `json:"aus"`
+	Satisfied    bool          `json:"satisfied"`
+	Preview      bool          `json:"preview"`
+	CourseStatus string        `json:"course_status,omitempty"`
+}
+
+// Cmi5Launch is the URL launching an AU session.
+type Cmi5Launch struct {
+	URL          string `json:"url"`
+	LaunchMethod string `json:"launch_method"`
+	LaunchMode   string `json:"launch_mode"`
+}
+
+// cmi5MoveOnSatisfied reports whether an AU status meets its moveOn criteria.
+func cmi5MoveOnSatisfied(moveOn string, status Cmi5AUStatus) bool {
+	switch moveOn {
+	case Cmi5MoveOnPassed:
+		return status.Passed
+	case Cmi5MoveOnCompleted:
+		return status.Completed
+	case Cmi5MoveOnCompletedAndPassed:
+		return status.Completed && status.Passed
+	case Cmi5MoveOnCompletedOrPassed:
+		return status.Completed || status.Passed
+	default:
+		return true
+	}
+}
+
+// cmi5Actor returns the agent of a user in cmi5 statements, identified by its
+// eLesson account as the cmi5 spec requires.
+func cmi5Actor(app core.App, user *core.Record) map[string]any {
+	name := user.GetString("name")
+	if name == "" {
+		name = user.Email()
+	}
+	return map[string]any{
+		"objectType": "Agent",
+		"name":       name,
+		"account": map[string]any{
+			"homePage": strings.TrimRight(app.Settings().Meta.AppURL, "/"),
+			"name":     user.Id,
+		},
+	}
+}
+
+// cmi5RegistrationStatuses returns the AU statuses of a registration by AU publisher id.
+func cmi5RegistrationStatuses(registration *core.Record) map[string]Cmi5AUStatus {
+	statuses := map[string]Cmi5AUStatus{}
+	if registration != nil {
+		_ = registration.UnmarshalJSONField("aus", &statuses)
+	}
+	return statuses
+}
+
+func findCmi5Registration(app core.App, lessonID, userID string) (*core.Record, error) {
+	return app.FindFirstRecordByFilter(
+		"cmi5_registrations",
+		"lesson = {:lesson} && assignee = {:assignee}",
+		dbx.Params{"lesson": lessonID, "assignee": userID},
+	)
+}
+
+func findOrCreateCmi5Registration(app core.App, lesson *core.Record, userID string) (*core.Record, error) {
+	registration, err := findCmi5Registration(app, lesson.Id, userID)
+	if err == nil {
+		return registration, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to find cmi5 registration: %w", err)
+	}
+
+	collection, err := app.FindCollectionByNameOrId("cmi5_registrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find cmi5_registrations collection: %w", err)
+	}
+
+	registration = core.NewRecord(collection)
+	registration.Set("lesson", lesson.Id)
+	registration.Set("course", lesson.GetString("course"))
+	registration.Set("assignee", userID)
+	registration.Set("registration", uuid.NewString())
+	registration.Set("aus", map[string]Cmi5AUStatus{})
+
+	if err := app.Save(registration); err != nil {
+		return nil, fmt.Errorf("failed to save cmi5 registration: %w", err)
+	}
+
+	return registration, nil
+}
+
+// findCmi5Session returns an AU session by its session id, unless expired.
+func findCmi5Session(app core.App, sessionID string) (*core.Record, error) {
+	session, err := app.FindFirstRecordByData("cmi5_sessions", "session_id", sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(session.GetDateTime("created").Time()) > cmi5SessionTTL {
+		return nil, ErrCmi5InvalidSession
+	}
+	return session, nil
+}
+
+// findCmi5SessionCredentials authenticates the LRS requests of an AU session
+// with the auth token returned by its fetch URL.
+func findCmi5SessionCredentials(app core.App, id, secret string) (*core.Record, error) {
+	session, err := app.FindRecordById("cmi5_sessions", id)
+	if err != nil {
+		return nil, err
+	}
+	if session.GetString("secret_hash") == "" || session.GetString("secret_hash") != HashXapiSecret(secret) ||
+		time.Since(session.GetDateTime("created").Time()) > cmi5SessionTTL {
+		return nil, ErrCmi5InvalidSession
+	}
+	return session, nil
+}
+
+// FetchCmi5AuthToken exchanges the token of a session fetch URL for the
+// Basic auth token of the session LRS requests. A fetch URL can only be used once.
+func FetchCmi5AuthToken(app core.App, fetchToken string) (string, error) {
+	secret := security.RandomString(40)
+	var sessionID string
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		session, err := txApp.FindFirstRecordByData("cmi5_sessions", "fetch_token_hash", HashXapiSecret(fetchToken))
+		if err != nil || time.Since(session.GetDateTime("created").Time()) > cmi5SessionTTL {
+			return ErrCmi5FetchInvalid
+		}
+		if session.GetBool("fetched") {
+			return ErrCmi5FetchUsed
+		}
+
+		session.Set("fetched", true)
+		session.Set("secret_hash", HashXapiSecret(secret))
+		if err := txApp.Save(session); err != nil {
+			return fmt.Errorf("failed to save cmi5 session: %w", err)
+		}
+
+		sessionID = session.Id
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(sessionID + ":" + secret)), nil
+}
+
+// cmi5Context is an AU session with the records it belongs to.
+type cmi5Context struct {
+	session      *core.Record
+	registration *core.Record
+	lesson       *core.Record
+	course       *core.Record
+	user         *core.Record
+	structure    Cmi5Structure
+	au           Cmi5AU
+	statuses     map[string]Cmi5AUStatus
+}
+
+func loadCmi5Context(app core.App, session *core.Record) (*cmi5Context, error) {
+	c := &cmi5Context{session: session}
+
+	var err error
+	if c.registration, err = app.FindRecordById("cmi5_registrations", session.GetString("registration")); err != nil {
+		return nil, fmt.Errorf("failed to find cmi5 registration: %w", err)
+	}
+	if c.lesson, err = app.FindRecordById("lessons", c.registration.GetString("lesson")); err != nil {
+		return nil, fmt.Errorf("failed to find lesson: %w", err)
+	}
+	if c.course, err = app.FindRecordById("courses", c.registration.GetString("course")); err != nil {
+		return nil, fmt.Errorf("failed to find course: %w", err)
+	}
+	if c.user, err = app.FindRecordById("users", c.registration.GetString("assignee")); err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	structure, ok := cmi5LessonStructure(c.lesson)
+	if !ok {
+		return nil, fmt.Errorf("%w: the lesson has no cmi5 package", ErrCmi5UnknownAU)
+	}
+	c.structure = structure
+	if c.au, ok = structure.findAU(session.GetString("au")); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCmi5UnknownAU, session.GetString("au"))
+	}
+	c.statuses = cmi5RegistrationStatuses(c.registration)
+
+	return c, nil
+}
+
+func (c *cmi5Context) activityID(app core.App) string {
+	return cmi5ActivityID(app, c.lesson.Id, "aus", c.au.ID)
+}
+
+// statement builds a cmi5 defined statement of the session about an activity
+// of the course structure, identified by its publisher id.
+func (c *cmi5Context) statement(app core.App, verb string, activityID, publisherID, activityType string, result map[string]any) XapiStatement {
+	statement := XapiStatement{
+		"actor": cmi5Actor(app, c.user),
+		"verb": map[string]any{
+			"id":      verb,
+			"display": map[string]string{"en-US": xapiVerbDisplay[verb]},
+		},
+		"object": map[string]any{
+			"objectType": "Activity",
+			"id":         activityID,
+			"definition": map[string]any{"type": cmi5ActivityTypePrefix + activityType},
+		},
+		"context": map[string]any{
+			"registration": c.registration.GetString("registration"),
+			"contextActivities": map[string]any{
+				"category": []any{map[string]any{"id": cmi5CategoryCmi5}},
+				"grouping": []any{map[string]any{"id": publisherID}},
+			},
+			"extensions": map[string]any{cmi5ExtensionPrefix + "sessionid": c.session.GetString("session_id")},
+		},
+	}
+	if result != nil {
+		statement["result"] = result
+	}
+	return statement
+}
+
+// storeStatement stores a statement eLesson makes about the session,
+// round tripped through JSON so that it's stored like received ones.
+func (c *cmi5Context) storeStatement(app core.App, statement XapiStatement) error {
+	raw, err := json.Marshal(statement)
+	if err != nil {
+		return fmt.Errorf("failed to serialize xAPI statement: %w", err)
+	}
+	statement = XapiStatement{}
+	if err := json.Unmarshal(raw, &statement); err != nil {
+		return fmt.Errorf("failed to serialize xAPI statement: %w", err)
+	}
+
+	_, err = StoreXapiStatement(app, c.session.GetString("organization"), statement, xapiAuthority(app))
+	return err
+}
+
+// Cmi5LessonStatus returns the AUs of a cmi5 lesson with their status for a user.
+func (cs *CourseService) Cmi5LessonStatus(lesson *core.Record, userID string, preview bool) (*Cmi5LessonStatus, error) {
+	structure, _ := cmi5LessonStructure(lesson)
+
+	registration, err := findCmi5Registration(cs.app, lesson.Id, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to find cmi5 registration: %w", err)
+	}
+	statuses := cmi5RegistrationStatuses(registration)
+
+	status := &Cmi5LessonStatus{
+		Title:     structure.Title,
+		AUs:       make([]Cmi5AUState, 0, len(structure.AUs)),
+		Satisfied: registration != nil && registration.GetBool("satisfied"),
+		Preview:   preview,
+	}
+	for _, au := range structure.AUs {
+		status.AUs = append(status.AUs, Cmi5AUState{
+			ID:           au.ID,
+			Title:        au.Title,
+			MoveOn:       au.MoveOn,
+			LaunchMethod: au.LaunchMethod,
+			Cmi5AUStatus: statuses[au.ID],
+		})
+	}
+
+	if progressRecord, err := cs.app.FindFirstRecordByFilter(
+		"progress",
+		"course = {:course} && assignee = {:assignee}",
+		dbx.Params{"course": lesson.GetString("course"), "assignee": userID},
+	); err == nil {
+		status.CourseStatus = progressRecord.GetString("status")
+	}
+
+	return status, nil
+}
+
+// LaunchCmi5AU starts a session of an AU for a user: it records the launch
+// data and the launched statement, and returns the URL handing the LRS
+// endpoint, the fetch URL, the actor and the registration to the AU.
+// Previews are launched in Browse mode, which doesn't track the learner.
+func (cs *CourseService) LaunchCmi5AU(lesson, course, user *core.Record, auID, returnURL string, preview bool) (*Cmi5Launch, error) {
+	structure, _ := cmi5LessonStructure(lesson)
+	au, ok := structure.findAU(auID)
+	if !ok {
+		return nil, ErrCmi5UnknownAU
+	}
+
+	organizationID := course.GetString("organization")
+	if organizationID == "" {
+		return nil, ErrCmi5NoOrganization
+	}
+
+	appURL := strings.TrimRight(cs.app.Settings().Meta.AppURL, "/")
+	fetchToken := security.RandomString(40)
+	launch := &Cmi5Launch{LaunchMethod: au.LaunchMethod, LaunchMode: Cmi5LaunchModeNormal}
+	if preview {
+		launch.LaunchMode = Cmi5LaunchModeBrowse
+	}
+
+	err := cs.app.RunInTransaction(func(txApp core.App) error {
+		txService := cs.withApp(txApp)
+
+		registration, err := findOrCreateCmi5Registration(txApp, lesson, user.Id)
+		if err != nil {
+			return err
+		}
+
+		if !preview {
+			if _, err := txService.advancePackageProgress(course.Id, user.Id, StatusInProgress, ProgressSourceCmi5); err != nil {
+				return err
+			}
+		}
+
+		sessions, err := txApp.FindCollectionByNameOrId("cmi5_sessions")
+		if err != nil {
+			return fmt.Errorf("failed to find cmi5_sessions collection: %w", err)
+		}
+		session := core.NewRecord(sessions)
+		session.Set("registration", registration.Id)
+		session.Set("organization", organizationID)
+		session.Set("au", au.ID)
+		session.Set("session_id", uuid.NewString())
+		session.Set("launch_mode", launch.LaunchMode)
+		session.Set("fetch_token_hash", HashXapiSecret(fetchToken))
+		if err := txApp.Save(session); err != nil {
+			return fmt.Errorf("failed to save cmi5 session: %w", err)
+		}
+
+		c := &cmi5Context{
+			session:      session,
+			registration: registration,
+			lesson:       lesson,
+			course:       course,
+			user:         user,
+			structure:    structure,
+			au:           au,
+			statuses:     cmi5RegistrationStatuses(registration),
+		}
+		activityID := c.activityID(txApp)
+		actor := cmi5Actor(txApp, user)
+		actorIFI, _ := XapiAgentIFI(actor)
+
+		auURL := au.URL
+		if parsed, err := url.Parse(au.URL); err == nil && !parsed.IsAbs() {
+			auURL = appURL + cmi5ContentURL(lesson.Id, session.GetString("session_id"), au.URL)
+		}
+
+		// the launch data the AU reads from the state API
+		launchData := map[string]any{
+			"contextTemplate": map[string]any{
+				"contextActivities": map[string]any{
+					"grouping": []any{map[string]any{"id": au.ID}},
+				},
+				"extensions": map[string]any{cmi5ExtensionPrefix + "sessionid": session.GetString("session_id")},
+			},
+			"launchMode":   launch.LaunchMode,
+			"launchMethod": au.LaunchMethod,
+			"moveOn":       au.MoveOn,
+		}
+		if au.MasteryScore != nil {
+			launchData["masteryScore"] = *au.MasteryScore
+		}
+		if au.LaunchParameters != "" {
+			launchData["launchParameters"] = au.LaunchParameters
+		}
+		if returnURL != "" {
+			launchData["returnURL"] = returnURL
+		}
+		rawLaunchData, err := json.Marshal(launchData)
+		if err != nil {
+			return fmt.Errorf("failed to serialize the launch data: %w", err)
+		}
+		err = saveXapiState(txApp, xapiStateKey{
+			Organization: organizationID,
+			ActivityID:   activityID,
+			AgentIFI:     actorIFI,
+			Registration: registration.GetString("registration"),
+			StateID:      cmi5LaunchDataStateID,
+		}, "application/json", rawLaunchData)
+		if err != nil {
+			return err
+		}
+
+		launched := c.statement(txApp, XapiVerbLaunched, activityID, au.ID, "au", nil)
+		extensions := launched["context"].(map[string]any)["extensions"].(map[string]any)
+		extensions[cmi5ExtensionPrefix+"launchmode"] = launch.LaunchMode
+		extensions[cmi5ExtensionPrefix+"launchurl"] = auURL
+		extensions[cmi5ExtensionPrefix+"moveon"] = au.MoveOn
+		if au.LaunchParameters != "" {
+			extensions[cmi5ExtensionPrefix+"launchparameters"] = au.LaunchParameters
+		}
+		if err := c.storeStatement(txApp, launched); err != nil {
+			return err
+		}
+
+		// AUs without moveOn criteria are satisfied by their first launch
+		if launch.LaunchMode == Cmi5LaunchModeNormal && au.MoveOn == Cmi5MoveOnNotApplicable && !c.statuses[au.ID].Satisfied {
+			if err := txService.WithActor(user.Id).satisfyCmi5AU(c); err != nil {
+				return err
+			}
+		}
+
+		rawActor, err := json.Marshal(actor)
+		if err != nil {
+			return fmt.Errorf("failed to serialize the actor: %w", err)
+		}
+		params := url.Values{
+			"endpoint":     {appURL + "/xapi/"},
+			"fetch":        {appURL + "/api/cmi5/sessions/fetch/" + fetchToken},
+			"actor":        {string(rawActor)},
+			"registration": {registration.GetString("registration")},
+			"activityId":   {activityID},
+		}
+		separator := "?"
+		if strings.Contains(auURL, "?") {
+			separator = "&"
+		}
+		launch.URL = auURL + separator + params.Encode()
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return launch, nil
+}
+
+// cmi5Reject wraps a cmi5 rule violation into ErrCmi5Rejected.
+func cmi5Reject(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrCmi5Rejected, fmt.Sprintf(format, args...))
+}
+
+// StoreCmi5Statement stores a statement sent by an AU session. The cmi5
+// defined statements must follow the session lifecycle (initialized first,
+// terminated last), and their completed, passed and failed outcomes are
+// recorded in the registration, satisfying the AU once its moveOn criteria
+// are met.
+func (cs *CourseService) StoreCmi5Statement(session *core.Record, statement XapiStatement) (string, error) {
+	if err := validateXapiStatement(statement, false); err != nil {
+		return "", err
+	}
+
+	var id string
+	err := cs.app.RunInTransaction(func(txApp core.App) error {
+		// the session may have changed since the request was authenticated
+		session, err := txApp.FindRecordById("cmi5_sessions", session.Id)
+		if err != nil {
+			return fmt.Errorf("failed to find cmi5 session: %w", err)
+		}
+
+		c, err := loadCmi5Context(txApp, session)
+		if err != nil {
+			return err
+		}
+		txService := cs.withApp(txApp).WithActor(c.user.Id)
+
+		// statements stored already are only checked against the stored ones
+		if statementID, _ := statement["id"].(string); statementID != "" {
+			if _, err := txApp.FindFirstRecordByData("xapi_statements", "statement_id", strings.ToLower(statementID)); err == nil {
+				id, err = StoreXapiStatement(txApp, session.GetString("organization"), statement, xapiAuthority(txApp))
+				return err
+			}
+		}
+
+		changed, err := c.applyStatement(txApp, statement)
+		if err != nil {
+			return err
+		}
+
+		id, err = StoreXapiStatement(txApp, session.GetString("organization"), statement, xapiAuthority(txApp))
+		if err != nil {
+			return err
+		}
+
+		if err := txApp.Save(session); err != nil {
+			return fmt.Errorf("failed to save cmi5 session: %w", err)
+		}
+
+		if !changed {
+			return nil
+		}
+
+		c.registration.Set("aus", c.statuses)
+		if err := txApp.Save(c.registration); err != nil {
+			return fmt.Errorf("failed to save cmi5 registration: %w", err)
+		}
+
+		if status := c.statuses[c.au.ID]; !status.Satisfied && cmi5MoveOnSatisfied(c.au.MoveOn, status) {
+			return txService.satisfyCmi5AU(c)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// applyStatement checks a statement against the session and applies the
+// cmi5 defined ones to the session and AU status, reporting whether the
+// status changed.
+func (c *cmi5Context) applyStatement(app core.App, statement XapiStatement) (bool, error) {
+	actorIFI, _ := XapiAgentIFI(statement["actor"].(map[string]any))
+	expectedIFI, _ := XapiAgentIFI(cmi5Actor(app, c.user))
+	if actorIFI != expectedIFI {
+		return false, cmi5Reject("the actor must be the launched learner")
+	}
+
+	context, _ := statement["context"].(map[string]any)
+	if registration, _ := context["registration"].(string); !strings.EqualFold(registration, c.registration.GetString("registration")) {
+		return false, cmi5Reject("the registration must be the one of the session")
+	}
+
+	if c.session.GetBool("terminated") {
+		return false, cmi5Reject("the session is terminated")
+	}
+
+	verb := statement["verb"].(map[string]any)["id"]
+	contextActivities, _ := context["contextActivities"].(map[string]any)
+	categories, _ := contextActivities["category"].([]any)
+	defined := slices.ContainsFunc(categories, func(category any) bool {
+		categoryMap, _ := category.(map[string]any)
+		return categoryMap["id"] == cmi5CategoryCmi5
+	})
+
+	if !c.session.GetBool("initialized") && !(defined && verb == Cmi5VerbInitialized) {
+		return false, cmi5Reject("the first statement of a session must be initialized")
+	}
+	if !defined {
+		return false, nil
+	}
+
+	object, _ := statement["object"].(map[string]any)
+	if object["id"] != c.activityID(app) {
+		return false, cmi5Reject("the object must be the launched AU")
+	}
+	extensions, _ := context["extensions"].(map[string]any)
+	if extensions[cmi5ExtensionPrefix+"sessionid"] != c.session.GetString("session_id") {
+		return false, cmi5Reject("the session id must be the one of the session")
+	}
+
+	status := c.statuses[c.au.ID]
+	judged := verb == XapiVerbCompleted || verb == XapiVerbPassed || verb == Cmi5VerbFailed
+	if judged && c.session.GetString("launch_mode") != Cmi5LaunchModeNormal {
+		return false, cmi5Reject("completed, passed and failed statements require the Normal launch mode")
+	}
+
+	var scaled *float64
+	if result, ok := statement["result"].(map[string]any); ok {
+		if score, ok := result["score"].(map[string]any); ok {
+			if value, ok := score["scaled"].(float64); ok {
+				scaled = &value
+			}
+		}
+	}
+
+	switch verb {
+	case Cmi5VerbInitialized:
+		if c.session.GetBool("initialized") {
+			return false, cmi5Reject("the session is initialized already")
+		}
+		c.session.Set("initialized", true)
+		return false, nil
+	case Cmi5VerbTerminated:
+		c.session.Set("terminated", true)
+		return false, nil
+	case XapiVerbCompleted:
+		if status.Completed {
+			return false, cmi5Reject("the AU is completed already")
+		}
+		status.Completed = true
+	case XapiVerbPassed:
+		if status.Passed {
+			return false, cmi5Reject("the AU is passed already")
+		}
+		if mastery := c.au.MasteryScore; mastery != nil && (scaled == nil || *scaled < *mastery) {
+			return false, cmi5Reject("passed requires a scaled score of at least %g", *mastery)
+		}
+		status.Passed, status.Failed = true, false
+		if scaled != nil {
+			status.Score = scaled
+		}
+	case Cmi5VerbFailed:
+		if status.Passed {
+			return false, cmi5Reject("the AU is passed already")
+		}
+		if mastery := c.au.MasteryScore; mastery != nil && (scaled == nil || *scaled >= *mastery) {
+			return false, cmi5Reject("failed requires a scaled score below %g", *mastery)
+		}
+		status.Failed = true
+		if scaled != nil {
+			status.Score = scaled
+		}
+	default:
+		return false, cmi5Reject("%v is not a cmi5 defined verb", verb)
+	}
+
+	c.statuses[c.au.ID] = status
+	return true, nil
+}
+
+// cmi5Satisfied reports whether an AU meets its moveOn criteria, AUs without
+// criteria always do.
+func (c *cmi5Context) cmi5Satisfied(au Cmi5AU) bool {
+	return au.MoveOn == Cmi5MoveOnNotApplicable || c.statuses[au.ID].Satisfied
+}
+
+// satisfyCmi5AU records that the AU of the session met its moveOn criteria,
+// with the satisfied statements of the AU and of the blocks and course it
+// completes. Once the whole course is satisfied, the lesson is completed and
+// the course progress follows.
+func (cs *CourseService) satisfyCmi5AU(c *cmi5Context) error {
+	status := c.statuses[c.au.ID]
+	status.Satisfied = true
+	c.statuses[c.au.ID] = status
+
+	c.registration.Set("aus", c.statuses)
+	if err := cs.app.Save(c.registration); err != nil {
+		return fmt.Errorf("failed to save cmi5 registration: %w", err)
+	}
+
+	satisfied := func(activityID, publisherID, activityType string) error {
+		statement := c.statement(cs.app, Cmi5VerbSatisfied, activityID, publisherID, activityType, nil)
+		categories := statement["context"].(map[string]any)["contextActivities"].(map[string]any)
+		categories["category"] = append(categories["category"].([]any), map[string]any{"id": cmi5CategoryMoveOn})
+		return c.storeStatement(cs.app, statement)
+	}
+
+	if err := satisfied(c.activityID(cs.app), c.au.ID, "au"); err != nil {
+		return err
+	}
+
+	// the enclosing blocks, innermost first, are satisfied once all their AUs are
+	for i := len(c.au.Blocks) - 1; i >= 0; i-- {
+		block := c.au.Blocks[i]
+		complete := true
+		for _, au := range c.structure.AUs {
+			if slices.Contains(au.Blocks, block) && !c.cmi5Satisfied(au) {
+				complete = false
+				break
+			}
+		}
+		if !complete {
+			return nil
+		}
+		if err := satisfied(cmi5ActivityID(cs.app, c.lesson.Id, "blocks", block), block, "block"); err != nil {
+			return err
+		}
+	}
+
+	if c.registration.GetBool("satisfied") {
+		return nil
+	}
+	for _, au := range c.structure.AUs {
+		if !c.cmi5Satisfied(au) {
+			return nil
+		}
+	}
+
+	c.registration.Set("satisfied", true)
+	if err := cs.app.Save(c.registration); err != nil {
+		return fmt.Errorf("failed to save cmi5 registration: %w", err)
+	}
+
+	lessonActivity := xapiActivity(cs.app, c.lesson, XapiActivityLesson)
+	if err := satisfied(lessonActivity["id"].(string), c.structure.ID, "course"); err != nil {
+		return err
+	}
+
+	// the AU reports its own passed and failed statements
+	if err := cs.completePackageLesson(c.lesson, c.user.Id, nil); err != nil {
+		return err
+	}
+	_, err := cs.advancePackageProgress(c.course.Id, c.user.Id, "", ProgressSourceCmi5)
+	return err
+}
+
+// cmi5StateAllowed checks that an AU session only accesses the state of its
+// AU, learner and registration, and doesn't change its launch data.
+func cmi5StateAllowed(app core.App, session *core.Record, key xapiStateKey, write bool) error {
+	c, err := loadCmi5Context(app, session)
+	if err != nil {
+		return err
+	}
+
+	actorIFI, _ := XapiAgentIFI(cmi5Actor(app, c.user))
+	switch {
+	case key.ActivityID != c.activityID(app) || key.AgentIFI != actorIFI:
+		return errors.New("cmi5 sessions can only access the state of their AU and learner")
+	case key.Registration != c.registration.GetString("registration"):
+		return errors.New("cmi5 sessions can only access the state of their registration")
+	case write && (key.StateID == "" || key.StateID == cmi5LaunchDataStateID):
+		return errors.New("the launch data can't be changed")
+	}
+	return nil
+}
@@ -0,0 +1,425 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+const testCmi5Structure = `<?xml version="1.0" encoding="utf-8"?>
+<courseStructure xmlns="https://w3id.org/xapi/profiles/cmi5/v1/CourseStructure.xsd">
+  <course id="https://example.com/courses/safety">
+    <title><langstring lang="en-US">Safety</langstring></title>
+    <description><langstring lang="en-US">Workplace safety</langstring></description>
+  </course>
+  <block id="https://example.com/courses/safety/basics">
+    <title><langstring lang="en-US">Basics</langstring></title>
+    <au id="https://example.com/courses/safety/quiz" moveOn="CompletedAndPassed" masteryScore="0.8">
+      <title><langstring lang="en-US">Quiz</langstring></title>
+      <url>quiz/index.html?lang=en</url>
+      <launchParameters>{"level": 1}</launchParameters>
+    </au>
+  </block>
+  <au id="https://example.com/courses/safety/video" launchMethod="OwnWindow">
+    <title><langstring lang="en-US">Video</langstring></title>
+    <url>https://media.example.com/safety/video.html</url>
+  </au>
+</courseStructure>`
+
+func TestParseCmi5Package(t *testing.T) {
+	archive := testScormZip(t, map[string]string{
+		"cmi5.xml":        testCmi5Structure,
+		"quiz/index.html": "<html>quiz</html>",
+	})
+	pkg, err := ParseCmi5Package(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("ParseCmi5Package failed: %v", err)
+	}
+
+	structure := pkg.Structure
+	if structure.ID != "https://example.com/courses/safety" || structure.Title != "Safety" || len(structure.Blocks) != 1 || len(structure.AUs) != 2 {
+		t.Fatalf("Unexpected course structure %+v", structure)
+	}
+	quiz, video := structure.AUs[0], structure.AUs[1]
+	if quiz.MoveOn != Cmi5MoveOnCompletedAndPassed || quiz.MasteryScore == nil || *quiz.MasteryScore != 0.8 ||
+		quiz.URL != "quiz/index.html?lang=en" || quiz.LaunchMethod != Cmi5LaunchMethodAnyWindow ||
+		quiz.LaunchParameters != `{"level": 1}` || len(quiz.Blocks) != 1 || quiz.Blocks[0] != "https://example.com/courses/safety/basics" {
+		t.Errorf("Unexpected quiz AU %+v", quiz)
+	}
+	if video.MoveOn != Cmi5MoveOnNotApplicable || video.LaunchMethod != Cmi5LaunchMethodOwnWindow || len(video.Blocks) != 0 {
+		t.Errorf("Unexpected video AU %+v", video)
+	}
+
+	// a course structure alone must only reference hosted AUs
+	hosted := strings.Replace(testCmi5Structure, "quiz/index.html?lang=en", "https://media.example.com/quiz.html", 1)
+	if _, err := ParseCmi5Package(strings.NewReader(hosted), int64(len(hosted))); err != nil {
+		t.Errorf("Expected a course structure with hosted AUs to be valid, got %v", err)
+	}
+
+	invalid := map[string][]byte{
+		"relative url without package": []byte(testCmi5Structure),
+		"missing launch file":          testScormZip(t, map[string]string{"cmi5.xml": testCmi5Structure}),
+		"missing structure":            testScormZip(t, map[string]string{"quiz/index.html": "quiz"}),
+		"invalid moveOn":               []byte(strings.Replace(hosted, "CompletedAndPassed", "Attempted", 1)),
+		"invalid masteryScore":         []byte(strings.Replace(hosted, `masteryScore="0.8"`, `masteryScore="80"`, 1)),
+		"duplicate ids":                []byte(strings.Replace(hosted, "safety/video", "safety/quiz", 1)),
+		"missing course":               []byte(strings.Replace(hosted, `<course id="https://example.com/courses/safety">`, `<other>`, 1)),
+		"not a course structure":       []byte(`<manifest/>`),
+	}
+	for name, content := range invalid {
+		if name == "missing course" {
+			content = bytes.Replace(content, []byte("</course>"), []byte("</other>"), 1)
+		}
+		if _, err := ParseCmi5Package(bytes.NewReader(content), int64(len(content))); !errors.Is(err, ErrCmi5InvalidPackage) {
+			t.Errorf("%s: expected ErrCmi5InvalidPackage, got %v", name, err)
+		}
+	}
+}
+
+func TestCmi5MoveOnSatisfied(t *testing.T) {
+	tests := []struct {
+		moveOn    string
+		status    Cmi5AUStatus
+		satisfied bool
+	}{
+		{Cmi5MoveOnCompleted, Cmi5AUStatus{Completed: true}, true},
+		{Cmi5MoveOnCompleted, Cmi5AUStatus{Passed: true}, false},
+		{Cmi5MoveOnPassed, Cmi5AUStatus{Passed: true}, true},
+		{Cmi5MoveOnPassed, Cmi5AUStatus{Completed: true, Failed: true}, false},
+		{Cmi5MoveOnCompletedAndPassed, Cmi5AUStatus{Completed: true}, false},
+		{Cmi5MoveOnCompletedAndPassed, Cmi5AUStatus{Completed: true, Passed: true}, true},
+		{Cmi5MoveOnCompletedOrPassed, Cmi5AUStatus{Passed: true}, true},
+		{Cmi5MoveOnCompletedOrPassed, Cmi5AUStatus{Failed: true}, false},
+		{Cmi5MoveOnNotApplicable, Cmi5AUStatus{}, true},
+	}
+
+	for _, tt := range tests {
+		if satisfied := cmi5MoveOnSatisfied(tt.moveOn, tt.status); satisfied != tt.satisfied {
+			t.Errorf("cmi5MoveOnSatisfied(%s, %+v) = %v; expected %v", tt.moveOn, tt.status, satisfied, tt.satisfied)
+		}
+	}
+}
+
+func TestCmi5Lesson(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	learner := createTestLearner(t, app)
+	initCmi5Hooks(app)
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatalf("Failed to find users collection: %v", err)
+	}
+
+	learner.Set("organization", testOrg1)
+	if err := app.Save(learner); err != nil {
+		t.Fatalf("Failed to save learner: %v", err)
+	}
+
+	instructor := core.NewRecord(users)
+	instructor.SetEmail("instructor@example.com")
+	instructor.SetPassword("1234567890")
+	instructor.Set("role", RoleInstructor)
+	instructor.Set("organization", testOrg1)
+	if err := app.Save(instructor); err != nil {
+		t.Fatalf("Failed to save instructor: %v", err)
+	}
+
+	course := createTestCourse(t, app, courses, "")
+	course.Set("owner", instructor.Id)
+	course.Set("organization", testOrg1)
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+	if err := service.EnrollUser(course.Id, learner.Id); err != nil {
+		t.Fatalf("EnrollUser failed: %v", err)
+	}
+
+	lessons, err := app.FindCollectionByNameOrId("lessons")
+	if err != nil {
+		t.Fatalf("Failed to find lessons collection: %v", err)
+	}
+
+	file, err := filesystem.NewFileFromBytes([]byte(testCmi5Structure), "cmi5.xml")
+	if err != nil {
+		t.Fatalf("Failed to create the package file: %v", err)
+	}
+	lesson := core.NewRecord(lessons)
+	lesson.Set("course", course.Id)
+	lesson.Set("title", "Safety")
+	lesson.Set("cmi5_package", file)
+	if err := app.Save(lesson); err == nil {
+		t.Fatal("Expected a course structure with packaged AUs to be rejected without the package")
+	}
+
+	file, err = filesystem.NewFileFromBytes(testScormZip(t, map[string]string{
+		"cmi5.xml":        testCmi5Structure,
+		"quiz/index.html": "<html>quiz</html>",
+	}), "safety.zip")
+	if err != nil {
+		t.Fatalf("Failed to create the package file: %v", err)
+	}
+	lesson.Set("cmi5_package", file)
+	lesson.Set("cmi5_structure", map[string]any{"id": "https://example.com/forged"})
+	if err := app.Save(lesson); err != nil {
+		t.Fatalf("Failed to save the cmi5 lesson: %v", err)
+	}
+	if structure, ok := cmi5LessonStructure(lesson); !ok || structure.ID != "https://example.com/courses/safety" {
+		t.Fatalf("Expected the course structure of the package, got %+v", structure)
+	}
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	bindXapiRoutes(r, service)
+	bindCmi5Routes(r, service)
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	appURL := strings.TrimRight(app.Settings().Meta.AppURL, "/")
+	send := func(user *core.Record, method, path string, body any, out any) int {
+		t.Helper()
+
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+		req, err := http.NewRequest(method, server.URL+strings.TrimPrefix(path, appURL), bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if user != nil {
+			token, err := user.NewAuthToken()
+			if err != nil {
+				t.Fatalf("Failed to create auth token: %v", err)
+			}
+			req.Header.Set("Authorization", token)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer res.Body.Close()
+
+		if out != nil {
+			if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+				t.Fatalf("Failed to decode %s %s response: %v", method, path, err)
+			}
+		}
+		return res.StatusCode
+	}
+
+	quizID, videoID := "https://example.com/courses/safety/quiz", "https://example.com/courses/safety/video"
+
+	launch := Cmi5Launch{}
+	if status := send(learner, http.MethodPost, "/api/cmi5/"+lesson.Id+"/launch", map[string]string{"au": "https://example.com/unknown"}, nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown AU, got %d", status)
+	}
+	if status := send(learner, http.MethodPost, "/api/cmi5/"+lesson.Id+"/launch", map[string]string{"au": quizID, "return_url": "https://app.example.com/safety"}, &launch); status != http.StatusOK {
+		t.Fatalf("Expected the learner to launch the quiz, got %d", status)
+	}
+	if launch.LaunchMode != Cmi5LaunchModeNormal || launch.LaunchMethod != Cmi5LaunchMethodAnyWindow {
+		t.Errorf("Unexpected launch %+v", launch)
+	}
+
+	progressRecord, err := app.FindFirstRecordByData("progress", "assignee", learner.Id)
+	if err != nil {
+		t.Fatalf("Failed to find progress record: %v", err)
+	}
+	if status := progressRecord.GetString("status"); status != StatusInProgress {
+		t.Errorf("Expected the launch to start the course, got %q", status)
+	}
+
+	launchURL, err := url.Parse(launch.URL)
+	if err != nil {
+		t.Fatalf("Invalid launch URL %q: %v", launch.URL, err)
+	}
+	params := launchURL.Query()
+	if params.Get("lang") != "en" || params.Get("endpoint") != appURL+"/xapi/" || params.Get("registration") == "" || !isXapiIRI(params.Get("activityId")) {
+		t.Errorf("Unexpected launch parameters %v", params)
+	}
+	actor := map[string]any{}
+	if err := json.Unmarshal([]byte(params.Get("actor")), &actor); err != nil {
+		t.Fatalf("Invalid launch actor: %v", err)
+	}
+
+	res, err := http.Get(server.URL + launchURL.Path)
+	if err != nil {
+		t.Fatalf("Failed to get the AU: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") ||
+		res.Header.Get("Content-Security-Policy") != "sandbox allow-scripts allow-forms; frame-ancestors 'self'" {
+		t.Errorf("Expected the sandboxed AU page, got %d %q %q", res.StatusCode, res.Header.Get("Content-Type"), res.Header.Get("Content-Security-Policy"))
+	}
+
+	// the fetch URL hands out the auth token once
+	fetchResult := map[string]string{}
+	if status := send(nil, http.MethodPost, params.Get("fetch"), nil, &fetchResult); status != http.StatusOK || fetchResult["auth-token"] == "" {
+		t.Fatalf("Expected the auth token, got %d %v", status, fetchResult)
+	}
+	if status := send(nil, http.MethodPost, params.Get("fetch"), nil, &fetchResult); status != http.StatusForbidden || fetchResult["error-code"] != "1" {
+		t.Errorf("Expected the second fetch to be refused, got %d %v", status, fetchResult)
+	}
+	if status := send(nil, http.MethodPost, "/api/cmi5/sessions/fetch/unknown", nil, &fetchResult); status != http.StatusForbidden || fetchResult["error-code"] != "3" {
+		t.Errorf("Expected an unknown fetch URL to be refused, got %d %v", status, fetchResult)
+	}
+
+	rawToken, err := base64.StdEncoding.DecodeString(fetchResult["auth-token"])
+	if err != nil {
+		t.Fatalf("Invalid auth token: %v", err)
+	}
+	key, secret, _ := strings.Cut(string(rawToken), ":")
+	client := &xapiTestClient{t: t, url: server.URL, key: key, secret: secret}
+
+	stateParams := url.Values{
+		"activityId":   {params.Get("activityId")},
+		"agent":        {params.Get("actor")},
+		"registration": {params.Get("registration")},
+	}
+	statePath := func(stateID string) string {
+		query := url.Values{}
+		for key, values := range stateParams {
+			query[key] = values
+		}
+		query.Set("stateId", stateID)
+		return "/xapi/activities/state?" + query.Encode()
+	}
+
+	launchData := map[string]any{}
+	if status := client.do(http.MethodGet, statePath(cmi5LaunchDataStateID), nil, &launchData); status != http.StatusOK {
+		t.Fatalf("Expected the launch data, got %d", status)
+	}
+	if launchData["launchMode"] != Cmi5LaunchModeNormal || launchData["moveOn"] != Cmi5MoveOnCompletedAndPassed ||
+		launchData["masteryScore"] != 0.8 || launchData["returnURL"] != "https://app.example.com/safety" || launchData["launchParameters"] != `{"level": 1}` {
+		t.Errorf("Unexpected launch data %v", launchData)
+	}
+	if status := client.do(http.MethodPut, statePath(cmi5LaunchDataStateID), map[string]any{"launchMode": "Review"}, nil); status != http.StatusForbidden {
+		t.Errorf("Expected the launch data to be read-only, got %d", status)
+	}
+
+	if status := client.do(http.MethodPut, statePath("bookmark"), map[string]any{"page": 1, "seen": true}, nil); status != http.StatusNoContent {
+		t.Errorf("Expected the bookmark to be stored, got %d", status)
+	}
+	if status := client.do(http.MethodPost, statePath("bookmark"), map[string]any{"page": 2}, nil); status != http.StatusNoContent {
+		t.Errorf("Expected the bookmark to be merged, got %d", status)
+	}
+	bookmark := map[string]any{}
+	if status := client.do(http.MethodGet, statePath("bookmark"), nil, &bookmark); status != http.StatusOK || bookmark["page"] != 2.0 || bookmark["seen"] != true {
+		t.Errorf("Expected the merged bookmark, got %d %v", status, bookmark)
+	}
+	stateIDs := []string{}
+	if status := client.do(http.MethodGet, "/xapi/activities/state?"+stateParams.Encode(), nil, &stateIDs); status != http.StatusOK || len(stateIDs) != 2 {
+		t.Errorf("Expected the state ids, got %d %v", status, stateIDs)
+	}
+	otherAgent := url.Values{"activityId": {params.Get("activityId")}, "agent": {`{"mbox": "mailto:other@example.com"}`}, "registration": {params.Get("registration")}}
+	if status := client.do(http.MethodGet, "/xapi/activities/state?"+otherAgent.Encode(), nil, nil); status != http.StatusForbidden {
+		t.Errorf("Expected the state of another agent to be forbidden, got %d", status)
+	}
+
+	cmi5Statement := func(verb string, result map[string]any) XapiStatement {
+		statement := XapiStatement{
+			"actor":  actor,
+			"verb":   map[string]any{"id": verb},
+			"object": map[string]any{"id": params.Get("activityId")},
+			"context": map[string]any{
+				"registration":      params.Get("registration"),
+				"contextActivities": map[string]any{"category": []any{map[string]any{"id": cmi5CategoryCmi5}}},
+				"extensions":        launchData["contextTemplate"].(map[string]any)["extensions"],
+			},
+		}
+		if result != nil {
+			statement["result"] = result
+		}
+		return statement
+	}
+	score := func(scaled float64) map[string]any {
+		return map[string]any{"score": map[string]any{"scaled": scaled}}
+	}
+
+	steps := []struct {
+		name      string
+		statement XapiStatement
+		status    int
+	}{
+		{"completed before initialized", cmi5Statement(XapiVerbCompleted, nil), http.StatusForbidden},
+		{"initialized", cmi5Statement(Cmi5VerbInitialized, nil), http.StatusOK},
+		{"initialized twice", cmi5Statement(Cmi5VerbInitialized, nil), http.StatusForbidden},
+		{"another actor", testXapiStatement("other@example.com", "http://adlnet.gov/expapi/verbs/answered", params.Get("activityId")), http.StatusForbidden},
+		{"completed", cmi5Statement(XapiVerbCompleted, nil), http.StatusOK},
+		{"completed twice", cmi5Statement(XapiVerbCompleted, nil), http.StatusForbidden},
+		{"failed", cmi5Statement(Cmi5VerbFailed, score(0.5)), http.StatusOK},
+		{"passed below mastery", cmi5Statement(XapiVerbPassed, score(0.7)), http.StatusForbidden},
+		{"passed", cmi5Statement(XapiVerbPassed, score(0.9)), http.StatusOK},
+		{"terminated", cmi5Statement(Cmi5VerbTerminated, nil), http.StatusOK},
+		{"after terminated", cmi5Statement(XapiVerbCompleted, nil), http.StatusForbidden},
+	}
+	for _, step := range steps {
+		if status := client.do(http.MethodPost, "/xapi/statements", step.statement, nil); status != step.status {
+			t.Errorf("%s: expected %d, got %d", step.name, step.status, status)
+		}
+	}
+
+	if status := client.do(http.MethodGet, "/xapi/statements", nil, nil); status != http.StatusForbidden {
+		t.Errorf("Expected cmi5 sessions not to query the statements, got %d", status)
+	}
+
+	// passing the quiz satisfies its block and the course, the video has no moveOn criteria
+	satisfied, err := app.CountRecords("xapi_statements", dbx.HashExp{"verb": Cmi5VerbSatisfied, "user": learner.Id})
+	if err != nil || satisfied != 3 {
+		t.Errorf("Expected the AU, block and course to be satisfied, got %d %v", satisfied, err)
+	}
+
+	lessonStatus := Cmi5LessonStatus{}
+	if status := send(learner, http.MethodGet, "/api/cmi5/"+lesson.Id, nil, &lessonStatus); status != http.StatusOK {
+		t.Fatalf("Expected the lesson status, got %d", status)
+	}
+	if !lessonStatus.Satisfied || lessonStatus.CourseStatus != StatusCompleted || len(lessonStatus.AUs) != 2 ||
+		!lessonStatus.AUs[0].Satisfied || lessonStatus.AUs[0].Score == nil || *lessonStatus.AUs[0].Score != 0.9 || lessonStatus.AUs[1].ID != videoID {
+		t.Errorf("Unexpected lesson status %+v", lessonStatus)
+	}
+
+	lessonProgress, err := app.FindFirstRecordByData("lesson_progress", "lesson", lesson.Id)
+	if err != nil || !lessonProgress.GetBool("completed") {
+		t.Errorf("Expected the lesson progress to be completed, got %v", err)
+	}
+
+	preview := Cmi5Launch{}
+	if status := send(instructor, http.MethodPost, "/api/cmi5/"+lesson.Id+"/launch", map[string]string{"au": videoID}, &preview); status != http.StatusOK ||
+		preview.LaunchMode != Cmi5LaunchModeBrowse || !strings.HasPrefix(preview.URL, "https://media.example.com/safety/video.html?") {
+		t.Errorf("Expected the instructor to browse the video, got %d %+v", status, preview)
+	}
+	if count, _ := app.CountRecords("lesson_progress", dbx.HashExp{"assignee": instructor.Id}); count != 0 {
+		t.Errorf("Expected previews not to be tracked, got %d lesson progress records", count)
+	}
+
+	outsider := core.NewRecord(users)
+	outsider.SetEmail("outsider@example.com")
+	outsider.SetPassword("1234567890")
+	if err := app.Save(outsider); err != nil {
+		t.Fatalf("Failed to save outsider: %v", err)
+	}
+	if status := send(outsider, http.MethodPost, "/api/cmi5/"+lesson.Id+"/launch", map[string]string{"au": quizID}, nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for a user outside the course, got %d", status)
+	}
+}
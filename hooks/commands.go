@@ -0,0 +1,200 @@
+package hooks
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/spf13/cobra"
+)
+
+func InitCommands(app *pocketbase.PocketBase) {
+	var recordedHead AuditHead
+	verifyAuditCmd := &cobra.Command{
+		Use:          "verify-audit",
+		Short:        "Verifies that the audit log hash chain has not been tampered with",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if (recordedHead.Count > 0) != (recordedHead.Hash != "") {
+				return fmt.Errorf("--head-count and --head-hash must be set together")
+			}
+
+			total, err := VerifyAuditLog(app, recordedHead)
+			if err != nil {
+				return fmt.Errorf("audit log verification failed after %d valid entries: %w", total, err)
+			}
+
+			head, err := FindAuditHead(app)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Audit log verified: %d entries, hash chain intact.\n", total)
+			fmt.Printf("Record the head to check the next verifications against: --head-count %d --head-hash %s\n", head.Count, head.Hash)
+			return nil
+		},
+	}
+	verifyAuditCmd.Flags().IntVar(&recordedHead.Count, "head-count", 0, "the entry count recorded by a previous verification")
+	verifyAuditCmd.Flags().StringVar(&recordedHead.Hash, "head-hash", "", "the head hash recorded by a previous verification")
+	app.RootCmd.AddCommand(verifyAuditCmd)
+
+	app.RootCmd.AddCommand(&cobra.Command{
+		Use:          "sanitize-lessons",
+		Short:        "Sanitizes the content of every lesson again, dropping the frames and media of hosts that are not allowed",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			updated, err := ResanitizeLessons(app)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Lessons sanitized: %d updated.\n", updated)
+			return nil
+		},
+	})
+
+	app.RootCmd.AddCommand(&cobra.Command{
+		Use:          "scim-token <organization-id> [name]",
+		Short:        "Issues a SCIM provisioning token for the identity provider of an organization",
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := app.FindRecordById("organizations", args[0]); err != nil {
+				return fmt.Errorf("failed to find organization %q: %w", args[0], err)
+			}
+
+			name := ""
+			if len(args) > 1 {
+				name = args[1]
+			}
+
+			token, _, err := CreateScimToken(app, args[0], name)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("SCIM token (shown only once): %s\n", token)
+			return nil
+		},
+	})
+
+	var readOnly bool
+	xapiCredentialsCmd := &cobra.Command{
+		Use:          "xapi-credentials <organization-id> [name]",
+		Short:        "Issues Basic auth credentials for the xAPI Learning Record Store of an organization",
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := app.FindRecordById("organizations", args[0]); err != nil {
+				return fmt.Errorf("failed to find organization %q: %w", args[0], err)
+			}
+
+			name := ""
+			if len(args) > 1 {
+				name = args[1]
+			}
+
+			key, secret, err := CreateXapiCredentials(app, args[0], name, readOnly)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("LRS key: %s\nLRS secret (shown only once): %s\n", key, secret)
+			return nil
+		},
+	}
+	xapiCredentialsCmd.Flags().BoolVar(&readOnly, "read-only", false, "only allow querying the statements")
+	app.RootCmd.AddCommand(xapiCredentialsCmd)
+
+	courseCmd := &cobra.Command{
+		Use:   "course",
+		Short: "Moves courses between eLesson instances as archives",
+	}
+
+	var output string
+	courseExportCmd := &cobra.Command{
+		Use:          "export <course-id>",
+		Short:        "Exports a course with its lessons, FAQs, resources and files to a zip archive",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			course, err := app.FindRecordById("courses", args[0])
+			if err != nil {
+				return fmt.Errorf("failed to find course %q: %w", args[0], err)
+			}
+
+			if output == "" {
+				output = course.Id + ".zip"
+			}
+			file, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			if err := NewCourseService(app).ExportCourseArchive(course, file); err != nil {
+				os.Remove(output)
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+
+			fmt.Printf("Course %q exported to %s.\n", course.GetString("title"), output)
+			return nil
+		},
+	}
+	courseExportCmd.Flags().StringVarP(&output, "output", "o", "", "the archive path (default \"<course-id>.zip\")")
+
+	var organizationID string
+	courseImportCmd := &cobra.Command{
+		Use:          "import <file>",
+		Short:        "Imports a course archive as a new course",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if organizationID != "" {
+				if _, err := app.FindRecordById("organizations", organizationID); err != nil {
+					return fmt.Errorf("failed to find organization %q: %w", organizationID, err)
+				}
+			}
+
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			info, err := file.Stat()
+			if err != nil {
+				return err
+			}
+
+			archive, err := ParseCourseArchive(file, info.Size())
+			if err != nil {
+				return err
+			}
+
+			// the imported records go through the same hooks as when served
+			if err := InitHooks(app); err != nil {
+				return err
+			}
+
+			result, err := NewCourseService(app).ImportCourseArchive(archive, organizationID)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Course %q imported as %s: %d lessons, %d FAQs, %d resources.\n",
+				result.Course.GetString("title"), result.Course.Id, result.Lessons, result.FAQs, result.Resources)
+			if len(result.Ignored) > 0 {
+				fmt.Printf("Fields missing from this instance were ignored: %s\n", strings.Join(result.Ignored, ", "))
+			}
+			return nil
+		},
+	}
+	courseImportCmd.Flags().StringVar(&organizationID, "organization", "", "the organization of the imported course")
+
+	courseCmd.AddCommand(courseExportCmd, courseImportCmd)
+	app.RootCmd.AddCommand(courseCmd)
+}
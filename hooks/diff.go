@@ -0,0 +1,211 @@
+package hooks
+
+import (
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// maxDiffEdits bounds the work of a diff, beyond it the changed part is
+// reported as deleted and inserted as a whole.
+const maxDiffEdits = 4000
+
+type diffOp int
+
+const (
+	diffEqual diffOp = iota
+	diffInsert
+	diffDelete
+)
+
+type diffEdit struct {
+	Op    diffOp
+	Token string
+}
+
+// diffTokens returns the shortest edit script turning a into b.
+func diffTokens(a, b []string) []diffEdit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]diffEdit, 0, len(a)+len(b))
+	for _, token := range a[:prefix] {
+		edits = append(edits, diffEdit{diffEqual, token})
+	}
+	edits = append(edits, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, token := range a[len(a)-suffix:] {
+		edits = append(edits, diffEdit{diffEqual, token})
+	}
+	return edits
+}
+
+// myersDiff implements the O(ND) difference algorithm of Eugene W. Myers.
+func myersDiff(a, b []string) []diffEdit {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace[d] holds v[-d..d] after the step d
+	trace := [][]int{}
+
+	for d, done := 0, false; !done; d++ {
+		if d > maxDiffEdits {
+			return replaceDiff(a, b)
+		}
+
+		for k := -d; k <= d; k += 2 {
+			x := v[offset+k-1] + 1
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+		trace = append(trace, slices.Clone(v[offset-d:offset+d+1]))
+	}
+
+	edits := []diffEdit{}
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		previous := trace[d-1]
+		k := x - y
+
+		previousK := k - 1
+		if k == -d || (k != d && previous[k-1+d-1] < previous[k+1+d-1]) {
+			previousK = k + 1
+		}
+		previousX := previous[previousK+d-1]
+		previousY := previousX - previousK
+
+		for x > previousX && y > previousY {
+			edits = append(edits, diffEdit{diffEqual, a[x-1]})
+			x, y = x-1, y-1
+		}
+		if x == previousX {
+			edits = append(edits, diffEdit{diffInsert, b[y-1]})
+			y--
+		} else {
+			edits = append(edits, diffEdit{diffDelete, a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		edits = append(edits, diffEdit{diffEqual, a[x-1]})
+		x, y = x-1, y-1
+	}
+
+	slices.Reverse(edits)
+	return edits
+}
+
+func replaceDiff(a, b []string) []diffEdit {
+	edits := make([]diffEdit, 0, len(a)+len(b))
+	for _, token := range a {
+		edits = append(edits, diffEdit{diffDelete, token})
+	}
+	for _, token := range b {
+		edits = append(edits, diffEdit{diffInsert, token})
+	}
+	return edits
+}
+
+// diffWords splits text into its spaces, words and punctuation marks.
+var diffWords = regexp.MustCompile(`\s+|[\p{L}\p{N}_']+|[^\s\p{L}\p{N}_']+`)
+
+// htmlDiffTokens splits HTML content into its tags and the words, spaces and
+// punctuation of its text.
+func htmlDiffTokens(content string) []string {
+	tokens := []string{}
+	tokenizer := nethtml.NewTokenizer(strings.NewReader(content))
+	for {
+		switch tokenizer.Next() {
+		case nethtml.ErrorToken:
+			return tokens
+		case nethtml.TextToken:
+			tokens = append(tokens, diffWords.FindAllString(string(tokenizer.Raw()), -1)...)
+		default:
+			tokens = append(tokens, string(tokenizer.Raw()))
+		}
+	}
+}
+
+// isDiffMarkup reports whether a token is markup, rather than content
+// (embedded images and media are content).
+func isDiffMarkup(token string) bool {
+	if !strings.HasPrefix(token, "<") {
+		return false
+	}
+
+	name := strings.TrimPrefix(token, "<")
+	if end := strings.IndexAny(name, " \t\r\n/>"); end >= 0 {
+		name = name[:end]
+	}
+	switch atom.Lookup([]byte(strings.ToLower(name))) {
+	case atom.Img, atom.Hr, atom.Embed:
+		return false
+	}
+	return true
+}
+
+// htmlDiff renders the changes between two HTML contents as the new content,
+// with the inserted text in ins elements and the deleted text in del elements.
+// Markup changes keep the markup of the new content.
+func htmlDiff(from, to string) string {
+	var builder strings.Builder
+	current := diffEqual
+	switchTo := func(op diffOp) {
+		if op == current {
+			return
+		}
+		switch current {
+		case diffInsert:
+			builder.WriteString("</ins>")
+		case diffDelete:
+			builder.WriteString("</del>")
+		}
+		switch op {
+		case diffInsert:
+			builder.WriteString("<ins>")
+		case diffDelete:
+			builder.WriteString("<del>")
+		}
+		current = op
+	}
+
+	for _, edit := range diffTokens(htmlDiffTokens(from), htmlDiffTokens(to)) {
+		if isDiffMarkup(edit.Token) {
+			switchTo(diffEqual)
+			if edit.Op != diffDelete {
+				builder.WriteString(edit.Token)
+			}
+			continue
+		}
+		switchTo(edit.Op)
+		builder.WriteString(edit.Token)
+	}
+	switchTo(diffEqual)
+
+	return builder.String()
+}
+
+// textDiff renders the changes between two texts as HTML.
+func textDiff(from, to string) string {
+	return htmlDiff(html.EscapeString(from), html.EscapeString(to))
+}
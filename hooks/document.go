@@ -0,0 +1,410 @@
+package hooks
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	mdhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// limit of the uploaded documents and of the files extracted from them
+	lessonDocumentMaxSize = 200 << 20
+	// limit of the Markdown documents and of the XML parts of Word documents
+	lessonDocumentMaxPartSize = 50 << 20
+)
+
+var ErrLessonDocumentInvalid = errors.New("invalid lesson document")
+
+// LessonDocument is a lesson written in a Markdown or Word document. Its
+// content refers to the images it embeds with lessonDocumentImageRef tokens.
+type LessonDocument struct {
+	Title   string
+	Summary string
+	Content string
+	Images  []*filesystem.File
+}
+
+// LessonDocumentImport is the lesson a document was imported into.
+type LessonDocumentImport struct {
+	Lesson *core.Record `json:"lesson"`
+	Images int          `json:"images"`
+	// the images that don't fit the lesson downloads
+	Skipped []string `json:"skipped"`
+}
+
+func lessonDocumentInvalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrLessonDocumentInvalid, fmt.Sprintf(format, args...))
+}
+
+// lessonDocumentImageRef is the placeholder of the i-th image of a document
+// in its content, until the URL of the stored file is known.
+func lessonDocumentImageRef(i int) string {
+	return fmt.Sprintf("$DOCUMENT-IMAGE-%d$", i)
+}
+
+// addImage adds an image to the document, returning its placeholder.
+func (d *LessonDocument) addImage(content []byte, name string) (string, error) {
+	file, err := filesystem.NewFileFromBytes(content, name)
+	if err != nil {
+		return "", err
+	}
+	d.Images = append(d.Images, file)
+	return lessonDocumentImageRef(len(d.Images) - 1), nil
+}
+
+// ParseLessonDocument converts a Markdown document (.md, or a .zip with a
+// Markdown document and its images) or a Word document (.docx) to a lesson.
+// Documents without title are titled after their file name.
+func ParseLessonDocument(name string, r io.ReaderAt, size int64) (*LessonDocument, error) {
+	var doc *LessonDocument
+	var err error
+
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown":
+		if size > lessonDocumentMaxPartSize {
+			return nil, lessonDocumentInvalid("the document exceeds %d bytes", lessonDocumentMaxPartSize)
+		}
+		content, readErr := io.ReadAll(io.NewSectionReader(r, 0, size))
+		if readErr != nil {
+			return nil, readErr
+		}
+		doc, err = parseMarkdownDocument(content, nil)
+	case ".zip":
+		doc, err = parseMarkdownArchive(r, size)
+	case ".docx":
+		doc, err = parseDocxDocument(r, size)
+	default:
+		return nil, lessonDocumentInvalid("only Markdown (.md, or .zip with images) and Word (.docx) documents can be imported")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.Title == "" {
+		doc.Title = strings.TrimSuffix(path.Base(name), path.Ext(name))
+	}
+	return doc, nil
+}
+
+// readZipFile returns the content of a file of a zip, up to limit bytes.
+func readZipFile(file *zip.File, limit uint64) ([]byte, error) {
+	if file.UncompressedSize64 > limit {
+		return nil, lessonDocumentInvalid("%s exceeds %d bytes", file.Name, limit)
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return nil, lessonDocumentInvalid("failed to open %s: %v", file.Name, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(io.LimitReader(reader, int64(limit)))
+	if err != nil {
+		return nil, lessonDocumentInvalid("failed to read %s: %v", file.Name, err)
+	}
+	return content, nil
+}
+
+// parseMarkdownArchive reads the single Markdown document of a zip, with the
+// images it refers to.
+func parseMarkdownArchive(r io.ReaderAt, size int64) (*LessonDocument, error) {
+	files, err := packageArchiveFiles(r, size, lessonDocumentMaxSize)
+	if err != nil {
+		return nil, lessonDocumentInvalid("%v", err)
+	}
+
+	var document *zip.File
+	byName := map[string]*zip.File{}
+	for _, file := range files {
+		name, _ := packageFilePath(file.Name)
+		if strings.HasPrefix(name, "__MACOSX/") {
+			continue
+		}
+		byName[name] = file
+
+		if ext := strings.ToLower(path.Ext(name)); ext == ".md" || ext == ".markdown" {
+			if document != nil {
+				return nil, lessonDocumentInvalid("the archive holds more than one Markdown document")
+			}
+			document = file
+		}
+	}
+	if document == nil {
+		return nil, lessonDocumentInvalid("the archive holds no Markdown document")
+	}
+
+	content, err := readZipFile(document, lessonDocumentMaxPartSize)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := path.Dir(document.Name)
+	return parseMarkdownDocument(content, func(ref string) ([]byte, string, bool) {
+		parsed, err := url.Parse(ref)
+		if err != nil || parsed.Scheme != "" || parsed.Host != "" || path.IsAbs(parsed.Path) {
+			return nil, "", false
+		}
+		name, ok := packageFilePath(path.Join(dir, parsed.Path))
+		if !ok || byName[name] == nil {
+			return nil, "", false
+		}
+		content, err := readZipFile(byName[name], lessonDocumentMaxSize)
+		if err != nil {
+			return nil, "", false
+		}
+		return content, path.Base(name), true
+	})
+}
+
+var (
+	markdown = goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		// raw HTML is kept, the lesson content is sanitized when saved
+		goldmark.WithRendererOptions(mdhtml.WithUnsafe()),
+	)
+	markdownFrontMatter = regexp.MustCompile(`(?s)^---[ \t]*\n(.*?)\n(?:---|\.\.\.)[ \t]*(?:\n|$)`)
+	dataURL             = regexp.MustCompile(`^data:(image/[\w.+-]+);base64,(.*)$`)
+)
+
+// parseMarkdownDocument converts a Markdown document to a lesson. Its front
+// matter sets the title and summary, otherwise a leading level 1 heading is
+// the title. Images with data URLs are extracted, and the other local images
+// are read with image.
+func parseMarkdownDocument(source []byte, image func(ref string) (content []byte, name string, ok bool)) (*LessonDocument, error) {
+	doc := &LessonDocument{}
+
+	source = bytes.ReplaceAll(source, []byte("\r\n"), []byte("\n"))
+	source = bytes.TrimPrefix(source, []byte("\ufeff"))
+	if match := markdownFrontMatter.FindSubmatch(source); match != nil {
+		frontMatter := struct {
+			Title       string `yaml:"title"`
+			Summary     string `yaml:"summary"`
+			Description string `yaml:"description"`
+		}{}
+		if err := yaml.Unmarshal(match[1], &frontMatter); err != nil {
+			return nil, lessonDocumentInvalid("invalid front matter: %v", err)
+		}
+		doc.Title = strings.TrimSpace(frontMatter.Title)
+		doc.Summary = strings.TrimSpace(frontMatter.Summary)
+		if doc.Summary == "" {
+			doc.Summary = strings.TrimSpace(frontMatter.Description)
+		}
+		source = source[len(match[0]):]
+	}
+
+	root := markdown.Parser().Parse(text.NewReader(source))
+
+	if heading, ok := root.FirstChild().(*ast.Heading); ok && heading.Level == 1 && doc.Title == "" {
+		doc.Title = markdownText(heading, source)
+		root.RemoveChild(root, heading)
+	}
+
+	images := map[string]string{}
+	err := ast.Walk(root, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		img, ok := node.(*ast.Image)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+
+		ref := string(img.Destination)
+		if placeholder, ok := images[ref]; ok {
+			img.Destination = []byte(placeholder)
+			return ast.WalkContinue, nil
+		}
+
+		var content []byte
+		var name string
+		if match := dataURL.FindStringSubmatch(ref); match != nil {
+			decoded, err := base64.StdEncoding.DecodeString(match[2])
+			if err != nil {
+				return ast.WalkStop, lessonDocumentInvalid("invalid embedded image: %v", err)
+			}
+			content, name = decoded, "image"+imageExtension(match[1])
+		} else if image != nil {
+			if content, name, ok = image(ref); !ok {
+				return ast.WalkContinue, nil
+			}
+		} else {
+			return ast.WalkContinue, nil
+		}
+
+		placeholder, err := doc.addImage(content, name)
+		if err != nil {
+			return ast.WalkStop, err
+		}
+		images[ref] = placeholder
+		img.Destination = []byte(placeholder)
+		return ast.WalkContinue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var content bytes.Buffer
+	if err := markdown.Renderer().Render(&content, source, root); err != nil {
+		return nil, fmt.Errorf("failed to render the document: %w", err)
+	}
+	doc.Content = strings.TrimSpace(content.String())
+
+	return doc, nil
+}
+
+// markdownText returns the text of a Markdown node.
+func markdownText(node ast.Node, source []byte) string {
+	var builder strings.Builder
+	ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Text:
+			builder.Write(n.Segment.Value(source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				builder.WriteByte(' ')
+			}
+		case *ast.String:
+			builder.Write(n.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(builder.String())
+}
+
+// imageExtension returns the file extension of an image MIME type.
+func imageExtension(mimeType string) string {
+	switch mimeType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/svg+xml":
+		return ".svg"
+	}
+	return "." + strings.TrimPrefix(mimeType, "image/")
+}
+
+// ImportLessonDocument sets the title, summary and content of a lesson, new or
+// not, to those of a document, adding its images to the lesson downloads.
+func (cs *CourseService) ImportLessonDocument(lesson *core.Record, doc *LessonDocument) (*LessonDocumentImport, error) {
+	result := &LessonDocumentImport{Skipped: []string{}}
+
+	if lesson.IsNew() && lesson.Id == "" {
+		lesson.Set("id", core.GenerateDefaultRandomId())
+	}
+	lesson.Set("title", doc.Title)
+	if doc.Summary != "" {
+		lesson.Set("summary", doc.Summary)
+	}
+
+	maxDownloads := 1
+	if field, ok := lesson.Collection().Fields.GetByName("downloads").(*core.FileField); ok && field.MaxSelect > 0 {
+		maxDownloads = field.MaxSelect
+	}
+	downloads := len(lesson.GetStringSlice("downloads"))
+
+	refs := make([]string, 0, len(doc.Images)*2)
+	images := []*filesystem.File{}
+	for i, image := range doc.Images {
+		target := image.OriginalName
+		if downloads+len(images) < maxDownloads && lessonFileFits(lesson.Collection(), "downloads", image) {
+			images = append(images, image)
+			target = lessonFileURL(lesson, image.Name)
+		} else {
+			result.Skipped = append(result.Skipped, image.OriginalName)
+		}
+		refs = append(refs, lessonDocumentImageRef(i), target)
+	}
+	if len(images) > 0 {
+		lesson.Set("downloads+", images)
+	}
+	lesson.Set("content", strings.NewReplacer(refs...).Replace(doc.Content))
+
+	if err := cs.app.Save(lesson); err != nil {
+		return nil, fmt.Errorf("failed to save lesson: %w", err)
+	}
+
+	result.Lesson = lesson
+	result.Images = len(images)
+	return result, nil
+}
+
+func bindDocumentRoutes(r *router.Router[*core.RequestEvent], courseService *CourseService) {
+	importDocument := func(e *core.RequestEvent, lesson *core.Record) error {
+		files, err := e.FindUploadedFiles("file")
+		if err != nil || len(files) == 0 {
+			return e.BadRequestError("The document file is required.", err)
+		}
+
+		doc, err := parsePackageFile(files[0], func(r io.ReaderAt, size int64) (*LessonDocument, error) {
+			return ParseLessonDocument(files[0].OriginalName, r, size)
+		})
+		if errors.Is(err, ErrLessonDocumentInvalid) {
+			return e.BadRequestError(err.Error(), nil)
+		}
+		if err != nil {
+			return e.InternalServerError("Failed to read the document.", err)
+		}
+
+		lesson.SetRaw(revisionAuthorKey, revisionAuthor(e))
+		result, err := courseService.ImportLessonDocument(lesson, doc)
+		var validationErrors validation.Errors
+		if errors.As(err, &validationErrors) {
+			return e.BadRequestError("Failed to import the document.", validationErrors)
+		}
+		if err != nil {
+			return e.InternalServerError("Failed to import the document.", err)
+		}
+
+		if err := apis.EnrichRecord(e, result.Lesson); err != nil {
+			return e.InternalServerError("", err)
+		}
+		return e.JSON(http.StatusOK, result)
+	}
+
+	// create a lesson of a course from a document
+	r.POST("/api/courses/{id}/lessons/import", func(e *core.RequestEvent) error {
+		course, err := e.App.FindRecordById("courses", e.Request.PathValue("id"))
+		if err != nil {
+			return e.NotFoundError("", err)
+		}
+		if !CanManageCourse(e.Auth, course) {
+			return e.ForbiddenError("Only the course instructor can add lessons.", nil)
+		}
+
+		lessons, err := e.App.FindCollectionByNameOrId("lessons")
+		if err != nil {
+			return e.InternalServerError("", err)
+		}
+		lesson := core.NewRecord(lessons)
+		lesson.Set("course", course.Id)
+
+		return importDocument(e, lesson)
+	}).Bind(RequireRole(RoleInstructor, RoleOrgAdmin), apis.BodyLimit(lessonDocumentMaxSize))
+
+	// replace the content of a lesson with a document
+	r.POST("/api/lessons/{id}/import", func(e *core.RequestEvent) error {
+		lesson, err := managedLesson(e)
+		if err != nil {
+			return err
+		}
+		return importDocument(e, lesson)
+	}).Bind(RequireRole(RoleInstructor, RoleOrgAdmin), apis.BodyLimit(lessonDocumentMaxSize))
+}
@@ -0,0 +1,321 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const testDocxDocument = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing"
+	xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main">
+<w:body>
+	<w:p><w:pPr><w:pStyle w:val="Title"/></w:pPr><w:r><w:t>Forklift basics</w:t></w:r></w:p>
+	<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Before driving</w:t></w:r></w:p>
+	<w:p>
+		<w:r><w:rPr><w:b/></w:rPr><w:t xml:space="preserve">Check </w:t></w:r>
+		<w:proofErr w:type="spellStart"/>
+		<w:r><w:rPr><w:b/></w:rPr><w:t>the brakes</w:t></w:r>
+		<w:r><w:t xml:space="preserve"> &amp; the </w:t></w:r>
+		<w:hyperlink r:id="rId2"><w:r><w:t>horn</w:t></w:r></w:hyperlink>
+		<w:del><w:r><w:delText> twice</w:delText></w:r></w:del>
+		<w:ins><w:r><w:t>.</w:t></w:r></w:ins>
+	</w:p>
+	<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>Daily</w:t></w:r></w:p>
+	<w:p><w:pPr><w:numPr><w:ilvl w:val="1"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>Brakes</w:t></w:r></w:p>
+	<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>Weekly</w:t></w:r></w:p>
+	<w:p/>
+	<w:p><w:r><w:drawing><wp:inline><wp:docPr id="1" name="Picture 1" descr="Mast diagram"/>
+		<a:graphic><a:graphicData><a:blip r:embed="rId1"/></a:graphicData></a:graphic>
+	</wp:inline></w:drawing></w:r></w:p>
+	<w:tbl>
+		<w:tr><w:trPr><w:tblHeader/></w:trPr>
+			<w:tc><w:p><w:r><w:t>Part</w:t></w:r></w:p></w:tc>
+			<w:tc><w:p><w:r><w:t>Check</w:t></w:r></w:p></w:tc>
+		</w:tr>
+		<w:tr>
+			<w:tc><w:tcPr><w:vMerge w:val="restart"/></w:tcPr><w:p><w:r><w:t>Forks</w:t></w:r></w:p></w:tc>
+			<w:tc><w:p><w:r><w:t>Cracks</w:t></w:r></w:p></w:tc>
+		</w:tr>
+		<w:tr>
+			<w:tc><w:tcPr><w:vMerge/></w:tcPr><w:p/></w:tc>
+			<w:tc><w:p><w:r><w:t>Bends</w:t></w:r></w:p></w:tc>
+		</w:tr>
+		<w:tr>
+			<w:tc><w:tcPr><w:gridSpan w:val="2"/></w:tcPr><w:p><w:r><w:t>Done</w:t></w:r></w:p></w:tc>
+		</w:tr>
+	</w:tbl>
+	<w:sectPr/>
+</w:body>
+</w:document>`
+
+// testDocx returns a Word document with formatting, a list, an image and a table.
+func testDocx(t *testing.T) []byte {
+	return testScormZip(t, map[string]string{
+		"_rels/.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+			<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>
+		</Relationships>`,
+		"word/document.xml": testDocxDocument,
+		"word/_rels/document.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+			<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="media/image1.png"/>
+			<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="https://example.com/horn" TargetMode="External"/>
+		</Relationships>`,
+		"word/styles.xml": `<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+			<w:style w:type="paragraph" w:styleId="Title"><w:name w:val="Title"/></w:style>
+			<w:style w:type="paragraph" w:styleId="Heading1"><w:name w:val="heading 1"/></w:style>
+		</w:styles>`,
+		"word/numbering.xml": `<w:numbering xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+			<w:abstractNum w:abstractNumId="0">
+				<w:lvl w:ilvl="0"><w:numFmt w:val="bullet"/></w:lvl>
+				<w:lvl w:ilvl="1"><w:numFmt w:val="decimal"/></w:lvl>
+			</w:abstractNum>
+			<w:num w:numId="1"><w:abstractNumId w:val="0"/></w:num>
+		</w:numbering>`,
+		"word/media/image1.png": string(testPNG(t)),
+		"docProps/core.xml": `<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/">
+			<dc:title></dc:title><dc:description>Driving safely</dc:description>
+		</cp:coreProperties>`,
+	})
+}
+
+func TestParseLessonDocument(t *testing.T) {
+	image := base64.StdEncoding.EncodeToString(testPNG(t))
+
+	scenarios := []struct {
+		name     string
+		file     string
+		content  []byte
+		title    string
+		summary  string
+		expected string
+		images   int
+	}{
+		{
+			"markdown front matter",
+			"basics.md",
+			[]byte("---\ntitle: Forklift basics\ndescription: Driving safely\n---\n# Before driving\r\n\r\nCheck **the brakes**.\n\n" +
+				"![Mast](data:image/png;base64," + image + ")\n![Mast](data:image/png;base64," + image + ")\n"),
+			"Forklift basics",
+			"Driving safely",
+			"<h1>Before driving</h1>\n<p>Check <strong>the brakes</strong>.</p>\n" +
+				`<p><img src="$DOCUMENT-IMAGE-0$" alt="Mast">` + "\n" + `<img src="$DOCUMENT-IMAGE-0$" alt="Mast"></p>`,
+			1,
+		},
+		{
+			"markdown heading",
+			"basics.md",
+			[]byte("\ufeff# Forklift *basics*\n\n| Part | Check |\n| --- | --- |\n| Forks | Cracks |\n"),
+			"Forklift basics",
+			"",
+			"<table>\n<thead>\n<tr>\n<th>Part</th>\n<th>Check</th>\n</tr>\n</thead>\n<tbody>\n<tr>\n<td>Forks</td>\n<td>Cracks</td>\n</tr>\n</tbody>\n</table>",
+			0,
+		},
+		{
+			"markdown archive",
+			"basics.zip",
+			testScormZip(t, map[string]string{
+				"basics/lesson.md":            "![Mast](images/mast.png) ![Missing](images/none.png) ![Remote](https://example.com/a.png)",
+				"basics/images/mast.png":      string(testPNG(t)),
+				"__MACOSX/basics/._lesson.md": "",
+			}),
+			"basics",
+			"",
+			`<p><img src="$DOCUMENT-IMAGE-0$" alt="Mast"> <img src="images/none.png" alt="Missing"> <img src="https://example.com/a.png" alt="Remote"></p>`,
+			1,
+		},
+		{
+			"word",
+			"Forklift.docx",
+			testDocx(t),
+			"Forklift basics",
+			"Driving safely",
+			`<h1>Before driving</h1><p><strong>Check the brakes</strong> &amp; the <a href="https://example.com/horn">horn</a>.</p>` +
+				`<ul><li>Daily<ol><li>Brakes</li></ol></li><li>Weekly</li></ul>` +
+				`<p><img src="$DOCUMENT-IMAGE-0$" alt="Mast diagram"></p>` +
+				`<table><thead><tr><th>Part</th><th>Check</th></tr></thead>` +
+				`<tbody><tr><td rowspan="2">Forks</td><td>Cracks</td></tr><tr><td>Bends</td></tr><tr><td colspan="2">Done</td></tr></tbody></table>`,
+			1,
+		},
+	}
+
+	for _, s := range scenarios {
+		doc, err := ParseLessonDocument(s.file, bytes.NewReader(s.content), int64(len(s.content)))
+		if err != nil {
+			t.Errorf("%s: ParseLessonDocument failed: %v", s.name, err)
+			continue
+		}
+		if doc.Title != s.title || doc.Summary != s.summary {
+			t.Errorf("%s: expected %q and %q, got %q and %q", s.name, s.title, s.summary, doc.Title, doc.Summary)
+		}
+		if doc.Content != s.expected {
+			t.Errorf("%s: expected content\n%s\ngot\n%s", s.name, s.expected, doc.Content)
+		}
+		if len(doc.Images) != s.images {
+			t.Errorf("%s: expected %d images, got %d", s.name, s.images, len(doc.Images))
+		}
+	}
+
+	for name, content := range map[string][]byte{
+		"basics.pdf":  []byte("%PDF-1.4"),
+		"basics.docx": []byte("not a zip"),
+		"notes.docx":  testScormZip(t, map[string]string{"notes.txt": "no document"}),
+		"two.zip":     testScormZip(t, map[string]string{"a.md": "a", "b.md": "b"}),
+		"front.md":    []byte("---\ntitle: [unclosed\n---\ntext"),
+	} {
+		if _, err := ParseLessonDocument(name, bytes.NewReader(content), int64(len(content))); !errors.Is(err, ErrLessonDocumentInvalid) {
+			t.Errorf("Expected %s to be rejected, got %v", name, err)
+		}
+	}
+}
+
+func TestCourseService_ImportLessonDocument(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	course, lessons := createTestAuthoredCourse(t, app, courses)
+
+	content := testDocx(t)
+	doc, err := ParseLessonDocument("Forklift.docx", bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("ParseLessonDocument failed: %v", err)
+	}
+
+	lesson := core.NewRecord(lessons[0].Collection())
+	lesson.Set("course", course.Id)
+	result, err := service.ImportLessonDocument(lesson, doc)
+	if err != nil {
+		t.Fatalf("ImportLessonDocument failed: %v", err)
+	}
+
+	imported, err := app.FindRecordById("lessons", result.Lesson.Id)
+	if err != nil {
+		t.Fatalf("Expected the lesson to be created: %v", err)
+	}
+	downloads := imported.GetStringSlice("downloads")
+	if result.Images != 1 || len(result.Skipped) != 0 || len(downloads) != 1 {
+		t.Fatalf("Expected the image to be added to the downloads, got %+v %v", result, downloads)
+	}
+	if imported.GetString("title") != "Forklift basics" || imported.GetString("summary") != "Driving safely" {
+		t.Errorf("Unexpected title and summary %q %q", imported.GetString("title"), imported.GetString("summary"))
+	}
+	if content := imported.GetString("content"); !strings.Contains(content, `<img src="`+lessonFileURL(imported, downloads[0])+`" alt="Mast diagram">`) ||
+		strings.Contains(content, "$DOCUMENT-IMAGE") {
+		t.Errorf("Expected the image to refer to the download, got %s", content)
+	}
+
+	// importing into an existing lesson keeps its downloads
+	basics := lessons[0]
+	existing := len(basics.GetStringSlice("downloads"))
+	doc, _ = ParseLessonDocument("basics.md", strings.NewReader("Updated"), 7)
+	if _, err := service.ImportLessonDocument(basics, doc); err != nil {
+		t.Fatalf("ImportLessonDocument failed: %v", err)
+	}
+	updated, _ := app.FindRecordById("lessons", basics.Id)
+	if updated.GetString("content") != "<p>Updated</p>" || updated.GetString("title") != "basics" ||
+		len(updated.GetStringSlice("downloads")) != existing {
+		t.Errorf("Expected the lesson content to be replaced, got %v", updated.FieldsData())
+	}
+}
+
+func TestDocumentRoutes(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, users := createTestCollections(t, app)
+	course, lessons := createTestAuthoredCourse(t, app, courses)
+
+	instructor := core.NewRecord(users)
+	instructor.SetEmail("instructor@example.com")
+	instructor.SetPassword("1234567890")
+	instructor.Set("role", RoleInstructor)
+	instructor.Set("organization", testOrg1)
+	learner := core.NewRecord(users)
+	learner.SetEmail("learner@example.com")
+	learner.SetPassword("1234567890")
+	learner.Set("organization", testOrg1)
+	for _, user := range []*core.Record{instructor, learner} {
+		if err := app.Save(user); err != nil {
+			t.Fatalf("Failed to save user: %v", err)
+		}
+	}
+	course.Set("owner", instructor.Id)
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	bindDocumentRoutes(r, service)
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	upload := func(user *core.Record, path, name string, content []byte) (int, map[string]any) {
+		t.Helper()
+
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", name)
+		part.Write(content)
+		form.Close()
+
+		req, _ := http.NewRequest(http.MethodPost, server.URL+path, &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		token, err := user.NewAuthToken()
+		if err != nil {
+			t.Fatalf("Failed to create auth token: %v", err)
+		}
+		req.Header.Set("Authorization", token)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		defer res.Body.Close()
+
+		result := map[string]any{}
+		data, _ := io.ReadAll(res.Body)
+		json.Unmarshal(data, &result)
+		return res.StatusCode, result
+	}
+
+	markdown := []byte("---\ntitle: Parking\n---\nLower the **forks**.")
+	if status, _ := upload(learner, "/api/courses/"+course.Id+"/lessons/import", "parking.md", markdown); status != http.StatusForbidden {
+		t.Errorf("Expected learners not to import documents, got %d", status)
+	}
+
+	status, result := upload(instructor, "/api/courses/"+course.Id+"/lessons/import", "parking.md", markdown)
+	lesson, _ := result["lesson"].(map[string]any)
+	if status != http.StatusOK || lesson["title"] != "Parking" || lesson["course"] != course.Id ||
+		lesson["content"] != "<p>Lower the <strong>forks</strong>.</p>" {
+		t.Errorf("Expected the instructor to create the lesson, got %d %v", status, result)
+	}
+
+	if status, result := upload(instructor, "/api/courses/"+course.Id+"/lessons/import", "parking.pdf", []byte("%PDF")); status != http.StatusBadRequest {
+		t.Errorf("Expected other documents to be rejected, got %d %v", status, result)
+	}
+
+	status, result = upload(instructor, "/api/lessons/"+lessons[1].Id+"/import", "Forklift.docx", testDocx(t))
+	lesson, _ = result["lesson"].(map[string]any)
+	if status != http.StatusOK || lesson["id"] != lessons[1].Id || result["images"] != float64(1) {
+		t.Errorf("Expected the instructor to replace the lesson content, got %d %v", status, result)
+	}
+}
@@ -0,0 +1,697 @@
+package hooks
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// docxNode is an element of the XML parts of a Word document. Elements and
+// attributes are matched by their local names, regardless of their namespace.
+type docxNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Nodes   []docxNode `xml:",any"`
+	Text    string     `xml:",chardata"`
+}
+
+// attr returns the value of an attribute of the node.
+func (n *docxNode) attr(name string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// relAttr returns the value of a relationship attribute (like r:id) of the node.
+func (n *docxNode) relAttr(name string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == name && strings.HasSuffix(attr.Name.Space, "/relationships") {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// child returns the first child element of the node with the given name.
+func (n *docxNode) child(name string) *docxNode {
+	for i := range n.Nodes {
+		if n.Nodes[i].XMLName.Local == name {
+			return &n.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// find returns the first descendant element of the node with the given name.
+func (n *docxNode) find(name string) *docxNode {
+	for i := range n.Nodes {
+		if n.Nodes[i].XMLName.Local == name {
+			return &n.Nodes[i]
+		}
+		if found := n.Nodes[i].find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// on reports whether a toggle property (like w:b) is set.
+func (n *docxNode) on() bool {
+	if n == nil {
+		return false
+	}
+	switch n.attr("val") {
+	case "0", "false", "off", "none":
+		return false
+	}
+	return true
+}
+
+// docxRelationship is the target of a relationship of a document part.
+type docxRelationship struct {
+	Target   string
+	External bool
+}
+
+// docxFormat is the character formatting of a run.
+type docxFormat struct {
+	Bold, Italic, Underline, Strike bool
+	// "superscript" or "subscript"
+	VertAlign string
+}
+
+// docxRun is a part of a paragraph, rendered with its formatting.
+type docxRun struct {
+	Format docxFormat
+	HTML   string
+}
+
+// docxConverter converts the body of a Word document to HTML.
+type docxConverter struct {
+	doc   *LessonDocument
+	files map[string]*zip.File
+	// the directory of the main document part, its relationships, the names
+	// of its styles by id and the format of its list levels by numbering id
+	dir       string
+	rels      map[string]docxRelationship
+	styles    map[string]string
+	numbering map[string]map[string]string
+	// the placeholders of the images already added, by path
+	images map[string]string
+}
+
+// readDocxPart parses an XML part of a Word document.
+func readDocxPart(files map[string]*zip.File, name string) (*docxNode, error) {
+	file, ok := files[name]
+	if !ok {
+		return nil, nil
+	}
+
+	content, err := readZipFile(file, lessonDocumentMaxPartSize)
+	if err != nil {
+		return nil, err
+	}
+
+	node := &docxNode{}
+	if err := xml.Unmarshal(content, node); err != nil {
+		return nil, lessonDocumentInvalid("invalid %s: %v", name, err)
+	}
+	return node, nil
+}
+
+// readDocxRelationships returns the relationships of a part by id.
+func readDocxRelationships(files map[string]*zip.File, part string) (map[string]docxRelationship, error) {
+	rels := map[string]docxRelationship{}
+
+	node, err := readDocxPart(files, path.Join(path.Dir(part), "_rels", path.Base(part)+".rels"))
+	if err != nil || node == nil {
+		return rels, err
+	}
+	for _, rel := range node.Nodes {
+		rels[rel.attr("Id")] = docxRelationship{
+			Target:   rel.attr("Target"),
+			External: rel.attr("TargetMode") == "External",
+		}
+	}
+	return rels, nil
+}
+
+// parseDocxDocument converts a Word document to a lesson. The document
+// properties set the title and summary, otherwise the paragraphs with the
+// title and subtitle styles do.
+func parseDocxDocument(r io.ReaderAt, size int64) (*LessonDocument, error) {
+	archive, err := packageArchiveFiles(r, size, lessonDocumentMaxSize)
+	if err != nil {
+		return nil, lessonDocumentInvalid("%v", err)
+	}
+	files := map[string]*zip.File{}
+	for _, file := range archive {
+		files[strings.TrimPrefix(file.Name, "/")] = file
+	}
+
+	// the main part is usually word/document.xml
+	main := "word/document.xml"
+	if rels, err := readDocxPart(files, "_rels/.rels"); err != nil {
+		return nil, err
+	} else if rels != nil {
+		for _, rel := range rels.Nodes {
+			if strings.HasSuffix(rel.attr("Type"), "/officeDocument") {
+				main = strings.TrimPrefix(rel.attr("Target"), "/")
+			}
+		}
+	}
+
+	document, err := readDocxPart(files, main)
+	if err != nil {
+		return nil, err
+	}
+	if document == nil || document.child("body") == nil {
+		return nil, lessonDocumentInvalid("not a Word document")
+	}
+
+	c := &docxConverter{
+		doc:       &LessonDocument{},
+		files:     files,
+		dir:       path.Dir(main),
+		styles:    map[string]string{},
+		numbering: map[string]map[string]string{},
+		images:    map[string]string{},
+	}
+	if c.rels, err = readDocxRelationships(files, main); err != nil {
+		return nil, err
+	}
+
+	if styles, err := readDocxPart(files, path.Join(c.dir, "styles.xml")); err != nil {
+		return nil, err
+	} else if styles != nil {
+		for _, style := range styles.Nodes {
+			if name := style.child("name"); style.XMLName.Local == "style" && name != nil {
+				c.styles[style.attr("styleId")] = strings.ToLower(name.attr("val"))
+			}
+		}
+	}
+
+	if numbering, err := readDocxPart(files, path.Join(c.dir, "numbering.xml")); err != nil {
+		return nil, err
+	} else if numbering != nil {
+		formats := map[string]map[string]string{}
+		for _, abstract := range numbering.Nodes {
+			if abstract.XMLName.Local != "abstractNum" {
+				continue
+			}
+			levels := map[string]string{}
+			for _, level := range abstract.Nodes {
+				if format := level.child("numFmt"); level.XMLName.Local == "lvl" && format != nil {
+					levels[level.attr("ilvl")] = format.attr("val")
+				}
+			}
+			formats[abstract.attr("abstractNumId")] = levels
+		}
+		for _, num := range numbering.Nodes {
+			if abstract := num.child("abstractNumId"); num.XMLName.Local == "num" && abstract != nil {
+				c.numbering[num.attr("numId")] = formats[abstract.attr("val")]
+			}
+		}
+	}
+
+	if properties, err := readDocxPart(files, "docProps/core.xml"); err != nil {
+		return nil, err
+	} else if properties != nil {
+		if title := properties.child("title"); title != nil {
+			c.doc.Title = strings.TrimSpace(title.Text)
+		}
+		if description := properties.child("description"); description != nil {
+			c.doc.Summary = strings.TrimSpace(description.Text)
+		}
+	}
+
+	content, err := c.blocks(document.child("body").Nodes)
+	if err != nil {
+		return nil, err
+	}
+	c.doc.Content = content
+
+	return c.doc, nil
+}
+
+// blocks renders the paragraphs and tables of the body or of a table cell.
+func (c *docxConverter) blocks(nodes []docxNode) (string, error) {
+	var out strings.Builder
+	// the tags of the open lists, by level
+	lists := []string{}
+	closeLists := func(depth int) {
+		for len(lists) > depth {
+			out.WriteString("</li></" + lists[len(lists)-1] + ">")
+			lists = lists[:len(lists)-1]
+		}
+	}
+
+	for i := range nodes {
+		node := &nodes[i]
+
+		switch node.XMLName.Local {
+		case "p":
+			content, err := c.inline(node.Nodes)
+			if err != nil {
+				return "", err
+			}
+			if strings.TrimSpace(content) == "" {
+				// empty paragraphs only space the document out
+				continue
+			}
+
+			tag, level, list := c.paragraphTag(node)
+			if list {
+				closeLists(level + 1)
+				if len(lists) == level+1 && lists[level] != tag {
+					closeLists(level)
+				}
+				if len(lists) == level+1 {
+					out.WriteString("</li><li>")
+				}
+				for len(lists) < level+1 {
+					out.WriteString("<" + tag + "><li>")
+					lists = append(lists, tag)
+				}
+				out.WriteString(content)
+				continue
+			}
+			closeLists(0)
+
+			switch tag {
+			case "title":
+				title := docxText(node)
+				if c.doc.Title == "" {
+					c.doc.Title = title
+					continue
+				}
+				if title == c.doc.Title {
+					continue
+				}
+				tag = "h1"
+			case "subtitle":
+				if c.doc.Summary == "" {
+					c.doc.Summary = docxText(node)
+					continue
+				}
+				tag = "p"
+			}
+			out.WriteString("<" + tag + ">" + content + "</" + tag + ">")
+		case "tbl":
+			closeLists(0)
+			table, err := c.table(node)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(table)
+		case "sdt", "customXml":
+			// content controls and custom XML wrap paragraphs
+			content := node
+			if node.XMLName.Local == "sdt" {
+				if content = node.child("sdtContent"); content == nil {
+					continue
+				}
+			}
+			blocks, err := c.blocks(content.Nodes)
+			if err != nil {
+				return "", err
+			}
+			closeLists(0)
+			out.WriteString(blocks)
+		}
+	}
+	closeLists(0)
+
+	return out.String(), nil
+}
+
+// paragraphTag returns the element of a paragraph, following its style, or
+// the list it belongs to.
+func (c *docxConverter) paragraphTag(p *docxNode) (tag string, level int, list bool) {
+	properties := p.child("pPr")
+	if properties == nil {
+		return "p", 0, false
+	}
+
+	style := ""
+	if id := properties.child("pStyle"); id != nil {
+		style = c.styles[id.attr("val")]
+		if style == "" {
+			style = strings.ToLower(id.attr("val"))
+		}
+	}
+
+	if numbering := properties.child("numPr"); numbering != nil {
+		id, levelNode := numbering.child("numId"), numbering.child("ilvl")
+		if id != nil && id.attr("val") != "0" {
+			levelName := "0"
+			if levelNode != nil {
+				levelName = levelNode.attr("val")
+			}
+			level, _ = strconv.Atoi(levelName)
+			level = min(max(level, 0), 8)
+
+			tag = "ol"
+			if c.numbering[id.attr("val")][levelName] == "bullet" {
+				tag = "ul"
+			}
+			return tag, level, true
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(style, "list bullet"):
+		return "ul", 0, true
+	case strings.HasPrefix(style, "list number"):
+		return "ol", 0, true
+	case style == "title", style == "subtitle":
+		return style, 0, false
+	case style == "quote", style == "intense quote":
+		return "blockquote", 0, false
+	case strings.HasPrefix(style, "heading "):
+		if n, err := strconv.Atoi(strings.TrimPrefix(style, "heading ")); err == nil && n >= 1 && n <= 6 {
+			return "h" + strconv.Itoa(n), 0, false
+		}
+	}
+	return "p", 0, false
+}
+
+// docxText returns the text of a paragraph.
+func docxText(p *docxNode) string {
+	var builder strings.Builder
+	var walk func(node *docxNode)
+	walk = func(node *docxNode) {
+		switch node.XMLName.Local {
+		case "t":
+			builder.WriteString(node.Text)
+			return
+		case "del", "moveFrom", "instrText":
+			return
+		}
+		for i := range node.Nodes {
+			walk(&node.Nodes[i])
+		}
+	}
+	walk(p)
+	return strings.Join(strings.Fields(builder.String()), " ")
+}
+
+// inline renders the runs of a paragraph, merging the runs with the same
+// formatting that Word splits text into.
+func (c *docxConverter) inline(nodes []docxNode) (string, error) {
+	runs := []docxRun{}
+	if err := c.runs(nodes, &runs); err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(runs); {
+		format := runs[i].Format
+		var group strings.Builder
+		for ; i < len(runs) && runs[i].Format == format; i++ {
+			group.WriteString(runs[i].HTML)
+		}
+		out.WriteString(formatHTML(format, group.String()))
+	}
+	return out.String(), nil
+}
+
+// formatHTML wraps content in the elements of a character formatting.
+func formatHTML(format docxFormat, content string) string {
+	if strings.TrimSpace(content) == "" {
+		return content
+	}
+
+	tags := []string{}
+	if format.Bold {
+		tags = append(tags, "strong")
+	}
+	if format.Italic {
+		tags = append(tags, "em")
+	}
+	if format.Underline {
+		tags = append(tags, "u")
+	}
+	if format.Strike {
+		tags = append(tags, "s")
+	}
+	switch format.VertAlign {
+	case "superscript":
+		tags = append(tags, "sup")
+	case "subscript":
+		tags = append(tags, "sub")
+	}
+
+	for i := len(tags) - 1; i >= 0; i-- {
+		content = "<" + tags[i] + ">" + content + "</" + tags[i] + ">"
+	}
+	return content
+}
+
+// runs collects the runs of paragraph content.
+func (c *docxConverter) runs(nodes []docxNode, runs *[]docxRun) error {
+	for i := range nodes {
+		node := &nodes[i]
+
+		switch node.XMLName.Local {
+		case "r":
+			run := docxRun{}
+			if properties := node.child("rPr"); properties != nil {
+				run.Format = docxFormat{
+					Bold:      properties.child("b").on(),
+					Italic:    properties.child("i").on(),
+					Underline: properties.child("u").on(),
+					Strike:    properties.child("strike").on() || properties.child("dstrike").on(),
+				}
+				if align := properties.child("vertAlign"); align != nil {
+					run.Format.VertAlign = align.attr("val")
+				}
+			}
+
+			var content strings.Builder
+			for j := range node.Nodes {
+				child := &node.Nodes[j]
+				switch child.XMLName.Local {
+				case "t":
+					content.WriteString(html.EscapeString(child.Text))
+				case "tab":
+					content.WriteString(" ")
+				case "noBreakHyphen":
+					content.WriteString("-")
+				case "br", "cr":
+					if child.attr("type") != "page" && child.attr("type") != "column" {
+						content.WriteString("<br>")
+					}
+				case "drawing", "pict":
+					image, err := c.image(child)
+					if err != nil {
+						return err
+					}
+					content.WriteString(image)
+				}
+			}
+			run.HTML = content.String()
+			*runs = append(*runs, run)
+		case "hyperlink":
+			content, err := c.inline(node.Nodes)
+			if err != nil {
+				return err
+			}
+			if rel, ok := c.rels[node.relAttr("id")]; ok && rel.External {
+				content = `<a href="` + html.EscapeString(rel.Target) + `">` + content + "</a>"
+			}
+			*runs = append(*runs, docxRun{HTML: content})
+		case "sdt":
+			if content := node.child("sdtContent"); content != nil {
+				if err := c.runs(content.Nodes, runs); err != nil {
+					return err
+				}
+			}
+		case "ins", "smartTag", "customXml", "fldSimple", "moveTo":
+			// tracked insertions and other wrappers of runs (tracked deletions are dropped)
+			if err := c.runs(node.Nodes, runs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// image renders a drawing (or a legacy VML picture) of the document, adding
+// its image to the lesson.
+func (c *docxConverter) image(node *docxNode) (string, error) {
+	id := ""
+	if blip := node.find("blip"); blip != nil {
+		id = blip.relAttr("embed")
+	} else if data := node.find("imagedata"); data != nil {
+		id = data.relAttr("id")
+	}
+	rel, ok := c.rels[id]
+	if !ok || rel.External {
+		return "", nil
+	}
+
+	name := strings.TrimPrefix(rel.Target, "/")
+	if !strings.HasPrefix(rel.Target, "/") {
+		name = path.Join(c.dir, rel.Target)
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".emf", ".wmf":
+		// Windows metafiles aren't shown by browsers
+		return "", nil
+	}
+
+	placeholder, ok := c.images[name]
+	if !ok {
+		file, exists := c.files[name]
+		if !exists {
+			return "", nil
+		}
+		content, err := readZipFile(file, lessonDocumentMaxSize)
+		if err != nil {
+			return "", err
+		}
+		if placeholder, err = c.doc.addImage(content, path.Base(name)); err != nil {
+			return "", err
+		}
+		c.images[name] = placeholder
+	}
+
+	alt := ""
+	if properties := node.find("docPr"); properties != nil {
+		alt = properties.attr("descr")
+		if alt == "" {
+			alt = properties.attr("title")
+		}
+	}
+	return fmt.Sprintf(`<img src="%s" alt="%s">`, placeholder, html.EscapeString(alt)), nil
+}
+
+// docxCell is a cell of a table, positioned in the table grid.
+type docxCell struct {
+	Column, Span int
+	// "restart" for the first cell of vertically merged cells, "continue" for the others
+	Merge   string
+	Content string
+}
+
+// table renders a table of the document, with its merged cells.
+func (c *docxConverter) table(tbl *docxNode) (string, error) {
+	rows := [][]docxCell{}
+	headers := []bool{}
+
+	for i := range tbl.Nodes {
+		tr := &tbl.Nodes[i]
+		if tr.XMLName.Local != "tr" {
+			continue
+		}
+
+		row := []docxCell{}
+		column := 0
+		for j := range tr.Nodes {
+			tc := &tr.Nodes[j]
+			if tc.XMLName.Local != "tc" {
+				continue
+			}
+
+			cell := docxCell{Column: column, Span: 1}
+			if properties := tc.child("tcPr"); properties != nil {
+				if span := properties.child("gridSpan"); span != nil {
+					if n, err := strconv.Atoi(span.attr("val")); err == nil && n > 1 {
+						cell.Span = n
+					}
+				}
+				if merge := properties.child("vMerge"); merge != nil {
+					cell.Merge = "continue"
+					if merge.attr("val") == "restart" {
+						cell.Merge = "restart"
+					}
+				}
+			}
+
+			content, err := c.blocks(tc.Nodes)
+			if err != nil {
+				return "", err
+			}
+			// a single paragraph is the cell content itself
+			if inner, ok := strings.CutPrefix(content, "<p>"); ok && strings.Count(content, "<p>") == 1 && strings.HasSuffix(inner, "</p>") {
+				content = strings.TrimSuffix(inner, "</p>")
+			}
+			cell.Content = content
+
+			row = append(row, cell)
+			column += cell.Span
+		}
+
+		rows = append(rows, row)
+		properties := tr.child("trPr")
+		headers = append(headers, properties != nil && properties.child("tblHeader").on())
+	}
+
+	var out strings.Builder
+	out.WriteString("<table>")
+	for i, row := range rows {
+		if i == 0 && headers[0] {
+			out.WriteString("<thead>")
+		} else if i == 0 || headers[i-1] && !headers[i] {
+			out.WriteString("<tbody>")
+		}
+
+		tag := "td"
+		if headers[i] {
+			tag = "th"
+		}
+		out.WriteString("<tr>")
+		for _, cell := range row {
+			if cell.Merge == "continue" {
+				continue
+			}
+
+			attrs := ""
+			if cell.Span > 1 {
+				attrs += fmt.Sprintf(` colspan="%d"`, cell.Span)
+			}
+			if cell.Merge == "restart" {
+				span := 1
+				for _, next := range rows[i+1:] {
+					if !rowHasCell(next, cell.Column, "continue") {
+						break
+					}
+					span++
+				}
+				if span > 1 {
+					attrs += fmt.Sprintf(` rowspan="%d"`, span)
+				}
+			}
+			out.WriteString("<" + tag + attrs + ">" + cell.Content + "</" + tag + ">")
+		}
+		out.WriteString("</tr>")
+
+		if headers[i] && (i == len(rows)-1 || !headers[i+1]) {
+			out.WriteString("</thead>")
+		} else if i == len(rows)-1 {
+			out.WriteString("</tbody>")
+		}
+	}
+	out.WriteString("</table>")
+
+	return out.String(), nil
+}
+
+// rowHasCell reports whether a row has a cell with the given merge at a column of the grid.
+func rowHasCell(row []docxCell, column int, merge string) bool {
+	for _, cell := range row {
+		if cell.Column == column && cell.Merge == merge {
+			return true
+		}
+	}
+	return false
+}
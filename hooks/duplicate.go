@@ -0,0 +1,209 @@
+package hooks
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// copyRecord returns an unsaved copy of a record, with a new id and copies of
+// its stored files, which keep their names.
+func copyRecord(record *core.Record, fsys *filesystem.System) (*core.Record, error) {
+	copied := core.NewRecord(record.Collection())
+	copied.Set("id", core.GenerateDefaultRandomId())
+
+	for _, field := range record.Collection().Fields {
+		name := field.GetName()
+		switch field.(type) {
+		case *core.AutodateField, *core.PasswordField:
+			continue
+		case *core.FileField:
+			files := []*filesystem.File{}
+			for _, storedName := range record.GetStringSlice(name) {
+				file, err := fsys.GetReuploadableFile(record.BaseFilesPath()+"/"+storedName, true)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read %s: %w", storedName, err)
+				}
+				files = append(files, file)
+			}
+			copied.Set(name, files)
+		default:
+			if name != "id" {
+				copied.Set(name, record.Get(name))
+			}
+		}
+	}
+
+	return copied, nil
+}
+
+// DuplicateCourse copies a course with its lessons, their stored files, FAQs
+// and resources. The copy is titled title, when given, and keeps the course
+// assignees only when withAssignees is set, starting their progress over.
+func (cs *CourseService) DuplicateCourse(courseID, title string, withAssignees bool) (*core.Record, error) {
+	fsys, err := cs.app.NewFilesystem()
+	if err != nil {
+		return nil, err
+	}
+	defer fsys.Close()
+
+	var duplicate *core.Record
+
+	err = cs.app.RunInTransaction(func(txApp core.App) error {
+		txService := cs.withApp(txApp)
+
+		course, err := txApp.FindRecordById("courses", courseID)
+		if err != nil {
+			return fmt.Errorf("failed to find course: %w", err)
+		}
+
+		duplicate, err = copyRecord(course, fsys)
+		if err != nil {
+			return err
+		}
+		if title != "" {
+			duplicate.Set("title", title)
+		}
+		if !withAssignees {
+			duplicate.Set("assignees", []string{})
+			duplicate.Set("assign_to_everyone", false)
+		}
+		if err := txApp.Save(duplicate); err != nil {
+			return fmt.Errorf("failed to save course: %w", err)
+		}
+
+		lessons, err := txApp.FindRecordsByFilter("lessons", "course = {:course}", "created", 0, 0, dbx.Params{"course": course.Id})
+		if err != nil {
+			return fmt.Errorf("failed to find lessons: %w", err)
+		}
+
+		// the copy of every lesson, to remap the lesson files and relations
+		copies := map[string]*core.Record{}
+		for _, lesson := range lessons {
+			copies[lesson.Id], err = copyRecord(lesson, fsys)
+			if err != nil {
+				return fmt.Errorf("failed to copy lesson %q: %w", lesson.GetString("title"), err)
+			}
+		}
+		remap := func(recordID string) (string, string, bool) {
+			if copied, ok := copies[recordID]; ok {
+				return copied.Collection().Id, copied.Id, true
+			}
+			return "", "", false
+		}
+
+		created := types.NowDateTime()
+		for i, lesson := range lessons {
+			copied := copies[lesson.Id]
+			copied.Set("course", duplicate.Id)
+			// lessons are listed by creation date
+			copied.SetRaw("created", created.Add(time.Duration(i)*time.Millisecond))
+
+			content, err := remapFileURLs(lesson.GetString("content"), remap)
+			if err != nil {
+				return fmt.Errorf("failed to remap the content files of lesson %q: %w", lesson.GetString("title"), err)
+			}
+			copied.Set("content", content)
+
+			if err := txApp.Save(copied); err != nil {
+				return fmt.Errorf("failed to save lesson %q: %w", lesson.GetString("title"), err)
+			}
+		}
+
+		// FAQs and resources shared by several lessons are copied once
+		copiedRelated := map[string]bool{}
+		for _, lesson := range lessons {
+			faqs, err := findLessonFAQs(txApp, lesson.Id)
+			if err != nil {
+				return fmt.Errorf("failed to find the FAQs of lesson %q: %w", lesson.GetString("title"), err)
+			}
+			resources, err := findLessonResources(txApp, lesson.Id)
+			if err != nil {
+				return fmt.Errorf("failed to find the resources of lesson %q: %w", lesson.GetString("title"), err)
+			}
+
+			for _, record := range append(faqs, resources...) {
+				if copiedRelated[record.Id] {
+					continue
+				}
+				copiedRelated[record.Id] = true
+
+				copied, err := copyRecord(record, fsys)
+				if err != nil {
+					return err
+				}
+				// only the lessons of the course are linked to the copy
+				lessonIDs := []string{}
+				for _, id := range record.GetStringSlice("lesson") {
+					if copies[id] != nil {
+						lessonIDs = append(lessonIDs, copies[id].Id)
+					}
+				}
+				copied.Set("lesson", lessonIDs)
+
+				if err := txApp.Save(copied); err != nil {
+					return fmt.Errorf("failed to save %s of lesson %q: %w", record.Collection().Name, lesson.GetString("title"), err)
+				}
+			}
+		}
+
+		assignees, err := txService.ProcessAssignToEveryone(duplicate)
+		if err != nil {
+			return err
+		}
+		for _, assignee := range assignees {
+			if err := txService.CreateProgressRecord(duplicate.Id, assignee, StatusNotStarted); err != nil {
+				return err
+			}
+		}
+
+		return txService.Audit(AuditCourseDuplicated, duplicate.Collection().Name, duplicate.Id, map[string]any{
+			"source":    course.Id,
+			"lessons":   len(lessons),
+			"assignees": assignees,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return duplicate, nil
+}
+
+func bindDuplicateRoutes(r *router.Router[*core.RequestEvent], courseService *CourseService) {
+	// copy a course, eg. to refresh it for a new year
+	r.POST("/api/courses/{id}/duplicate", func(e *core.RequestEvent) error {
+		data := struct {
+			Title            string `json:"title" form:"title"`
+			WithoutAssignees bool   `json:"without_assignees" form:"without_assignees"`
+		}{}
+		if err := e.BindBody(&data); err != nil {
+			return e.BadRequestError("Failed to read request data.", err)
+		}
+
+		course, err := e.App.FindRecordById("courses", e.Request.PathValue("id"))
+		if err != nil {
+			return e.NotFoundError("", err)
+		}
+		if !CanManageCourse(e.Auth, course) {
+			return e.ForbiddenError("Only the admins of the course organization can duplicate it.", nil)
+		}
+
+		duplicate, err := courseService.WithActor(requestActor(e)).DuplicateCourse(course.Id, data.Title, !data.WithoutAssignees)
+		if err != nil {
+			return e.InternalServerError("Failed to duplicate the course.", err)
+		}
+
+		if err := apis.EnrichRecord(e, duplicate); err != nil {
+			return e.InternalServerError("", err)
+		}
+		return e.JSON(http.StatusOK, duplicate)
+	}).Bind(RequireRole(RoleOrgAdmin))
+}
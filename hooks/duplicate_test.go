@@ -0,0 +1,171 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestCourseService_DuplicateCourse(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, users := createTestCollections(t, app)
+	learner := createTestUser(t, app, users, "learner@example.com", "")
+	course, lessons := createTestAuthoredCourse(t, app, courses)
+	course.Set("assignees", []string{learner.Id})
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+
+	duplicate, err := service.DuplicateCourse(course.Id, "Forklift safety 2027", true)
+	if err != nil {
+		t.Fatalf("DuplicateCourse failed: %v", err)
+	}
+	if duplicate.Id == course.Id || duplicate.GetString("title") != "Forklift safety 2027" || duplicate.GetString("organization") != testOrg1 ||
+		duplicate.GetString("description") != "Driving forklifts in the warehouse" {
+		t.Errorf("Unexpected duplicate %v", duplicate.FieldsData())
+	}
+	if assignees := duplicate.GetStringSlice("assignees"); len(assignees) != 1 || assignees[0] != learner.Id {
+		t.Errorf("Expected the duplicate to keep its assignees, got %v", assignees)
+	}
+	if records, err := app.FindAllRecords("progress", dbx.HashExp{"course": duplicate.Id, "assignee": learner.Id, "status": StatusNotStarted}); err != nil || len(records) != 1 {
+		t.Errorf("Expected the assignee progress to start over, got %d %v", len(records), err)
+	}
+
+	copies, err := app.FindRecordsByFilter("lessons", "course = {:course}", "created", 0, 0, dbx.Params{"course": duplicate.Id})
+	if err != nil || len(copies) != 2 {
+		t.Fatalf("Expected 2 copied lessons, got %d %v", len(copies), err)
+	}
+	basics := copies[0]
+	if basics.Id == lessons[0].Id || basics.GetString("title") != "Basics" || copies[1].GetString("title") != "Advanced <maneuvers>" {
+		t.Errorf("Expected the lessons to keep their order, got %q and %q", basics.GetString("title"), copies[1].GetString("title"))
+	}
+
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		t.Fatalf("Failed to open the filesystem: %v", err)
+	}
+	defer fsys.Close()
+	for _, field := range []string{"video", "thumbnail", "captions", "downloads"} {
+		for _, name := range basics.GetStringSlice(field) {
+			if exists, err := fsys.Exists(basics.BaseFilesPath() + "/" + name); err != nil || !exists {
+				t.Errorf("Expected the %s file %s to be copied, got %v", field, name, err)
+			}
+		}
+		if strings.Join(basics.GetStringSlice(field), ",") != strings.Join(lessons[0].GetStringSlice(field), ",") {
+			t.Errorf("Expected the %s files to keep their names, got %v", field, basics.GetStringSlice(field))
+		}
+	}
+
+	diagramURL := lessonFileURL(basics, basics.GetStringSlice("downloads")[0])
+	if !strings.Contains(basics.GetString("content"), `src="`+diagramURL+`"`) {
+		t.Errorf("Expected the content to embed the copied diagram, got %q", basics.GetString("content"))
+	}
+
+	if faqs, err := findLessonFAQs(app, basics.Id); err != nil || len(faqs) != 1 || faqs[0].GetString("answer") != "Yes, a valid operator license." {
+		t.Errorf("Expected the copied FAQ, got %d %v", len(faqs), err)
+	}
+	resources, err := findLessonResources(app, copies[1].Id)
+	if err != nil || len(resources) != 1 || strings.Join(resources[0].GetStringSlice("lesson"), ",") != basics.Id+","+copies[1].Id {
+		t.Errorf("Expected the resource shared by both copied lessons, got %d %v", len(resources), err)
+	}
+	if original, err := findLessonResources(app, lessons[1].Id); err != nil || len(original) != 1 ||
+		strings.Join(original[0].GetStringSlice("lesson"), ",") != lessons[0].Id+","+lessons[1].Id {
+		t.Errorf("Expected the original resource to be left untouched, got %d %v", len(original), err)
+	}
+
+	entries, err := app.FindAllRecords("audit_log", dbx.HashExp{"action": AuditCourseDuplicated, "target_id": duplicate.Id})
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected the duplication to be audited, got %d %v", len(entries), err)
+	}
+
+	blank, err := service.DuplicateCourse(course.Id, "", false)
+	if err != nil {
+		t.Fatalf("DuplicateCourse failed: %v", err)
+	}
+	if blank.GetString("title") != "Forklift safety" || len(blank.GetStringSlice("assignees")) != 0 {
+		t.Errorf("Expected a copy without assignees, got %v", blank.FieldsData())
+	}
+	if records, err := app.FindAllRecords("progress", dbx.HashExp{"course": blank.Id}); err != nil || len(records) != 0 {
+		t.Errorf("Expected no progress for the copy without assignees, got %d %v", len(records), err)
+	}
+}
+
+func TestDuplicateRoutes(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, users := createTestCollections(t, app)
+	course, _ := createTestAuthoredCourse(t, app, courses)
+
+	newUser := func(email, role, organization string) *core.Record {
+		user := core.NewRecord(users)
+		user.SetEmail(email)
+		user.SetPassword("1234567890")
+		user.Set("role", role)
+		user.Set("organization", organization)
+		if err := app.Save(user); err != nil {
+			t.Fatalf("Failed to save user: %v", err)
+		}
+		return user
+	}
+	admin := newUser("admin@example.com", RoleOrgAdmin, testOrg1)
+	otherAdmin := newUser("admin2@example.com", RoleOrgAdmin, testOrg2)
+	instructor := newUser("instructor@example.com", RoleInstructor, testOrg1)
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	bindDuplicateRoutes(r, service)
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	duplicate := func(user *core.Record, body string) (int, map[string]any) {
+		t.Helper()
+
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/courses/"+course.Id+"/duplicate", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		token, err := user.NewAuthToken()
+		if err != nil {
+			t.Fatalf("Failed to create auth token: %v", err)
+		}
+		req.Header.Set("Authorization", token)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Duplicate request failed: %v", err)
+		}
+		defer res.Body.Close()
+
+		content, _ := io.ReadAll(res.Body)
+		data := map[string]any{}
+		json.Unmarshal(content, &data)
+		return res.StatusCode, data
+	}
+
+	if status, _ := duplicate(instructor, "{}"); status != http.StatusForbidden {
+		t.Errorf("Expected instructors not to duplicate courses, got %d", status)
+	}
+	if status, _ := duplicate(otherAdmin, "{}"); status != http.StatusForbidden {
+		t.Errorf("Expected the admins of other organizations not to duplicate the course, got %d", status)
+	}
+
+	status, data := duplicate(admin, `{"title": "Forklift safety 2027", "without_assignees": true}`)
+	if status != http.StatusOK || data["title"] != "Forklift safety 2027" || data["id"] == course.Id {
+		t.Errorf("Expected the admin to duplicate the course, got %d %v", status, data)
+	}
+}
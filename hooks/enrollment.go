@@ -0,0 +1,278 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Course enrollment modes. Courses without a mode are assigned-only.
+const (
+	EnrollmentAssigned = "assigned"
+	EnrollmentOpen     = "open"
+	EnrollmentApproval = "approval"
+)
+
+const (
+	EnrollmentRequestPending  = "pending"
+	EnrollmentRequestApproved = "approved"
+	EnrollmentRequestRejected = "rejected"
+)
+
+var (
+	ErrAlreadyEnrolled          = errors.New("already enrolled in the course")
+	ErrEnrollmentClosed         = errors.New("course is not open for enrollment")
+	ErrEnrollmentRequestDecided = errors.New("enrollment request was already decided")
+)
+
+// EnrollUser assigns a user to a course and creates their progress record.
+func (cs *CourseService) EnrollUser(courseID, userID string) error {
+	return cs.app.RunInTransaction(func(txApp core.App) error {
+		txService := cs.withApp(txApp)
+
+		courseRecord, err := txApp.FindRecordById("courses", courseID)
+		if err != nil {
+			return fmt.Errorf("failed to find course: %w", err)
+		}
+
+		assignees := courseRecord.GetStringSlice("assignees")
+		if slices.Contains(assignees, userID) {
+			return ErrAlreadyEnrolled
+		}
+
+		courseRecord.Set("assignees", append(assignees, userID))
+		if err := txApp.Save(courseRecord); err != nil {
+			return fmt.Errorf("failed to save course with new assignee: %w", err)
+		}
+
+		err = txService.Audit(AuditCourseAssigneeAdded, courseRecord.Collection().Name, courseRecord.Id, map[string]any{
+			"assignee": userID,
+		})
+		if err != nil {
+			return err
+		}
+
+		return txService.CreateProgressRecord(courseRecord.Id, userID, StatusNotStarted)
+	})
+}
+
+// RequestEnrollment queues an enrollment request for an approval-required course,
+// returning the pending request of the user if there is one already.
+func (cs *CourseService) RequestEnrollment(courseID, userID string) (*core.Record, error) {
+	var enrollmentRequest *core.Record
+
+	err := cs.app.RunInTransaction(func(txApp core.App) error {
+		txService := cs.withApp(txApp)
+
+		courseRecord, err := txApp.FindRecordById("courses", courseID)
+		if err != nil {
+			return fmt.Errorf("failed to find course: %w", err)
+		}
+
+		if courseRecord.GetString("enrollment") != EnrollmentApproval {
+			return ErrEnrollmentClosed
+		}
+
+		if slices.Contains(courseRecord.GetStringSlice("assignees"), userID) {
+			return ErrAlreadyEnrolled
+		}
+
+		enrollmentRequest, err = txApp.FindFirstRecordByFilter(
+			"enrollment_requests",
+			"course = {:course} && user = {:user} && status = {:status}",
+			dbx.Params{"course": courseID, "user": userID, "status": EnrollmentRequestPending},
+		)
+		if err == nil {
+			return nil
+		}
+
+		requestsCollection, err := txApp.FindCollectionByNameOrId("enrollment_requests")
+		if err != nil {
+			return fmt.Errorf("failed to find enrollment_requests collection: %w", err)
+		}
+
+		enrollmentRequest = core.NewRecord(requestsCollection)
+		enrollmentRequest.Set("course", courseID)
+		enrollmentRequest.Set("user", userID)
+		enrollmentRequest.Set("status", EnrollmentRequestPending)
+
+		if err := txApp.Save(enrollmentRequest); err != nil {
+			return fmt.Errorf("failed to save enrollment request: %w", err)
+		}
+
+		return txService.Audit(AuditEnrollmentRequested, requestsCollection.Name, enrollmentRequest.Id, map[string]any{
+			"course": courseID,
+			"user":   userID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return enrollmentRequest, nil
+}
+
+// DecideEnrollmentRequest approves (enrolling the user) or rejects a pending enrollment request.
+func (cs *CourseService) DecideEnrollmentRequest(requestID string, approve bool) (*core.Record, error) {
+	var enrollmentRequest *core.Record
+
+	err := cs.app.RunInTransaction(func(txApp core.App) error {
+		txService := cs.withApp(txApp)
+
+		var err error
+		enrollmentRequest, err = txApp.FindRecordById("enrollment_requests", requestID)
+		if err != nil {
+			return fmt.Errorf("failed to find enrollment request: %w", err)
+		}
+
+		if enrollmentRequest.GetString("status") != EnrollmentRequestPending {
+			return ErrEnrollmentRequestDecided
+		}
+
+		status, action := EnrollmentRequestRejected, AuditEnrollmentRejected
+		if approve {
+			status, action = EnrollmentRequestApproved, AuditEnrollmentApproved
+		}
+
+		enrollmentRequest.Set("status", status)
+		enrollmentRequest.Set("decided_by", cs.actor)
+		enrollmentRequest.Set("decided_at", types.NowDateTime())
+
+		if err := txApp.Save(enrollmentRequest); err != nil {
+			return fmt.Errorf("failed to save enrollment request: %w", err)
+		}
+
+		err = txService.Audit(action, enrollmentRequest.Collection().Name, enrollmentRequest.Id, map[string]any{
+			"course": enrollmentRequest.GetString("course"),
+			"user":   enrollmentRequest.GetString("user"),
+		})
+		if err != nil {
+			return err
+		}
+
+		if !approve {
+			return nil
+		}
+
+		err = txService.EnrollUser(enrollmentRequest.GetString("course"), enrollmentRequest.GetString("user"))
+		if errors.Is(err, ErrAlreadyEnrolled) {
+			// assigned in the meantime
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return enrollmentRequest, nil
+}
+
+// canDecideEnrollment reports whether the auth record can approve or reject
+// the enrollment of user into course: the course managers and the user's managers.
+func canDecideEnrollment(auth, course, user *core.Record) bool {
+	if CanManageCourse(auth, course) {
+		return true
+	}
+
+	return UserRole(auth) == RoleManager && slices.Contains(user.GetStringSlice("managers"), auth.Id)
+}
+
+func bindEnrollmentRoutes(r *router.Router[*core.RequestEvent], courseService *CourseService) {
+	// enroll the current user into an open course, or ask to be enrolled into an approval-required one
+	r.POST("/api/courses/{id}/enroll", func(e *core.RequestEvent) error {
+		courseRecord, err := e.App.FindRecordById("courses", e.Request.PathValue("id"))
+		if err != nil || courseRecord.GetString("organization") != e.Auth.GetString("organization") {
+			return e.NotFoundError("", err)
+		}
+
+		courseService := courseService.WithActor(e.Auth.Id)
+
+		switch courseRecord.GetString("enrollment") {
+		case EnrollmentOpen:
+			if err := courseService.EnrollUser(courseRecord.Id, e.Auth.Id); err != nil {
+				return enrollmentError(e, err)
+			}
+
+			progressRecord, err := e.App.FindFirstRecordByFilter(
+				"progress",
+				"course = {:course} && assignee = {:assignee}",
+				dbx.Params{"course": courseRecord.Id, "assignee": e.Auth.Id},
+			)
+			if err != nil {
+				return e.InternalServerError("", err)
+			}
+
+			if err := apis.EnrichRecord(e, progressRecord); err != nil {
+				return e.InternalServerError("", err)
+			}
+
+			return e.JSON(http.StatusOK, progressRecord)
+		case EnrollmentApproval:
+			enrollmentRequest, err := courseService.RequestEnrollment(courseRecord.Id, e.Auth.Id)
+			if err != nil {
+				return enrollmentError(e, err)
+			}
+
+			if err := apis.EnrichRecord(e, enrollmentRequest); err != nil {
+				return e.InternalServerError("", err)
+			}
+
+			return e.JSON(http.StatusAccepted, enrollmentRequest)
+		default:
+			return enrollmentError(e, ErrEnrollmentClosed)
+		}
+	}).Bind(apis.RequireAuth("users"))
+
+	decide := func(approve bool) func(e *core.RequestEvent) error {
+		return func(e *core.RequestEvent) error {
+			enrollmentRequest, err := e.App.FindRecordById("enrollment_requests", e.Request.PathValue("id"))
+			if err != nil {
+				return e.NotFoundError("", err)
+			}
+
+			courseRecord, err := e.App.FindRecordById("courses", enrollmentRequest.GetString("course"))
+			if err != nil {
+				return e.NotFoundError("", err)
+			}
+
+			user, err := e.App.FindRecordById("users", enrollmentRequest.GetString("user"))
+			if err != nil {
+				return e.NotFoundError("", err)
+			}
+
+			if !canDecideEnrollment(e.Auth, courseRecord, user) {
+				return e.ForbiddenError("Only the course instructor or the learner's managers can decide this enrollment.", nil)
+			}
+
+			enrollmentRequest, err = courseService.WithActor(requestActor(e)).DecideEnrollmentRequest(enrollmentRequest.Id, approve)
+			if err != nil {
+				return enrollmentError(e, err)
+			}
+
+			return e.JSON(http.StatusOK, enrollmentRequest)
+		}
+	}
+
+	r.POST("/api/enrollment-requests/{id}/approve", decide(true)).Bind(apis.RequireAuth())
+	r.POST("/api/enrollment-requests/{id}/reject", decide(false)).Bind(apis.RequireAuth())
+}
+
+func enrollmentError(e *core.RequestEvent, err error) error {
+	switch {
+	case errors.Is(err, ErrAlreadyEnrolled):
+		return e.BadRequestError("You are already enrolled in this course.", nil)
+	case errors.Is(err, ErrEnrollmentClosed):
+		return e.ForbiddenError("This course is not open for enrollment.", nil)
+	case errors.Is(err, ErrEnrollmentRequestDecided):
+		return e.BadRequestError("The enrollment request was already decided.", nil)
+	}
+	return e.InternalServerError("Failed to enroll.", err)
+}
@@ -0,0 +1,101 @@
+package hooks
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+func createTestCourse(t *testing.T, app *tests.TestApp, courses *core.Collection, enrollment string) *core.Record {
+	course := core.NewRecord(courses)
+	course.Set("title", "Course "+enrollment)
+	course.Set("enrollment", enrollment)
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+	return course
+}
+
+func TestCourseService_EnrollUser(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	user := createTestLearner(t, app)
+	course := createTestCourse(t, app, courses, EnrollmentOpen)
+
+	if err := service.EnrollUser(course.Id, user.Id); err != nil {
+		t.Fatalf("EnrollUser failed: %v", err)
+	}
+
+	course, err := app.FindRecordById("courses", course.Id)
+	if err != nil {
+		t.Fatalf("Failed to reload course: %v", err)
+	}
+	if !slices.Contains(course.GetStringSlice("assignees"), user.Id) {
+		t.Errorf("Expected %s to be assigned, got %v", user.Id, course.GetStringSlice("assignees"))
+	}
+
+	progressRecords, err := app.FindAllRecords("progress")
+	if err != nil {
+		t.Fatalf("Failed to find progress records: %v", err)
+	}
+	if len(progressRecords) != 1 || progressRecords[0].GetString("status") != StatusNotStarted {
+		t.Errorf("Expected a single Not Started progress record, got %d", len(progressRecords))
+	}
+
+	if err := service.EnrollUser(course.Id, user.Id); !errors.Is(err, ErrAlreadyEnrolled) {
+		t.Errorf("Expected ErrAlreadyEnrolled, got %v", err)
+	}
+}
+
+func TestCourseService_EnrollmentRequests(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	user := createTestLearner(t, app)
+
+	openCourse := createTestCourse(t, app, courses, EnrollmentOpen)
+	if _, err := service.RequestEnrollment(openCourse.Id, user.Id); !errors.Is(err, ErrEnrollmentClosed) {
+		t.Errorf("Expected ErrEnrollmentClosed for an open course, got %v", err)
+	}
+
+	course := createTestCourse(t, app, courses, EnrollmentApproval)
+
+	request, err := service.RequestEnrollment(course.Id, user.Id)
+	if err != nil {
+		t.Fatalf("RequestEnrollment failed: %v", err)
+	}
+
+	again, err := service.RequestEnrollment(course.Id, user.Id)
+	if err != nil {
+		t.Fatalf("RequestEnrollment failed: %v", err)
+	}
+	if again.Id != request.Id {
+		t.Errorf("Expected the pending request %s to be reused, got %s", request.Id, again.Id)
+	}
+
+	decided, err := service.WithActor("manager1").DecideEnrollmentRequest(request.Id, true)
+	if err != nil {
+		t.Fatalf("DecideEnrollmentRequest failed: %v", err)
+	}
+	if decided.GetString("status") != EnrollmentRequestApproved || decided.GetString("decided_by") != "manager1" {
+		t.Errorf("Expected the request to be approved by manager1, got %q by %q", decided.GetString("status"), decided.GetString("decided_by"))
+	}
+
+	course, err = app.FindRecordById("courses", course.Id)
+	if err != nil {
+		t.Fatalf("Failed to reload course: %v", err)
+	}
+	if !slices.Contains(course.GetStringSlice("assignees"), user.Id) {
+		t.Errorf("Expected the approved user to be assigned")
+	}
+
+	if _, err := service.DecideEnrollmentRequest(request.Id, false); !errors.Is(err, ErrEnrollmentRequestDecided) {
+		t.Errorf("Expected ErrEnrollmentRequestDecided, got %v", err)
+	}
+}
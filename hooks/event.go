@@ -10,20 +10,23 @@ import (
 )
 
 type CourseService struct {
-	app core.App
+	app    core.App
+	actor  string
+	events *CourseEvents
 }
 
 func NewCourseService(app core.App) *CourseService {
-	return &CourseService{app: app}
+	return &CourseService{app: app, events: Events(app)}
 }
 
-func (cs *CourseService) GetAllUserIDs() ([]string, error) {
+// GetAllUserIDs returns the ids of every user of an organization.
+func (cs *CourseService) GetAllUserIDs(organizationID string) ([]string, error) {
 	usersCollection, err := cs.app.FindCollectionByNameOrId("users")
 	if err != nil {
 		return nil, fmt.Errorf("failed to find users collection: %w", err)
 	}
 
-	allUsers, err := cs.app.FindAllRecords(usersCollection.Name)
+	allUsers, err := cs.app.FindAllRecords(usersCollection.Name, dbx.HashExp{"organization": organizationID})
 	if err != nil {
 		return nil, fmt.Errorf("failed to find all users: %w", err)
 	}
@@ -45,11 +48,33 @@ func (cs *CourseService) CreateProgressRecord(courseID, assigneeID, status strin
 	progressRecord.Set("course", courseID)
 	progressRecord.Set("assignee", assigneeID)
 	progressRecord.Set("status", status)
+	StampProgressTimestamps(progressRecord, "", status)
 
 	if err := cs.app.Save(progressRecord); err != nil {
 		return fmt.Errorf("failed to save progress record: %w", err)
 	}
-	return nil
+
+	err = cs.Audit(AuditProgressCreated, progressCollection.Name, progressRecord.Id, map[string]any{
+		"course":   courseID,
+		"assignee": assigneeID,
+		"status":   status,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = cs.events.OnCourseAssigned.Trigger(&CourseAssignedEvent{
+		App:        cs.app,
+		Actor:      cs.actor,
+		CourseId:   courseID,
+		AssigneeId: assigneeID,
+		ProgressId: progressRecord.Id,
+	})
+	if err != nil {
+		return err
+	}
+
+	return cs.RecordProgressEvent(progressRecord, "", status, "", ProgressSourceAssignment)
 }
 
 func (cs *CourseService) DeleteProgressRecords(courseID, assigneeID string) error {
@@ -71,6 +96,25 @@ func (cs *CourseService) DeleteProgressRecords(courseID, assigneeID string) erro
 		if err := cs.app.Delete(progressRecord); err != nil {
 			return fmt.Errorf("failed to delete progress record: %w", err)
 		}
+
+		err := cs.Audit(AuditProgressDeleted, progressCollection.Name, progressRecord.Id, map[string]any{
+			"course":   courseID,
+			"assignee": assigneeID,
+			"status":   progressRecord.GetString("status"),
+		})
+		if err != nil {
+			return err
+		}
+
+		err = cs.events.OnAssigneeRemoved.Trigger(&AssigneeRemovedEvent{
+			App:        cs.app,
+			Actor:      cs.actor,
+			CourseId:   courseID,
+			AssigneeId: assigneeID,
+		})
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -92,7 +136,7 @@ func (cs *CourseService) HandleCourseAssigneeChange(courseRecord *core.Record, o
 	}
 
 	for _, assignee := range toAdd {
-		if err := cs.CreateProgressRecord(courseRecord.Id, assignee, "Not Started"); err != nil {
+		if err := cs.CreateProgressRecord(courseRecord.Id, assignee, StatusNotStarted); err != nil {
 			return err
 		}
 	}
@@ -103,7 +147,14 @@ func (cs *CourseService) HandleCourseAssigneeChange(courseRecord *core.Record, o
 		}
 	}
 
-	return nil
+	if len(toAdd) == 0 && len(toRemove) == 0 {
+		return nil
+	}
+
+	return cs.Audit(AuditCourseAssigneesChanged, courseRecord.Collection().Name, courseRecord.Id, map[string]any{
+		"added":   toAdd,
+		"removed": toRemove,
+	})
 }
 
 func (cs *CourseService) ProcessAssignToEveryone(record *core.Record) ([]string, error) {
@@ -111,7 +162,8 @@ func (cs *CourseService) ProcessAssignToEveryone(record *core.Record) ([]string,
 		return record.GetStringSlice("assignees"), nil
 	}
 
-	allUserIDs, err := cs.GetAllUserIDs()
+	// everyone means everyone in the organization of the course
+	allUserIDs, err := cs.GetAllUserIDs(record.GetString("organization"))
 	if err != nil {
 		return nil, err
 	}
@@ -121,11 +173,20 @@ func (cs *CourseService) ProcessAssignToEveryone(record *core.Record) ([]string,
 		return nil, fmt.Errorf("failed to save course with all users: %w", err)
 	}
 
+	err = cs.Audit(AuditCourseAssignToEveryone, record.Collection().Name, record.Id, map[string]any{
+		"assignees": allUserIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return allUserIDs, nil
 }
 
 func (cs *CourseService) RemoveAssigneeFromCourse(courseID, assigneeToRemove string) error {
 	return cs.app.RunInTransaction(func(txApp core.App) error {
+		txService := cs.withApp(txApp)
+
 		courseRecord, err := txApp.FindRecordById("courses", courseID)
 		if err != nil {
 			return fmt.Errorf("failed to find course: %w", err)
@@ -149,7 +210,19 @@ func (cs *CourseService) RemoveAssigneeFromCourse(courseID, assigneeToRemove str
 			return fmt.Errorf("failed to save course after removing assignee: %w", err)
 		}
 
-		return nil
+		err = txService.Audit(AuditCourseAssigneeRemoved, courseRecord.Collection().Name, courseRecord.Id, map[string]any{
+			"assignee": assigneeToRemove,
+		})
+		if err != nil {
+			return err
+		}
+
+		return txService.events.OnAssigneeRemoved.Trigger(&AssigneeRemovedEvent{
+			App:        txApp,
+			Actor:      txService.actor,
+			CourseId:   courseRecord.Id,
+			AssigneeId: assigneeToRemove,
+		})
 	})
 }
 
@@ -170,6 +243,20 @@ func (cs *CourseService) AddAssigneeToCourse(courseID, assigneeID string) error
 		if err := cs.app.Save(courseRecord); err != nil {
 			return fmt.Errorf("failed to save course with new assignee: %w", err)
 		}
+
+		err := cs.Audit(AuditCourseAssigneeAdded, courseRecord.Collection().Name, courseRecord.Id, map[string]any{
+			"assignee": assigneeID,
+		})
+		if err != nil {
+			return err
+		}
+
+		return cs.events.OnCourseAssigned.Trigger(&CourseAssignedEvent{
+			App:        cs.app,
+			Actor:      cs.actor,
+			CourseId:   courseRecord.Id,
+			AssigneeId: assigneeID,
+		})
 	}
 	return nil
 }
@@ -180,6 +267,11 @@ func (cs *CourseService) AssignUserToAllEveryCourses(userID string) error {
 		return fmt.Errorf("failed to find progress collection: %w", err)
 	}
 
+	user, err := cs.app.FindRecordById("users", userID)
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
 	coursesCollection, err := cs.app.FindCollectionByNameOrId("courses")
 	if err != nil {
 		return fmt.Errorf("failed to find courses collection: %w", err)
@@ -187,7 +279,10 @@ func (cs *CourseService) AssignUserToAllEveryCourses(userID string) error {
 
 	assignedToEveryoneCourses, err := cs.app.FindAllRecords(
 		coursesCollection.Name,
-		dbx.HashExp{"assign_to_everyone": true},
+		dbx.HashExp{
+			"assign_to_everyone": true,
+			"organization":       user.GetString("organization"),
+		},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to find courses assigned to everyone: %w", err)
@@ -202,7 +297,14 @@ func (cs *CourseService) AssignUserToAllEveryCourses(userID string) error {
 				return fmt.Errorf("failed to save course with new user: %w", err)
 			}
 
-			if err := cs.CreateProgressRecord(course.Id, userID, "Not Started"); err != nil {
+			err := cs.Audit(AuditCourseAssigneeAdded, coursesCollection.Name, course.Id, map[string]any{
+				"assignee": userID,
+			})
+			if err != nil {
+				return err
+			}
+
+			if err := cs.CreateProgressRecord(course.Id, userID, StatusNotStarted); err != nil {
 				return err
 			}
 		}
@@ -211,13 +313,44 @@ func (cs *CourseService) AssignUserToAllEveryCourses(userID string) error {
 	return nil
 }
 
+// OnboardUser publishes the UserOnboarded event for a newly created user.
+func (cs *CourseService) OnboardUser(user *core.Record) error {
+	return cs.events.OnUserOnboarded.Trigger(&UserOnboardedEvent{
+		App:   cs.app,
+		Actor: cs.actor,
+		User:  user,
+	})
+}
+
 func InitHooks(app *pocketbase.PocketBase) error {
 	courseService := NewCourseService(app)
 
+	initAuditLogHooks(app)
+	initWebhookHooks(app)
+	initManagerHooks(app)
+	initOrganizationHooks(app)
+	initInviteHooks(app)
+	initSignupHooks(app)
+	initProvisioningHooks(app)
+	initSamlHooks(app)
+	initLtiHooks(app)
+	initXapiHooks(app)
+	initScormHooks(app)
+	initCmi5Hooks(app)
+	initSanitizeHooks(app)
+	initCaptionsHooks(app)
+	initLessonRevisionHooks(app)
+
 	// create progress records for every assignee added when a course record is created
 	app.OnRecordCreateRequest("courses").BindFunc(func(e *core.RecordRequestEvent) error {
+		// instructors own the courses they create
+		if e.Record.GetString("owner") == "" && UserRole(e.Auth) == RoleInstructor {
+			e.Record.Set("owner", e.Auth.Id)
+		}
+
 		e.Next()
 		record := e.Record
+		courseService := courseService.WithActor(requestActor(e.RequestEvent))
 
 		assignees, err := courseService.ProcessAssignToEveryone(record)
 		if err != nil {
@@ -225,7 +358,7 @@ func InitHooks(app *pocketbase.PocketBase) error {
 		}
 
 		for _, assignee := range assignees {
-			if err := courseService.CreateProgressRecord(record.Id, assignee, "Not Started"); err != nil {
+			if err := courseService.CreateProgressRecord(record.Id, assignee, StatusNotStarted); err != nil {
 				return err
 			}
 		}
@@ -240,6 +373,7 @@ func InitHooks(app *pocketbase.PocketBase) error {
 		updatedRecord := e.Record
 		originalRecord := updatedRecord.Original()
 		originalAssignees := originalRecord.GetStringSlice("assignees")
+		courseService := courseService.WithActor(requestActor(e.RequestEvent))
 
 		// Process assign_to_everyone and get final assignees
 		updatedAssignees, err := courseService.ProcessAssignToEveryone(updatedRecord)
@@ -260,12 +394,44 @@ func InitHooks(app *pocketbase.PocketBase) error {
 		assigneeToRemove := deletedProgressRecord.GetString("assignee")
 
 		if courseId != "" && assigneeToRemove != "" {
-			return courseService.RemoveAssigneeFromCourse(courseId, assigneeToRemove)
+			return courseService.WithActor(requestActor(e.RequestEvent)).RemoveAssigneeFromCourse(courseId, assigneeToRemove)
 		}
 
 		return nil
 	})
 
+	// validate progress status changes and record them in the progress history
+	app.OnRecordUpdateRequest("progress").BindFunc(func(e *core.RecordRequestEvent) error {
+		from := e.Record.Original().GetString("status")
+		to := e.Record.GetString("status")
+
+		// the timestamps only follow the status changes
+		e.Record.Set("started_at", e.Record.Original().Get("started_at"))
+		e.Record.Set("completed_at", e.Record.Original().Get("completed_at"))
+
+		if from == to {
+			return e.Next()
+		}
+
+		if err := ValidateStatusTransition(from, to, ProgressSourceAPI); err != nil {
+			return e.BadRequestError("Invalid progress status change.", statusTransitionError(err))
+		}
+
+		StampProgressTimestamps(e.Record, from, to)
+
+		return e.App.RunInTransaction(func(txApp core.App) error {
+			e.App = txApp
+
+			if err := e.Next(); err != nil {
+				return err
+			}
+
+			actorID := requestActor(e.RequestEvent)
+
+			return courseService.withApp(txApp).RecordProgressEvent(e.Record, from, to, actorID, ProgressSourceAPI)
+		})
+	})
+
 	// reset the course and assignee fields to their original values when they get updated
 	app.OnRecordUpdateRequest("progress").BindFunc(func(e *core.RecordRequestEvent) error {
 		e.Next()
@@ -277,12 +443,22 @@ func InitHooks(app *pocketbase.PocketBase) error {
 		originalAssignee := originalRecord.GetString("assignee")
 
 		if updatedRecord.GetString("course") != originalCourse || updatedRecord.GetString("assignee") != originalAssignee {
+			attemptedCourse := updatedRecord.GetString("course")
+			attemptedAssignee := updatedRecord.GetString("assignee")
+
 			updatedRecord.Set("course", originalCourse)
 			updatedRecord.Set("assignee", originalAssignee)
 
-			if err := app.Save(updatedRecord); err != nil {
+			if err := e.App.Save(updatedRecord); err != nil {
 				return fmt.Errorf("failed to revert progress record changes: %w", err)
 			}
+
+			return courseService.WithActor(requestActor(e.RequestEvent)).withApp(e.App).Audit(AuditProgressChangeReverted, updatedRecord.Collection().Name, updatedRecord.Id, map[string]any{
+				"course":             originalCourse,
+				"assignee":           originalAssignee,
+				"attempted_course":   attemptedCourse,
+				"attempted_assignee": attemptedAssignee,
+			})
 		}
 
 		return nil
@@ -297,18 +473,48 @@ func InitHooks(app *pocketbase.PocketBase) error {
 		courseId := progressRecord.GetString("course")
 
 		if courseId != "" && assignee != "" {
-			return courseService.AddAssigneeToCourse(courseId, assignee)
+			return courseService.WithActor(requestActor(e.RequestEvent)).AddAssigneeToCourse(courseId, assignee)
 		}
 
 		return nil
 	})
 
-	// add new users to courses that are assigned to everyone and create progress records for them
+	// onboard new users created through the API, self-registration and OAuth2 sign-ups
 	app.OnRecordCreateRequest("users").BindFunc(func(e *core.RecordRequestEvent) error {
-		e.Next()
+		if err := e.Next(); err != nil {
+			return err
+		}
 
 		newUser := e.Record
-		return courseService.AssignUserToAllEveryCourses(newUser.Id)
+		return courseService.WithActor(requestActor(e.RequestEvent)).withApp(e.App).OnboardUser(newUser)
+	})
+
+	// publish LessonCompleted events when learners complete lessons
+	app.OnRecordCreateRequest("lesson_progress").BindFunc(func(e *core.RecordRequestEvent) error {
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		return courseService.WithActor(requestActor(e.RequestEvent)).HandleLessonProgressChange(e.Record, false)
+	})
+
+	app.OnRecordUpdateRequest("lesson_progress").BindFunc(func(e *core.RecordRequestEvent) error {
+		wasCompleted := e.Record.Original().GetBool("completed")
+
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		return courseService.WithActor(requestActor(e.RequestEvent)).HandleLessonProgressChange(e.Record, wasCompleted)
+	})
+
+	// add onboarded users to courses that are assigned to everyone and create progress records for them
+	Events(app).OnUserOnboarded.BindFunc(func(e *UserOnboardedEvent) error {
+		if err := NewCourseService(e.App).WithActor(e.Actor).AssignUserToAllEveryCourses(e.User.Id); err != nil {
+			return err
+		}
+
+		return e.Next()
 	})
 
 	return nil
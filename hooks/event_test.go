@@ -15,36 +15,40 @@ func createTestCourseService() (*CourseService, *tests.TestApp) {
 
 func TestCourseService_GetAllUserIDs(t *testing.T) {
 	service, app := createTestCourseService()
+	defer app.Cleanup()
 
 	// Check if users collection exists, skip if not
 	usersCollection, err := app.FindCollectionByNameOrId("users")
 	if err != nil {
 		t.Skipf("Users collection not available in test app: %v", err)
 	}
+	_, usersCollection = createTestCollections(t, app)
 
-	// Test with empty users collection
-	userIDs, err := service.GetAllUserIDs()
+	// Test with an organization without users
+	userIDs, err := service.GetAllUserIDs(testOrg1)
 	if err != nil {
 		t.Errorf("GetAllUserIDs failed: %v", err)
 	}
 
-	if len(userIDs) == 0 {
-		t.Log("No users found (expected for empty test database)")
-	} else {
-		t.Logf("Found %d users", len(userIDs))
+	if len(userIDs) != 0 {
+		t.Errorf("Expected no users, got %d", len(userIDs))
 	}
 
-	// Create a test user record
-	testUser := core.NewRecord(usersCollection)
-	testUser.Set("email", "test@example.com")
-	
-	err = app.Save(testUser)
-	if err != nil {
-		t.Errorf("Failed to save test user: %v", err)
+	// Create a test user record in the organization and another one outside of it
+	for _, organization := range []string{testOrg1, testOrg2} {
+		testUser := core.NewRecord(usersCollection)
+		testUser.SetEmail(organization + "@example.com")
+		testUser.SetPassword("1234567890")
+		testUser.Set("organization", organization)
+
+		err = app.Save(testUser)
+		if err != nil {
+			t.Errorf("Failed to save test user: %v", err)
+		}
 	}
 
 	// Test again with one user
-	userIDs, err = service.GetAllUserIDs()
+	userIDs, err = service.GetAllUserIDs(testOrg1)
 	if err != nil {
 		t.Errorf("GetAllUserIDs failed after adding user: %v", err)
 	}
@@ -345,10 +349,11 @@ func BenchmarkCourseService_GetAllUserIDs(b *testing.B) {
 	if err != nil {
 		b.Skipf("Users collection not available: %v", err)
 	}
+	createTestCollections(b, app)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := service.GetAllUserIDs()
+		_, err := service.GetAllUserIDs("")
 		if err != nil {
 			b.Errorf("GetAllUserIDs failed: %v", err)
 		}
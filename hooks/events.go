@@ -0,0 +1,174 @@
+package hooks
+
+import (
+	"sync"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+)
+
+// Domain event names.
+const (
+	EventCourseAssigned        = "CourseAssigned"
+	EventAssigneeRemoved       = "AssigneeRemoved"
+	EventProgressStatusChanged = "ProgressStatusChanged"
+	EventLessonCompleted       = "LessonCompleted"
+	EventUserOnboarded         = "UserOnboarded"
+)
+
+// CourseEvent is implemented by all course lifecycle events.
+type CourseEvent interface {
+	hook.Resolver
+	EventName() string
+}
+
+// CourseAssignedEvent is published when a learner gets assigned to a course.
+type CourseAssignedEvent struct {
+	hook.Event
+	App        core.App
+	Actor      string
+	CourseId   string
+	AssigneeId string
+	ProgressId string
+}
+
+func (e *CourseAssignedEvent) EventName() string { return EventCourseAssigned }
+
+// AssigneeRemovedEvent is published when a learner gets removed from a course.
+type AssigneeRemovedEvent struct {
+	hook.Event
+	App        core.App
+	Actor      string
+	CourseId   string
+	AssigneeId string
+}
+
+func (e *AssigneeRemovedEvent) EventName() string { return EventAssigneeRemoved }
+
+// ProgressStatusChangedEvent is published after a course progress status change is persisted.
+type ProgressStatusChangedEvent struct {
+	hook.Event
+	App      core.App
+	Actor    string
+	Progress *core.Record
+	From     string
+	To       string
+	Source   string
+}
+
+func (e *ProgressStatusChangedEvent) EventName() string { return EventProgressStatusChanged }
+
+// LessonCompletedEvent is published when a learner completes a lesson.
+type LessonCompletedEvent struct {
+	hook.Event
+	App            core.App
+	Actor          string
+	LessonProgress *core.Record
+}
+
+func (e *LessonCompletedEvent) EventName() string { return EventLessonCompleted }
+
+// UserOnboardedEvent is published when a new user joins eLesson.
+type UserOnboardedEvent struct {
+	hook.Event
+	App   core.App
+	Actor string
+	User  *core.Record
+}
+
+func (e *UserOnboardedEvent) EventName() string { return EventUserOnboarded }
+
+// CourseEvents holds the course lifecycle hooks that other packages can subscribe to,
+// eg. Events(app).OnCourseAssigned.BindFunc(...). Handlers must call e.Next().
+type CourseEvents struct {
+	OnCourseAssigned        *hook.Hook[*CourseAssignedEvent]
+	OnAssigneeRemoved       *hook.Hook[*AssigneeRemovedEvent]
+	OnProgressStatusChanged *hook.Hook[*ProgressStatusChangedEvent]
+	OnLessonCompleted       *hook.Hook[*LessonCompletedEvent]
+	OnUserOnboarded         *hook.Hook[*UserOnboardedEvent]
+}
+
+func NewCourseEvents() *CourseEvents {
+	return &CourseEvents{
+		OnCourseAssigned:        &hook.Hook[*CourseAssignedEvent]{},
+		OnAssigneeRemoved:       &hook.Hook[*AssigneeRemovedEvent]{},
+		OnProgressStatusChanged: &hook.Hook[*ProgressStatusChangedEvent]{},
+		OnLessonCompleted:       &hook.Hook[*LessonCompletedEvent]{},
+		OnUserOnboarded:         &hook.Hook[*UserOnboardedEvent]{},
+	}
+}
+
+const courseEventsStoreKey = "elesson.courseEvents"
+
+// Events returns the course events bus shared by every CourseService of app.
+func Events(app core.App) *CourseEvents {
+	return app.Store().GetOrSet(courseEventsStoreKey, func() any {
+		return NewCourseEvents()
+	}).(*CourseEvents)
+}
+
+// EventRecorder collects every published course event, mainly for tests.
+type EventRecorder struct {
+	mu     sync.Mutex
+	events []CourseEvent
+}
+
+// NewEventRecorder subscribes a recorder to all events of the bus.
+func NewEventRecorder(events *CourseEvents) *EventRecorder {
+	recorder := &EventRecorder{}
+
+	events.OnCourseAssigned.BindFunc(func(e *CourseAssignedEvent) error {
+		recorder.record(e)
+		return e.Next()
+	})
+	events.OnAssigneeRemoved.BindFunc(func(e *AssigneeRemovedEvent) error {
+		recorder.record(e)
+		return e.Next()
+	})
+	events.OnProgressStatusChanged.BindFunc(func(e *ProgressStatusChangedEvent) error {
+		recorder.record(e)
+		return e.Next()
+	})
+	events.OnLessonCompleted.BindFunc(func(e *LessonCompletedEvent) error {
+		recorder.record(e)
+		return e.Next()
+	})
+	events.OnUserOnboarded.BindFunc(func(e *UserOnboardedEvent) error {
+		recorder.record(e)
+		return e.Next()
+	})
+
+	return recorder
+}
+
+func (r *EventRecorder) record(e CourseEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// Events returns a copy of the recorded events in publish order.
+func (r *EventRecorder) Events() []CourseEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]CourseEvent(nil), r.events...)
+}
+
+// Names returns the names of the recorded events in publish order.
+func (r *EventRecorder) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.events))
+	for _, e := range r.events {
+		names = append(names, e.EventName())
+	}
+	return names
+}
+
+// Reset forgets all recorded events.
+func (r *EventRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+}
@@ -0,0 +1,126 @@
+package hooks
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+)
+
+func TestEvents_SharedPerApp(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	if Events(app) != Events(app) {
+		t.Error("Expected the same events bus for the same app")
+	}
+
+	_, otherApp := createTestCourseService()
+	defer otherApp.Cleanup()
+
+	if Events(app) == Events(otherApp) {
+		t.Error("Expected a separate events bus per app")
+	}
+}
+
+func TestEventRecorder(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	recorder := NewEventRecorder(Events(app))
+
+	usersCollection := core.NewAuthCollection("test_users")
+	user := core.NewRecord(usersCollection)
+	user.Id = "user1"
+
+	if err := service.WithActor("admin").OnboardUser(user); err != nil {
+		t.Fatalf("OnboardUser failed: %v", err)
+	}
+
+	lessonProgressCollection := core.NewBaseCollection("lesson_progress")
+	lessonProgressCollection.Fields.Add(&core.BoolField{Name: "completed"})
+	lessonProgress := core.NewRecord(lessonProgressCollection)
+
+	// not completed yet
+	if err := service.HandleLessonProgressChange(lessonProgress, false); err != nil {
+		t.Fatalf("HandleLessonProgressChange failed: %v", err)
+	}
+
+	lessonProgress.Set("completed", true)
+	if err := service.HandleLessonProgressChange(lessonProgress, false); err != nil {
+		t.Fatalf("HandleLessonProgressChange failed: %v", err)
+	}
+
+	// already completed before the change
+	if err := service.HandleLessonProgressChange(lessonProgress, true); err != nil {
+		t.Fatalf("HandleLessonProgressChange failed: %v", err)
+	}
+
+	expected := []string{EventUserOnboarded, EventLessonCompleted}
+	if names := recorder.Names(); !slices.Equal(names, expected) {
+		t.Fatalf("Expected events %v, got %v", expected, names)
+	}
+
+	onboarded, ok := recorder.Events()[0].(*UserOnboardedEvent)
+	if !ok {
+		t.Fatalf("Expected a *UserOnboardedEvent, got %T", recorder.Events()[0])
+	}
+	if onboarded.Actor != "admin" || onboarded.User.Id != "user1" {
+		t.Errorf("Unexpected UserOnboarded event data: actor %q, user %q", onboarded.Actor, onboarded.User.Id)
+	}
+
+	recorder.Reset()
+	if len(recorder.Events()) != 0 {
+		t.Error("Expected no events after Reset")
+	}
+}
+
+func TestEvents_SubscriberPriorities(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	calls := []string{}
+	events := Events(app)
+
+	events.OnUserOnboarded.Bind(&hook.Handler[*UserOnboardedEvent]{
+		Func: func(e *UserOnboardedEvent) error {
+			calls = append(calls, "late")
+			return e.Next()
+		},
+		Priority: 10,
+	})
+
+	events.OnUserOnboarded.Bind(&hook.Handler[*UserOnboardedEvent]{
+		Func: func(e *UserOnboardedEvent) error {
+			calls = append(calls, "early")
+			return e.Next()
+		},
+		Priority: -10,
+	})
+
+	user := core.NewRecord(core.NewAuthCollection("test_users"))
+	if err := service.OnboardUser(user); err != nil {
+		t.Fatalf("OnboardUser failed: %v", err)
+	}
+
+	if !slices.Equal(calls, []string{"early", "late"}) {
+		t.Errorf("Expected subscribers to run by priority, got %v", calls)
+	}
+}
+
+func TestEvents_SubscriberErrorAbortsPublish(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	subscriberErr := errors.New("subscriber failed")
+	Events(app).OnUserOnboarded.BindFunc(func(e *UserOnboardedEvent) error {
+		return subscriberErr
+	})
+
+	user := core.NewRecord(core.NewAuthCollection("test_users"))
+	if err := service.OnboardUser(user); !errors.Is(err, subscriberErr) {
+		t.Errorf("Expected the subscriber error, got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package hooks
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// expiringStore is an in-memory map whose entries expire, used to remember
+// the pending single sign-on and launch requests between two browser hops.
+type expiringStore struct {
+	mu      sync.Mutex
+	entries map[string]expiringEntry
+}
+
+type expiringEntry struct {
+	value     any
+	expiresAt time.Time
+}
+
+// appExpiringStore returns the expiringStore registered under key in the app store.
+func appExpiringStore(app core.App, key string) *expiringStore {
+	return app.Store().GetOrSet(key, func() any {
+		return &expiringStore{entries: map[string]expiringEntry{}}
+	}).(*expiringStore)
+}
+
+// set remembers value under key until expiresAt, dropping the expired entries.
+func (s *expiringStore) set(key string, value any, expiresAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for existing, entry := range s.entries {
+		if entry.expiresAt.Before(now) {
+			delete(s.entries, existing)
+		}
+	}
+	s.entries[key] = expiringEntry{value: value, expiresAt: expiresAt}
+}
+
+// get returns the value of key, if it has not expired.
+func (s *expiringStore) get(key string) (any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || entry.expiresAt.Before(time.Now()) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// take returns the value of key and forgets it, so that it can be used only once.
+func (s *expiringStore) take(key string) (any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	delete(s.entries, key)
+	if !ok || entry.expiresAt.Before(time.Now()) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// keys returns the keys that have not expired.
+func (s *expiringStore) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(s.entries))
+	for key, entry := range s.entries {
+		if entry.expiresAt.After(now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,130 @@
+package hooks
+
+import (
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlURLAttributes are the attributes holding the links and embedded files of HTML content.
+var htmlURLAttributes = []string{"href", "src", "poster"}
+
+// parseHTMLFragment parses HTML content, like the one of an editor field,
+// as the children of a body element.
+func parseHTMLFragment(content string) ([]*html.Node, error) {
+	return html.ParseFragment(strings.NewReader(content), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+}
+
+// renderHTMLNodes renders HTML nodes back to HTML content.
+func renderHTMLNodes(nodes []*html.Node) (string, error) {
+	var builder strings.Builder
+	for _, node := range nodes {
+		if err := html.Render(&builder, node); err != nil {
+			return "", err
+		}
+	}
+	return builder.String(), nil
+}
+
+// htmlChildren returns the children of an HTML node, detached from it.
+func htmlChildren(node *html.Node) []*html.Node {
+	children := []*html.Node{}
+	for child := node.FirstChild; child != nil; {
+		next := child.NextSibling
+		node.RemoveChild(child)
+		children = append(children, child)
+		child = next
+	}
+	return children
+}
+
+// walkHTML calls fn for node and each of its descendants, in document order.
+func walkHTML(node *html.Node, fn func(*html.Node)) {
+	fn(node)
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		walkHTML(child, fn)
+	}
+}
+
+// findHTMLElement returns the first element of node (or node itself) matching match.
+func findHTMLElement(node *html.Node, match func(*html.Node) bool) *html.Node {
+	if node.Type == html.ElementNode && match(node) {
+		return node
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if found := findHTMLElement(child, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// htmlElementNamed returns a matcher of the elements with the given tag.
+func htmlElementNamed(tag atom.Atom) func(*html.Node) bool {
+	return func(node *html.Node) bool {
+		return node.DataAtom == tag
+	}
+}
+
+// htmlElementWithClass returns a matcher of the elements with the given class.
+func htmlElementWithClass(class string) func(*html.Node) bool {
+	return func(node *html.Node) bool {
+		return slices.Contains(strings.Fields(htmlAttr(node, "class")), class)
+	}
+}
+
+// htmlAttr returns the value of an attribute of an HTML element.
+func htmlAttr(node *html.Node, name string) string {
+	for _, attr := range node.Attr {
+		if attr.Namespace == "" && attr.Key == name {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// setHTMLAttr sets the value of an existing attribute of an HTML element.
+func setHTMLAttr(node *html.Node, name, value string) {
+	for i, attr := range node.Attr {
+		if attr.Namespace == "" && attr.Key == name {
+			node.Attr[i].Val = value
+		}
+	}
+}
+
+// htmlText returns the text of an HTML node, with its whitespace collapsed.
+func htmlText(node *html.Node) string {
+	var builder strings.Builder
+	walkHTML(node, func(n *html.Node) {
+		if n.Type == html.TextNode {
+			builder.WriteString(n.Data)
+			builder.WriteByte(' ')
+		}
+	})
+	return strings.Join(strings.Fields(builder.String()), " ")
+}
+
+// rewriteHTMLURLs replaces the links and embedded files of HTML nodes with the
+// values returned by rewrite, which reports whether the value has to change.
+func rewriteHTMLURLs(nodes []*html.Node, rewrite func(value string) (string, bool)) {
+	for _, node := range nodes {
+		walkHTML(node, func(n *html.Node) {
+			if n.Type != html.ElementNode {
+				return
+			}
+			for _, name := range htmlURLAttributes {
+				if value := htmlAttr(n, name); value != "" {
+					if rewritten, ok := rewrite(value); ok {
+						setHTMLAttr(n, name, rewritten)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+var (
+	ErrInviteNotFound     = errors.New("invite code not found")
+	ErrInviteRevoked      = errors.New("invite code was revoked")
+	ErrInviteExpired      = errors.New("invite code has expired")
+	ErrInviteUsedUp       = errors.New("invite code has reached its usage limit")
+	ErrInviteOrganization = errors.New("invite code belongs to another organization")
+	ErrInviteEmpty        = errors.New("invite must grant courses or groups")
+)
+
+// inviteBodyField is the optional users create field used to redeem an invite on registration.
+const inviteBodyField = "invite"
+
+// CheckInvite returns an error when the invite can no longer be redeemed.
+func CheckInvite(invite *core.Record) error {
+	if !invite.GetDateTime("revoked_at").IsZero() {
+		return ErrInviteRevoked
+	}
+
+	expiresAt := invite.GetDateTime("expires_at")
+	if !expiresAt.IsZero() && expiresAt.Time().Before(types.NowDateTime().Time()) {
+		return ErrInviteExpired
+	}
+
+	maxUses := invite.GetInt("max_uses")
+	if maxUses > 0 && invite.GetInt("uses") >= maxUses {
+		return ErrInviteUsedUp
+	}
+
+	return nil
+}
+
+// RedeemInvite enrolls a user into every course of an invite, adds them to
+// every group of the invite and logs the redemption. Users without an
+// organization join the one of the invite. Redeeming the same invite twice
+// returns the existing redemption.
+func (cs *CourseService) RedeemInvite(code, userID string) (*core.Record, error) {
+	var redemption *core.Record
+
+	err := cs.app.RunInTransaction(func(txApp core.App) error {
+		txService := cs.withApp(txApp)
+
+		invite, err := txApp.FindFirstRecordByData("invites", "code", code)
+		if err != nil {
+			return ErrInviteNotFound
+		}
+
+		user, err := txApp.FindRecordById("users", userID)
+		if err != nil {
+			return fmt.Errorf("failed to find user: %w", err)
+		}
+
+		redemption, err = txApp.FindFirstRecordByFilter(
+			"invite_redemptions",
+			"invite = {:invite} && user = {:user}",
+			dbx.Params{"invite": invite.Id, "user": user.Id},
+		)
+		if err == nil {
+			return nil
+		}
+
+		if err := CheckInvite(invite); err != nil {
+			return err
+		}
+
+		organizationID := invite.GetString("organization")
+		switch user.GetString("organization") {
+		case organizationID:
+		case "":
+			user.Set("organization", organizationID)
+			if err := txApp.Save(user); err != nil {
+				return fmt.Errorf("failed to move user to the invite organization: %w", err)
+			}
+
+			// everyone now includes the user
+			if err := txService.AssignUserToAllEveryCourses(user.Id); err != nil {
+				return err
+			}
+		default:
+			return ErrInviteOrganization
+		}
+
+		courseIDs := invite.GetStringSlice("courses")
+		for _, courseID := range courseIDs {
+			err := txService.EnrollUser(courseID, user.Id)
+			if err != nil && !errors.Is(err, ErrAlreadyEnrolled) {
+				return err
+			}
+		}
+
+		// joining a group enrolls the user into the group courses
+		groupIDs := invite.GetStringSlice("groups")
+		for _, groupID := range groupIDs {
+			group, err := txApp.FindRecordById("groups", groupID)
+			if err != nil {
+				return fmt.Errorf("failed to find invite group: %w", err)
+			}
+
+			members := group.GetStringSlice("members")
+			if slices.Contains(members, user.Id) {
+				continue
+			}
+			if err := txService.SetGroupMembers(group, append(members, user.Id)); err != nil {
+				return err
+			}
+		}
+
+		redemptionsCollection, err := txApp.FindCollectionByNameOrId("invite_redemptions")
+		if err != nil {
+			return fmt.Errorf("failed to find invite_redemptions collection: %w", err)
+		}
+
+		redemption = core.NewRecord(redemptionsCollection)
+		redemption.Set("invite", invite.Id)
+		redemption.Set("user", user.Id)
+		redemption.Set("courses", courseIDs)
+		redemption.Set("groups", groupIDs)
+
+		if err := txApp.Save(redemption); err != nil {
+			return fmt.Errorf("failed to save invite redemption: %w", err)
+		}
+
+		invite.Set("uses", invite.GetInt("uses")+1)
+		if err := txApp.Save(invite); err != nil {
+			return fmt.Errorf("failed to save invite: %w", err)
+		}
+
+		return txService.Audit(AuditInviteRedeemed, invite.Collection().Name, invite.Id, map[string]any{
+			"user":    user.Id,
+			"courses": courseIDs,
+			"groups":  groupIDs,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return redemption, nil
+}
+
+// RevokeInvite stops an invite from being redeemed again.
+func (cs *CourseService) RevokeInvite(invite *core.Record) error {
+	if !invite.GetDateTime("revoked_at").IsZero() {
+		return nil
+	}
+
+	return cs.app.RunInTransaction(func(txApp core.App) error {
+		invite.Set("revoked_at", types.NowDateTime())
+		if err := txApp.Save(invite); err != nil {
+			return fmt.Errorf("failed to revoke invite: %w", err)
+		}
+
+		return cs.withApp(txApp).Audit(AuditInviteRevoked, invite.Collection().Name, invite.Id, nil)
+	})
+}
+
+// canManageInvite reports whether the auth record can revoke the invite:
+// superusers, the org admins of its organization and the instructor who created it.
+func canManageInvite(auth, invite *core.Record) bool {
+	if auth.IsSuperuser() {
+		return true
+	}
+
+	if auth.GetString("organization") != invite.GetString("organization") {
+		return false
+	}
+
+	switch UserRole(auth) {
+	case RoleOrgAdmin:
+		return true
+	case RoleInstructor:
+		return invite.GetString("created_by") == auth.Id
+	}
+	return false
+}
+
+func initInviteHooks(app core.App) {
+	// instructors can only invite to the courses they manage, and only org admins to groups
+	app.OnRecordCreateRequest("invites").BindFunc(func(e *core.RecordRequestEvent) error {
+		e.Record.Set("created_by", requestActor(e.RequestEvent))
+		e.Record.Set("uses", 0)
+
+		courses, err := e.App.FindRecordsByIds("courses", e.Record.GetStringSlice("courses"))
+		if err != nil {
+			return e.BadRequestError("Failed to load the invite courses.", err)
+		}
+
+		groups, err := e.App.FindRecordsByIds("groups", e.Record.GetStringSlice("groups"))
+		if err != nil {
+			return e.BadRequestError("Failed to load the invite groups.", err)
+		}
+
+		if len(courses) == 0 && len(groups) == 0 {
+			return e.BadRequestError("Invalid invite.", validation.Errors{
+				"courses": validation.NewError("validation_invite_empty", ErrInviteEmpty.Error()),
+			})
+		}
+
+		for _, course := range courses {
+			if course.GetString("organization") != e.Record.GetString("organization") || !CanManageCourse(e.Auth, course) {
+				return e.ForbiddenError("You can only invite to the courses you manage.", nil)
+			}
+		}
+
+		for _, group := range groups {
+			if group.GetString("organization") != e.Record.GetString("organization") || !(e.Auth.IsSuperuser() || UserRole(e.Auth) == RoleOrgAdmin) {
+				return e.ForbiddenError("Only org admins can invite to groups.", nil)
+			}
+		}
+
+		return e.Next()
+	})
+
+	// redeem the invite code sent with the registration
+	app.OnRecordCreateRequest("users").BindFunc(func(e *core.RecordRequestEvent) error {
+		info, err := e.RequestInfo()
+		if err != nil {
+			return err
+		}
+
+		code, _ := info.Body[inviteBodyField].(string)
+		if code == "" {
+			return e.Next()
+		}
+
+		invite, err := e.App.FindFirstRecordByData("invites", "code", code)
+		if err != nil {
+			return inviteError(e.RequestEvent, inviteBodyField, ErrInviteNotFound)
+		}
+
+		if err := CheckInvite(invite); err != nil {
+			return inviteError(e.RequestEvent, inviteBodyField, err)
+		}
+
+		// join the invite organization before the user is onboarded,
+		// so that the onboarding assigns its "everyone" courses
+		if e.Record.GetString("organization") == "" {
+			e.Record.Set("organization", invite.GetString("organization"))
+		}
+
+		return e.App.RunInTransaction(func(txApp core.App) error {
+			e.App = txApp
+
+			if err := e.Next(); err != nil {
+				return err
+			}
+
+			courseService := NewCourseService(txApp).WithActor(e.Record.Id)
+			if _, err := courseService.RedeemInvite(code, e.Record.Id); err != nil {
+				return inviteError(e.RequestEvent, inviteBodyField, err)
+			}
+
+			return nil
+		})
+	})
+}
+
+func bindInviteRoutes(r *router.Router[*core.RequestEvent], courseService *CourseService) {
+	// enroll the current user into the courses of an invite
+	r.POST("/api/invites/redeem", func(e *core.RequestEvent) error {
+		data := struct {
+			Code string `json:"code" form:"code"`
+		}{}
+		if err := e.BindBody(&data); err != nil {
+			return e.BadRequestError("Failed to read request data.", err)
+		}
+
+		redemption, err := courseService.WithActor(e.Auth.Id).RedeemInvite(data.Code, e.Auth.Id)
+		if err != nil {
+			return inviteError(e, "code", err)
+		}
+
+		if err := apis.EnrichRecord(e, redemption); err != nil {
+			return e.InternalServerError("", err)
+		}
+
+		return e.JSON(http.StatusOK, redemption)
+	}).Bind(apis.RequireAuth("users"))
+
+	r.POST("/api/invites/{id}/revoke", func(e *core.RequestEvent) error {
+		invite, err := e.App.FindRecordById("invites", e.Request.PathValue("id"))
+		if err != nil || !canManageInvite(e.Auth, invite) {
+			return e.NotFoundError("", err)
+		}
+
+		if err := courseService.WithActor(requestActor(e)).RevokeInvite(invite); err != nil {
+			return e.InternalServerError("Failed to revoke invite.", err)
+		}
+
+		return e.JSON(http.StatusOK, invite)
+	}).Bind(RequireRole(RoleInstructor, RoleOrgAdmin))
+}
+
+// inviteError converts invite errors into API errors, reporting invalid codes on field.
+func inviteError(e *core.RequestEvent, field string, err error) error {
+	switch {
+	case errors.Is(err, ErrInviteNotFound),
+		errors.Is(err, ErrInviteRevoked),
+		errors.Is(err, ErrInviteExpired),
+		errors.Is(err, ErrInviteUsedUp),
+		errors.Is(err, ErrInviteOrganization):
+		return e.BadRequestError("Invalid invite code.", validation.Errors{
+			field: validation.NewError("validation_invalid_invite", err.Error()),
+		})
+	}
+	return e.InternalServerError("Failed to redeem invite.", err)
+}
@@ -0,0 +1,272 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func TestCheckInvite(t *testing.T) {
+	collection := core.NewBaseCollection("invites")
+	collection.Fields.Add(
+		&core.DateField{Name: "expires_at"},
+		&core.NumberField{Name: "max_uses"},
+		&core.NumberField{Name: "uses"},
+		&core.DateField{Name: "revoked_at"},
+	)
+
+	tests := []struct {
+		name     string
+		data     map[string]any
+		expected error
+	}{
+		{"unlimited", map[string]any{"uses": 10}, nil},
+		{"under the limit", map[string]any{"max_uses": 2, "uses": 1}, nil},
+		{"used up", map[string]any{"max_uses": 2, "uses": 2}, ErrInviteUsedUp},
+		{"not expired yet", map[string]any{"expires_at": types.NowDateTime().Add(time.Hour)}, nil},
+		{"expired", map[string]any{"expires_at": types.NowDateTime().Add(-time.Hour)}, ErrInviteExpired},
+		{"revoked", map[string]any{"revoked_at": types.NowDateTime()}, ErrInviteRevoked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invite := core.NewRecord(collection)
+			invite.Load(tt.data)
+
+			if err := CheckInvite(invite); !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestCourseService_RedeemInvite(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	user := createTestLearner(t, app)
+	invites, err := app.FindCollectionByNameOrId("invites")
+	if err != nil {
+		t.Fatalf("Failed to find invites collection: %v", err)
+	}
+
+	course := createTestCourse(t, app, courses, "")
+	course.Set("organization", testOrg1)
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+
+	invite := core.NewRecord(invites)
+	invite.Set("code", "PARTNERS24")
+	invite.Set("courses", []string{course.Id})
+	invite.Set("organization", testOrg1)
+	invite.Set("max_uses", 1)
+	if err := app.Save(invite); err != nil {
+		t.Fatalf("Failed to save invite: %v", err)
+	}
+
+	if _, err := service.RedeemInvite("UNKNOWN", user.Id); !errors.Is(err, ErrInviteNotFound) {
+		t.Errorf("Expected ErrInviteNotFound, got %v", err)
+	}
+
+	redemption, err := service.RedeemInvite("PARTNERS24", user.Id)
+	if err != nil {
+		t.Fatalf("RedeemInvite failed: %v", err)
+	}
+
+	// redeeming twice returns the same redemption without using the invite again
+	again, err := service.RedeemInvite("PARTNERS24", user.Id)
+	if err != nil {
+		t.Fatalf("RedeemInvite failed on the second redemption: %v", err)
+	}
+	if again.Id != redemption.Id {
+		t.Errorf("Expected redemption %s, got %s", redemption.Id, again.Id)
+	}
+
+	user, err = app.FindRecordById("users", user.Id)
+	if err != nil {
+		t.Fatalf("Failed to reload user: %v", err)
+	}
+	if organization := user.GetString("organization"); organization != testOrg1 {
+		t.Errorf("Expected the user to join org1, got %q", organization)
+	}
+
+	progressRecords, err := app.FindAllRecords("progress")
+	if err != nil {
+		t.Fatalf("Failed to find progress records: %v", err)
+	}
+	if len(progressRecords) != 1 {
+		t.Errorf("Expected 1 progress record, got %d", len(progressRecords))
+	}
+
+	invite, err = app.FindRecordById("invites", invite.Id)
+	if err != nil {
+		t.Fatalf("Failed to reload invite: %v", err)
+	}
+	if uses := invite.GetInt("uses"); uses != 1 {
+		t.Errorf("Expected 1 use, got %d", uses)
+	}
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatalf("Failed to find users collection: %v", err)
+	}
+	other := core.NewRecord(users)
+	other.SetEmail("partner@example.com")
+	other.SetPassword("1234567890")
+	if err := app.Save(other); err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	if _, err := service.RedeemInvite("PARTNERS24", other.Id); !errors.Is(err, ErrInviteUsedUp) {
+		t.Errorf("Expected ErrInviteUsedUp, got %v", err)
+	}
+}
+
+func TestInviteRegistration(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, users := createTestCollections(t, app)
+	initOrganizationHooks(app)
+	initInviteHooks(app)
+
+	// onboard registered users like the users hook of InitHooks
+	app.OnRecordCreateRequest("users").BindFunc(func(e *core.RecordRequestEvent) error {
+		if err := e.Next(); err != nil {
+			return err
+		}
+		return NewCourseService(e.App).OnboardUser(e.Record)
+	})
+	onboardedOrganization := ""
+	Events(app).OnUserOnboarded.BindFunc(func(e *UserOnboardedEvent) error {
+		onboardedOrganization = e.User.GetString("organization")
+		if err := NewCourseService(e.App).AssignUserToAllEveryCourses(e.User.Id); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+
+	admin := core.NewRecord(users)
+	admin.SetEmail("admin@example.com")
+	admin.SetPassword("1234567890")
+	admin.Set("role", RoleOrgAdmin)
+	admin.Set("organization", testOrg1)
+	if err := app.Save(admin); err != nil {
+		t.Fatalf("Failed to save admin: %v", err)
+	}
+
+	everyone := createTestCourse(t, app, courses, "")
+	everyone.Set("organization", testOrg1)
+	everyone.Set("assign_to_everyone", true)
+	groupCourse := createTestCourse(t, app, courses, "")
+	groupCourse.Set("organization", testOrg1)
+	for _, course := range []*core.Record{everyone, groupCourse} {
+		if err := app.Save(course); err != nil {
+			t.Fatalf("Failed to save course: %v", err)
+		}
+	}
+
+	groups, err := app.FindCollectionByNameOrId("groups")
+	if err != nil {
+		t.Fatalf("Failed to find groups collection: %v", err)
+	}
+	group := core.NewRecord(groups)
+	group.Set("name", "Partners")
+	group.Set("organization", testOrg1)
+	group.Set("courses", []string{groupCourse.Id})
+	if err := app.Save(group); err != nil {
+		t.Fatalf("Failed to save group: %v", err)
+	}
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	send := func(auth *core.Record, path string, body map[string]any) (int, map[string]any) {
+		t.Helper()
+
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(http.MethodPost, server.URL+path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != nil {
+			token, err := auth.NewAuthToken()
+			if err != nil {
+				t.Fatalf("Failed to create auth token: %v", err)
+			}
+			req.Header.Set("Authorization", token)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer res.Body.Close()
+
+		content, _ := io.ReadAll(res.Body)
+		result := map[string]any{}
+		json.Unmarshal(content, &result)
+		return res.StatusCode, result
+	}
+
+	// invites grant courses or groups
+	if status, _ := send(admin, "/api/collections/invites/records", map[string]any{}); status != http.StatusBadRequest {
+		t.Errorf("Expected an invite without courses and groups to be rejected, got %d", status)
+	}
+	// invite codes are generated, so that they can't be guessed
+	if status, _ := send(admin, "/api/collections/invites/records", map[string]any{"groups": []string{group.Id}, "code": "PARTNERS24"}); status != http.StatusBadRequest {
+		t.Errorf("Expected an invite with a chosen code to be rejected, got %d", status)
+	}
+	status, invite := send(admin, "/api/collections/invites/records", map[string]any{"groups": []string{group.Id}})
+	if status != http.StatusOK || len(invite["code"].(string)) < 10 {
+		t.Fatalf("Expected the admin to invite to a group, got %d %v", status, invite)
+	}
+
+	status, user := send(nil, "/api/collections/users/records", map[string]any{
+		"email":           "partner@example.com",
+		"password":        "1234567890",
+		"passwordConfirm": "1234567890",
+		"invite":          invite["code"],
+	})
+	if status != http.StatusOK || user["organization"] != testOrg1 {
+		t.Fatalf("Expected the partner to register with the invite, got %d %v", status, user)
+	}
+
+	// the user joined the invite organization before being onboarded
+	if onboardedOrganization != testOrg1 {
+		t.Errorf("Expected the user to be onboarded in org1, got %q", onboardedOrganization)
+	}
+
+	group, err = app.FindRecordById("groups", group.Id)
+	if err != nil {
+		t.Fatalf("Failed to reload group: %v", err)
+	}
+	if members := group.GetStringSlice("members"); len(members) != 1 || members[0] != user["id"] {
+		t.Errorf("Expected the partner to join the group, got %v", members)
+	}
+
+	for _, course := range []*core.Record{everyone, groupCourse} {
+		if _, err := app.FindFirstRecordByFilter("progress", "course = {:course} && assignee = {:assignee}",
+			dbx.Params{"course": course.Id, "assignee": user["id"]}); err != nil {
+			t.Errorf("Expected the partner to be assigned %q: %v", course.GetString("title"), err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package hooks
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// localRedirect only accepts local paths as the page to return to after a login.
+func localRedirect(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/"
+	}
+	return path
+}
+
+// loginRedirect sends the browser of a single sign-on login to the login page,
+// which stores the auth token from the URL fragment and opens redirect.
+func loginRedirect(e *core.RequestEvent, user *core.Record, redirect string) error {
+	token, err := user.NewAuthToken()
+	if err != nil {
+		return e.InternalServerError("Failed to create the auth token.", err)
+	}
+
+	fragment := url.Values{}
+	fragment.Set("auth_token", token)
+	fragment.Set("redirect", localRedirect(redirect))
+
+	return e.Redirect(http.StatusSeeOther, "/login#"+fragment.Encode())
+}
+
+// loginErrorRedirect sends the browser of a failed single sign-on login to the
+// login page, with the reason in the URL fragment.
+func loginErrorRedirect(e *core.RequestEvent, message string) error {
+	fragment := url.Values{}
+	fragment.Set("auth_error", message)
+
+	return e.Redirect(http.StatusSeeOther, "/login#"+fragment.Encode())
+}
@@ -0,0 +1,721 @@
+package hooks
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// LTI 1.3 message types.
+const (
+	LtiVersion             = "1.3.0"
+	LtiResourceLinkRequest = "LtiResourceLinkRequest"
+	LtiDeepLinkingRequest  = "LtiDeepLinkingRequest"
+	LtiDeepLinkingResponse = "LtiDeepLinkingResponse"
+)
+
+// Claims of the messages the tool signs, the launch claims are decoded into ltiLaunchClaims.
+const (
+	ltiClaimMessageType        = "https://purl.imsglobal.org/spec/lti/claim/message_type"
+	ltiClaimVersion            = "https://purl.imsglobal.org/spec/lti/claim/version"
+	ltiClaimDeploymentID       = "https://purl.imsglobal.org/spec/lti/claim/deployment_id"
+	ltiClaimDeepLinkingData    = "https://purl.imsglobal.org/spec/lti-dl/claim/data"
+	ltiClaimDeepLinkingItems   = "https://purl.imsglobal.org/spec/lti-dl/claim/content_items"
+	ltiScopeScore              = "https://purl.imsglobal.org/spec/lti-ags/scope/score"
+	ltiDeepLinkingResourceLink = "ltiResourceLink"
+)
+
+const (
+	// ltiRequestTTL is how long the login initiation and deep linking steps wait for the next browser hop.
+	ltiRequestTTL = 10 * time.Minute
+	// ltiKeySetTTL is how long the platform public keys are cached.
+	ltiKeySetTTL = time.Hour
+	// ltiMessageTTL is the lifetime of the messages signed by the tool.
+	ltiMessageTTL = 5 * time.Minute
+
+	// ltiStateCookie ties the launch state to the browser that initiated the login.
+	ltiStateCookie = "elesson_lti_state"
+
+	ltiStatesStoreKey    = "elesson.ltiStates"
+	ltiDeepLinksStoreKey = "elesson.ltiDeepLinks"
+	ltiKeySetsStoreKey   = "elesson.ltiKeySets"
+)
+
+var (
+	ErrLtiNoEmail      = errors.New("the platform did not send an email address")
+	ErrLtiEmailTaken   = errors.New("an account with this email address already exists")
+	ErrLtiOrganization = errors.New("the user belongs to another organization")
+	ErrLtiDeactivated  = errors.New("the account is deactivated")
+	ErrLtiCourse       = errors.New("the course is not available to this platform")
+	ErrLtiInvalidState = errors.New("the launch state is invalid or expired")
+	ErrLtiInvalidToken = errors.New("the launch token is invalid")
+)
+
+var ltiClient = newOutboundClient(10 * time.Second)
+
+// ltiLaunchClaims are the claims of an LTI 1.3 launch id token.
+type ltiLaunchClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string         `json:"nonce"`
+	Email         string         `json:"email"`
+	Name          string         `json:"name"`
+	GivenName     string         `json:"given_name"`
+	FamilyName    string         `json:"family_name"`
+	MessageType   string         `json:"https://purl.imsglobal.org/spec/lti/claim/message_type"`
+	Version       string         `json:"https://purl.imsglobal.org/spec/lti/claim/version"`
+	DeploymentID  string         `json:"https://purl.imsglobal.org/spec/lti/claim/deployment_id"`
+	TargetLinkURI string         `json:"https://purl.imsglobal.org/spec/lti/claim/target_link_uri"`
+	Custom        map[string]any `json:"https://purl.imsglobal.org/spec/lti/claim/custom"`
+	ResourceLink  struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	} `json:"https://purl.imsglobal.org/spec/lti/claim/resource_link"`
+	AgsEndpoint *struct {
+		Scope    []string `json:"scope"`
+		LineItem string   `json:"lineitem"`
+	} `json:"https://purl.imsglobal.org/spec/lti-ags/claim/endpoint"`
+	DeepLinkingSettings *struct {
+		ReturnURL   string   `json:"deep_link_return_url"`
+		AcceptTypes []string `json:"accept_types"`
+		Data        string   `json:"data"`
+	} `json:"https://purl.imsglobal.org/spec/lti-dl/claim/deep_linking_settings"`
+}
+
+// LtiLaunch holds what a resource link launch tells about the user and the course.
+type LtiLaunch struct {
+	Sub            string
+	Email          string
+	Name           string
+	CourseID       string
+	DeploymentID   string
+	ResourceLinkID string
+	// LineItem is the AGS line item receiving the score, empty when the platform
+	// doesn't grant the score scope.
+	LineItem string
+}
+
+// ltiLoginState is remembered between the login initiation and the launch.
+type ltiLoginState struct {
+	Platform string
+	Nonce    string
+}
+
+// ltiDeepLink is remembered between a deep linking request and the course pick.
+type ltiDeepLink struct {
+	Platform     string
+	DeploymentID string
+	ReturnURL    string
+	Data         string
+}
+
+// ltiLaunchFromClaims maps the claims of a resource link launch.
+func ltiLaunchFromClaims(claims *ltiLaunchClaims) LtiLaunch {
+	launch := LtiLaunch{
+		Sub:            claims.Subject,
+		Email:          strings.ToLower(strings.TrimSpace(claims.Email)),
+		Name:           claims.Name,
+		DeploymentID:   claims.DeploymentID,
+		ResourceLinkID: claims.ResourceLink.ID,
+	}
+	if launch.Name == "" {
+		launch.Name = strings.TrimSpace(claims.GivenName + " " + claims.FamilyName)
+	}
+
+	// deep linked resource links carry the course as a custom parameter,
+	// manually configured links may use the target link URI instead
+	if course, ok := claims.Custom["course"].(string); ok {
+		launch.CourseID = course
+	} else if target, err := url.Parse(claims.TargetLinkURI); err == nil {
+		launch.CourseID = target.Query().Get("course")
+	}
+
+	if claims.AgsEndpoint != nil && slices.Contains(claims.AgsEndpoint.Scope, ltiScopeScore) {
+		launch.LineItem = claims.AgsEndpoint.LineItem
+	}
+
+	return launch
+}
+
+// LtiLaunch finds or provisions the user of a resource link launch, enrolls it
+// in the launched course and remembers the launch for the grade passback.
+func (cs *CourseService) LtiLaunch(platform *core.Record, launch LtiLaunch) (*core.Record, error) {
+	organizationID := platform.GetString("organization")
+
+	courseRecord, err := cs.app.FindRecordById("courses", launch.CourseID)
+	if err != nil || courseRecord.GetString("organization") != organizationID {
+		return nil, ErrLtiCourse
+	}
+
+	var user *core.Record
+
+	err = cs.app.RunInTransaction(func(txApp core.App) error {
+		txService := cs.withApp(txApp)
+
+		previous, _ := txApp.FindFirstRecordByFilter(
+			"lti_launches",
+			"platform = {:platform} && sub = {:sub}",
+			dbx.Params{"platform": platform.Id, "sub": launch.Sub},
+		)
+		if previous != nil {
+			user, _ = txApp.FindRecordById("users", previous.GetString("user"))
+		}
+
+		if user == nil {
+			if launch.Email == "" {
+				return ErrLtiNoEmail
+			}
+
+			// the platform doesn't verify the email claim, so it never links
+			// to an existing account
+			if existing, _ := txApp.FindAuthRecordByEmail("users", launch.Email); existing != nil {
+				return ErrLtiEmailTaken
+			}
+
+			collection, err := txApp.FindCollectionByNameOrId("users")
+			if err != nil {
+				return fmt.Errorf("failed to find users collection: %w", err)
+			}
+
+			user = core.NewRecord(collection)
+			user.SetEmail(launch.Email)
+			user.SetPassword(security.RandomString(30))
+			user.SetVerified(true)
+			user.Set("organization", organizationID)
+			user.Set("name", launch.Name)
+
+			if err := txService.ProvisionUser(user); err != nil {
+				return err
+			}
+		} else {
+			if user.GetString("organization") != organizationID {
+				return ErrLtiOrganization
+			}
+			if IsDeactivated(user) {
+				return ErrLtiDeactivated
+			}
+		}
+
+		if err := txService.EnrollUser(courseRecord.Id, user.Id); err != nil && !errors.Is(err, ErrAlreadyEnrolled) {
+			return err
+		}
+
+		launchRecord, _ := txApp.FindFirstRecordByFilter(
+			"lti_launches",
+			"platform = {:platform} && sub = {:sub} && resource_link_id = {:link}",
+			dbx.Params{"platform": platform.Id, "sub": launch.Sub, "link": launch.ResourceLinkID},
+		)
+		if launchRecord == nil {
+			collection, err := txApp.FindCollectionByNameOrId("lti_launches")
+			if err != nil {
+				return fmt.Errorf("failed to find lti_launches collection: %w", err)
+			}
+			launchRecord = core.NewRecord(collection)
+			launchRecord.Set("platform", platform.Id)
+			launchRecord.Set("sub", launch.Sub)
+			launchRecord.Set("resource_link_id", launch.ResourceLinkID)
+		}
+		launchRecord.Set("user", user.Id)
+		launchRecord.Set("course", courseRecord.Id)
+		launchRecord.Set("deployment_id", launch.DeploymentID)
+		launchRecord.Set("lineitem", launch.LineItem)
+
+		if err := txApp.Save(launchRecord); err != nil {
+			return fmt.Errorf("failed to save LTI launch: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ltiToolKey parses the private key the tool signs its messages with for a platform.
+func ltiToolKey(platform *core.Record) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(platform.GetString("tool_key")))
+	if block == nil {
+		return nil, errors.New("missing tool key")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// generateLtiToolKey creates the RSA key of a platform registration as PEM.
+func generateLtiToolKey() (string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})), nil
+}
+
+// ltiJSONWebKey is an RSA public key of a JSON Web Key Set.
+type ltiJSONWebKey struct {
+	Kty string `json:"kty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func newLtiJSONWebKey(kid string, key *rsa.PublicKey) ltiJSONWebKey {
+	return ltiJSONWebKey{
+		Kty: "RSA",
+		Alg: "RS256",
+		Use: "sig",
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func (k ltiJSONWebKey) publicKey() (*rsa.PublicKey, error) {
+	if k.Kty != "RSA" {
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key exponent: %w", err)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+// ltiPlatformKey returns the platform public key with the kid, fetching the
+// platform key set again when the key isn't cached (eg. after a key rotation).
+func ltiPlatformKey(app core.App, platform *core.Record, kid string) (*rsa.PublicKey, error) {
+	jwksURL := platform.GetString("jwks_url")
+	keySets := appExpiringStore(app, ltiKeySetsStoreKey)
+
+	if cached, ok := keySets.get(jwksURL); ok {
+		if key, ok := cached.(map[string]*rsa.PublicKey)[kid]; ok {
+			return key, nil
+		}
+	}
+
+	res, err := ltiClient.Get(jwksURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the platform keys: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch the platform keys: unexpected response status %d", res.StatusCode)
+	}
+
+	var keySet struct {
+		Keys []ltiJSONWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&keySet); err != nil {
+		return nil, fmt.Errorf("failed to read the platform keys: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range keySet.Keys {
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	keySets.set(jwksURL, keys, time.Now().Add(ltiKeySetTTL))
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown platform key %q", kid)
+	}
+	return key, nil
+}
+
+// parseLtiLaunch validates the id token of a launch against the platform registration.
+func parseLtiLaunch(app core.App, platform *core.Record, idToken, nonce string) (*ltiLaunchClaims, error) {
+	claims := &ltiLaunchClaims{}
+
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return ltiPlatformKey(app, platform, kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(platform.GetString("issuer")),
+		jwt.WithAudience(platform.GetString("client_id")),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrLtiInvalidToken, err)
+	}
+
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrLtiInvalidToken)
+	}
+	if claims.Version != LtiVersion {
+		return nil, fmt.Errorf("%w: unsupported LTI version %q", ErrLtiInvalidToken, claims.Version)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrLtiInvalidToken)
+	}
+
+	deploymentIDs := []string{}
+	if err := platform.UnmarshalJSONField("deployment_ids", &deploymentIDs); err != nil {
+		return nil, fmt.Errorf("invalid deployment_ids: %w", err)
+	}
+	if len(deploymentIDs) > 0 && !slices.Contains(deploymentIDs, claims.DeploymentID) {
+		return nil, fmt.Errorf("%w: unknown deployment %q", ErrLtiInvalidToken, claims.DeploymentID)
+	}
+
+	return claims, nil
+}
+
+// ltiToolURL returns the absolute URL of a tool endpoint of a platform registration.
+func ltiToolURL(app core.App, platform *core.Record, endpoint string) string {
+	return strings.TrimRight(app.Settings().Meta.AppURL, "/") + "/api/lti/" + platform.Id + "/" + endpoint
+}
+
+var ltiDeepLinkingTemplate = template.Must(template.New("deepLinking").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Select a course</title></head>
+<body>
+<h1>Select a course</h1>
+{{range .Courses}}
+<form method="post" action="{{$.Action}}">
+<input type="hidden" name="deep_link" value="{{$.DeepLink}}">
+<input type="hidden" name="course" value="{{.Id}}">
+<button type="submit">{{.GetString "title"}}</button>
+</form>
+{{else}}
+<p>There are no courses to link.</p>
+{{end}}
+</body>
+</html>
+`))
+
+var ltiAutoPostTemplate = template.Must(template.New("autoPost").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Returning to the platform</title></head>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="JWT" value="{{.JWT}}">
+<noscript><button type="submit">Continue</button></noscript>
+</form>
+</body>
+</html>
+`))
+
+// ltiDeepLinkingJWT signs the deep linking response returning a course resource link.
+func ltiDeepLinkingJWT(app core.App, platform *core.Record, deepLink ltiDeepLink, course *core.Record) (string, error) {
+	key, err := ltiToolKey(platform)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                platform.GetString("client_id"),
+		"aud":                platform.GetString("issuer"),
+		"iat":                now.Unix(),
+		"exp":                now.Add(ltiMessageTTL).Unix(),
+		"nonce":              security.RandomString(32),
+		ltiClaimMessageType:  LtiDeepLinkingResponse,
+		ltiClaimVersion:      LtiVersion,
+		ltiClaimDeploymentID: deepLink.DeploymentID,
+		ltiClaimDeepLinkingItems: []map[string]any{{
+			"type":  ltiDeepLinkingResourceLink,
+			"title": course.GetString("title"),
+			"url":   ltiToolURL(app, platform, "launch"),
+			"custom": map[string]string{
+				"course": course.Id,
+			},
+			"lineItem": map[string]any{
+				"label":        course.GetString("title"),
+				"scoreMaximum": 1,
+			},
+		}},
+	}
+	if deepLink.Data != "" {
+		claims[ltiClaimDeepLinkingData] = deepLink.Data
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = platform.Id
+
+	return token.SignedString(key)
+}
+
+func initLtiHooks(app core.App) {
+	bindLtiSubscribers(Events(app))
+
+	app.OnRecordCreate("lti_platforms").BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.GetString("tool_key") == "" {
+			key, err := generateLtiToolKey()
+			if err != nil {
+				return fmt.Errorf("failed to generate the tool key: %w", err)
+			}
+			e.Record.Set("tool_key", key)
+		}
+		return e.Next()
+	})
+
+	app.OnRecordValidate("lti_platforms").BindFunc(func(e *core.RecordEvent) error {
+		deploymentIDs := []string{}
+		if err := e.Record.UnmarshalJSONField("deployment_ids", &deploymentIDs); err != nil {
+			return validation.Errors{
+				"deployment_ids": validation.NewError("validation_invalid_deployment_ids", "Must be a list of deployment ids."),
+			}
+		}
+		return e.Next()
+	})
+
+	initLtiScoreHooks(app)
+}
+
+func bindLtiRoutes(r *router.Router[*core.RequestEvent], courseService *CourseService) {
+	findPlatform := func(e *core.RequestEvent) (*core.Record, error) {
+		platform, err := e.App.FindRecordById("lti_platforms", e.Request.PathValue("id"))
+		if err != nil {
+			return nil, e.NotFoundError("", err)
+		}
+		return platform, nil
+	}
+
+	// the tool public key, to register in the platform
+	r.GET("/api/lti/{id}/jwks", func(e *core.RequestEvent) error {
+		platform, err := findPlatform(e)
+		if err != nil {
+			return err
+		}
+
+		key, err := ltiToolKey(platform)
+		if err != nil {
+			return e.InternalServerError("The LTI platform is misconfigured.", err)
+		}
+
+		return e.JSON(http.StatusOK, map[string]any{
+			"keys": []ltiJSONWebKey{newLtiJSONWebKey(platform.Id, &key.PublicKey)},
+		})
+	})
+
+	// the third party initiated login: send the browser back to the platform
+	// authorization endpoint, which posts the launch id token
+	login := func(e *core.RequestEvent) error {
+		platform, err := findPlatform(e)
+		if err != nil {
+			return err
+		}
+
+		if err := e.Request.ParseForm(); err != nil {
+			return e.BadRequestError("Failed to read the login request.", err)
+		}
+		params := e.Request.Form
+
+		if params.Get("iss") != platform.GetString("issuer") {
+			return e.BadRequestError("Unknown issuer.", nil)
+		}
+		if clientID := params.Get("client_id"); clientID != "" && clientID != platform.GetString("client_id") {
+			return e.BadRequestError("Unknown client_id.", nil)
+		}
+		if params.Get("login_hint") == "" {
+			return e.BadRequestError("Missing login_hint.", nil)
+		}
+
+		state := security.RandomString(32)
+		nonce := security.RandomString(32)
+		appExpiringStore(e.App, ltiStatesStoreKey).set(state, ltiLoginState{Platform: platform.Id, Nonce: nonce}, time.Now().Add(ltiRequestTTL))
+		// the launch is a cross-site form post from the platform, so the
+		// cookie must be sent with SameSite=None
+		e.SetCookie(&http.Cookie{
+			Name:     ltiStateCookie,
+			Value:    state,
+			Path:     "/api/lti/" + platform.Id + "/",
+			MaxAge:   int(ltiRequestTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteNoneMode,
+		})
+
+		authURL, err := url.Parse(platform.GetString("auth_login_url"))
+		if err != nil {
+			return e.InternalServerError("The LTI platform is misconfigured.", err)
+		}
+
+		query := authURL.Query()
+		query.Set("scope", "openid")
+		query.Set("response_type", "id_token")
+		query.Set("response_mode", "form_post")
+		query.Set("prompt", "none")
+		query.Set("client_id", platform.GetString("client_id"))
+		query.Set("redirect_uri", ltiToolURL(e.App, platform, "launch"))
+		query.Set("login_hint", params.Get("login_hint"))
+		query.Set("state", state)
+		query.Set("nonce", nonce)
+		if hint := params.Get("lti_message_hint"); hint != "" {
+			query.Set("lti_message_hint", hint)
+		}
+		authURL.RawQuery = query.Encode()
+
+		return e.Redirect(http.StatusFound, authURL.String())
+	}
+	r.GET("/api/lti/{id}/login", login)
+	r.POST("/api/lti/{id}/login", login)
+
+	// the launch: validate the id token, then open the course or the deep linking picker
+	r.POST("/api/lti/{id}/launch", func(e *core.RequestEvent) error {
+		platform, err := findPlatform(e)
+		if err != nil {
+			return err
+		}
+
+		if err := e.Request.ParseForm(); err != nil {
+			return e.BadRequestError("Failed to read the launch.", err)
+		}
+
+		// a launch is only accepted in the browser that initiated the login,
+		// so that a launch of someone else can't be completed in it
+		cookie, err := e.Request.Cookie(ltiStateCookie)
+		if err != nil || cookie.Value == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(e.Request.PostForm.Get("state"))) != 1 {
+			return ltiLaunchError(e, "", ErrLtiInvalidState)
+		}
+		e.SetCookie(&http.Cookie{
+			Name:     ltiStateCookie,
+			Path:     "/api/lti/" + platform.Id + "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteNoneMode,
+		})
+
+		stored, ok := appExpiringStore(e.App, ltiStatesStoreKey).take(e.Request.PostForm.Get("state"))
+		state, _ := stored.(ltiLoginState)
+		if !ok || state.Platform != platform.Id {
+			return ltiLaunchError(e, "", ErrLtiInvalidState)
+		}
+
+		claims, err := parseLtiLaunch(e.App, platform, e.Request.PostForm.Get("id_token"), state.Nonce)
+		if err != nil {
+			return ltiLaunchError(e, "", err)
+		}
+
+		switch claims.MessageType {
+		case LtiResourceLinkRequest:
+			launch := ltiLaunchFromClaims(claims)
+
+			user, err := courseService.WithActor(platform.Id).withApp(e.App).LtiLaunch(platform, launch)
+			if err != nil {
+				return ltiLaunchError(e, launch.Email, err)
+			}
+
+			return loginRedirect(e, user, "/")
+		case LtiDeepLinkingRequest:
+			settings := claims.DeepLinkingSettings
+			if settings == nil || settings.ReturnURL == "" || !slices.Contains(settings.AcceptTypes, ltiDeepLinkingResourceLink) {
+				return ltiLaunchError(e, "", fmt.Errorf("%w: the platform doesn't accept resource links", ErrLtiInvalidToken))
+			}
+
+			courses, err := e.App.FindRecordsByFilter(
+				"courses",
+				"organization = {:organization}",
+				"title",
+				0,
+				0,
+				dbx.Params{"organization": platform.GetString("organization")},
+			)
+			if err != nil {
+				return e.InternalServerError("Failed to find courses.", err)
+			}
+
+			deepLink := security.RandomString(32)
+			appExpiringStore(e.App, ltiDeepLinksStoreKey).set(deepLink, ltiDeepLink{
+				Platform:     platform.Id,
+				DeploymentID: claims.DeploymentID,
+				ReturnURL:    settings.ReturnURL,
+				Data:         settings.Data,
+			}, time.Now().Add(ltiRequestTTL))
+
+			e.Response.Header().Set("Content-Type", "text/html; charset=utf-8")
+			e.Response.WriteHeader(http.StatusOK)
+			return ltiDeepLinkingTemplate.Execute(e.Response, map[string]any{
+				"Action":   ltiToolURL(e.App, platform, "deep-link"),
+				"DeepLink": deepLink,
+				"Courses":  courses,
+			})
+		default:
+			return ltiLaunchError(e, "", fmt.Errorf("%w: unsupported message type %q", ErrLtiInvalidToken, claims.MessageType))
+		}
+	})
+
+	// return the picked course to the platform as a deep linking response
+	r.POST("/api/lti/{id}/deep-link", func(e *core.RequestEvent) error {
+		platform, err := findPlatform(e)
+		if err != nil {
+			return err
+		}
+
+		if err := e.Request.ParseForm(); err != nil {
+			return e.BadRequestError("Failed to read the selected course.", err)
+		}
+
+		stored, ok := appExpiringStore(e.App, ltiDeepLinksStoreKey).take(e.Request.PostForm.Get("deep_link"))
+		deepLink, _ := stored.(ltiDeepLink)
+		if !ok || deepLink.Platform != platform.Id {
+			return e.BadRequestError("The deep linking request is invalid or expired.", nil)
+		}
+
+		course, err := e.App.FindRecordById("courses", e.Request.PostForm.Get("course"))
+		if err != nil || course.GetString("organization") != platform.GetString("organization") {
+			return e.BadRequestError("Unknown course.", err)
+		}
+
+		signed, err := ltiDeepLinkingJWT(e.App, platform, deepLink, course)
+		if err != nil {
+			return e.InternalServerError("Failed to sign the deep linking response.", err)
+		}
+
+		e.Response.Header().Set("Content-Type", "text/html; charset=utf-8")
+		e.Response.WriteHeader(http.StatusOK)
+		return ltiAutoPostTemplate.Execute(e.Response, map[string]any{
+			"Action": deepLink.ReturnURL,
+			"JWT":    signed,
+		})
+	})
+}
+
+// ltiLaunchError sends the browser of a failed launch to the login page with the reason.
+func ltiLaunchError(e *core.RequestEvent, email string, err error) error {
+	e.App.Logger().Warn("LTI launch failed", "email", email, "error", err)
+
+	message := "The LTI launch failed."
+	switch {
+	case errors.Is(err, ErrLtiNoEmail),
+		errors.Is(err, ErrLtiEmailTaken),
+		errors.Is(err, ErrLtiOrganization),
+		errors.Is(err, ErrLtiDeactivated),
+		errors.Is(err, ErrLtiCourse),
+		errors.Is(err, ErrLtiInvalidState):
+		message = "The LTI launch failed: " + err.Error() + "."
+	}
+
+	return loginErrorRedirect(e, message)
+}
@@ -0,0 +1,285 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/routine"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	ltiScoreContentType    = "application/vnd.ims.lis.v1.score+json"
+	ltiClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	ltiAccessTokensKey     = "elesson.ltiAccessTokens"
+)
+
+// QueueLtiScores queues the completion score of a progress record for every
+// launch of its course by its assignee that came with an AGS line item.
+// Scores are sent once the surrounding transaction (if any) is committed.
+func QueueLtiScores(app core.App, progressRecord *core.Record) error {
+	launches, err := app.FindRecordsByFilter(
+		"lti_launches",
+		"user = {:user} && course = {:course} && lineitem != ''",
+		"",
+		0,
+		0,
+		dbx.Params{"user": progressRecord.GetString("assignee"), "course": progressRecord.GetString("course")},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to find LTI launches: %w", err)
+	}
+
+	if len(launches) == 0 {
+		return nil
+	}
+
+	scoresCollection, err := app.FindCollectionByNameOrId("lti_scores")
+	if err != nil {
+		return fmt.Errorf("failed to find lti_scores collection: %w", err)
+	}
+
+	timestamp := progressRecord.GetDateTime("completed_at")
+	if timestamp.IsZero() {
+		timestamp = types.NowDateTime()
+	}
+
+	for _, launch := range launches {
+		payload, err := json.Marshal(map[string]any{
+			"userId":           launch.GetString("sub"),
+			"scoreGiven":       1,
+			"scoreMaximum":     1,
+			"activityProgress": "Completed",
+			"gradingProgress":  "FullyGraded",
+			"timestamp":        timestamp.Time().Format(time.RFC3339),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to serialize LTI score: %w", err)
+		}
+
+		score := core.NewRecord(scoresCollection)
+		score.Set("launch", launch.Id)
+		score.Set("progress", progressRecord.Id)
+		score.Set("status", DeliveryPending)
+		score.Set("attempts", 0)
+		// picked up by the retry job if the immediate attempt never happens
+		score.Set("next_attempt_at", types.NowDateTime().Add(webhookRetryDelays[0]))
+		score.Set("payload", types.JSONRaw(payload))
+
+		if err := app.Save(score); err != nil {
+			return fmt.Errorf("failed to save LTI score: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ltiAccessToken returns an AGS access token of the platform, requested with
+// the OAuth 2 client credentials grant and a client assertion signed by the tool.
+func ltiAccessToken(app core.App, platform *core.Record) (string, error) {
+	tokens := appExpiringStore(app, ltiAccessTokensKey)
+	if token, ok := tokens.get(platform.Id); ok {
+		return token.(string), nil
+	}
+
+	key, err := ltiToolKey(platform)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	assertion := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{
+		Issuer:    platform.GetString("client_id"),
+		Subject:   platform.GetString("client_id"),
+		Audience:  jwt.ClaimStrings{platform.GetString("auth_token_url")},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ltiMessageTTL)),
+		ID:        security.RandomString(32),
+	})
+	assertion.Header["kid"] = platform.Id
+
+	signed, err := assertion.SignedString(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign the client assertion: %w", err)
+	}
+
+	res, err := ltiClient.PostForm(platform.GetString("auth_token_url"), url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {ltiClientAssertionType},
+		"client_assertion":      {signed},
+		"scope":                 {ltiScopeScore},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to request an access token: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to request an access token: unexpected response status %d", res.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("invalid access token response: %v", err)
+	}
+
+	// renew the token a minute before it expires
+	if lifetime := time.Duration(token.ExpiresIn)*time.Second - time.Minute; lifetime > 0 {
+		tokens.set(platform.Id, token.AccessToken, now.Add(lifetime))
+	}
+
+	return token.AccessToken, nil
+}
+
+// ltiScoresURL returns the scores endpoint of an AGS line item.
+func ltiScoresURL(lineItem string) (string, error) {
+	u, err := url.Parse(lineItem)
+	if err != nil {
+		return "", fmt.Errorf("invalid line item URL: %w", err)
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/scores"
+	return u.String(), nil
+}
+
+// SendLtiScore sends a single score attempt to the platform and stores its outcome.
+func SendLtiScore(app core.App, score *core.Record) error {
+	launch, err := app.FindRecordById("lti_launches", score.GetString("launch"))
+	if err != nil {
+		return fmt.Errorf("failed to find LTI launch: %w", err)
+	}
+
+	platform, err := app.FindRecordById("lti_platforms", launch.GetString("platform"))
+	if err != nil {
+		return fmt.Errorf("failed to find LTI platform: %w", err)
+	}
+
+	attempts := score.GetInt("attempts") + 1
+	score.Set("attempts", attempts)
+
+	scoresURL, err := ltiScoresURL(launch.GetString("lineitem"))
+	var accessToken string
+	if err == nil {
+		accessToken, err = ltiAccessToken(app, platform)
+	}
+
+	var req *http.Request
+	if err == nil {
+		req, err = http.NewRequest(http.MethodPost, scoresURL, bytes.NewReader([]byte(score.GetString("payload"))))
+	}
+	if err == nil {
+		req.Header.Set("Content-Type", ltiScoreContentType)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		var res *http.Response
+		res, err = ltiClient.Do(req)
+		if err == nil {
+			// only the status is kept, the org admins read the score log
+			res.Body.Close()
+
+			score.Set("response_code", res.StatusCode)
+
+			if res.StatusCode < 200 || res.StatusCode > 299 {
+				err = fmt.Errorf("unexpected response status %d", res.StatusCode)
+			}
+			if res.StatusCode == http.StatusUnauthorized {
+				// the cached access token may have been revoked
+				appExpiringStore(app, ltiAccessTokensKey).take(platform.Id)
+			}
+		}
+	}
+
+	if err == nil {
+		score.Set("status", DeliverySucceeded)
+		score.Set("last_error", "")
+		score.Set("next_attempt_at", "")
+		score.Set("delivered_at", types.NowDateTime())
+	} else {
+		score.Set("last_error", err.Error())
+		if attempts > len(webhookRetryDelays) {
+			score.Set("status", DeliveryFailed)
+			score.Set("next_attempt_at", "")
+		} else {
+			score.Set("status", DeliveryPending)
+			score.Set("next_attempt_at", types.NowDateTime().Add(webhookRetryDelays[attempts-1]))
+		}
+	}
+
+	if saveErr := app.Save(score); saveErr != nil {
+		return fmt.Errorf("failed to save LTI score: %w", saveErr)
+	}
+
+	return err
+}
+
+// RetryPendingLtiScores sends every pending score whose retry time has come.
+func RetryPendingLtiScores(app core.App) error {
+	scores, err := app.FindRecordsByFilter(
+		"lti_scores",
+		"status = {:status} && next_attempt_at <= {:now}",
+		"next_attempt_at",
+		100,
+		0,
+		dbx.Params{"status": DeliveryPending, "now": types.NowDateTime()},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to find pending LTI scores: %w", err)
+	}
+
+	for _, score := range scores {
+		if err := SendLtiScore(app, score); err != nil {
+			app.Logger().Warn("LTI score passback failed", "score", score.Id, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// bindLtiSubscribers passes the completed courses back to the launching platforms.
+func bindLtiSubscribers(events *CourseEvents) {
+	events.OnProgressStatusChanged.BindFunc(func(e *ProgressStatusChangedEvent) error {
+		if e.To == StatusCompleted {
+			if err := QueueLtiScores(e.App, e.Progress); err != nil {
+				return err
+			}
+		}
+		return e.Next()
+	})
+}
+
+func initLtiScoreHooks(app core.App) {
+	// send new scores right after they are committed
+	app.OnRecordAfterCreateSuccess("lti_scores").BindFunc(func(e *core.RecordEvent) error {
+		scoreID := e.Record.Id
+		routine.FireAndForget(func() {
+			score, err := app.FindRecordById("lti_scores", scoreID)
+			if err != nil {
+				app.Logger().Warn("Failed to load LTI score", "score", scoreID, "error", err)
+				return
+			}
+
+			if err := SendLtiScore(app, score); err != nil {
+				app.Logger().Warn("LTI score passback failed", "score", scoreID, "error", err)
+			}
+		})
+		return e.Next()
+	})
+
+	app.Cron().MustAdd("ltiScoreRetries", "* * * * *", func() {
+		if err := RetryPendingLtiScores(app); err != nil {
+			app.Logger().Error("Failed to retry LTI scores", "error", err)
+		}
+	})
+}
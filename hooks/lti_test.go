@@ -0,0 +1,450 @@
+package hooks
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+// testLtiPlatform is an in-process LMS stand-in serving the platform key set,
+// the AGS token endpoint and a line item, and signing launches with its own key.
+type testLtiPlatform struct {
+	t       *testing.T
+	key     *rsa.PrivateKey
+	server  *httptest.Server
+	toolKey *rsa.PublicKey
+
+	mu     sync.Mutex
+	scores []map[string]any
+}
+
+func newTestLtiPlatform(t *testing.T) *testLtiPlatform {
+	allowTestOutbound(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate the platform key: %v", err)
+	}
+
+	platform := &testLtiPlatform{t: t, key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []ltiJSONWebKey{newLtiJSONWebKey("platform-key", &key.PublicKey)},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		_, err := jwt.Parse(r.FormValue("client_assertion"), func(*jwt.Token) (any, error) {
+			return platform.toolKey, nil
+		}, jwt.WithIssuer("tool-client"), jwt.WithAudience(platform.server.URL+"/token"))
+		if err != nil || r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != ltiScopeScore {
+			http.Error(w, "invalid client assertion", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "platform-token", "expires_in": 3600})
+	})
+	mux.HandleFunc("POST /lineitems/1/scores", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer platform-token" || r.Header.Get("Content-Type") != ltiScoreContentType {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		score := map[string]any{}
+		json.NewDecoder(r.Body).Decode(&score)
+
+		platform.mu.Lock()
+		platform.scores = append(platform.scores, score)
+		platform.mu.Unlock()
+	})
+	platform.server = httptest.NewServer(mux)
+
+	return platform
+}
+
+// idToken signs a launch of message type for the nonce, with extra claims merged in.
+func (p *testLtiPlatform) idToken(nonce, messageType string, extra jwt.MapClaims) string {
+	claims := jwt.MapClaims{
+		"iss":                p.server.URL,
+		"aud":                "tool-client",
+		"sub":                "lms-user-1",
+		"iat":                time.Now().Unix(),
+		"exp":                time.Now().Add(time.Minute).Unix(),
+		"nonce":              nonce,
+		"email":              "Learner.One@Example.com",
+		"given_name":         "Learner",
+		"family_name":        "One",
+		ltiClaimMessageType:  messageType,
+		ltiClaimVersion:      LtiVersion,
+		ltiClaimDeploymentID: "dep1",
+	}
+	for name, value := range extra {
+		claims[name] = value
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "platform-key"
+
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		p.t.Fatalf("Failed to sign the id token: %v", err)
+	}
+	return signed
+}
+
+// createTestLtiPlatform registers platform in testOrg1.
+func createTestLtiPlatform(t *testing.T, app *tests.TestApp, platform *testLtiPlatform) *core.Record {
+	platforms, err := app.FindCollectionByNameOrId("lti_platforms")
+	if err != nil {
+		t.Fatalf("Failed to find lti_platforms collection: %v", err)
+	}
+
+	toolKey, err := generateLtiToolKey()
+	if err != nil {
+		t.Fatalf("Failed to generate the tool key: %v", err)
+	}
+
+	record := core.NewRecord(platforms)
+	record.Set("name", "Partner LMS")
+	record.Set("organization", testOrg1)
+	record.Set("issuer", platform.server.URL)
+	record.Set("client_id", "tool-client")
+	record.Set("deployment_ids", []string{"dep1"})
+	record.Set("auth_login_url", platform.server.URL+"/auth")
+	record.Set("auth_token_url", platform.server.URL+"/token")
+	record.Set("jwks_url", platform.server.URL+"/jwks")
+	record.Set("tool_key", toolKey)
+	if err := app.Save(record); err != nil {
+		t.Fatalf("Failed to save LTI platform: %v", err)
+	}
+
+	key, err := ltiToolKey(record)
+	if err != nil {
+		t.Fatalf("Failed to parse the tool key: %v", err)
+	}
+	platform.toolKey = &key.PublicKey
+
+	return record
+}
+
+func TestLtiLaunch(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	bindTestOnboarding(app)
+	bindLtiSubscribers(Events(app))
+
+	course := createTestCourse(t, app, courses, "")
+	course.Set("organization", testOrg1)
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+
+	lms := newTestLtiPlatform(t)
+	defer lms.server.Close()
+	platform := createTestLtiPlatform(t, app, lms)
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	bindLtiRoutes(r, service)
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	app.Settings().Meta.AppURL = server.URL
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	toolURL := server.URL + "/api/lti/" + platform.Id
+
+	// the state cookie of the last login, sent back by hand as it's a
+	// Secure cookie and the test server is plain HTTP
+	var stateCookie *http.Cookie
+
+	login := func() (state, nonce string) {
+		res, err := client.Get(toolURL + "/login?" + url.Values{
+			"iss":              {lms.server.URL},
+			"login_hint":       {"lms-user-1"},
+			"target_link_uri":  {toolURL + "/launch"},
+			"lti_message_hint": {"hint"},
+		}.Encode())
+		if err != nil {
+			t.Fatalf("Failed to initiate the login: %v", err)
+		}
+		res.Body.Close()
+
+		location, err := url.Parse(res.Header.Get("Location"))
+		if err != nil || res.StatusCode != http.StatusFound || !strings.HasPrefix(location.String(), lms.server.URL+"/auth") {
+			t.Fatalf("Expected a redirect to the platform, got %d %q", res.StatusCode, res.Header.Get("Location"))
+		}
+		query := location.Query()
+		if query.Get("redirect_uri") != toolURL+"/launch" || query.Get("client_id") != "tool-client" || query.Get("lti_message_hint") != "hint" {
+			t.Fatalf("Unexpected authentication request %v", query)
+		}
+
+		stateCookie = nil
+		for _, cookie := range res.Cookies() {
+			if cookie.Name == ltiStateCookie && cookie.Value == query.Get("state") {
+				stateCookie = cookie
+			}
+		}
+		if stateCookie == nil || !stateCookie.HttpOnly || !stateCookie.Secure || stateCookie.SameSite != http.SameSiteNoneMode {
+			t.Fatalf("Expected a state cookie for the launch, got %v", res.Cookies())
+		}
+		return query.Get("state"), query.Get("nonce")
+	}
+
+	post := func(path string, form url.Values) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, toolURL+path, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if stateCookie != nil {
+			req.AddCookie(&http.Cookie{Name: stateCookie.Name, Value: stateCookie.Value})
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to post to %s: %v", path, err)
+		}
+		return res
+	}
+
+	launch := func(state, idToken string) url.Values {
+		res := post("/launch", url.Values{"state": {state}, "id_token": {idToken}})
+		res.Body.Close()
+
+		location, err := url.Parse(res.Header.Get("Location"))
+		if err != nil || res.StatusCode != http.StatusSeeOther {
+			t.Fatalf("Expected a redirect to the login page, got %d %q", res.StatusCode, res.Header.Get("Location"))
+		}
+		fragment, _ := url.ParseQuery(location.Fragment)
+		return fragment
+	}
+
+	resourceLink := jwt.MapClaims{
+		"https://purl.imsglobal.org/spec/lti/claim/resource_link": map[string]any{"id": "link1"},
+		"https://purl.imsglobal.org/spec/lti/claim/custom":        map[string]any{"course": course.Id},
+		"https://purl.imsglobal.org/spec/lti-ags/claim/endpoint": map[string]any{
+			"scope":    []string{ltiScopeScore},
+			"lineitem": lms.server.URL + "/lineitems/1",
+		},
+	}
+
+	state, nonce := login()
+	fragment := launch(state, lms.idToken(nonce, LtiResourceLinkRequest, resourceLink))
+
+	user, err := app.FindAuthRecordByToken(fragment.Get("auth_token"), core.TokenTypeAuth)
+	if err != nil {
+		t.Fatalf("Expected a valid auth token, got %v", fragment)
+	}
+	if user.Email() != "learner.one@example.com" || user.GetString("name") != "Learner One" || user.GetString("organization") != testOrg1 {
+		t.Errorf("Unexpected provisioned user %s %q in %q", user.Email(), user.GetString("name"), user.GetString("organization"))
+	}
+
+	course, err = app.FindRecordById("courses", course.Id)
+	if err != nil {
+		t.Fatalf("Failed to reload course: %v", err)
+	}
+	if !slices.Contains(course.GetStringSlice("assignees"), user.Id) {
+		t.Errorf("Expected the launching user to be enrolled")
+	}
+
+	// the state can't be used twice
+	if fragment := launch(state, lms.idToken(nonce, LtiResourceLinkRequest, resourceLink)); fragment.Get("auth_error") == "" {
+		t.Errorf("Expected the replayed launch to fail, got %v", fragment)
+	}
+
+	// the launch must happen in the browser that initiated the login
+	state, nonce = login()
+	stateCookie = nil
+	if fragment := launch(state, lms.idToken(nonce, LtiResourceLinkRequest, resourceLink)); fragment.Get("auth_error") == "" {
+		t.Errorf("Expected the launch without the state cookie to fail, got %v", fragment)
+	}
+
+	// launches must be signed by the platform, for a known deployment
+	state, nonce = login()
+	forged := lms.idToken(nonce, LtiResourceLinkRequest, resourceLink)
+	if fragment := launch(state, forged[:len(forged)-4]+"AAAA"); fragment.Get("auth_error") == "" {
+		t.Errorf("Expected the forged launch to fail, got %v", fragment)
+	}
+	state, nonce = login()
+	otherDeployment := jwt.MapClaims{ltiClaimDeploymentID: "dep2"}
+	for name, value := range resourceLink {
+		otherDeployment[name] = value
+	}
+	if fragment := launch(state, lms.idToken(nonce, LtiResourceLinkRequest, otherDeployment)); fragment.Get("auth_error") == "" {
+		t.Errorf("Expected the unknown deployment to fail, got %v", fragment)
+	}
+
+	// completing the course passes the score back to the line item
+	progress, err := app.FindFirstRecordByFilter("progress", "course = {:course} && assignee = {:user}", dbx.Params{"course": course.Id, "user": user.Id})
+	if err != nil {
+		t.Fatalf("Failed to find progress: %v", err)
+	}
+	progress.Set("status", StatusCompleted)
+	if err := app.Save(progress); err != nil {
+		t.Fatalf("Failed to save progress: %v", err)
+	}
+	if err := service.RecordProgressEvent(progress, StatusInProgress, StatusCompleted, user.Id, ProgressSourceAPI); err != nil {
+		t.Fatalf("RecordProgressEvent failed: %v", err)
+	}
+
+	scores, err := app.FindAllRecords("lti_scores")
+	if err != nil || len(scores) != 1 {
+		t.Fatalf("Expected 1 queued score, got %d (%v)", len(scores), err)
+	}
+	if err := SendLtiScore(app, scores[0]); err != nil {
+		t.Fatalf("SendLtiScore failed: %v", err)
+	}
+	if scores[0].GetString("status") != DeliverySucceeded {
+		t.Errorf("Expected the score to be delivered, got %q", scores[0].GetString("status"))
+	}
+	if len(lms.scores) != 1 || lms.scores[0]["userId"] != "lms-user-1" || lms.scores[0]["scoreGiven"] != 1.0 || lms.scores[0]["activityProgress"] != "Completed" {
+		t.Errorf("Unexpected scores received by the platform %v", lms.scores)
+	}
+
+	// deep linking returns a signed resource link to the picked course
+	state, nonce = login()
+	res := post("/launch", url.Values{"state": {state}, "id_token": {lms.idToken(nonce, LtiDeepLinkingRequest, jwt.MapClaims{
+		"https://purl.imsglobal.org/spec/lti-dl/claim/deep_linking_settings": map[string]any{
+			"deep_link_return_url": lms.server.URL + "/deep-link-return",
+			"accept_types":         []string{ltiDeepLinkingResourceLink},
+			"data":                 "context1",
+		},
+	})}})
+	picker, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	deepLink := regexp.MustCompile(`name="deep_link" value="([^"]+)"`).FindSubmatch(picker)
+	if res.StatusCode != http.StatusOK || deepLink == nil || !strings.Contains(string(picker), course.GetString("title")) {
+		t.Fatalf("Expected the course picker, got %d %s", res.StatusCode, picker)
+	}
+
+	res = post("/deep-link", url.Values{"deep_link": {string(deepLink[1])}, "course": {course.Id}})
+	response, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	signed := regexp.MustCompile(`name="JWT" value="([^"]+)"`).FindSubmatch(response)
+	if !strings.Contains(string(response), `action="`+lms.server.URL+`/deep-link-return"`) || signed == nil {
+		t.Fatalf("Expected a form posting back to the platform, got %s", response)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(string(signed[1]), claims, func(*jwt.Token) (any, error) {
+		return lms.toolKey, nil
+	}, jwt.WithIssuer("tool-client"), jwt.WithAudience(lms.server.URL))
+	if err != nil {
+		t.Fatalf("Invalid deep linking response: %v", err)
+	}
+	items, _ := claims[ltiClaimDeepLinkingItems].([]any)
+	if claims[ltiClaimMessageType] != LtiDeepLinkingResponse || claims[ltiClaimDeepLinkingData] != "context1" || len(items) != 1 {
+		t.Fatalf("Unexpected deep linking response %v", claims)
+	}
+	item := items[0].(map[string]any)
+	if item["url"] != toolURL+"/launch" || item["custom"].(map[string]any)["course"] != course.Id {
+		t.Errorf("Unexpected content item %v", item)
+	}
+}
+
+func TestCourseService_LtiLaunch(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	bindTestOnboarding(app)
+	lms := newTestLtiPlatform(t)
+	defer lms.server.Close()
+	platform := createTestLtiPlatform(t, app, lms)
+
+	course := createTestCourse(t, app, courses, "")
+	course.Set("organization", testOrg1)
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+	otherCourse := createTestCourse(t, app, courses, "")
+	otherCourse.Set("organization", testOrg2)
+	if err := app.Save(otherCourse); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+
+	if _, err := service.LtiLaunch(platform, LtiLaunch{Sub: "s1", Email: "a@example.com", CourseID: otherCourse.Id}); err != ErrLtiCourse {
+		t.Errorf("Expected ErrLtiCourse for a course of another organization, got %v", err)
+	}
+	if _, err := service.LtiLaunch(platform, LtiLaunch{Sub: "s1", CourseID: course.Id}); err != ErrLtiNoEmail {
+		t.Errorf("Expected ErrLtiNoEmail, got %v", err)
+	}
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatalf("Failed to find users collection: %v", err)
+	}
+	outsider := core.NewRecord(users)
+	outsider.SetEmail("outsider@example.com")
+	outsider.SetPassword("1234567890")
+	outsider.Set("organization", testOrg2)
+	if err := app.Save(outsider); err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	if _, err := service.LtiLaunch(platform, LtiLaunch{Sub: "s2", Email: "outsider@example.com", CourseID: course.Id}); err != ErrLtiEmailTaken {
+		t.Errorf("Expected ErrLtiEmailTaken, got %v", err)
+	}
+
+	// the unverified email claim doesn't log in as an existing user of the organization
+	admin := core.NewRecord(users)
+	admin.SetEmail("admin@example.com")
+	admin.SetPassword("1234567890")
+	admin.Set("organization", testOrg1)
+	admin.Set("role", RoleOrgAdmin)
+	if err := app.Save(admin); err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	if user, err := service.LtiLaunch(platform, LtiLaunch{Sub: "s4", Email: "admin@example.com", CourseID: course.Id}); err != ErrLtiEmailTaken || user != nil {
+		t.Errorf("Expected ErrLtiEmailTaken for the email of an existing user, got %v %v", user, err)
+	}
+	if launch, _ := app.FindFirstRecordByData("lti_launches", "user", admin.Id); launch != nil {
+		t.Errorf("Expected no launch to be linked to the existing user")
+	}
+
+	// later launches find the user by its platform subject, even if the email changed
+	first, err := service.LtiLaunch(platform, LtiLaunch{Sub: "s3", Email: "s3@example.com", CourseID: course.Id, ResourceLinkID: "l1"})
+	if err != nil {
+		t.Fatalf("LtiLaunch failed: %v", err)
+	}
+	second, err := service.LtiLaunch(platform, LtiLaunch{Sub: "s3", Email: "renamed@example.com", CourseID: course.Id, ResourceLinkID: "l1"})
+	if err != nil {
+		t.Fatalf("LtiLaunch failed: %v", err)
+	}
+	if first.Id != second.Id {
+		t.Errorf("Expected the same user for the same subject")
+	}
+
+	launches, err := app.FindAllRecords("lti_launches")
+	if err != nil || len(launches) != 1 {
+		t.Errorf("Expected a single launch per subject and resource link, got %d (%v)", len(launches), err)
+	}
+}
@@ -0,0 +1,133 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+var ErrManagerCycle = errors.New("manager hierarchy cycle")
+
+// ResolveManagers returns the management chain of a user that reports to
+// managerID, starting with the direct manager and ending with the top of the
+// hierarchy. It relies on the already materialized "managers" field of the
+// direct manager, so it doesn't need to walk the whole hierarchy.
+func ResolveManagers(app core.App, userID, managerID string) ([]string, error) {
+	if managerID == "" {
+		return []string{}, nil
+	}
+
+	if managerID == userID {
+		return nil, fmt.Errorf("%w: a user can't be their own manager", ErrManagerCycle)
+	}
+
+	manager, err := app.FindRecordById("users", managerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find manager: %w", err)
+	}
+
+	chain := append([]string{manager.Id}, manager.GetStringSlice("managers")...)
+	if userID != "" && slices.Contains(chain, userID) {
+		return nil, fmt.Errorf("%w: %s already reports to %s", ErrManagerCycle, managerID, userID)
+	}
+
+	return chain, nil
+}
+
+// GetReportIDs returns the ids of the direct and indirect reports of a manager.
+func (cs *CourseService) GetReportIDs(managerID string) ([]string, error) {
+	reports, err := cs.app.FindRecordsByFilter(
+		"users",
+		"managers.id ?= {:manager}",
+		"",
+		0,
+		0,
+		dbx.Params{"manager": managerID},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find reports: %w", err)
+	}
+
+	reportIDs := make([]string, 0, len(reports))
+	for _, report := range reports {
+		reportIDs = append(reportIDs, report.Id)
+	}
+	return reportIDs, nil
+}
+
+// syncManagers refreshes the materialized "managers" field of a user record
+// from its "manager" relation.
+func syncManagers(app core.App, user *core.Record) error {
+	if managerID := user.GetString("manager"); managerID != "" {
+		manager, err := app.FindRecordById("users", managerID)
+		if err != nil {
+			return fmt.Errorf("failed to find manager: %w", err)
+		}
+
+		if manager.GetString("organization") != user.GetString("organization") {
+			return validation.Errors{
+				"manager": validation.NewError("validation_manager_organization", "The manager must belong to the same organization."),
+			}
+		}
+	}
+
+	chain, err := ResolveManagers(app, user.Id, user.GetString("manager"))
+	if err != nil {
+		if errors.Is(err, ErrManagerCycle) {
+			return validation.Errors{
+				"manager": validation.NewError("validation_manager_cycle", err.Error()),
+			}
+		}
+		return err
+	}
+
+	user.Set("managers", chain)
+	return nil
+}
+
+// initManagerHooks keeps the "managers" ancestor list of every user in sync with
+// the manager hierarchy. Collection API rules can't recurse over a self relation,
+// so rules such as "assignee.managers.id ?= @request.auth.id" use this list instead.
+func initManagerHooks(app core.App) {
+	app.OnRecordCreate("users").BindFunc(func(e *core.RecordEvent) error {
+		if err := syncManagers(e.App, e.Record); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+
+	app.OnRecordUpdate("users").BindFunc(func(e *core.RecordEvent) error {
+		if err := syncManagers(e.App, e.Record); err != nil {
+			return err
+		}
+
+		originalManagers := e.Record.Original().GetStringSlice("managers")
+
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		if slices.Equal(originalManagers, e.Record.GetStringSlice("managers")) {
+			return nil
+		}
+
+		// the chain changed, so propagate it down to the direct reports
+		// (which in turn propagate it to their own reports)
+		reports, err := e.App.FindAllRecords("users", dbx.HashExp{"manager": e.Record.Id})
+		if err != nil {
+			return fmt.Errorf("failed to find direct reports: %w", err)
+		}
+
+		for _, report := range reports {
+			if err := e.App.Save(report); err != nil {
+				return fmt.Errorf("failed to update reports of %s: %w", e.Record.Id, err)
+			}
+		}
+
+		return nil
+	})
+}
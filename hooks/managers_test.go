@@ -0,0 +1,212 @@
+package hooks
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+func createTestUser(t *testing.T, app *tests.TestApp, users *core.Collection, email, managerID string) *core.Record {
+	user := core.NewRecord(users)
+	user.SetEmail(email)
+	user.SetPassword("1234567890")
+	user.Set("manager", managerID)
+
+	if err := app.Save(user); err != nil {
+		t.Fatalf("Failed to create user %s: %v", email, err)
+	}
+	return user
+}
+
+func TestInitManagerHooks_Hierarchy(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	_, users := createTestCollections(t, app)
+	initManagerHooks(app)
+
+	director := createTestUser(t, app, users, "director@example.com", "")
+	lead := createTestUser(t, app, users, "lead@example.com", director.Id)
+	learner := createTestUser(t, app, users, "learner@example.com", lead.Id)
+
+	if got := learner.GetStringSlice("managers"); !slices.Equal(got, []string{lead.Id, director.Id}) {
+		t.Errorf("Expected learner managers [lead director], got %v", got)
+	}
+
+	reports, err := service.GetReportIDs(director.Id)
+	if err != nil {
+		t.Fatalf("GetReportIDs failed: %v", err)
+	}
+	if len(reports) != 2 || !slices.Contains(reports, lead.Id) || !slices.Contains(reports, learner.Id) {
+		t.Errorf("Expected director to have lead and learner as reports, got %v", reports)
+	}
+
+	// moving the lead under a new manager must update the whole subtree
+	vp := createTestUser(t, app, users, "vp@example.com", "")
+	lead.Set("manager", vp.Id)
+	if err := app.Save(lead); err != nil {
+		t.Fatalf("Failed to move lead: %v", err)
+	}
+
+	learner, err = app.FindRecordById("users", learner.Id)
+	if err != nil {
+		t.Fatalf("Failed to reload learner: %v", err)
+	}
+	if got := learner.GetStringSlice("managers"); !slices.Equal(got, []string{lead.Id, vp.Id}) {
+		t.Errorf("Expected learner managers [lead vp], got %v", got)
+	}
+
+	reports, err = service.GetReportIDs(director.Id)
+	if err != nil {
+		t.Fatalf("GetReportIDs failed: %v", err)
+	}
+	if len(reports) != 0 {
+		t.Errorf("Expected director to have no reports left, got %v", reports)
+	}
+}
+
+func TestInitManagerHooks_RejectsCycles(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	_, users := createTestCollections(t, app)
+	initManagerHooks(app)
+
+	director := createTestUser(t, app, users, "director@example.com", "")
+	lead := createTestUser(t, app, users, "lead@example.com", director.Id)
+
+	director.Set("manager", lead.Id)
+	err := app.Save(director)
+
+	var validationErrors validation.Errors
+	if !errors.As(err, &validationErrors) || validationErrors["manager"] == nil {
+		t.Fatalf("Expected a manager validation error, got %v", err)
+	}
+
+	lead.Set("manager", lead.Id)
+	if err := app.Save(lead); err == nil {
+		t.Error("Expected an error when a user manages themselves")
+	}
+}
+
+func TestManagerRules(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, users := createTestCollections(t, app)
+	initManagerHooks(app)
+
+	newUser := func(email, role, managerID string) *core.Record {
+		user := core.NewRecord(users)
+		user.SetEmail(email)
+		user.SetPassword("1234567890")
+		user.Set("manager", managerID)
+		user.Set("role", role)
+		user.Set("organization", testOrg1)
+		if err := app.Save(user); err != nil {
+			t.Fatalf("Failed to save user %s: %v", email, err)
+		}
+		return user
+	}
+	manager := newUser("manager@example.com", RoleManager, "")
+	report := newUser("report@example.com", "", manager.Id)
+	other := newUser("other@example.com", "", "")
+	// only users with the manager role see the progress of their reports
+	lead := newUser("lead@example.com", "", "")
+	otherReport := newUser("other-report@example.com", "", lead.Id)
+
+	course := createTestCourse(t, app, courses, "")
+	course.Set("organization", testOrg1)
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+
+	progressCollection, err := app.FindCollectionByNameOrId("progress")
+	if err != nil {
+		t.Fatalf("Failed to find progress collection: %v", err)
+	}
+	progressIDs := map[string]string{}
+	for _, assignee := range []*core.Record{report, other, otherReport} {
+		progress := core.NewRecord(progressCollection)
+		progress.Set("course", course.Id)
+		progress.Set("assignee", assignee.Id)
+		progress.Set("organization", testOrg1)
+		progress.Set("status", StatusInProgress)
+		if err := app.Save(progress); err != nil {
+			t.Fatalf("Failed to save progress: %v", err)
+		}
+		if err := service.RecordProgressEvent(progress, StatusNotStarted, StatusInProgress, assignee.Id, ProgressSourceAPI); err != nil {
+			t.Fatalf("RecordProgressEvent failed: %v", err)
+		}
+		progressIDs[assignee.Id] = progress.Id
+	}
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(auth *core.Record, path string) (int, map[string]any) {
+		t.Helper()
+
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		token, err := auth.NewAuthToken()
+		if err != nil {
+			t.Fatalf("Failed to create auth token: %v", err)
+		}
+		req.Header.Set("Authorization", token)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer res.Body.Close()
+
+		var out map[string]any
+		json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out
+	}
+
+	assignees := func(out map[string]any) []string {
+		ids := []string{}
+		items, _ := out["items"].([]any)
+		for _, item := range items {
+			ids = append(ids, item.(map[string]any)["assignee"].(string))
+		}
+		return ids
+	}
+
+	for _, collection := range []string{"progress", "progress_events"} {
+		status, out := get(manager, "/api/collections/"+collection+"/records")
+		if status != http.StatusOK || !slices.Equal(assignees(out), []string{report.Id}) {
+			t.Errorf("Expected the manager to list the %s of their report only, got %d %v", collection, status, out)
+		}
+
+		if status, out := get(lead, "/api/collections/"+collection+"/records"); status != http.StatusOK || len(assignees(out)) != 0 {
+			t.Errorf("Expected a user without the manager role not to list the %s of their reports, got %d %v", collection, status, out)
+		}
+	}
+
+	if status, _ := get(manager, "/api/collections/progress/records/"+progressIDs[report.Id]); status != http.StatusOK {
+		t.Errorf("Expected the manager to view the progress of their report, got %d", status)
+	}
+	for _, assignee := range []*core.Record{other, otherReport} {
+		if status, _ := get(manager, "/api/collections/progress/records/"+progressIDs[assignee.Id]); status != http.StatusNotFound {
+			t.Errorf("Expected the progress of %s to be hidden from the manager, got %d", assignee.Email(), status)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package hooks
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/plugins/jsvm"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+var (
+	testMigrationsOnce sync.Once
+	testMigrations     core.MigrationsList
+	testMigrationsErr  error
+)
+
+// loadTestMigrations loads pb_migrations into a dedicated list, leaving
+// core.AppMigrations untouched so plain test apps keep the default schema.
+func loadTestMigrations() (core.MigrationsList, error) {
+	testMigrationsOnce.Do(func() {
+		app, err := tests.NewTestApp()
+		if err != nil {
+			testMigrationsErr = err
+			return
+		}
+		defer app.Cleanup()
+
+		appMigrations := core.AppMigrations
+		core.AppMigrations = core.MigrationsList{}
+		defer func() {
+			testMigrations = core.AppMigrations
+			core.AppMigrations = appMigrations
+		}()
+
+		testMigrationsErr = jsvm.Register(app, jsvm.Config{
+			HooksDir:      "../pb_hooks",
+			MigrationsDir: "../pb_migrations",
+		})
+	})
+
+	return testMigrations, testMigrationsErr
+}
+
+// Organizations created by createTestCollections.
+const (
+	testOrg1 = "org100000000001"
+	testOrg2 = "org200000000002"
+)
+
+// createTestCollections creates the eLesson collections in the test app by
+// running the real pb_migrations against it, plus the testOrg1 and testOrg2
+// organizations.
+func createTestCollections(tb testing.TB, app *tests.TestApp) (courses, users *core.Collection) {
+	tb.Helper()
+
+	migrations, err := loadTestMigrations()
+	if err != nil {
+		tb.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	if _, err := core.NewMigrationsRunner(app, migrations).Up(); err != nil {
+		tb.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	organizations, err := app.FindCollectionByNameOrId("organizations")
+	if err != nil {
+		tb.Fatalf("Failed to find organizations collection: %v", err)
+	}
+	for _, id := range []string{testOrg1, testOrg2} {
+		organization := core.NewRecord(organizations)
+		organization.Id = id
+		organization.Set("name", "Organization "+id)
+		if err := app.Save(organization); err != nil {
+			tb.Fatalf("Failed to save organization: %v", err)
+		}
+	}
+
+	if courses, err = app.FindCollectionByNameOrId("courses"); err != nil {
+		tb.Fatalf("Failed to find courses collection: %v", err)
+	}
+	if users, err = app.FindCollectionByNameOrId("users"); err != nil {
+		tb.Fatalf("Failed to find users collection: %v", err)
+	}
+
+	return courses, users
+}
+
+// createTestLearner creates the learner@example.com user.
+func createTestLearner(tb testing.TB, app *tests.TestApp) *core.Record {
+	tb.Helper()
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		tb.Fatalf("Failed to find users collection: %v", err)
+	}
+
+	learner := core.NewRecord(users)
+	learner.SetEmail("learner@example.com")
+	learner.SetPassword("1234567890")
+	if err := app.Save(learner); err != nil {
+		tb.Fatalf("Failed to save learner: %v", err)
+	}
+	return learner
+}
@@ -0,0 +1,64 @@
+package hooks
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// organizationScopedCollections are stamped with the organization of the
+// authenticated user creating them. Superusers can pick any organization.
+var organizationScopedCollections = []string{"users", "courses", "resources", "webhooks", "invites", "groups", "saml_providers", "lti_platforms", "xapi_forwarders"}
+
+// courseScopedCollections inherit the organization of their course.
+var courseScopedCollections = []string{"lessons", "progress"}
+
+// CourseOrganization returns the organization id of a course.
+func CourseOrganization(app core.App, courseID string) (string, error) {
+	courseRecord, err := app.FindRecordById("courses", courseID)
+	if err != nil {
+		return "", fmt.Errorf("failed to find course: %w", err)
+	}
+	return courseRecord.GetString("organization"), nil
+}
+
+// inheritCourseOrganization copies the course organization into a course scoped record.
+func inheritCourseOrganization(app core.App, record *core.Record) error {
+	courseID := record.GetString("course")
+	if courseID == "" {
+		return nil
+	}
+
+	organizationID, err := CourseOrganization(app, courseID)
+	if err != nil {
+		return err
+	}
+
+	record.Set("organization", organizationID)
+	return nil
+}
+
+// initOrganizationHooks keeps every record in the organization of its creator
+// or of its course, so that the collection rules can isolate the organizations.
+func initOrganizationHooks(app core.App) {
+	app.OnRecordCreateRequest(organizationScopedCollections...).BindFunc(func(e *core.RecordRequestEvent) error {
+		if e.Auth != nil && !e.Auth.IsSuperuser() {
+			e.Record.Set("organization", e.Auth.GetString("organization"))
+		}
+		return e.Next()
+	})
+
+	app.OnRecordCreate(courseScopedCollections...).BindFunc(func(e *core.RecordEvent) error {
+		if err := inheritCourseOrganization(e.App, e.Record); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+
+	app.OnRecordUpdate(courseScopedCollections...).BindFunc(func(e *core.RecordEvent) error {
+		if err := inheritCourseOrganization(e.App, e.Record); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+}
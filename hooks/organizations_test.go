@@ -0,0 +1,223 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestInitOrganizationHooks_InheritsCourseOrganization(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	initOrganizationHooks(app)
+
+	lessons, err := app.FindCollectionByNameOrId("lessons")
+	if err != nil {
+		t.Fatalf("Failed to find lessons collection: %v", err)
+	}
+
+	course := core.NewRecord(courses)
+	course.Set("title", "Onboarding")
+	course.Set("organization", testOrg1)
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+
+	lesson := core.NewRecord(lessons)
+	lesson.Set("course", course.Id)
+	lesson.Set("title", "Welcome")
+	lesson.Set("organization", testOrg2)
+	if err := app.Save(lesson); err != nil {
+		t.Fatalf("Failed to save lesson: %v", err)
+	}
+
+	if organization := lesson.GetString("organization"); organization != testOrg1 {
+		t.Errorf("Expected the lesson to inherit organization org1, got %q", organization)
+	}
+}
+
+func TestCourseService_ProcessAssignToEveryone_Organization(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, users := createTestCollections(t, app)
+
+	userIDs := map[string]string{}
+	for _, organization := range []string{testOrg1, testOrg2} {
+		user := core.NewRecord(users)
+		user.SetEmail(organization + "@example.com")
+		user.SetPassword("1234567890")
+		user.Set("organization", organization)
+		if err := app.Save(user); err != nil {
+			t.Fatalf("Failed to save user: %v", err)
+		}
+		userIDs[organization] = user.Id
+	}
+
+	course := core.NewRecord(courses)
+	course.Set("title", "Security training")
+	course.Set("assign_to_everyone", true)
+	course.Set("organization", testOrg1)
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+
+	assignees, err := service.ProcessAssignToEveryone(course)
+	if err != nil {
+		t.Fatalf("ProcessAssignToEveryone failed: %v", err)
+	}
+
+	if !slices.Equal(assignees, []string{userIDs[testOrg1]}) {
+		t.Errorf("Expected only the org1 user to be assigned, got %v", assignees)
+	}
+}
+
+func TestOrganizationRules(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, users := createTestCollections(t, app)
+	initOrganizationHooks(app)
+
+	newUser := func(email, role, organization string) *core.Record {
+		user := core.NewRecord(users)
+		user.SetEmail(email)
+		user.SetPassword("1234567890")
+		user.Set("role", role)
+		user.Set("organization", organization)
+		if err := app.Save(user); err != nil {
+			t.Fatalf("Failed to save user: %v", err)
+		}
+		return user
+	}
+	admin := newUser("admin1@example.com", RoleOrgAdmin, testOrg1)
+	learner := newUser("learner1@example.com", "", testOrg1)
+	outsider := newUser("learner2@example.com", "", testOrg2)
+
+	courseIDs := map[string]string{}
+	for _, organization := range []string{testOrg1, testOrg2} {
+		course := core.NewRecord(courses)
+		course.Set("title", "Onboarding")
+		course.Set("organization", organization)
+		if err := app.Save(course); err != nil {
+			t.Fatalf("Failed to save course: %v", err)
+		}
+		courseIDs[organization] = course.Id
+	}
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	send := func(method, path string, body map[string]any) (int, map[string]any) {
+		t.Helper()
+
+		var reader io.Reader
+		if body != nil {
+			data, _ := json.Marshal(body)
+			reader = bytes.NewReader(data)
+		}
+		req, _ := http.NewRequest(method, server.URL+path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		token, err := admin.NewAuthToken()
+		if err != nil {
+			t.Fatalf("Failed to create auth token: %v", err)
+		}
+		req.Header.Set("Authorization", token)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer res.Body.Close()
+
+		var out map[string]any
+		json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out
+	}
+
+	t.Run("list", func(t *testing.T) {
+		status, out := send(http.MethodGet, "/api/collections/courses/records", nil)
+		items, _ := out["items"].([]any)
+		if status != http.StatusOK || len(items) != 1 || items[0].(map[string]any)["id"] != courseIDs[testOrg1] {
+			t.Errorf("Expected only the course of the organization, got %d %v", status, out)
+		}
+	})
+
+	t.Run("view", func(t *testing.T) {
+		if status, _ := send(http.MethodGet, "/api/collections/courses/records/"+courseIDs[testOrg1], nil); status != http.StatusOK {
+			t.Errorf("Expected the course of the organization, got %d", status)
+		}
+		if status, _ := send(http.MethodGet, "/api/collections/courses/records/"+courseIDs[testOrg2], nil); status != http.StatusNotFound {
+			t.Errorf("Expected the course of another organization to be hidden, got %d", status)
+		}
+	})
+
+	t.Run("create", func(t *testing.T) {
+		for _, assignees := range [][]string{{outsider.Id}, {learner.Id, outsider.Id}} {
+			if status, out := send(http.MethodPost, "/api/collections/courses/records", map[string]any{"title": "Security", "assignees": assignees}); status != http.StatusBadRequest {
+				t.Errorf("Expected a course assigned to %v to be rejected, got %d %v", assignees, status, out)
+			}
+		}
+
+		status, out := send(http.MethodPost, "/api/collections/courses/records", map[string]any{"title": "Security", "assignees": []string{learner.Id}})
+		if status != http.StatusOK || out["organization"] != testOrg1 {
+			t.Errorf("Expected the course to be created in the organization, got %d %v", status, out)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		path := "/api/collections/courses/records/" + courseIDs[testOrg1]
+		for _, body := range []map[string]any{
+			{"assignees": []string{outsider.Id}},
+			{"assignees": []string{learner.Id, outsider.Id}},
+			{"assignees+": outsider.Id},
+		} {
+			if status, out := send(http.MethodPatch, path, body); status != http.StatusNotFound {
+				t.Errorf("Expected %v to be rejected, got %d %v", body, status, out)
+			}
+		}
+
+		if status, out := send(http.MethodPatch, path, map[string]any{"assignees": []string{learner.Id}}); status != http.StatusOK {
+			t.Errorf("Expected the assignee of the organization to be added, got %d %v", status, out)
+		}
+		if status, out := send(http.MethodPatch, path, map[string]any{"title": "Onboarding 2027"}); status != http.StatusOK {
+			t.Errorf("Expected the course to be updated, got %d %v", status, out)
+		}
+		if status, _ := send(http.MethodPatch, "/api/collections/courses/records/"+courseIDs[testOrg2], map[string]any{"title": "Taken over"}); status != http.StatusNotFound {
+			t.Errorf("Expected the course of another organization not to be updated, got %d", status)
+		}
+	})
+
+	t.Run("progress", func(t *testing.T) {
+		for _, progress := range []map[string]any{
+			{"course": courseIDs[testOrg1], "assignee": outsider.Id, "status": StatusNotStarted},
+			{"course": courseIDs[testOrg2], "assignee": learner.Id, "status": StatusNotStarted},
+		} {
+			if status, out := send(http.MethodPost, "/api/collections/progress/records", progress); status != http.StatusBadRequest {
+				t.Errorf("Expected progress %v to be rejected, got %d %v", progress, status, out)
+			}
+		}
+
+		status, out := send(http.MethodPost, "/api/collections/progress/records", map[string]any{"course": courseIDs[testOrg1], "assignee": learner.Id, "status": StatusNotStarted})
+		if status != http.StatusOK || out["organization"] != testOrg1 {
+			t.Errorf("Expected progress to be created in the organization, got %d %v", status, out)
+		}
+	})
+}
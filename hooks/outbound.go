@@ -0,0 +1,92 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrOutboundDestination is returned when an outbound request targets an URL
+// that the instance refuses to call.
+var ErrOutboundDestination = errors.New("outbound destination not allowed")
+
+// outboundAllowPrivate lets the tests reach their local plain HTTP servers.
+var outboundAllowPrivate = false
+
+// nonPublicPrefixes are the internal ranges that netip.Addr doesn't classify:
+// "this network" (reaching the host on Linux) and the carrier-grade NAT range.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// newOutboundClient returns an HTTP client for the URLs set by the
+// organizations, like the webhook, LRS forwarder and LTI platform URLs. It only
+// sends https requests to public addresses and doesn't follow redirects, so
+// these URLs can't be used to reach the services of the instance network.
+func newOutboundClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: outboundDialControl}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would dial the destination in place of the checked dialer
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: outboundTransport{base: transport},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// outboundTransport rejects the requests that aren't sent over https.
+type outboundTransport struct {
+	base http.RoundTripper
+}
+
+func (t outboundTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" && !outboundAllowPrivate {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("%w: %s isn't an https URL", ErrOutboundDestination, req.URL.Redacted())
+	}
+	return t.base.RoundTrip(req)
+}
+
+// outboundDialControl checks the resolved address of every connection, so that
+// host names resolving to internal addresses are rejected as well.
+func outboundDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	if !outboundAllowPrivate && !isPublicAddress(ip.Unmap()) {
+		return fmt.Errorf("%w: %s isn't a public address", ErrOutboundDestination, ip)
+	}
+	return nil
+}
+
+// isPublicAddress reports whether ip is a globally routable unicast address.
+func isPublicAddress(ip netip.Addr) bool {
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
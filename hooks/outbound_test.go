@@ -0,0 +1,71 @@
+package hooks
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// allowTestOutbound lets the outbound clients reach the local test servers.
+func allowTestOutbound(t *testing.T) {
+	outboundAllowPrivate = true
+	t.Cleanup(func() { outboundAllowPrivate = false })
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	scenarios := []struct {
+		address  string
+		expected bool
+	}{
+		{"93.184.215.14", true},
+		{"2606:2800:21f:cb07:6820:80da:af6b:8b2c", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.100.175", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+	}
+	for _, s := range scenarios {
+		if public := isPublicAddress(netip.MustParseAddr(s.address)); public != s.expected {
+			t.Errorf("%s: expected public %v, got %v", s.address, s.expected, public)
+		}
+	}
+}
+
+func TestOutboundClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	client := newOutboundClient(5 * time.Second)
+
+	if _, err := client.Get("http://example.com/hook"); !errors.Is(err, ErrOutboundDestination) {
+		t.Errorf("Expected plain HTTP URLs to be rejected, got %v", err)
+	}
+
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrOutboundDestination) {
+		t.Errorf("Expected loopback addresses to be rejected, got %v", err)
+	}
+
+	// redirects are returned as is
+	allowTestOutbound(t)
+	client.Transport.(outboundTransport).base.(*http.Transport).TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected the local server to be reached, got %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Errorf("Expected the redirect not to be followed, got status %d", res.StatusCode)
+	}
+}
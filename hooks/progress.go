@@ -0,0 +1,191 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	StatusNotStarted = "Not Started"
+	StatusInProgress = "In Progress"
+	StatusCompleted  = "Completed"
+)
+
+// Sources describing where a progress status change originated from.
+const (
+	ProgressSourceAPI        = "api"
+	ProgressSourceAssignment = "assignment"
+	ProgressSourceReset      = "reset"
+	ProgressSourceScorm      = "scorm"
+	ProgressSourceCmi5       = "cmi5"
+)
+
+var ErrInvalidStatusTransition = errors.New("invalid progress status transition")
+
+// statusTransitions lists the status changes allowed through regular updates.
+// Completed courses can only go back to Not Started through an explicit reset.
+var statusTransitions = map[string][]string{
+	StatusNotStarted: {StatusInProgress},
+	StatusInProgress: {StatusNotStarted, StatusCompleted},
+	StatusCompleted:  {},
+}
+
+func ValidateStatusTransition(from, to, source string) error {
+	if from == to {
+		return nil
+	}
+
+	if _, ok := statusTransitions[to]; !ok {
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidStatusTransition, to)
+	}
+
+	if source == ProgressSourceReset {
+		if to != StatusNotStarted {
+			return fmt.Errorf("%w: reset must go back to %q", ErrInvalidStatusTransition, StatusNotStarted)
+		}
+		return nil
+	}
+
+	allowed, ok := statusTransitions[from]
+	if !ok {
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidStatusTransition, from)
+	}
+
+	for _, status := range allowed {
+		if status == to {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %q to %q", ErrInvalidStatusTransition, from, to)
+}
+
+// StampProgressTimestamps updates started_at/completed_at according to the status change.
+func StampProgressTimestamps(progressRecord *core.Record, from, to string) {
+	if from == to {
+		return
+	}
+
+	now := types.NowDateTime()
+
+	switch to {
+	case StatusNotStarted:
+		progressRecord.Set("started_at", "")
+		progressRecord.Set("completed_at", "")
+	case StatusInProgress:
+		if progressRecord.GetDateTime("started_at").IsZero() {
+			progressRecord.Set("started_at", now)
+		}
+		progressRecord.Set("completed_at", "")
+	case StatusCompleted:
+		if progressRecord.GetDateTime("started_at").IsZero() {
+			progressRecord.Set("started_at", now)
+		}
+		progressRecord.Set("completed_at", now)
+	}
+}
+
+// statusTransitionError wraps a transition error into API validation data.
+func statusTransitionError(err error) validation.Errors {
+	return validation.Errors{
+		"status": validation.NewError("validation_invalid_status_transition", err.Error()),
+	}
+}
+
+func (cs *CourseService) RecordProgressEvent(progressRecord *core.Record, from, to, actorID, source string) error {
+	if actorID == "" {
+		actorID = cs.actor
+	}
+
+	eventsCollection, err := cs.app.FindCollectionByNameOrId("progress_events")
+	if err != nil {
+		return fmt.Errorf("failed to find progress_events collection: %w", err)
+	}
+
+	event := core.NewRecord(eventsCollection)
+	event.Set("progress", progressRecord.Id)
+	event.Set("course", progressRecord.GetString("course"))
+	event.Set("assignee", progressRecord.GetString("assignee"))
+	event.Set("from", from)
+	event.Set("to", to)
+	event.Set("actor", actorID)
+	event.Set("source", source)
+
+	if err := cs.app.Save(event); err != nil {
+		return fmt.Errorf("failed to save progress event: %w", err)
+	}
+
+	if from == "" {
+		// the initial status is already part of the progress.created audit entry
+		return nil
+	}
+
+	err = cs.WithActor(actorID).Audit(AuditProgressStatusChanged, progressRecord.Collection().Name, progressRecord.Id, map[string]any{
+		"course":   progressRecord.GetString("course"),
+		"assignee": progressRecord.GetString("assignee"),
+		"from":     from,
+		"to":       to,
+		"source":   source,
+	})
+	if err != nil {
+		return err
+	}
+
+	return cs.events.OnProgressStatusChanged.Trigger(&ProgressStatusChangedEvent{
+		App:      cs.app,
+		Actor:    actorID,
+		Progress: progressRecord,
+		From:     from,
+		To:       to,
+		Source:   source,
+	})
+}
+
+// ResetProgressStatus moves a progress record back to "Not Started",
+// which is the only way to leave the "Completed" status.
+func (cs *CourseService) ResetProgressStatus(progressID, actorID string) error {
+	return cs.app.RunInTransaction(func(txApp core.App) error {
+		txService := cs.withApp(txApp)
+
+		progressRecord, err := txApp.FindRecordById("progress", progressID)
+		if err != nil {
+			return fmt.Errorf("failed to find progress record: %w", err)
+		}
+
+		from := progressRecord.GetString("status")
+		if from == StatusNotStarted {
+			return nil
+		}
+
+		if err := ValidateStatusTransition(from, StatusNotStarted, ProgressSourceReset); err != nil {
+			return err
+		}
+
+		progressRecord.Set("status", StatusNotStarted)
+		StampProgressTimestamps(progressRecord, from, StatusNotStarted)
+
+		if err := txApp.Save(progressRecord); err != nil {
+			return fmt.Errorf("failed to reset progress record: %w", err)
+		}
+
+		return txService.RecordProgressEvent(progressRecord, from, StatusNotStarted, actorID, ProgressSourceReset)
+	})
+}
+
+// HandleLessonProgressChange publishes a LessonCompleted event when a lesson
+// progress record becomes completed.
+func (cs *CourseService) HandleLessonProgressChange(lessonProgress *core.Record, wasCompleted bool) error {
+	if wasCompleted || !lessonProgress.GetBool("completed") {
+		return nil
+	}
+
+	return cs.events.OnLessonCompleted.Trigger(&LessonCompletedEvent{
+		App:            cs.app,
+		Actor:          cs.actor,
+		LessonProgress: lessonProgress,
+	})
+}
@@ -0,0 +1,204 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func newTestProgressRecord() *core.Record {
+	collection := core.NewBaseCollection("progress")
+	collection.Fields.Add(&core.TextField{Name: "status"})
+	collection.Fields.Add(&core.DateField{Name: "started_at"})
+	collection.Fields.Add(&core.DateField{Name: "completed_at"})
+	return core.NewRecord(collection)
+}
+
+func TestValidateStatusTransition(t *testing.T) {
+	testCases := []struct {
+		name    string
+		from    string
+		to      string
+		source  string
+		wantErr bool
+	}{
+		{"start_course", StatusNotStarted, StatusInProgress, ProgressSourceAPI, false},
+		{"complete_course", StatusInProgress, StatusCompleted, ProgressSourceAPI, false},
+		{"abandon_course", StatusInProgress, StatusNotStarted, ProgressSourceAPI, false},
+		{"unchanged_status", StatusCompleted, StatusCompleted, ProgressSourceAPI, false},
+		{"skip_in_progress", StatusNotStarted, StatusCompleted, ProgressSourceAPI, true},
+		{"reopen_completed", StatusCompleted, StatusInProgress, ProgressSourceAPI, true},
+		{"uncomplete_without_reset", StatusCompleted, StatusNotStarted, ProgressSourceAPI, true},
+		{"reset_completed", StatusCompleted, StatusNotStarted, ProgressSourceReset, false},
+		{"reset_to_other_status", StatusCompleted, StatusInProgress, ProgressSourceReset, true},
+		{"unknown_status", StatusNotStarted, "Paused", ProgressSourceAPI, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateStatusTransition(tc.from, tc.to, tc.source)
+			if tc.wantErr && !errors.Is(err, ErrInvalidStatusTransition) {
+				t.Errorf("Expected ErrInvalidStatusTransition, got %v", err)
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStampProgressTimestamps(t *testing.T) {
+	record := newTestProgressRecord()
+
+	StampProgressTimestamps(record, StatusNotStarted, StatusInProgress)
+	startedAt := record.GetDateTime("started_at")
+	if startedAt.IsZero() {
+		t.Fatal("Expected started_at to be set when starting a course")
+	}
+	if !record.GetDateTime("completed_at").IsZero() {
+		t.Error("Expected completed_at to stay empty when starting a course")
+	}
+
+	StampProgressTimestamps(record, StatusInProgress, StatusCompleted)
+	if record.GetDateTime("completed_at").IsZero() {
+		t.Error("Expected completed_at to be set when completing a course")
+	}
+	if !record.GetDateTime("started_at").Equal(startedAt) {
+		t.Error("Expected started_at to be preserved when completing a course")
+	}
+
+	StampProgressTimestamps(record, StatusCompleted, StatusNotStarted)
+	if !record.GetDateTime("started_at").IsZero() || !record.GetDateTime("completed_at").IsZero() {
+		t.Error("Expected timestamps to be cleared on reset")
+	}
+}
+
+func TestCourseService_ResetProgressStatus(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	learner := createTestLearner(t, app)
+	course := createTestCourse(t, app, courses, EnrollmentOpen)
+
+	progressCollection, err := app.FindCollectionByNameOrId("progress")
+	if err != nil {
+		t.Fatalf("Failed to find progress collection: %v", err)
+	}
+
+	progressRecord := core.NewRecord(progressCollection)
+	progressRecord.Set("course", course.Id)
+	progressRecord.Set("assignee", learner.Id)
+	progressRecord.Set("status", StatusCompleted)
+
+	if err := app.Save(progressRecord); err != nil {
+		t.Fatalf("Failed to save test progress record: %v", err)
+	}
+
+	if err := service.ResetProgressStatus(progressRecord.Id, learner.Id); err != nil {
+		t.Fatalf("ResetProgressStatus failed: %v", err)
+	}
+
+	updatedRecord, err := app.FindRecordById("progress", progressRecord.Id)
+	if err != nil {
+		t.Fatalf("Failed to find reset progress record: %v", err)
+	}
+
+	if status := updatedRecord.GetString("status"); status != StatusNotStarted {
+		t.Errorf("Expected status %q, got %q", StatusNotStarted, status)
+	}
+	if !updatedRecord.GetDateTime("completed_at").IsZero() {
+		t.Error("Expected completed_at to be cleared on reset")
+	}
+
+	event, err := app.FindFirstRecordByFilter("progress_events", "progress = {:progress}", dbx.Params{"progress": progressRecord.Id})
+	if err != nil {
+		t.Fatalf("Expected a progress event for the reset: %v", err)
+	}
+	if event.GetString("from") != StatusCompleted || event.GetString("to") != StatusNotStarted || event.GetString("source") != ProgressSourceReset {
+		t.Errorf("Unexpected progress event %v", event.PublicExport())
+	}
+}
+
+func TestProgressUpdateRule(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	learner := createTestLearner(t, app)
+	learner.Set("organization", testOrg1)
+	if err := app.Save(learner); err != nil {
+		t.Fatalf("Failed to save learner: %v", err)
+	}
+	course := createTestCourse(t, app, courses, EnrollmentOpen)
+	course.Set("organization", testOrg1)
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+
+	progressCollection, err := app.FindCollectionByNameOrId("progress")
+	if err != nil {
+		t.Fatalf("Failed to find progress collection: %v", err)
+	}
+	progressRecord := core.NewRecord(progressCollection)
+	progressRecord.Set("course", course.Id)
+	progressRecord.Set("assignee", learner.Id)
+	progressRecord.Set("organization", testOrg1)
+	progressRecord.Set("status", StatusNotStarted)
+	if err := app.Save(progressRecord); err != nil {
+		t.Fatalf("Failed to save test progress record: %v", err)
+	}
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	token, err := learner.NewAuthToken()
+	if err != nil {
+		t.Fatalf("Failed to create auth token: %v", err)
+	}
+
+	patch := func(body map[string]any) int {
+		t.Helper()
+
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(http.MethodPatch, server.URL+"/api/collections/progress/records/"+progressRecord.Id, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", token)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("PATCH failed: %v", err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	// learners can't backdate or forge their completion history
+	for _, body := range []map[string]any{
+		{"started_at": "2020-01-01 00:00:00.000Z"},
+		{"status": StatusCompleted, "completed_at": "2020-01-02 00:00:00.000Z"},
+	} {
+		if status := patch(body); status != http.StatusNotFound {
+			t.Errorf("Expected %v to be rejected, got %d", body, status)
+		}
+	}
+
+	if status := patch(map[string]any{"status": StatusInProgress}); status != http.StatusOK {
+		t.Errorf("Expected the learner to update the status, got %d", status)
+	}
+}
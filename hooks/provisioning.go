@@ -0,0 +1,215 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+var ErrGroupMemberOrganization = errors.New("group members must belong to the group organization")
+
+// IsDeactivated reports whether a user was deactivated by an admin or the identity provider.
+func IsDeactivated(user *core.Record) bool {
+	return !user.GetDateTime("deactivated_at").IsZero()
+}
+
+// ProvisionUser creates a user managed by an identity provider and onboards it
+// like any other new user.
+func (cs *CourseService) ProvisionUser(user *core.Record) error {
+	return cs.app.RunInTransaction(func(txApp core.App) error {
+		txService := cs.withApp(txApp)
+
+		if err := txApp.Save(user); err != nil {
+			return err
+		}
+
+		err := txService.Audit(AuditUserProvisioned, user.Collection().Name, user.Id, map[string]any{
+			"external_id": user.GetString("external_id"),
+		})
+		if err != nil {
+			return err
+		}
+
+		return txService.OnboardUser(user)
+	})
+}
+
+// UpdateProvisionedUser saves the changes of the identity provider to a user,
+// auditing its deactivation and reactivation.
+func (cs *CourseService) UpdateProvisionedUser(user *core.Record) error {
+	wasDeactivated := IsDeactivated(user.Original())
+
+	return cs.app.RunInTransaction(func(txApp core.App) error {
+		if err := txApp.Save(user); err != nil {
+			return err
+		}
+
+		switch isDeactivated := IsDeactivated(user); {
+		case isDeactivated && !wasDeactivated:
+			return cs.withApp(txApp).Audit(AuditUserDeactivated, user.Collection().Name, user.Id, nil)
+		case !isDeactivated && wasDeactivated:
+			return cs.withApp(txApp).Audit(AuditUserReactivated, user.Collection().Name, user.Id, nil)
+		}
+		return nil
+	})
+}
+
+// DeprovisionUser removes a user from all of its courses, deleting its progress, and then deletes it.
+func (cs *CourseService) DeprovisionUser(user *core.Record) error {
+	return cs.app.RunInTransaction(func(txApp core.App) error {
+		txService := cs.withApp(txApp)
+
+		courses, err := txApp.FindRecordsByFilter("courses", "assignees.id ?= {:user}", "", 0, 0, dbx.Params{"user": user.Id})
+		if err != nil {
+			return fmt.Errorf("failed to find the user courses: %w", err)
+		}
+
+		for _, course := range courses {
+			assignees := course.GetStringSlice("assignees")
+			remaining := slices.DeleteFunc(slices.Clone(assignees), func(id string) bool { return id == user.Id })
+			course.Set("assignees", remaining)
+			if err := txApp.Save(course); err != nil {
+				return fmt.Errorf("failed to save course after removing assignee: %w", err)
+			}
+
+			if err := txService.HandleCourseAssigneeChange(course, assignees, remaining); err != nil {
+				return err
+			}
+		}
+
+		if err := txApp.Delete(user); err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+
+		return txService.Audit(AuditUserDeprovisioned, user.Collection().Name, user.Id, map[string]any{
+			"external_id": user.GetString("external_id"),
+		})
+	})
+}
+
+// SetGroupMembers replaces the members of a group and enrolls them into the group courses.
+func (cs *CourseService) SetGroupMembers(group *core.Record, memberIDs []string) error {
+	originalMembers := group.GetStringSlice("members")
+
+	return cs.app.RunInTransaction(func(txApp core.App) error {
+		txService := cs.withApp(txApp)
+
+		if err := checkGroupMembers(txApp, group.GetString("organization"), memberIDs); err != nil {
+			return err
+		}
+
+		group.Set("members", memberIDs)
+		if err := txApp.Save(group); err != nil {
+			return err
+		}
+
+		added := make([]string, 0)
+		removed := make([]string, 0)
+		for _, member := range memberIDs {
+			if !slices.Contains(originalMembers, member) {
+				added = append(added, member)
+			}
+		}
+		for _, member := range originalMembers {
+			if !slices.Contains(memberIDs, member) {
+				removed = append(removed, member)
+			}
+		}
+
+		if len(added) > 0 || len(removed) > 0 {
+			err := txService.Audit(AuditGroupMembersChanged, group.Collection().Name, group.Id, map[string]any{
+				"added":   added,
+				"removed": removed,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return txService.AssignGroupCourses(group)
+	})
+}
+
+// AssignGroupCourses enrolls every member of a group into every course of the group.
+// Members leaving a group keep their assignments and progress.
+func (cs *CourseService) AssignGroupCourses(group *core.Record) error {
+	for _, courseID := range group.GetStringSlice("courses") {
+		for _, memberID := range group.GetStringSlice("members") {
+			err := cs.EnrollUser(courseID, memberID)
+			if err != nil && !errors.Is(err, ErrAlreadyEnrolled) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkGroupMembers makes sure every member belongs to the organization of the group.
+func checkGroupMembers(app core.App, organizationID string, memberIDs []string) error {
+	members, err := app.FindRecordsByIds("users", memberIDs)
+	if err != nil {
+		return fmt.Errorf("failed to find group members: %w", err)
+	}
+
+	if len(members) != len(memberIDs) {
+		return ErrGroupMemberOrganization
+	}
+	for _, member := range members {
+		if member.GetString("organization") != organizationID {
+			return ErrGroupMemberOrganization
+		}
+	}
+	return nil
+}
+
+// initProvisioningHooks keeps deactivated users out and applies the group
+// course assignments of the groups managed through the API.
+func initProvisioningHooks(app core.App) {
+	courseService := NewCourseService(app)
+
+	// sign out deactivated users everywhere
+	app.OnRecordUpdate("users").BindFunc(func(e *core.RecordEvent) error {
+		if IsDeactivated(e.Record) && !IsDeactivated(e.Record.Original()) {
+			e.Record.RefreshTokenKey()
+		}
+		return e.Next()
+	})
+
+	app.OnRecordAuthRequest("users").BindFunc(func(e *core.RecordAuthRequestEvent) error {
+		if IsDeactivated(e.Record) {
+			return e.ForbiddenError("The account is deactivated.", nil)
+		}
+		return e.Next()
+	})
+
+	app.OnRecordCreateRequest("groups").BindFunc(func(e *core.RecordRequestEvent) error {
+		return groupRequest(e, courseService)
+	})
+
+	app.OnRecordUpdateRequest("groups").BindFunc(func(e *core.RecordRequestEvent) error {
+		return groupRequest(e, courseService)
+	})
+}
+
+func groupRequest(e *core.RecordRequestEvent, courseService *CourseService) error {
+	err := checkGroupMembers(e.App, e.Record.GetString("organization"), e.Record.GetStringSlice("members"))
+	if errors.Is(err, ErrGroupMemberOrganization) {
+		return e.BadRequestError(err.Error(), nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	return e.App.RunInTransaction(func(txApp core.App) error {
+		e.App = txApp
+
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		return courseService.WithActor(requestActor(e.RequestEvent)).withApp(txApp).AssignGroupCourses(e.Record)
+	})
+}
@@ -0,0 +1,158 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+// progressResetCollections lists the per-lesson learner state that is wiped
+// together with the course status (lesson completion, video positions, SCORM
+// data and cmi5 registrations, the next launch starting a new registration).
+// Collections are matched by their "course" and "assignee" relation fields.
+// eLesson has no quizzes yet, so there are no quiz attempts to reset.
+var progressResetCollections = []string{"lesson_progress", "scorm_data", "cmi5_registrations"}
+
+// ResetProgress resets the course progress of the given assignees (or of every
+// course assignee when none are given) back to "Not Started" and clears their
+// per-lesson state. Everything happens in a single transaction.
+func (cs *CourseService) ResetProgress(courseID string, assigneeIDs []string, actorID string) error {
+	return cs.app.RunInTransaction(func(txApp core.App) error {
+		txService := cs.WithActor(actorID).withApp(txApp)
+
+		courseRecord, err := txApp.FindRecordById("courses", courseID)
+		if err != nil {
+			return fmt.Errorf("failed to find course: %w", err)
+		}
+
+		if len(assigneeIDs) == 0 {
+			assigneeIDs = courseRecord.GetStringSlice("assignees")
+		}
+
+		for _, assigneeID := range assigneeIDs {
+			if err := txService.resetAssigneeProgress(courseRecord.Id, assigneeID, actorID); err != nil {
+				return err
+			}
+		}
+
+		return txService.Audit(AuditProgressReset, courseRecord.Collection().Name, courseRecord.Id, map[string]any{
+			"assignees": assigneeIDs,
+		})
+	})
+}
+
+func (cs *CourseService) resetAssigneeProgress(courseID, assigneeID, actorID string) error {
+	progressRecords, err := cs.app.FindAllRecords("progress",
+		dbx.HashExp{
+			"assignee": assigneeID,
+			"course":   courseID,
+		})
+	if err != nil {
+		return fmt.Errorf("failed to find progress records: %w", err)
+	}
+
+	for _, progressRecord := range progressRecords {
+		if err := cs.ResetProgressStatus(progressRecord.Id, actorID); err != nil {
+			return err
+		}
+	}
+
+	for _, collectionName := range progressResetCollections {
+		collection, err := cs.app.FindCollectionByNameOrId(collectionName)
+		if err != nil {
+			// the learner state collection is not installed
+			continue
+		}
+
+		records, err := cs.app.FindAllRecords(collection.Name,
+			dbx.HashExp{
+				"assignee": assigneeID,
+				"course":   courseID,
+			})
+		if err != nil {
+			return fmt.Errorf("failed to find %s records: %w", collection.Name, err)
+		}
+
+		for _, record := range records {
+			if err := cs.app.Delete(record); err != nil {
+				return fmt.Errorf("failed to delete %s record: %w", collection.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func bindResetRoutes(r *router.Router[*core.RequestEvent], courseService *CourseService) {
+	// reset the course progress of the current learner (the only way out of "Completed")
+	r.POST("/api/progress/{id}/reset", func(e *core.RequestEvent) error {
+		progressRecord, err := e.App.FindRecordById("progress", e.Request.PathValue("id"))
+		if err != nil {
+			return e.NotFoundError("", err)
+		}
+
+		if progressRecord.GetString("assignee") != e.Auth.Id {
+			courseRecord, err := e.App.FindRecordById("courses", progressRecord.GetString("course"))
+			if err != nil || !CanManageCourse(e.Auth, courseRecord) {
+				return e.NotFoundError("", err)
+			}
+		}
+
+		err = courseService.ResetProgress(
+			progressRecord.GetString("course"),
+			[]string{progressRecord.GetString("assignee")},
+			e.Auth.Id,
+		)
+		if err != nil {
+			return resetProgressError(e, err)
+		}
+
+		progressRecord, err = e.App.FindRecordById("progress", progressRecord.Id)
+		if err != nil {
+			return e.InternalServerError("", err)
+		}
+
+		if err := apis.EnrichRecord(e, progressRecord); err != nil {
+			return e.InternalServerError("", err)
+		}
+
+		return e.JSON(http.StatusOK, progressRecord)
+	}).Bind(apis.RequireAuth())
+
+	// reset the course progress of the given learners or of all course assignees
+	r.POST("/api/courses/{id}/reset-progress", func(e *core.RequestEvent) error {
+		data := struct {
+			Assignees []string `json:"assignees" form:"assignees"`
+		}{}
+		if err := e.BindBody(&data); err != nil {
+			return e.BadRequestError("Failed to read request data.", err)
+		}
+
+		courseRecord, err := e.App.FindRecordById("courses", e.Request.PathValue("id"))
+		if err != nil {
+			return e.NotFoundError("", err)
+		}
+
+		if !CanManageCourse(e.Auth, courseRecord) {
+			return e.ForbiddenError("Only the course instructor can reset its progress.", nil)
+		}
+
+		if err := courseService.ResetProgress(courseRecord.Id, data.Assignees, e.Auth.Id); err != nil {
+			return resetProgressError(e, err)
+		}
+
+		return e.NoContent(http.StatusNoContent)
+	}).Bind(RequireRole(RoleInstructor, RoleOrgAdmin))
+}
+
+func resetProgressError(e *core.RequestEvent, err error) error {
+	if errors.Is(err, ErrInvalidStatusTransition) {
+		return e.BadRequestError("Invalid progress status change.", statusTransitionError(err))
+	}
+	return e.InternalServerError("Failed to reset progress.", err)
+}
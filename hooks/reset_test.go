@@ -0,0 +1,204 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+// createTestResetCourse saves a course of testOrg1 assigned to the given
+// learners, who completed it and its first lesson.
+func createTestResetCourse(t *testing.T, app *tests.TestApp, courses *core.Collection, assignees ...*core.Record) (*core.Record, []*core.Record) {
+	t.Helper()
+
+	course, lessons := createTestAuthoredCourse(t, app, courses)
+
+	progressCollection, err := app.FindCollectionByNameOrId("progress")
+	if err != nil {
+		t.Fatalf("Failed to find progress collection: %v", err)
+	}
+	lessonProgressCollection, err := app.FindCollectionByNameOrId("lesson_progress")
+	if err != nil {
+		t.Fatalf("Failed to find lesson_progress collection: %v", err)
+	}
+
+	var progressRecords []*core.Record
+	for _, assignee := range assignees {
+		course.Set("assignees+", assignee.Id)
+		if err := app.Save(course); err != nil {
+			t.Fatalf("Failed to assign course: %v", err)
+		}
+
+		progressRecord := core.NewRecord(progressCollection)
+		progressRecord.Set("course", course.Id)
+		progressRecord.Set("assignee", assignee.Id)
+		progressRecord.Set("status", StatusCompleted)
+		if err := app.Save(progressRecord); err != nil {
+			t.Fatalf("Failed to save progress record: %v", err)
+		}
+		progressRecords = append(progressRecords, progressRecord)
+
+		lessonProgress := core.NewRecord(lessonProgressCollection)
+		lessonProgress.Set("lesson", lessons[0].Id)
+		lessonProgress.Set("course", course.Id)
+		lessonProgress.Set("assignee", assignee.Id)
+		lessonProgress.Set("completed", true)
+		lessonProgress.Set("video_position", 42)
+		if err := app.Save(lessonProgress); err != nil {
+			t.Fatalf("Failed to save lesson progress: %v", err)
+		}
+	}
+
+	return course, progressRecords
+}
+
+func TestCourseService_ResetProgress(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, users := createTestCollections(t, app)
+	learner1 := createTestUser(t, app, users, "learner1@example.com", "")
+	learner2 := createTestUser(t, app, users, "learner2@example.com", "")
+	course, _ := createTestResetCourse(t, app, courses, learner1, learner2)
+
+	// an empty assignees list resets every course assignee
+	if err := service.ResetProgress(course.Id, nil, learner1.Id); err != nil {
+		t.Fatalf("ResetProgress failed: %v", err)
+	}
+
+	records, err := app.FindAllRecords("progress", dbx.HashExp{"course": course.Id})
+	if err != nil || len(records) != 2 {
+		t.Fatalf("Expected 2 progress records, got %d %v", len(records), err)
+	}
+	for _, record := range records {
+		if record.GetString("status") != StatusNotStarted || !record.GetDateTime("completed_at").IsZero() {
+			t.Errorf("Expected progress of %s to be reset, got %q", record.GetString("assignee"), record.GetString("status"))
+		}
+	}
+
+	if count, _ := app.CountRecords("lesson_progress", dbx.HashExp{"course": course.Id}); count != 0 {
+		t.Errorf("Expected the lesson progress to be cleared, got %d records", count)
+	}
+	if count, _ := app.CountRecords("progress_events", dbx.HashExp{"course": course.Id, "source": ProgressSourceReset}); count != 2 {
+		t.Errorf("Expected a reset event per assignee, got %d", count)
+	}
+	if count, _ := app.CountRecords("audit_log", dbx.HashExp{"action": AuditProgressReset, "target_id": course.Id}); count != 1 {
+		t.Errorf("Expected the reset to be audited, got %d", count)
+	}
+}
+
+func TestResetRoutes(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, users := createTestCollections(t, app)
+
+	newUser := func(email, role, organization string) *core.Record {
+		user := core.NewRecord(users)
+		user.SetEmail(email)
+		user.SetPassword("1234567890")
+		user.Set("role", role)
+		user.Set("organization", organization)
+		if err := app.Save(user); err != nil {
+			t.Fatalf("Failed to save user: %v", err)
+		}
+		return user
+	}
+	admin := newUser("admin@example.com", RoleOrgAdmin, testOrg1)
+	otherAdmin := newUser("admin2@example.com", RoleOrgAdmin, testOrg2)
+	learner1 := newUser("learner1@example.com", "", testOrg1)
+	learner2 := newUser("learner2@example.com", "", testOrg1)
+	learner3 := newUser("learner3@example.com", "", testOrg1)
+	course, progressRecords := createTestResetCourse(t, app, courses, learner1, learner2, learner3)
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	bindResetRoutes(r, service)
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	send := func(user *core.Record, path, body string) (int, map[string]any) {
+		t.Helper()
+
+		req, _ := http.NewRequest(http.MethodPost, server.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		token, err := user.NewAuthToken()
+		if err != nil {
+			t.Fatalf("Failed to create auth token: %v", err)
+		}
+		req.Header.Set("Authorization", token)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Reset request failed: %v", err)
+		}
+		defer res.Body.Close()
+
+		content, _ := io.ReadAll(res.Body)
+		data := map[string]any{}
+		json.Unmarshal(content, &data)
+		return res.StatusCode, data
+	}
+	statusOf := func(progressRecord *core.Record) string {
+		t.Helper()
+
+		record, err := app.FindRecordById("progress", progressRecord.Id)
+		if err != nil {
+			t.Fatalf("Failed to reload progress record: %v", err)
+		}
+		return record.GetString("status")
+	}
+
+	// learners reset their own progress only
+	if status, _ := send(learner2, "/api/progress/"+progressRecords[0].Id+"/reset", ""); status != http.StatusNotFound {
+		t.Errorf("Expected learners not to reset the progress of others, got %d", status)
+	}
+	status, data := send(learner1, "/api/progress/"+progressRecords[0].Id+"/reset", "")
+	if status != http.StatusOK || data["status"] != StatusNotStarted {
+		t.Errorf("Expected the learner to reset their progress, got %d %v", status, data)
+	}
+	if count, _ := app.CountRecords("lesson_progress", dbx.HashExp{"assignee": learner1.Id}); count != 0 {
+		t.Errorf("Expected the learner's lesson progress to be cleared, got %d records", count)
+	}
+	if statusOf(progressRecords[1]) != StatusCompleted {
+		t.Error("Expected the progress of other learners to be kept")
+	}
+
+	// admins of the course organization reset the given learners or every assignee
+	coursePath := "/api/courses/" + course.Id + "/reset-progress"
+	if status, _ := send(learner1, coursePath, "{}"); status != http.StatusForbidden {
+		t.Errorf("Expected learners not to reset the course progress, got %d", status)
+	}
+	if status, _ := send(otherAdmin, coursePath, "{}"); status != http.StatusForbidden {
+		t.Errorf("Expected the admins of other organizations not to reset the course progress, got %d", status)
+	}
+	if status, _ := send(admin, coursePath, `{"assignees": ["`+learner2.Id+`"]}`); status != http.StatusNoContent {
+		t.Errorf("Expected the admin to reset a learner's progress, got %d", status)
+	}
+	if statusOf(progressRecords[1]) != StatusNotStarted || statusOf(progressRecords[2]) != StatusCompleted {
+		t.Error("Expected only the given learner's progress to be reset")
+	}
+	if status, _ := send(admin, coursePath, "{}"); status != http.StatusNoContent {
+		t.Errorf("Expected the admin to reset every assignee, got %d", status)
+	}
+	if statusOf(progressRecords[2]) != StatusNotStarted {
+		t.Error("Expected every assignee's progress to be reset")
+	}
+	if count, _ := app.CountRecords("lesson_progress", dbx.HashExp{"course": course.Id}); count != 0 {
+		t.Errorf("Expected the lesson progress of the course to be cleared, got %d records", count)
+	}
+}
@@ -0,0 +1,390 @@
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+// lessonRevisionFileFields are the file fields of the lessons kept in their
+// revisions. SCORM and cmi5 packages hold the runtime data of the learners and
+// aren't rolled back.
+var lessonRevisionFileFields = []string{"video", "thumbnail", "captions", "downloads"}
+
+// raw record keys passing the author and the restored revision of a lesson
+// save to its revision (PocketBase neither stores nor exports "@" keys)
+const (
+	revisionAuthorKey   = "@revisionAuthor"
+	revisionRestoredKey = "@revisionRestored"
+)
+
+// LessonRevisionDiff is the difference between two revisions of a lesson,
+// rendered as HTML with ins and del elements.
+type LessonRevisionDiff struct {
+	From    int    `json:"from"`
+	To      int    `json:"to"`
+	Content string `json:"content"`
+	Summary string `json:"summary"`
+	// the changed file fields
+	Files map[string]LessonFilesDiff `json:"files"`
+}
+
+type LessonFilesDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// lessonRevisionFiles returns the stored files of a lesson by field.
+func lessonRevisionFiles(lesson *core.Record) map[string][]string {
+	files := map[string][]string{}
+	for _, field := range lessonRevisionFileFields {
+		if lesson.Collection().Fields.GetByName(field) != nil {
+			files[field] = lesson.GetStringSlice(field)
+		}
+	}
+	return files
+}
+
+// revisionFiles returns the files of a lesson revision by field.
+func revisionFiles(revision *core.Record) map[string][]string {
+	files := map[string][]string{}
+	json.Unmarshal([]byte(revision.GetString("files")), &files)
+	return files
+}
+
+func findLessonRevisions(app core.App, lessonID string) ([]*core.Record, error) {
+	return app.FindRecordsByFilter("lesson_revisions", "lesson = {:lesson}", "-number", 0, 0, dbx.Params{"lesson": lessonID})
+}
+
+// RecordLessonRevision adds a revision with the content, summary and files of
+// a lesson, unless they're unchanged since its latest revision. The files new
+// to the lesson history are copied to the revision, which keeps them once the
+// lesson drops them.
+func (cs *CourseService) RecordLessonRevision(lesson *core.Record) (*core.Record, error) {
+	revisions, err := findLessonRevisions(cs.app, lesson.Id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find lesson revisions: %w", err)
+	}
+
+	files := lessonRevisionFiles(lesson)
+	if len(revisions) > 0 {
+		latest := revisions[0]
+		if latest.GetString("content") == lesson.GetString("content") &&
+			latest.GetString("summary") == lesson.GetString("summary") &&
+			maps.EqualFunc(revisionFiles(latest), files, slices.Equal) {
+			return nil, nil
+		}
+	}
+
+	stored := map[string]bool{}
+	for _, revision := range revisions {
+		for _, name := range revision.GetStringSlice("stored") {
+			stored[name] = true
+		}
+	}
+
+	fsys, err := cs.app.NewFilesystem()
+	if err != nil {
+		return nil, err
+	}
+	defer fsys.Close()
+
+	newFiles := []*filesystem.File{}
+	for _, field := range lessonRevisionFileFields {
+		for _, name := range files[field] {
+			if stored[name] {
+				continue
+			}
+			file, err := fsys.GetReuploadableFile(lesson.BaseFilesPath()+"/"+name, true)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", name, err)
+			}
+			newFiles = append(newFiles, file)
+			stored[name] = true
+		}
+	}
+
+	collection, err := cs.app.FindCollectionByNameOrId("lesson_revisions")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find lesson_revisions collection: %w", err)
+	}
+
+	revision := core.NewRecord(collection)
+	revision.Set("lesson", lesson.Id)
+	revision.Set("number", len(revisions)+1)
+	if len(revisions) > 0 {
+		revision.Set("number", revisions[0].GetInt("number")+1)
+	}
+	revision.Set("content", lesson.GetString("content"))
+	revision.Set("summary", lesson.GetString("summary"))
+	revision.Set("files", files)
+	revision.Set("stored", newFiles)
+	revision.Set("author", lesson.GetString(revisionAuthorKey))
+	revision.Set("restored", lesson.GetInt(revisionRestoredKey))
+
+	if err := cs.app.Save(revision); err != nil {
+		return nil, fmt.Errorf("failed to save lesson revision: %w", err)
+	}
+	return revision, nil
+}
+
+// RollbackLesson restores the content, summary and files of a lesson revision,
+// which is recorded as a new revision authored by the service actor, a user.
+func (cs *CourseService) RollbackLesson(lessonID, revisionID string) (*core.Record, error) {
+	fsys, err := cs.app.NewFilesystem()
+	if err != nil {
+		return nil, err
+	}
+	defer fsys.Close()
+
+	var lesson *core.Record
+	err = cs.app.RunInTransaction(func(txApp core.App) error {
+		lesson, err = txApp.FindRecordById("lessons", lessonID)
+		if err != nil {
+			return fmt.Errorf("failed to find lesson: %w", err)
+		}
+
+		revisions, err := findLessonRevisions(txApp, lesson.Id)
+		if err != nil {
+			return fmt.Errorf("failed to find lesson revisions: %w", err)
+		}
+		index := slices.IndexFunc(revisions, func(revision *core.Record) bool { return revision.Id == revisionID })
+		if index < 0 {
+			return fmt.Errorf("lesson %s has no revision %s", lesson.Id, revisionID)
+		}
+		revision := revisions[index]
+
+		lesson.Set("content", revision.GetString("content"))
+		lesson.Set("summary", revision.GetString("summary"))
+
+		// the files dropped by the lesson since are copied back from the revision storing them
+		for field, names := range revisionFiles(revision) {
+			if lesson.Collection().Fields.GetByName(field) == nil {
+				continue
+			}
+
+			current := lesson.GetStringSlice(field)
+			values := []any{}
+			for _, name := range names {
+				if slices.Contains(current, name) {
+					values = append(values, name)
+					continue
+				}
+
+				storing := slices.IndexFunc(revisions, func(revision *core.Record) bool {
+					return slices.Contains(revision.GetStringSlice("stored"), name)
+				})
+				if storing < 0 {
+					return fmt.Errorf("the file %s of revision %d is missing", name, revision.GetInt("number"))
+				}
+				file, err := fsys.GetReuploadableFile(revisions[storing].BaseFilesPath()+"/"+name, true)
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %w", name, err)
+				}
+				values = append(values, file)
+			}
+			lesson.Set(field, values)
+		}
+
+		lesson.SetRaw(revisionAuthorKey, cs.actor)
+		lesson.SetRaw(revisionRestoredKey, revision.GetInt("number"))
+		if err := txApp.Save(lesson); err != nil {
+			return fmt.Errorf("failed to save lesson: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return lesson, nil
+}
+
+// DiffLessonRevisions compares two revisions of a lesson.
+func DiffLessonRevisions(from, to *core.Record) *LessonRevisionDiff {
+	diff := &LessonRevisionDiff{
+		From:    from.GetInt("number"),
+		To:      to.GetInt("number"),
+		Content: htmlDiff(from.GetString("content"), to.GetString("content")),
+		Summary: textDiff(from.GetString("summary"), to.GetString("summary")),
+		Files:   map[string]LessonFilesDiff{},
+	}
+
+	fromFiles, toFiles := revisionFiles(from), revisionFiles(to)
+	for _, field := range lessonRevisionFileFields {
+		changes := LessonFilesDiff{Added: []string{}, Removed: []string{}}
+		for _, name := range toFiles[field] {
+			if !slices.Contains(fromFiles[field], name) {
+				changes.Added = append(changes.Added, name)
+			}
+		}
+		for _, name := range fromFiles[field] {
+			if !slices.Contains(toFiles[field], name) {
+				changes.Removed = append(changes.Removed, name)
+			}
+		}
+		if len(changes.Added) > 0 || len(changes.Removed) > 0 {
+			diff.Files[field] = changes
+		}
+	}
+
+	return diff
+}
+
+// revisionAuthor returns the user of a request changing a lesson, if any
+// (superusers aren't users).
+func revisionAuthor(e *core.RequestEvent) string {
+	if e.Auth == nil || e.Auth.Collection().Name != "users" {
+		return ""
+	}
+	return e.Auth.Id
+}
+
+func initLessonRevisionHooks(app core.App) {
+	courseService := NewCourseService(app)
+
+	app.OnRecordCreateRequest("lessons").BindFunc(func(e *core.RecordRequestEvent) error {
+		e.Record.SetRaw(revisionAuthorKey, revisionAuthor(e.RequestEvent))
+		return e.Next()
+	})
+
+	app.OnRecordUpdateRequest("lessons").BindFunc(func(e *core.RecordRequestEvent) error {
+		e.Record.SetRaw(revisionAuthorKey, revisionAuthor(e.RequestEvent))
+		return e.Next()
+	})
+
+	app.OnRecordCreate("lessons").BindFunc(func(e *core.RecordEvent) error {
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		_, err := courseService.withApp(e.App).RecordLessonRevision(e.Record)
+		return err
+	})
+
+	app.OnRecordUpdate("lessons").BindFunc(func(e *core.RecordEvent) error {
+		service := courseService.withApp(e.App)
+
+		// lessons created before their history was kept start it with their
+		// current state, whose files the update may drop
+		revisions, err := findLessonRevisions(e.App, e.Record.Id)
+		if err != nil {
+			return fmt.Errorf("failed to find lesson revisions: %w", err)
+		}
+		if len(revisions) == 0 {
+			if _, err := service.RecordLessonRevision(e.Record.Original()); err != nil {
+				return err
+			}
+		}
+
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		_, err = service.RecordLessonRevision(e.Record)
+		return err
+	})
+}
+
+// managedLesson finds the lesson of the request, whose course must be managed by the user.
+func managedLesson(e *core.RequestEvent) (*core.Record, error) {
+	lesson, err := e.App.FindRecordById("lessons", e.Request.PathValue("id"))
+	if err != nil {
+		return nil, e.NotFoundError("", err)
+	}
+
+	course, err := e.App.FindRecordById("courses", lesson.GetString("course"))
+	if err != nil {
+		return nil, e.NotFoundError("", err)
+	}
+
+	if !CanManageCourse(e.Auth, course) {
+		return nil, e.ForbiddenError("Only the course instructor can manage the lesson.", nil)
+	}
+
+	return lesson, nil
+}
+
+func bindRevisionRoutes(r *router.Router[*core.RequestEvent], courseService *CourseService) {
+	// list the revisions of a lesson, latest first
+	r.GET("/api/lessons/{id}/revisions", func(e *core.RequestEvent) error {
+		lesson, err := managedLesson(e)
+		if err != nil {
+			return err
+		}
+
+		revisions, err := findLessonRevisions(e.App, lesson.Id)
+		if err != nil {
+			return e.InternalServerError("", err)
+		}
+
+		if err := apis.EnrichRecords(e, revisions); err != nil {
+			return e.InternalServerError("", err)
+		}
+		return e.JSON(http.StatusOK, revisions)
+	}).Bind(RequireRole(RoleInstructor, RoleOrgAdmin))
+
+	// compare two revisions of a lesson, the latest one by default
+	r.GET("/api/lessons/{id}/revisions/diff", func(e *core.RequestEvent) error {
+		lesson, err := managedLesson(e)
+		if err != nil {
+			return err
+		}
+
+		revisions, err := findLessonRevisions(e.App, lesson.Id)
+		if err != nil {
+			return e.InternalServerError("", err)
+		}
+		find := func(id string) *core.Record {
+			index := slices.IndexFunc(revisions, func(revision *core.Record) bool { return revision.Id == id })
+			if index < 0 {
+				return nil
+			}
+			return revisions[index]
+		}
+
+		from := find(e.Request.URL.Query().Get("from"))
+		if from == nil {
+			return e.BadRequestError("Unknown from revision.", nil)
+		}
+		to := revisions[0]
+		if id := e.Request.URL.Query().Get("to"); id != "" {
+			if to = find(id); to == nil {
+				return e.BadRequestError("Unknown to revision.", nil)
+			}
+		}
+
+		return e.JSON(http.StatusOK, DiffLessonRevisions(from, to))
+	}).Bind(RequireRole(RoleInstructor, RoleOrgAdmin))
+
+	// restore a revision of a lesson
+	r.POST("/api/lessons/{id}/revisions/{revision}/rollback", func(e *core.RequestEvent) error {
+		lesson, err := managedLesson(e)
+		if err != nil {
+			return err
+		}
+
+		revision, err := e.App.FindRecordById("lesson_revisions", e.Request.PathValue("revision"))
+		if err != nil || revision.GetString("lesson") != lesson.Id {
+			return e.NotFoundError("", err)
+		}
+
+		lesson, err = courseService.WithActor(revisionAuthor(e)).RollbackLesson(lesson.Id, revision.Id)
+		if err != nil {
+			return e.InternalServerError("Failed to roll back the lesson.", err)
+		}
+
+		if err := apis.EnrichRecord(e, lesson); err != nil {
+			return e.InternalServerError("", err)
+		}
+		return e.JSON(http.StatusOK, lesson)
+	}).Bind(RequireRole(RoleInstructor, RoleOrgAdmin))
+}
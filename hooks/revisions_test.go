@@ -0,0 +1,265 @@
+package hooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestHTMLDiff(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		from     string
+		to       string
+		expected string
+	}{
+		{"unchanged", "<p>Same</p>", "<p>Same</p>", "<p>Same</p>"},
+		{
+			"changed words",
+			"<p>The quick brown fox</p>",
+			"<p>The slow brown fox jumps</p>",
+			"<p>The <del>quick</del><ins>slow</ins> brown fox<ins> jumps</ins></p>",
+		},
+		{
+			"new markup",
+			"<p>Look behind you.</p>",
+			"<p>Look <strong>behind</strong> you.</p>",
+			"<p>Look <strong>behind</strong> you.</p>",
+		},
+		{
+			"removed block",
+			`<p>Intro</p><img src="a.png"><h2>Old</h2>`,
+			"<p>Intro</p>",
+			`<p>Intro</p><del><img src="a.png"></del><del>Old</del>`,
+		},
+	}
+
+	for _, s := range scenarios {
+		if diff := htmlDiff(s.from, s.to); diff != s.expected {
+			t.Errorf("%s: expected %q, got %q", s.name, s.expected, diff)
+		}
+	}
+
+	if diff := textDiff("Brakes & horn", "Brakes & lights"); diff != "Brakes &amp; <del>horn</del><ins>lights</ins>" {
+		t.Errorf("Expected the summary diff to be escaped, got %q", diff)
+	}
+
+	from := strings.Repeat("a ", maxDiffEdits)
+	to := strings.Repeat("b ", maxDiffEdits)
+	if diff := textDiff(from, to); !strings.HasPrefix(diff, "<del>a") || !strings.HasSuffix(diff, "b</ins> ") {
+		t.Errorf("Expected a large diff to replace the whole text, got %q...", diff[:20])
+	}
+}
+
+func TestCourseService_LessonRevisions(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, users := createTestCollections(t, app)
+	initLessonRevisionHooks(app)
+	author := createTestUser(t, app, users, "author@example.com", "")
+	reviewer := createTestUser(t, app, users, "reviewer@example.com", "")
+	_, lessons := createTestAuthoredCourse(t, app, courses)
+	basics := lessons[0]
+	downloads := basics.GetStringSlice("downloads")
+
+	revisions, err := findLessonRevisions(app, basics.Id)
+	if err != nil || len(revisions) != 2 {
+		t.Fatalf("Expected a revision for the lesson creation and its content, got %d %v", len(revisions), err)
+	}
+	if revisions[1].GetInt("number") != 1 || len(revisions[1].GetStringSlice("stored")) != 5 || revisions[0].GetInt("number") != 2 ||
+		len(revisions[0].GetStringSlice("stored")) != 0 {
+		t.Errorf("Expected the first revision to store the lesson files once, got %v and %v",
+			revisions[1].GetStringSlice("stored"), revisions[0].GetStringSlice("stored"))
+	}
+
+	// saves leaving the content, summary and files unchanged aren't revisions
+	basics.Set("title", "Forklift basics")
+	if err := app.Save(basics); err != nil {
+		t.Fatalf("Failed to save lesson: %v", err)
+	}
+	if revisions, _ := findLessonRevisions(app, basics.Id); len(revisions) != 2 {
+		t.Errorf("Expected no revision for a title change, got %d", len(revisions))
+	}
+
+	checklist := downloads[1]
+	basics.Set("downloads-", checklist)
+	basics.Set("content", "<p>Read the rules twice.</p>")
+	basics.SetRaw(revisionAuthorKey, author.Id)
+	if err := app.Save(basics); err != nil {
+		t.Fatalf("Failed to save lesson: %v", err)
+	}
+
+	revisions, _ = findLessonRevisions(app, basics.Id)
+	if len(revisions) != 3 || revisions[0].GetString("author") != author.Id {
+		t.Fatalf("Expected a third revision by the author, got %d", len(revisions))
+	}
+	diff := DiffLessonRevisions(revisions[1], revisions[0])
+	if diff.From != 2 || diff.To != 3 || !strings.Contains(diff.Content, "rules<ins> twice</ins>.") || diff.Summary != "What every driver must know" {
+		t.Errorf("Unexpected diff %+v", diff)
+	}
+	if changes, ok := diff.Files["downloads"]; !ok || len(diff.Files) != 1 || len(changes.Added) != 0 ||
+		strings.Join(changes.Removed, ",") != checklist {
+		t.Errorf("Expected the checklist to be removed, got %+v", diff.Files)
+	}
+
+	restored, err := service.WithActor(reviewer.Id).RollbackLesson(basics.Id, revisions[1].Id)
+	if err != nil {
+		t.Fatalf("RollbackLesson failed: %v", err)
+	}
+	if restored.GetString("content") != revisions[1].GetString("content") ||
+		strings.Join(restored.GetStringSlice("downloads"), ",") != strings.Join(downloads, ",") {
+		t.Errorf("Expected the revision to be restored, got %v", restored.FieldsData())
+	}
+
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		t.Fatalf("Failed to open the filesystem: %v", err)
+	}
+	defer fsys.Close()
+	reader, err := fsys.GetReader(restored.BaseFilesPath() + "/" + checklist)
+	if err != nil {
+		t.Fatalf("Expected the checklist to be restored: %v", err)
+	}
+	content, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(content) != "Check the brakes & the horn." {
+		t.Errorf("Unexpected checklist content %q", content)
+	}
+
+	revisions, _ = findLessonRevisions(app, basics.Id)
+	if len(revisions) != 4 || revisions[0].GetInt("restored") != 2 || revisions[0].GetString("author") != reviewer.Id {
+		t.Errorf("Expected the rollback to be recorded as revision 4, got %d", len(revisions))
+	}
+}
+
+func TestRevisionRoutes(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, users := createTestCollections(t, app)
+	initLessonRevisionHooks(app)
+	course, lessons := createTestAuthoredCourse(t, app, courses)
+	advanced := lessons[1]
+
+	newUser := func(email, role, organization string) *core.Record {
+		user := core.NewRecord(users)
+		user.SetEmail(email)
+		user.SetPassword("1234567890")
+		user.Set("role", role)
+		user.Set("organization", organization)
+		if err := app.Save(user); err != nil {
+			t.Fatalf("Failed to save user: %v", err)
+		}
+		return user
+	}
+	instructor := newUser("instructor@example.com", RoleInstructor, testOrg1)
+	otherInstructor := newUser("instructor2@example.com", RoleInstructor, testOrg1)
+	learner := newUser("learner@example.com", "", testOrg1)
+	course.Set("owner", instructor.Id)
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+
+	advanced.Set("content", "<h2>Reversing</h2><p>Look behind you, then reverse.</p>")
+	if err := app.Save(advanced); err != nil {
+		t.Fatalf("Failed to save lesson: %v", err)
+	}
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	bindRevisionRoutes(r, service)
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	send := func(user *core.Record, method, path string, result any) int {
+		t.Helper()
+
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		token, err := user.NewAuthToken()
+		if err != nil {
+			t.Fatalf("Failed to create auth token: %v", err)
+		}
+		req.Header.Set("Authorization", token)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer res.Body.Close()
+
+		if result != nil {
+			json.NewDecoder(res.Body).Decode(result)
+		}
+		return res.StatusCode
+	}
+
+	path := "/api/lessons/" + advanced.Id + "/revisions"
+	if status := send(learner, http.MethodGet, path, nil); status != http.StatusForbidden {
+		t.Errorf("Expected learners not to list revisions, got %d", status)
+	}
+	if status := send(otherInstructor, http.MethodGet, path, nil); status != http.StatusForbidden {
+		t.Errorf("Expected other instructors not to list revisions, got %d", status)
+	}
+
+	revisions := []map[string]any{}
+	if status := send(instructor, http.MethodGet, path, &revisions); status != http.StatusOK || len(revisions) != 2 {
+		t.Fatalf("Expected the instructor to list 2 revisions, got %d %v", status, revisions)
+	}
+	first := revisions[1]["id"].(string)
+
+	diff := LessonRevisionDiff{}
+	if status := send(instructor, http.MethodGet, path+"/diff?from="+first, &diff); status != http.StatusOK ||
+		diff.Content != "<h2>Reversing</h2><p>Look behind you<ins>, then reverse</ins>.</p>" {
+		t.Errorf("Expected the diff to the latest revision, got %d %+v", status, diff)
+	}
+	if status := send(instructor, http.MethodGet, path+"/diff?from=missing", nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown revision, got %d", status)
+	}
+
+	lesson := map[string]any{}
+	if status := send(instructor, http.MethodPost, path+"/"+first+"/rollback", &lesson); status != http.StatusOK ||
+		lesson["content"] != "<h2>Reversing</h2><p>Look behind you.</p>" {
+		t.Errorf("Expected the lesson to be rolled back, got %d %v", status, lesson)
+	}
+
+	other, _ := findLessonRevisions(app, lessons[0].Id)
+	if status := send(instructor, http.MethodPost, path+"/"+other[0].Id+"/rollback", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for the revision of another lesson, got %d", status)
+	}
+
+	if revisions, _ := findLessonRevisions(app, advanced.Id); len(revisions) != 3 || revisions[0].GetString("author") != instructor.Id {
+		t.Errorf("Expected the rollback to be recorded for the instructor, got %d", len(revisions))
+	}
+
+	// superusers aren't users, their revisions have no author
+	superusers, err := app.FindCollectionByNameOrId(core.CollectionNameSuperusers)
+	if err != nil {
+		t.Fatalf("Failed to find superusers collection: %v", err)
+	}
+	superuser := core.NewRecord(superusers)
+	superuser.SetEmail("root@example.com")
+	superuser.SetPassword("1234567890")
+	if err := app.Save(superuser); err != nil {
+		t.Fatalf("Failed to save superuser: %v", err)
+	}
+	latest := revisions[0]["id"].(string)
+	if status := send(superuser, http.MethodPost, path+"/"+latest+"/rollback", nil); status != http.StatusOK {
+		t.Errorf("Expected the superuser to roll the lesson back, got %d", status)
+	}
+	if revisions, _ := findLessonRevisions(app, advanced.Id); len(revisions) != 4 || revisions[0].GetString("author") != "" {
+		t.Errorf("Expected the superuser rollback to be recorded without author, got %d", len(revisions))
+	}
+}
@@ -0,0 +1,77 @@
+package hooks
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+)
+
+// User roles. Users without a role are learners.
+const (
+	RoleLearner    = "learner"
+	RoleInstructor = "instructor"
+	RoleManager    = "manager"
+	RoleOrgAdmin   = "org_admin"
+)
+
+const requireRoleMiddlewareId = "elessonRequireRole"
+
+// UserRole returns the role of an auth record, defaulting to RoleLearner.
+func UserRole(auth *core.Record) string {
+	if auth == nil || auth.IsSuperuser() {
+		return ""
+	}
+
+	if role := auth.GetString("role"); role != "" {
+		return role
+	}
+	return RoleLearner
+}
+
+// HasRole reports whether the auth record is a superuser or a user with one of the given roles.
+func HasRole(auth *core.Record, roles ...string) bool {
+	if auth == nil {
+		return false
+	}
+
+	if auth.IsSuperuser() {
+		return true
+	}
+
+	return slices.Contains(roles, UserRole(auth))
+}
+
+// RequireRole middleware requires a request authenticated as a superuser or as
+// a user with one of the given roles.
+func RequireRole(roles ...string) *hook.Handler[*core.RequestEvent] {
+	return &hook.Handler[*core.RequestEvent]{
+		Id: requireRoleMiddlewareId,
+		Func: func(e *core.RequestEvent) error {
+			if e.Auth == nil {
+				return e.UnauthorizedError("The request requires valid authorization token.", nil)
+			}
+
+			if !HasRole(e.Auth, roles...) {
+				return e.ForbiddenError("You are not allowed to perform this request.", nil)
+			}
+
+			return e.Next()
+		},
+	}
+}
+
+// CanManageCourse reports whether the auth record can author the course and
+// manage its assignees, which is the case for superusers, the org admins of
+// the course organization and the instructor who owns the course.
+func CanManageCourse(auth *core.Record, course *core.Record) bool {
+	if auth != nil && auth.IsSuperuser() {
+		return true
+	}
+
+	if UserRole(auth) == RoleOrgAdmin {
+		return auth.GetString("organization") == course.GetString("organization")
+	}
+
+	return UserRole(auth) == RoleInstructor && course.GetString("owner") == auth.Id
+}
@@ -0,0 +1,301 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+func TestHasRole(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatalf("Failed to find users collection: %v", err)
+	}
+	superusers, err := app.FindCollectionByNameOrId(core.CollectionNameSuperusers)
+	if err != nil {
+		t.Fatalf("Failed to find superusers collection: %v", err)
+	}
+
+	newUser := func(role string) *core.Record {
+		user := core.NewRecord(users)
+		user.Id = "user_" + role
+		user.Set("role", role)
+		return user
+	}
+
+	tests := []struct {
+		name     string
+		auth     *core.Record
+		roles    []string
+		expected bool
+	}{
+		{"guest", nil, []string{RoleLearner}, false},
+		{"superuser", core.NewRecord(superusers), []string{RoleOrgAdmin}, true},
+		{"user without role is a learner", newUser(""), []string{RoleLearner}, true},
+		{"instructor", newUser(RoleInstructor), []string{RoleInstructor, RoleOrgAdmin}, true},
+		{"learner is not an instructor", newUser(RoleLearner), []string{RoleInstructor, RoleOrgAdmin}, false},
+		{"manager is not an org admin", newUser(RoleManager), []string{RoleOrgAdmin}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasRole(tt.auth, tt.roles...); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCanManageCourse(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatalf("Failed to find users collection: %v", err)
+	}
+
+	newUser := func(id, role string) *core.Record {
+		user := core.NewRecord(users)
+		user.Id = id
+		user.Set("role", role)
+		return user
+	}
+
+	course := core.NewRecord(core.NewBaseCollection("courses"))
+	course.Set("owner", "owner")
+
+	otherAdmin := newUser("other_admin", RoleOrgAdmin)
+	otherAdmin.Set("organization", testOrg2)
+
+	tests := []struct {
+		name     string
+		auth     *core.Record
+		expected bool
+	}{
+		{"guest", nil, false},
+		{"owning instructor", newUser("owner", RoleInstructor), true},
+		{"other instructor", newUser("other", RoleInstructor), false},
+		{"owner without instructor role", newUser("owner", RoleLearner), false},
+		{"org admin", newUser("admin", RoleOrgAdmin), true},
+		{"org admin of another organization", otherAdmin, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanManageCourse(tt.auth, course); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatalf("Failed to find users collection: %v", err)
+	}
+
+	newUser := func(role string) *core.Record {
+		user := core.NewRecord(users)
+		user.Set("role", role)
+		return user
+	}
+
+	tests := []struct {
+		name         string
+		auth         *core.Record
+		expectedCode int // 0 when the request is expected to pass
+	}{
+		{"guest", nil, http.StatusUnauthorized},
+		{"learner", newUser(RoleLearner), http.StatusForbidden},
+		{"instructor", newUser(RoleInstructor), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &core.RequestEvent{App: app, Auth: tt.auth}
+			e.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+			e.Response = httptest.NewRecorder()
+
+			err := RequireRole(RoleInstructor).Func(e)
+			if tt.expectedCode == 0 {
+				if err != nil {
+					t.Fatalf("Expected the request to pass, got %v", err)
+				}
+				return
+			}
+
+			apiErr, ok := err.(*router.ApiError)
+			if !ok || apiErr.Status != tt.expectedCode {
+				t.Errorf("Expected a %d error, got %v", tt.expectedCode, err)
+			}
+		})
+	}
+}
+
+func TestRoleRules(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, users := createTestCollections(t, app)
+	initOrganizationHooks(app)
+
+	newUser := func(email, role string) *core.Record {
+		user := core.NewRecord(users)
+		user.SetEmail(email)
+		user.SetPassword("1234567890")
+		user.Set("role", role)
+		user.Set("organization", testOrg1)
+		if err := app.Save(user); err != nil {
+			t.Fatalf("Failed to save user %s: %v", email, err)
+		}
+		return user
+	}
+	learner := newUser("learner@example.com", RoleLearner)
+	owner := newUser("owner@example.com", RoleInstructor)
+	instructor := newUser("instructor@example.com", RoleInstructor)
+	admin := newUser("admin@example.com", RoleOrgAdmin)
+
+	lessons, err := app.FindCollectionByNameOrId("lessons")
+	if err != nil {
+		t.Fatalf("Failed to find lessons collection: %v", err)
+	}
+	newCourse := func() (*core.Record, *core.Record) {
+		course := core.NewRecord(courses)
+		course.Set("title", "Forklift safety")
+		course.Set("owner", owner.Id)
+		course.Set("organization", testOrg1)
+		course.Set("assignees", []string{learner.Id})
+		if err := app.Save(course); err != nil {
+			t.Fatalf("Failed to save course: %v", err)
+		}
+		lesson := core.NewRecord(lessons)
+		lesson.Set("course", course.Id)
+		lesson.Set("title", "Basics")
+		if err := app.Save(lesson); err != nil {
+			t.Fatalf("Failed to save lesson: %v", err)
+		}
+		return course, lesson
+	}
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	send := func(auth *core.Record, method, path string, body map[string]any) int {
+		t.Helper()
+
+		var reader io.Reader
+		if body != nil {
+			data, _ := json.Marshal(body)
+			reader = bytes.NewReader(data)
+		}
+		req, _ := http.NewRequest(method, server.URL+path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		token, err := auth.NewAuthToken()
+		if err != nil {
+			t.Fatalf("Failed to create auth token: %v", err)
+		}
+		req.Header.Set("Authorization", token)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	// learners are read-only and instructors only author the courses they own
+	denied := map[string]*core.Record{"learner": learner, "instructor of another course": instructor}
+	allowed := map[string]*core.Record{"course owner": owner, "org admin": admin}
+
+	t.Run("create", func(t *testing.T) {
+		course, _ := newCourse()
+
+		if status := send(learner, http.MethodPost, "/api/collections/courses/records", map[string]any{"title": "Driving"}); status != http.StatusBadRequest {
+			t.Errorf("Expected the learner not to create courses, got %d", status)
+		}
+		for name, auth := range map[string]*core.Record{"instructor": instructor, "org admin": admin} {
+			if status := send(auth, http.MethodPost, "/api/collections/courses/records", map[string]any{"title": "Driving", "owner": auth.Id}); status != http.StatusOK {
+				t.Errorf("Expected the %s to create courses, got %d", name, status)
+			}
+		}
+
+		lesson := map[string]any{"course": course.Id, "title": "Reversing"}
+		for name, auth := range denied {
+			if status := send(auth, http.MethodPost, "/api/collections/lessons/records", lesson); status != http.StatusBadRequest {
+				t.Errorf("Expected the %s not to add lessons, got %d", name, status)
+			}
+		}
+		for name, auth := range allowed {
+			if status := send(auth, http.MethodPost, "/api/collections/lessons/records", lesson); status != http.StatusOK {
+				t.Errorf("Expected the %s to add lessons, got %d", name, status)
+			}
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		course, lesson := newCourse()
+
+		for name, auth := range denied {
+			if status := send(auth, http.MethodPatch, "/api/collections/courses/records/"+course.Id, map[string]any{"title": "Renamed"}); status != http.StatusNotFound {
+				t.Errorf("Expected the %s not to update the course, got %d", name, status)
+			}
+			if status := send(auth, http.MethodPatch, "/api/collections/lessons/records/"+lesson.Id, map[string]any{"title": "Renamed"}); status != http.StatusNotFound {
+				t.Errorf("Expected the %s not to update the lesson, got %d", name, status)
+			}
+		}
+		for name, auth := range allowed {
+			if status := send(auth, http.MethodPatch, "/api/collections/courses/records/"+course.Id, map[string]any{"title": "Renamed"}); status != http.StatusOK {
+				t.Errorf("Expected the %s to update the course, got %d", name, status)
+			}
+			if status := send(auth, http.MethodPatch, "/api/collections/lessons/records/"+lesson.Id, map[string]any{"title": "Renamed"}); status != http.StatusOK {
+				t.Errorf("Expected the %s to update the lesson, got %d", name, status)
+			}
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		for name, auth := range allowed {
+			course, lesson := newCourse()
+
+			for deniedName, deniedAuth := range denied {
+				if status := send(deniedAuth, http.MethodDelete, "/api/collections/lessons/records/"+lesson.Id, nil); status != http.StatusNotFound {
+					t.Errorf("Expected the %s not to delete the lesson, got %d", deniedName, status)
+				}
+				if status := send(deniedAuth, http.MethodDelete, "/api/collections/courses/records/"+course.Id, nil); status != http.StatusNotFound {
+					t.Errorf("Expected the %s not to delete the course, got %d", deniedName, status)
+				}
+			}
+
+			if status := send(auth, http.MethodDelete, "/api/collections/lessons/records/"+lesson.Id, nil); status != http.StatusNoContent {
+				t.Errorf("Expected the %s to delete the lesson, got %d", name, status)
+			}
+			if status := send(auth, http.MethodDelete, "/api/collections/courses/records/"+course.Id, nil); status != http.StatusNoContent {
+				t.Errorf("Expected the %s to delete the course, got %d", name, status)
+			}
+		}
+	})
+}
@@ -0,0 +1,27 @@
+package hooks
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+func InitRoutes(app core.App, r *router.Router[*core.RequestEvent]) {
+	courseService := NewCourseService(app)
+
+	bindResetRoutes(r, courseService)
+	bindWebhookRoutes(r)
+	bindEnrollmentRoutes(r, courseService)
+	bindInviteRoutes(r, courseService)
+	bindScimRoutes(r, courseService)
+	bindSamlRoutes(r, courseService)
+	bindLtiRoutes(r, courseService)
+	bindXapiRoutes(r, courseService)
+	bindScormRoutes(r, courseService)
+	bindCmi5Routes(r, courseService)
+	bindCartridgeRoutes(r, courseService)
+	bindArchiveRoutes(r, courseService)
+	bindDuplicateRoutes(r, courseService)
+	bindRevisionRoutes(r, courseService)
+	bindDocumentRoutes(r, courseService)
+	bindBookRoutes(r, courseService)
+}
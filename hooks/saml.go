@@ -0,0 +1,435 @@
+package hooks
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+var (
+	ErrSamlNoAccount       = errors.New("no account exists for this user")
+	ErrSamlNoEmail         = errors.New("the identity provider did not send an email address")
+	ErrSamlOrganization    = errors.New("the user belongs to another organization")
+	ErrSamlDeactivated     = errors.New("the account is deactivated")
+	ErrSamlReplayedRequest = errors.New("the SAML response was already used")
+	ErrSamlUnknownRequest  = errors.New("the SAML response answers an unknown or already answered request")
+)
+
+// samlRequestTTL is how long a login started at the SP waits for the IdP response.
+const samlRequestTTL = 10 * time.Minute
+
+// samlDefaultAttributes lists the assertion attributes read for each users field
+// when the provider attribute_map doesn't name one. Attributes are matched by
+// their name or friendly name.
+var samlDefaultAttributes = map[string][]string{
+	"email": {
+		"email", "mail", "emailaddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+	},
+	"name": {
+		"displayName", "cn", "name",
+		"urn:oid:2.5.4.3",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+	},
+	"given_name": {
+		"givenName", "firstName",
+		"urn:oid:2.5.4.42",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname",
+	},
+	"family_name": {
+		"sn", "surname", "lastName",
+		"urn:oid:2.5.4.4",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/surname",
+	},
+	"department": {
+		"department",
+		"http://schemas.microsoft.com/ws/2008/06/identity/claims/department",
+	},
+}
+
+// SamlProfile holds the users fields mapped from a SAML assertion.
+type SamlProfile struct {
+	NameID     string
+	Email      string
+	Name       string
+	Department string
+}
+
+// MapSamlAssertion maps the attributes of an assertion to users fields. attributeMap
+// overrides the attribute read for a field, eg. {"department": "costCenter"}.
+func MapSamlAssertion(assertion *saml.Assertion, attributeMap map[string]string) SamlProfile {
+	attribute := func(field string) string {
+		names := samlDefaultAttributes[field]
+		if name := attributeMap[field]; name != "" {
+			names = []string{name}
+		}
+
+		for _, statement := range assertion.AttributeStatements {
+			for _, attr := range statement.Attributes {
+				matches := slices.ContainsFunc(names, func(name string) bool {
+					return strings.EqualFold(attr.Name, name) || strings.EqualFold(attr.FriendlyName, name)
+				})
+				if matches && len(attr.Values) > 0 {
+					return strings.TrimSpace(attr.Values[0].Value)
+				}
+			}
+		}
+		return ""
+	}
+
+	profile := SamlProfile{
+		Email:      strings.ToLower(attribute("email")),
+		Name:       attribute("name"),
+		Department: attribute("department"),
+	}
+
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		profile.NameID = assertion.Subject.NameID.Value
+	}
+
+	if profile.Email == "" && strings.Contains(profile.NameID, "@") {
+		profile.Email = strings.ToLower(profile.NameID)
+	}
+
+	if profile.Name == "" {
+		profile.Name = strings.TrimSpace(attribute("given_name") + " " + attribute("family_name"))
+	}
+
+	return profile
+}
+
+// SamlLogin finds the user of a SAML profile within the organization of the
+// provider, creating it when the provider allows just-in-time provisioning.
+// Known users get their mapped fields updated.
+func (cs *CourseService) SamlLogin(provider *core.Record, profile SamlProfile) (*core.Record, error) {
+	if profile.Email == "" {
+		return nil, ErrSamlNoEmail
+	}
+
+	organizationID := provider.GetString("organization")
+
+	var user *core.Record
+	if profile.NameID != "" {
+		user, _ = cs.app.FindFirstRecordByFilter(
+			"users",
+			"external_id = {:nameID} && organization = {:organization}",
+			dbx.Params{"nameID": profile.NameID, "organization": organizationID},
+		)
+	}
+	if user == nil {
+		user, _ = cs.app.FindAuthRecordByEmail("users", profile.Email)
+	}
+
+	if user == nil {
+		if !provider.GetBool("jit") {
+			return nil, ErrSamlNoAccount
+		}
+
+		collection, err := cs.app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil, fmt.Errorf("failed to find users collection: %w", err)
+		}
+
+		user = core.NewRecord(collection)
+		user.SetEmail(profile.Email)
+		user.SetPassword(security.RandomString(30))
+		user.SetVerified(true)
+		user.Set("organization", organizationID)
+		user.Set("external_id", profile.NameID)
+		user.Set("name", profile.Name)
+		user.Set("department", profile.Department)
+
+		if err := cs.ProvisionUser(user); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	if user.GetString("organization") != organizationID {
+		return nil, ErrSamlOrganization
+	}
+	if IsDeactivated(user) {
+		return nil, ErrSamlDeactivated
+	}
+
+	if user.GetString("external_id") == "" {
+		user.Set("external_id", profile.NameID)
+	}
+	if profile.Name != "" {
+		user.Set("name", profile.Name)
+	}
+	if profile.Department != "" {
+		user.Set("department", profile.Department)
+	}
+	if err := cs.app.Save(user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return user, nil
+}
+
+// samlServiceProvider configures the service provider of a saml_providers record.
+func samlServiceProvider(app core.App, provider *core.Record) (*saml.ServiceProvider, error) {
+	idpMetadata, err := samlsp.ParseMetadata([]byte(provider.GetString("idp_metadata")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the IdP metadata: %w", err)
+	}
+
+	keyBlock, _ := pem.Decode([]byte(provider.GetString("sp_key")))
+	if keyBlock == nil {
+		return nil, errors.New("missing service provider key")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the service provider key: %w", err)
+	}
+
+	certificateBlock, _ := pem.Decode([]byte(provider.GetString("sp_certificate")))
+	if certificateBlock == nil {
+		return nil, errors.New("missing service provider certificate")
+	}
+	certificate, err := x509.ParseCertificate(certificateBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the service provider certificate: %w", err)
+	}
+
+	baseURL, err := url.Parse(strings.TrimRight(app.Settings().Meta.AppURL, "/") + "/api/saml/" + provider.Id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid application URL: %w", err)
+	}
+
+	return &saml.ServiceProvider{
+		EntityID:          baseURL.JoinPath("metadata").String(),
+		Key:               key,
+		Certificate:       certificate,
+		MetadataURL:       *baseURL.JoinPath("metadata"),
+		AcsURL:            *baseURL.JoinPath("acs"),
+		IDPMetadata:       idpMetadata,
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+		AllowIDPInitiated: true,
+	}, nil
+}
+
+// generateSamlKeyPair creates the self-signed key pair of a service provider as PEM.
+func generateSamlKeyPair(commonName string) (string, string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	certificatePEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	return string(keyPEM), string(certificatePEM), nil
+}
+
+const (
+	// samlRequestsStoreKey names the expiring store remembering the ids of the
+	// pending authentication requests, to reject the responses to unknown or
+	// already answered requests.
+	samlRequestsStoreKey = "elesson.samlRequests"
+
+	// samlAssertionsStoreKey names the expiring store remembering the ids of
+	// the consumed assertions, to reject replayed responses.
+	samlAssertionsStoreKey = "elesson.samlAssertions"
+)
+
+func initSamlHooks(app core.App) {
+	app.OnRecordCreate("saml_providers").BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.GetString("sp_key") == "" {
+			key, certificate, err := generateSamlKeyPair(e.Record.GetString("name"))
+			if err != nil {
+				return fmt.Errorf("failed to generate the service provider key: %w", err)
+			}
+			e.Record.Set("sp_key", key)
+			e.Record.Set("sp_certificate", certificate)
+		}
+		return e.Next()
+	})
+
+	app.OnRecordValidate("saml_providers").BindFunc(func(e *core.RecordEvent) error {
+		if _, err := samlsp.ParseMetadata([]byte(e.Record.GetString("idp_metadata"))); err != nil {
+			return validation.Errors{
+				"idp_metadata": validation.NewError("validation_invalid_idp_metadata", "Invalid IdP metadata XML."),
+			}
+		}
+		return e.Next()
+	})
+}
+
+func bindSamlRoutes(r *router.Router[*core.RequestEvent], courseService *CourseService) {
+	findProvider := func(e *core.RequestEvent) (*core.Record, *saml.ServiceProvider, error) {
+		provider, err := e.App.FindRecordById("saml_providers", e.Request.PathValue("id"))
+		if err != nil {
+			return nil, nil, e.NotFoundError("", err)
+		}
+
+		sp, err := samlServiceProvider(e.App, provider)
+		if err != nil {
+			return nil, nil, e.InternalServerError("The SAML provider is misconfigured.", err)
+		}
+		return provider, sp, nil
+	}
+
+	// the service provider metadata to register in the IdP
+	r.GET("/api/saml/{id}/metadata", func(e *core.RequestEvent) error {
+		_, sp, err := findProvider(e)
+		if err != nil {
+			return err
+		}
+
+		metadata, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+		if err != nil {
+			return e.InternalServerError("", err)
+		}
+
+		return e.Blob(http.StatusOK, "application/samlmetadata+xml", metadata)
+	})
+
+	// start an SP initiated login, returning to the redirect path afterwards
+	r.GET("/api/saml/{id}/login", func(e *core.RequestEvent) error {
+		_, sp, err := findProvider(e)
+		if err != nil {
+			return err
+		}
+
+		authnRequest, err := sp.MakeAuthenticationRequest(
+			sp.GetSSOBindingLocation(saml.HTTPRedirectBinding),
+			saml.HTTPRedirectBinding,
+			saml.HTTPPostBinding,
+		)
+		if err != nil {
+			return e.InternalServerError("Failed to create the SAML request.", err)
+		}
+
+		redirectURL, err := authnRequest.Redirect(localRedirect(e.Request.URL.Query().Get("redirect")), sp)
+		if err != nil {
+			return e.InternalServerError("Failed to create the SAML request.", err)
+		}
+
+		appExpiringStore(e.App, samlRequestsStoreKey).set(authnRequest.ID, true, time.Now().Add(samlRequestTTL))
+
+		return e.Redirect(http.StatusFound, redirectURL.String())
+	})
+
+	// the assertion consumer service: log the user in and hand the auth token to the UI
+	r.POST("/api/saml/{id}/acs", func(e *core.RequestEvent) error {
+		provider, sp, err := findProvider(e)
+		if err != nil {
+			return err
+		}
+
+		if err := e.Request.ParseForm(); err != nil {
+			return e.BadRequestError("Failed to read the SAML response.", err)
+		}
+
+		rawResponse, err := base64.StdEncoding.DecodeString(e.Request.PostForm.Get("SAMLResponse"))
+		if err != nil {
+			return samlLoginError(e, "", fmt.Errorf("invalid SAMLResponse encoding: %w", err))
+		}
+
+		requests := appExpiringStore(e.App, samlRequestsStoreKey)
+
+		assertion, err := sp.ParseXMLResponse(rawResponse, requests.keys(), sp.AcsURL)
+		if err != nil {
+			var invalidErr *saml.InvalidResponseError
+			if errors.As(err, &invalidErr) {
+				err = invalidErr.PrivateErr
+			}
+			return samlLoginError(e, "", err)
+		}
+
+		// each assertion logs in once
+		assertions := appExpiringStore(e.App, samlAssertionsStoreKey)
+		if _, ok := assertions.get(assertion.ID); ok {
+			return samlLoginError(e, "", ErrSamlReplayedRequest)
+		}
+		expiresAt := time.Now().Add(samlRequestTTL)
+		if assertion.Conditions != nil && assertion.Conditions.NotOnOrAfter.After(expiresAt) {
+			expiresAt = assertion.Conditions.NotOnOrAfter
+		}
+		assertions.set(assertion.ID, true, expiresAt)
+
+		// and each pending request is answered by a single assertion, while
+		// IdP initiated assertions answer no request
+		if assertion.Subject != nil {
+			for _, confirmation := range assertion.Subject.SubjectConfirmations {
+				if data := confirmation.SubjectConfirmationData; data != nil && data.InResponseTo != "" {
+					if _, ok := requests.take(data.InResponseTo); !ok {
+						return samlLoginError(e, "", ErrSamlUnknownRequest)
+					}
+				}
+			}
+		}
+
+		attributeMap := map[string]string{}
+		if err := provider.UnmarshalJSONField("attribute_map", &attributeMap); err != nil {
+			return e.InternalServerError("Invalid attribute_map.", err)
+		}
+
+		profile := MapSamlAssertion(assertion, attributeMap)
+
+		user, err := courseService.WithActor(provider.Id).withApp(e.App).SamlLogin(provider, profile)
+		if err != nil {
+			return samlLoginError(e, profile.Email, err)
+		}
+
+		return loginRedirect(e, user, e.Request.PostForm.Get("RelayState"))
+	})
+}
+
+// samlLoginError sends the browser back to the login page with the reason of a failed SAML login.
+func samlLoginError(e *core.RequestEvent, email string, err error) error {
+	e.App.Logger().Warn("SAML login failed", "email", email, "error", err)
+
+	message := "The SAML login failed."
+	switch {
+	case errors.Is(err, ErrSamlNoAccount),
+		errors.Is(err, ErrSamlNoEmail),
+		errors.Is(err, ErrSamlOrganization),
+		errors.Is(err, ErrSamlDeactivated):
+		message = "The SAML login failed: " + err.Error() + "."
+	}
+
+	return loginErrorRedirect(e, message)
+}
@@ -0,0 +1,285 @@
+package hooks
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/crewjam/saml"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+// testIdentityProvider is an in-process SAML IdP stand-in that trusts a single service provider.
+type testIdentityProvider struct {
+	t          *testing.T
+	idp        *saml.IdentityProvider
+	spMetadata *saml.EntityDescriptor
+}
+
+func newTestIdentityProvider(t *testing.T) *testIdentityProvider {
+	keyPEM, certificatePEM, err := generateSamlKeyPair("test idp")
+	if err != nil {
+		t.Fatalf("Failed to generate the IdP key: %v", err)
+	}
+
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse the IdP key: %v", err)
+	}
+	certificateBlock, _ := pem.Decode([]byte(certificatePEM))
+	certificate, err := x509.ParseCertificate(certificateBlock.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse the IdP certificate: %v", err)
+	}
+
+	metadataURL, _ := url.Parse("https://idp.example.com/metadata")
+	ssoURL, _ := url.Parse("https://idp.example.com/sso")
+
+	provider := &testIdentityProvider{t: t}
+	provider.idp = &saml.IdentityProvider{
+		Key:                     key,
+		Signer:                  key,
+		Certificate:             certificate,
+		MetadataURL:             *metadataURL,
+		SSOURL:                  *ssoURL,
+		ServiceProviderProvider: provider,
+	}
+	return provider
+}
+
+func (p *testIdentityProvider) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	if p.spMetadata == nil || p.spMetadata.EntityID != serviceProviderID {
+		return nil, os.ErrNotExist
+	}
+	return p.spMetadata, nil
+}
+
+func (p *testIdentityProvider) metadataXML() string {
+	raw, err := xml.Marshal(p.idp.Metadata())
+	if err != nil {
+		p.t.Fatalf("Failed to marshal the IdP metadata: %v", err)
+	}
+	return string(raw)
+}
+
+// respond logs session in for the authentication request of loginURL and
+// returns the form the browser would post to the ACS.
+func (p *testIdentityProvider) respond(loginURL string, session *saml.Session) url.Values {
+	req, err := saml.NewIdpAuthnRequest(p.idp, httptest.NewRequest(http.MethodGet, loginURL, nil))
+	if err != nil {
+		p.t.Fatalf("NewIdpAuthnRequest failed: %v", err)
+	}
+	if err := req.Validate(); err != nil {
+		p.t.Fatalf("Invalid authentication request: %v", err)
+	}
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		p.t.Fatalf("MakeAssertion failed: %v", err)
+	}
+
+	form, err := req.PostBinding()
+	if err != nil {
+		p.t.Fatalf("PostBinding failed: %v", err)
+	}
+
+	return url.Values{"SAMLResponse": {form.SAMLResponse}, "RelayState": {form.RelayState}}
+}
+
+// createTestSamlProvider configures a provider trusting idp.
+func createTestSamlProvider(t *testing.T, app *tests.TestApp, idp *testIdentityProvider, jit bool) *core.Record {
+	collection, err := app.FindCollectionByNameOrId("saml_providers")
+	if err != nil {
+		t.Fatalf("Failed to find saml_providers collection: %v", err)
+	}
+
+	provider := core.NewRecord(collection)
+	provider.Set("name", "Corporate IdP")
+	provider.Set("organization", testOrg1)
+	provider.Set("idp_metadata", idp.metadataXML())
+	provider.Set("attribute_map", map[string]string{"department": "costCenter"})
+	provider.Set("jit", jit)
+	if err := app.Save(provider); err != nil {
+		t.Fatalf("Failed to save SAML provider: %v", err)
+	}
+	return provider
+}
+
+func TestSamlLogin(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	bindTestOnboarding(app)
+	initSamlHooks(app)
+
+	everyone := createTestCourse(t, app, courses, "")
+	everyone.Set("assign_to_everyone", true)
+	everyone.Set("organization", testOrg1)
+	if err := app.Save(everyone); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	bindSamlRoutes(r, NewCourseService(app))
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	app.Settings().Meta.AppURL = server.URL
+
+	idp := newTestIdentityProvider(t)
+	provider := createTestSamlProvider(t, app, idp, true)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	// the IdP registers the SP from its metadata
+	res, err := client.Get(server.URL + "/api/saml/" + provider.Id + "/metadata")
+	if err != nil {
+		t.Fatalf("Failed to fetch the SP metadata: %v", err)
+	}
+	rawMetadata, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	idp.spMetadata = &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(rawMetadata, idp.spMetadata); err != nil {
+		t.Fatalf("Failed to parse the SP metadata: %v", err)
+	}
+
+	res, err = client.Get(server.URL + "/api/saml/" + provider.Id + "/login?redirect=/security-basics")
+	if err != nil {
+		t.Fatalf("Failed to start the login: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound || !strings.HasPrefix(res.Header.Get("Location"), "https://idp.example.com/sso") {
+		t.Fatalf("Expected a redirect to the IdP, got %d %q", res.StatusCode, res.Header.Get("Location"))
+	}
+
+	loginURL := res.Header.Get("Location")
+	form := idp.respond(loginURL, &saml.Session{
+		ID:            "session1",
+		NameID:        "jane.doe",
+		UserEmail:     "Jane@Example.com",
+		UserGivenName: "Jane",
+		UserSurname:   "Doe",
+		CustomAttributes: []saml.Attribute{{
+			Name:   "costCenter",
+			Values: []saml.AttributeValue{{Type: "xs:string", Value: "Sales"}},
+		}},
+	})
+
+	acs := func() url.Values {
+		res, err := client.PostForm(server.URL+"/api/saml/"+provider.Id+"/acs", form)
+		if err != nil {
+			t.Fatalf("Failed to post the SAML response: %v", err)
+		}
+		res.Body.Close()
+
+		location, err := url.Parse(res.Header.Get("Location"))
+		if err != nil || res.StatusCode != http.StatusSeeOther {
+			t.Fatalf("Expected a redirect to the login page, got %d %q", res.StatusCode, res.Header.Get("Location"))
+		}
+		fragment, _ := url.ParseQuery(location.Fragment)
+		return fragment
+	}
+
+	fragment := acs()
+	if fragment.Get("auth_error") != "" || fragment.Get("redirect") != "/security-basics" {
+		t.Fatalf("Expected a successful login, got %v", fragment)
+	}
+
+	user, err := app.FindAuthRecordByToken(fragment.Get("auth_token"), core.TokenTypeAuth)
+	if err != nil {
+		t.Fatalf("Expected a valid auth token: %v", err)
+	}
+	if user.Email() != "jane@example.com" || user.GetString("name") != "Jane Doe" || user.GetString("department") != "Sales" {
+		t.Errorf("Unexpected mapped user %s %q %q", user.Email(), user.GetString("name"), user.GetString("department"))
+	}
+	if user.GetString("organization") != testOrg1 || user.GetString("external_id") != "jane.doe" {
+		t.Errorf("Expected jane.doe in org1, got %q in %q", user.GetString("external_id"), user.GetString("organization"))
+	}
+
+	everyone, err = app.FindRecordById("courses", everyone.Id)
+	if err != nil {
+		t.Fatalf("Failed to reload course: %v", err)
+	}
+	if !slices.Contains(everyone.GetStringSlice("assignees"), user.Id) {
+		t.Errorf("Expected the new user to be assigned to the everyone course")
+	}
+
+	// the same response can't log in twice
+	if fragment := acs(); fragment.Get("auth_error") == "" {
+		t.Errorf("Expected the replayed response to fail, got %v", fragment)
+	}
+
+	// and a request is answered only once, even by a new assertion
+	form = idp.respond(loginURL, &saml.Session{
+		ID:        "session2",
+		NameID:    "jane.doe",
+		UserEmail: "Jane@Example.com",
+	})
+	if fragment := acs(); fragment.Get("auth_error") == "" {
+		t.Errorf("Expected a second assertion for the same request to fail, got %v", fragment)
+	}
+}
+
+func TestCourseService_SamlLogin(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	createTestCollections(t, app)
+	bindTestOnboarding(app)
+	initSamlHooks(app)
+
+	provider := createTestSamlProvider(t, app, newTestIdentityProvider(t), false)
+
+	if _, err := service.SamlLogin(provider, SamlProfile{NameID: "bob"}); err != ErrSamlNoEmail {
+		t.Errorf("Expected ErrSamlNoEmail, got %v", err)
+	}
+
+	if _, err := service.SamlLogin(provider, SamlProfile{Email: "bob@example.com"}); err != ErrSamlNoAccount {
+		t.Errorf("Expected ErrSamlNoAccount without just-in-time provisioning, got %v", err)
+	}
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatalf("Failed to find users collection: %v", err)
+	}
+	for _, organization := range []string{testOrg1, testOrg2} {
+		user := core.NewRecord(users)
+		user.SetEmail(organization + "@example.com")
+		user.SetPassword("1234567890")
+		user.Set("organization", organization)
+		if err := app.Save(user); err != nil {
+			t.Fatalf("Failed to save user: %v", err)
+		}
+	}
+
+	if _, err := service.SamlLogin(provider, SamlProfile{Email: testOrg2 + "@example.com"}); err != ErrSamlOrganization {
+		t.Errorf("Expected ErrSamlOrganization, got %v", err)
+	}
+
+	user, err := service.SamlLogin(provider, SamlProfile{NameID: "o1", Email: testOrg1 + "@example.com", Name: "Org One"})
+	if err != nil {
+		t.Fatalf("SamlLogin failed: %v", err)
+	}
+	if user.GetString("external_id") != "o1" || user.GetString("name") != "Org One" {
+		t.Errorf("Expected the existing user to be linked and updated, got %q %q", user.GetString("external_id"), user.GetString("name"))
+	}
+}
@@ -0,0 +1,417 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrEmbedNotAllowed is returned for the frames and media of content
+// embedding other pages or files than those of the allowed hosts.
+var ErrEmbedNotAllowed = errors.New("only the https pages and media of the allowed hosts can be embedded")
+
+// errDropElement tells sanitizeHTMLChildren to drop an element with its content.
+var errDropElement = errors.New("drop the element")
+
+// defaultEmbedHosts are the hosts the lessons can embed in frames and media
+// elements, besides
+// the embed_hosts of their organization. "*." entries also allow subdomains.
+var defaultEmbedHosts = []string{
+	"www.youtube.com",
+	"www.youtube-nocookie.com",
+	"player.vimeo.com",
+	"www.loom.com",
+	"fast.wistia.net",
+	"docs.google.com",
+}
+
+// embedSandbox restricts what the embedded pages can do.
+const embedSandbox = "allow-scripts allow-same-origin allow-presentation allow-popups"
+
+// sanitizedAttributes are the attributes kept by the sanitizer, by element
+// (0 for those of every element).
+var sanitizedAttributes = map[atom.Atom][]string{
+	0:               {"class", "title", "lang", "dir", "style"},
+	atom.A:          {"href"},
+	atom.Img:        {"src", "alt", "width", "height"},
+	atom.Video:      {"src", "poster", "controls", "width", "height", "preload", "loop", "muted"},
+	atom.Audio:      {"src", "controls", "preload", "loop", "muted"},
+	atom.Source:     {"src", "type"},
+	atom.Track:      {"src", "kind", "srclang", "label", "default"},
+	atom.Iframe:     {"src", "width", "height", "title", "allow", "allowfullscreen"},
+	atom.Blockquote: {"cite"},
+	atom.Q:          {"cite"},
+	atom.Ol:         {"start", "type", "reversed"},
+	atom.Td:         {"colspan", "rowspan"},
+	atom.Th:         {"colspan", "rowspan", "scope"},
+	atom.Col:        {"span"},
+	atom.Colgroup:   {"span"},
+}
+
+// sanitizedElements are the elements kept by the sanitizer. Other elements
+// are replaced by their content, apart from droppedElements.
+var sanitizedElements = []atom.Atom{
+	atom.P, atom.Br, atom.Hr, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+	atom.Strong, atom.B, atom.Em, atom.I, atom.U, atom.S, atom.Strike, atom.Sub, atom.Sup, atom.Small, atom.Mark,
+	atom.Del, atom.Ins, atom.Abbr, atom.Cite, atom.Q, atom.Code, atom.Pre, atom.Kbd, atom.Blockquote,
+	atom.Ul, atom.Ol, atom.Li, atom.Dl, atom.Dt, atom.Dd,
+	atom.A, atom.Img, atom.Figure, atom.Figcaption, atom.Video, atom.Audio, atom.Source, atom.Track, atom.Iframe,
+	atom.Table, atom.Caption, atom.Thead, atom.Tbody, atom.Tfoot, atom.Tr, atom.Th, atom.Td, atom.Col, atom.Colgroup,
+	atom.Div, atom.Span, atom.Section, atom.Article, atom.Aside, atom.Header, atom.Footer, atom.Details, atom.Summary,
+}
+
+// droppedElements are removed with their content.
+var droppedElements = []atom.Atom{
+	atom.Script, atom.Style, atom.Noscript, atom.Template, atom.Object, atom.Embed, atom.Applet,
+	atom.Frame, atom.Frameset, atom.Form, atom.Input, atom.Button, atom.Select, atom.Textarea,
+	atom.Link, atom.Meta, atom.Base, atom.Title, atom.Head, atom.Svg, atom.Math,
+}
+
+// sanitizedStyles are the CSS properties kept in style attributes.
+var sanitizedStyles = []string{
+	"text-align", "color", "background-color", "font-weight", "font-style", "text-decoration",
+	"vertical-align", "width", "height",
+}
+
+var (
+	styleValue      = regexp.MustCompile(`^[\w\s#%.,+-]*$`)
+	styleColorValue = regexp.MustCompile(`^(rgb|rgba|hsl|hsla)\([\d\s.,%]+\)$`)
+	dataImageURL    = regexp.MustCompile(`^data:image/(png|jpeg|gif|webp);base64,`)
+)
+
+// ContentPolicy tells the sanitizer where the content is served from and what
+// it may embed.
+type ContentPolicy struct {
+	// the URL of the instance, whose links are made relative
+	AppURL string
+	// the hosts of the frames and media
+	EmbedHosts []string
+	// drop the frames and media of other hosts instead of failing, for the
+	// content saved before the policy
+	DropEmbeds bool
+}
+
+// allowsEmbed reports whether the policy allows frames of host.
+func (p ContentPolicy) allowsEmbed(host string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range p.EmbedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// SanitizeContent cleans HTML content, like the one of lessons, up before it's
+// rendered as is to the learners. Only the known formatting, media and table
+// elements and attributes are kept, dropping scripts, styles, forms and event
+// handlers. Links are limited to web, mail and phone URLs (and images to web
+// and data URLs), those of the instance are made relative and the external ones
+// open in a new tab. Frames must embed https pages of the policy hosts, in a
+// sandbox, and the video, audio, source and track elements files of the
+// instance or https files of the policy hosts, otherwise ErrEmbedNotAllowed
+// is returned (or the elements are dropped, with DropEmbeds).
+func SanitizeContent(content string, policy ContentPolicy) (string, error) {
+	nodes, err := parseHTMLFragment(content)
+	if err != nil {
+		return "", err
+	}
+
+	appURL, _ := url.Parse(policy.AppURL)
+
+	root := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	for _, node := range nodes {
+		root.AppendChild(node)
+	}
+	if err := sanitizeHTMLChildren(root, policy, appURL); err != nil {
+		return "", err
+	}
+
+	return renderHTMLNodes(htmlChildren(root))
+}
+
+// sanitizeHTMLChildren sanitizes the children of an HTML node in place.
+func sanitizeHTMLChildren(node *html.Node, policy ContentPolicy, appURL *url.URL) error {
+	for _, child := range htmlChildren(node) {
+		switch {
+		case child.Type == html.TextNode:
+			node.AppendChild(child)
+		case child.Type != html.ElementNode, child.Namespace != "", slices.Contains(droppedElements, child.DataAtom):
+			// comments, like the conditional ones of office documents, are dropped too
+		case !slices.Contains(sanitizedElements, child.DataAtom):
+			// the content of unknown elements is kept
+			if err := sanitizeHTMLChildren(child, policy, appURL); err != nil {
+				return err
+			}
+			for _, grandchild := range htmlChildren(child) {
+				node.AppendChild(grandchild)
+			}
+		default:
+			err := sanitizeHTMLElement(child, policy, appURL)
+			if errors.Is(err, errDropElement) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := sanitizeHTMLChildren(child, policy, appURL); err != nil {
+				return err
+			}
+			node.AppendChild(child)
+		}
+	}
+	return nil
+}
+
+// sanitizeHTMLElement keeps the allowed attributes of an element, with safe
+// URLs and styles.
+func sanitizeHTMLElement(node *html.Node, policy ContentPolicy, appURL *url.URL) error {
+	attrs := []html.Attribute{}
+	for _, attr := range node.Attr {
+		key := strings.ToLower(attr.Key)
+		if attr.Namespace != "" || !slices.Contains(sanitizedAttributes[0], key) && !slices.Contains(sanitizedAttributes[node.DataAtom], key) {
+			continue
+		}
+
+		value := strings.TrimSpace(attr.Val)
+		switch key {
+		case "href", "src", "poster", "cite":
+			var ok bool
+			if value, ok = sanitizeURL(node.DataAtom, key, value, appURL); !ok {
+				continue
+			}
+		case "style":
+			if value = sanitizeStyle(value); value == "" {
+				continue
+			}
+		}
+		attrs = append(attrs, html.Attribute{Key: key, Val: value})
+	}
+	node.Attr = attrs
+
+	switch node.DataAtom {
+	case atom.A:
+		if href := htmlAttr(node, "href"); strings.HasPrefix(href, "https://") || strings.HasPrefix(href, "http://") {
+			node.Attr = append(node.Attr,
+				html.Attribute{Key: "target", Val: "_blank"},
+				html.Attribute{Key: "rel", Val: "noopener noreferrer"},
+			)
+		}
+	case atom.Iframe:
+		src, err := url.Parse(htmlAttr(node, "src"))
+		if err != nil || src.Scheme != "https" || !policy.allowsEmbed(src.Hostname()) || isAppHost(src.Hostname(), appURL) {
+			return policy.embedError(htmlAttr(node, "src"))
+		}
+		node.Attr = append(node.Attr, html.Attribute{Key: "sandbox", Val: embedSandbox})
+	case atom.Video, atom.Audio, atom.Source, atom.Track:
+		for _, key := range []string{"src", "poster"} {
+			value := htmlAttr(node, key)
+			if value == "" {
+				continue
+			}
+			// the URLs of the instance are relative by now
+			src, err := url.Parse(value)
+			if err != nil || src.Host != "" && (src.Scheme != "https" || !policy.allowsEmbed(src.Hostname())) {
+				return policy.embedError(value)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isAppHost reports whether host is the one of the instance, whose pages
+// would run in a sandbox allowing same origin scripts.
+func isAppHost(host string, appURL *url.URL) bool {
+	return appURL != nil && appURL.Hostname() != "" && strings.EqualFold(host, appURL.Hostname())
+}
+
+// appEmbedHostError returns the validation error of embed hosts allowing frames
+// of one of the hosts of the instance.
+func appEmbedHostError(hosts []string, appHosts ...string) error {
+	policy := ContentPolicy{EmbedHosts: hosts}
+	for _, host := range appHosts {
+		if host != "" && policy.allowsEmbed(host) {
+			return validation.Errors{
+				"embed_hosts": validation.NewError("validation_app_embed_host", fmt.Sprintf("The host of the application (%s) can't be embedded.", host)),
+			}
+		}
+	}
+	return nil
+}
+
+// embedError reports a frame or media URL the policy doesn't allow.
+func (p ContentPolicy) embedError(value string) error {
+	if p.DropEmbeds {
+		return errDropElement
+	}
+	return fmt.Errorf("%w, not %q", ErrEmbedNotAllowed, value)
+}
+
+// sanitizeURL returns the safe value of a link, or false when it's not allowed.
+func sanitizeURL(element atom.Atom, attribute, value string, appURL *url.URL) (string, bool) {
+	if element == atom.Img && attribute == "src" && dataImageURL.MatchString(value) {
+		return value, true
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return "", false
+	}
+
+	switch strings.ToLower(parsed.Scheme) {
+	case "":
+		if parsed.Host != "" {
+			// protocol relative URLs
+			parsed.Scheme = "https"
+		}
+	case "http", "https":
+	case "mailto", "tel":
+		return value, element == atom.A
+	default:
+		return "", false
+	}
+
+	// the links to the instance keep working when it moves
+	if appURL != nil && appURL.Host != "" && strings.EqualFold(parsed.Host, appURL.Host) && element != atom.Iframe {
+		parsed.Scheme, parsed.Host, parsed.User = "", "", nil
+		if parsed.Path == "" {
+			parsed.Path = "/"
+		}
+	}
+
+	return parsed.String(), true
+}
+
+// sanitizeStyle keeps the allowed properties of a style attribute with plain values.
+func sanitizeStyle(style string) string {
+	declarations := []string{}
+	for _, declaration := range strings.Split(style, ";") {
+		property, value, ok := strings.Cut(declaration, ":")
+		if !ok {
+			continue
+		}
+		property = strings.ToLower(strings.TrimSpace(property))
+		value = strings.TrimSpace(value)
+		if !slices.Contains(sanitizedStyles, property) ||
+			!styleValue.MatchString(value) && !styleColorValue.MatchString(strings.ToLower(value)) {
+			continue
+		}
+		declarations = append(declarations, property+": "+value)
+	}
+	return strings.Join(declarations, "; ")
+}
+
+// organizationEmbedHosts returns the hosts the content of an organization can embed.
+func organizationEmbedHosts(app core.App, organizationID string) []string {
+	hosts := slices.Clone(defaultEmbedHosts)
+	if organizationID == "" {
+		return hosts
+	}
+
+	organization, err := app.FindRecordById("organizations", organizationID)
+	if err != nil {
+		return hosts
+	}
+	extra := []string{}
+	organization.UnmarshalJSONField("embed_hosts", &extra)
+	return append(hosts, extra...)
+}
+
+// ResanitizeLessons sanitizes the content of every lesson again, like after a
+// change of the sanitizer, dropping the frames and media that the policy of
+// their organization doesn't allow. It returns the number of updated lessons.
+func ResanitizeLessons(app core.App) (int, error) {
+	lessons, err := app.FindAllRecords("lessons")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find lessons: %w", err)
+	}
+
+	updated := 0
+	for _, lesson := range lessons {
+		content := lesson.GetString("content")
+		sanitized, err := SanitizeContent(content, ContentPolicy{
+			AppURL:     app.Settings().Meta.AppURL,
+			EmbedHosts: organizationEmbedHosts(app, lesson.GetString("organization")),
+			DropEmbeds: true,
+		})
+		if err != nil {
+			return updated, fmt.Errorf("failed to sanitize lesson %s: %w", lesson.Id, err)
+		}
+		if sanitized == content {
+			continue
+		}
+
+		lesson.Set("content", sanitized)
+		if err := app.Save(lesson); err != nil {
+			return updated, fmt.Errorf("failed to save lesson %s: %w", lesson.Id, err)
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+func initSanitizeHooks(app core.App) {
+	sanitizeLesson := func(e *core.RecordEvent) error {
+		content := e.Record.GetString("content")
+		if !e.Record.IsNew() && content == e.Record.Original().GetString("content") {
+			return e.Next()
+		}
+
+		sanitized, err := SanitizeContent(content, ContentPolicy{
+			AppURL:     e.App.Settings().Meta.AppURL,
+			EmbedHosts: organizationEmbedHosts(e.App, e.Record.GetString("organization")),
+		})
+		if errors.Is(err, ErrEmbedNotAllowed) {
+			return validation.Errors{
+				"content": validation.NewError("validation_embed_not_allowed", err.Error()),
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to sanitize the lesson content: %w", err)
+		}
+		e.Record.Set("content", sanitized)
+
+		return e.Next()
+	}
+	app.OnRecordCreate("lessons").BindFunc(sanitizeLesson)
+	app.OnRecordUpdate("lessons").BindFunc(sanitizeLesson)
+
+	app.OnRecordValidate("organizations").BindFunc(func(e *core.RecordEvent) error {
+		hosts := []string{}
+		if err := e.Record.UnmarshalJSONField("embed_hosts", &hosts); err != nil {
+			return validation.Errors{
+				"embed_hosts": validation.NewError("validation_invalid_embed_hosts", "Must be a list of host names."),
+			}
+		}
+		appURL, _ := url.Parse(e.App.Settings().Meta.AppURL)
+		if appURL != nil {
+			if err := appEmbedHostError(hosts, appURL.Hostname()); err != nil {
+				return err
+			}
+		}
+		return e.Next()
+	})
+
+	// the host the API is reached at, for the instances without an app URL
+	checkRequestHost := func(e *core.RecordRequestEvent) error {
+		hosts := []string{}
+		e.Record.UnmarshalJSONField("embed_hosts", &hosts)
+		host := (&url.URL{Host: e.Request.Host}).Hostname()
+		if err := appEmbedHostError(hosts, host); err != nil {
+			return e.BadRequestError("Failed to save the organization.", err)
+		}
+		return e.Next()
+	}
+	app.OnRecordCreateRequest("organizations").BindFunc(checkRequestHost)
+	app.OnRecordUpdateRequest("organizations").BindFunc(checkRequestHost)
+}
@@ -0,0 +1,279 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestSanitizeContent(t *testing.T) {
+	policy := ContentPolicy{
+		AppURL:     "https://learn.example.com",
+		EmbedHosts: append(slices.Clone(defaultEmbedHosts), "*.example.org"),
+	}
+
+	scenarios := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{
+			"formatting",
+			`<h2>Brakes</h2><p>Check <strong>both</strong> pedals.</p><ul><li>Daily</li></ul>`,
+			`<h2>Brakes</h2><p>Check <strong>both</strong> pedals.</p><ul><li>Daily</li></ul>`,
+		},
+		{
+			"scripts",
+			`<p>Hi</p><script>alert(1)</script><style>p{}</style><noscript>x</noscript>`,
+			`<p>Hi</p>`,
+		},
+		{
+			"event handlers",
+			`<p onclick="alert(1)" class="lead">Hi</p><img src="a.png" onerror="alert(1)" alt="A">`,
+			`<p class="lead">Hi</p><img src="a.png" alt="A"/>`,
+		},
+		{
+			"script links",
+			`<a href="javascript:alert(1)">Go</a><a href=" JaVaScRiPt:alert(1)">Go</a><img src="data:text/html,x">`,
+			`<a>Go</a><a>Go</a><img/>`,
+		},
+		{
+			"external links",
+			`<a href="https://example.com/rules" target="_self" rel="opener">Rules</a><a href="mailto:safety@example.com">Mail</a>`,
+			`<a href="https://example.com/rules" target="_blank" rel="noopener noreferrer">Rules</a><a href="mailto:safety@example.com">Mail</a>`,
+		},
+		{
+			"instance links",
+			`<a href="https://learn.example.com/courses/1">Next</a><img src="//learn.example.com/api/files/c/r/a.png">`,
+			`<a href="/courses/1">Next</a><img src="/api/files/c/r/a.png"/>`,
+		},
+		{
+			"data images",
+			`<img src="data:image/png;base64,iVBORw0KGgo=">`,
+			`<img src="data:image/png;base64,iVBORw0KGgo="/>`,
+		},
+		{
+			"office markup",
+			`<!--[if gte mso 9]><xml></xml><![endif]--><p class="MsoNormal"><o:p></o:p><font face="Arial">Pasted</font></p>`,
+			`<p class="MsoNormal">Pasted</p>`,
+		},
+		{
+			"foreign content",
+			`<svg><a xlink:href="javascript:alert(1)"><text>x</text></a></svg><math><mi>y</mi></math><form><input value="z"></form>`,
+			``,
+		},
+		{
+			"styles",
+			`<p style="text-align: center; background: url(x.png); color: rgb(1, 2, 3); width: expression(alert(1))">Hi</p>`,
+			`<p style="text-align: center; color: rgb(1, 2, 3)">Hi</p>`,
+		},
+		{
+			"embeds",
+			`<iframe src="https://www.youtube.com/embed/abc" allowfullscreen onload="x()"></iframe><iframe src="https://videos.example.org/1"></iframe>`,
+			`<iframe src="https://www.youtube.com/embed/abc" allowfullscreen="" sandbox="` + embedSandbox + `"></iframe>` +
+				`<iframe src="https://videos.example.org/1" sandbox="` + embedSandbox + `"></iframe>`,
+		},
+		{
+			"media",
+			`<video src="/api/files/c/r/a.mp4" poster="https://videos.example.org/p.jpg" controls><source src="https://learn.example.com/api/files/c/r/a.webm" type="video/webm"><track src="/api/files/c/r/a.vtt" kind="captions"></video>`,
+			`<video src="/api/files/c/r/a.mp4" poster="https://videos.example.org/p.jpg" controls=""><source src="/api/files/c/r/a.webm" type="video/webm"/><track src="/api/files/c/r/a.vtt" kind="captions"/></video>`,
+		},
+	}
+
+	for _, s := range scenarios {
+		sanitized, err := SanitizeContent(s.content, policy)
+		if err != nil {
+			t.Errorf("%s: SanitizeContent failed: %v", s.name, err)
+			continue
+		}
+		if sanitized != s.expected {
+			t.Errorf("%s: expected %q, got %q", s.name, s.expected, sanitized)
+		}
+		if again, _ := SanitizeContent(sanitized, policy); again != sanitized {
+			t.Errorf("%s: expected the sanitized content to stay as is, got %q", s.name, again)
+		}
+	}
+
+	for _, content := range []string{
+		`<iframe src="https://evil.example.com/"></iframe>`,
+		`<iframe src="http://www.youtube.com/embed/abc"></iframe>`,
+		`<iframe src="javascript:alert(1)"></iframe>`,
+		`<iframe srcdoc="<script>alert(1)</script>"></iframe>`,
+		`<iframe src="https://example.org.evil.com/"></iframe>`,
+		`<video><track src="https://evil.example.com/t.vtt" kind="captions"></video>`,
+		`<audio><source src="https://evil.example.com/a.mp3"></audio>`,
+		`<video src="http://videos.example.org/a.mp4"></video>`,
+		`<video poster="//evil.example.com/p.jpg"></video>`,
+	} {
+		if _, err := SanitizeContent(content, policy); !errors.Is(err, ErrEmbedNotAllowed) {
+			t.Errorf("Expected ErrEmbedNotAllowed for %s, got %v", content, err)
+		}
+	}
+
+	// the pages of the instance aren't framed even when a policy host covers it
+	appPolicy := policy
+	appPolicy.EmbedHosts = []string{"*.example.com"}
+	if _, err := SanitizeContent(`<iframe src="https://learn.example.com/api/files/c/r/a.html"></iframe>`, appPolicy); !errors.Is(err, ErrEmbedNotAllowed) {
+		t.Errorf("Expected ErrEmbedNotAllowed for a frame of the instance, got %v", err)
+	}
+
+	// the content saved before the policy loses its frames and media of other hosts
+	dropPolicy := policy
+	dropPolicy.DropEmbeds = true
+	sanitized, err := SanitizeContent(`<p>Watch</p><iframe src="https://evil.example.com/"></iframe><video controls><track src="https://evil.example.com/t.vtt"></video>`, dropPolicy)
+	if err != nil || sanitized != `<p>Watch</p><video controls=""></video>` {
+		t.Errorf("Expected the frames and media of other hosts to be dropped, got %q %v", sanitized, err)
+	}
+}
+
+func TestResanitizeLessons(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	_, lessons := createTestAuthoredCourse(t, app, courses)
+
+	// content saved before the sanitizer
+	lessons[0].Set("content", `<p onclick="x()">Watch</p><video><track src="https://evil.example.com/t.vtt"></video>`)
+	if err := app.Save(lessons[0]); err != nil {
+		t.Fatalf("Failed to save lesson: %v", err)
+	}
+
+	updated, err := ResanitizeLessons(app)
+	if err != nil {
+		t.Fatalf("ResanitizeLessons failed: %v", err)
+	}
+	if updated != 1 {
+		t.Errorf("Expected 1 updated lesson, got %d", updated)
+	}
+
+	lesson, err := app.FindRecordById("lessons", lessons[0].Id)
+	if err != nil {
+		t.Fatalf("Failed to reload lesson: %v", err)
+	}
+	if content := lesson.GetString("content"); content != `<p>Watch</p><video></video>` {
+		t.Errorf("Expected the lesson content to be sanitized again, got %q", content)
+	}
+
+	if updated, err := ResanitizeLessons(app); err != nil || updated != 0 {
+		t.Errorf("Expected the sanitized lessons to stay as they are, got %d %v", updated, err)
+	}
+}
+
+func TestInitSanitizeHooks(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	initSanitizeHooks(app)
+
+	organization, err := app.FindRecordById("organizations", testOrg1)
+	if err != nil {
+		t.Fatalf("Failed to find organization: %v", err)
+	}
+	organization.Set("embed_hosts", []string{"videos.acme.com"})
+	if err := app.Save(organization); err != nil {
+		t.Fatalf("Failed to save organization: %v", err)
+	}
+	organization.Set("embed_hosts", `"videos.acme.com"`)
+	if err := app.Save(organization); err == nil {
+		t.Errorf("Expected embed hosts other than a list to be rejected")
+	}
+
+	app.Settings().Meta.AppURL = "https://learn.acme.com"
+	for _, hosts := range [][]string{{"learn.acme.com"}, {"LEARN.acme.com"}, {"videos.acme.com", "*.acme.com"}} {
+		organization.Set("embed_hosts", hosts)
+		if err := app.Save(organization); err == nil || !strings.Contains(err.Error(), "learn.acme.com") {
+			t.Errorf("Expected the embed hosts %v covering the application host to be rejected, got %v", hosts, err)
+		}
+	}
+	organization.Set("embed_hosts", []string{"videos.acme.com"})
+
+	course := core.NewRecord(courses)
+	course.Set("title", "Forklift safety")
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+
+	lessons, _ := app.FindCollectionByNameOrId("lessons")
+	lesson := core.NewRecord(lessons)
+	lesson.Set("course", course.Id)
+	lesson.Set("title", "Safety videos")
+	lesson.Set("organization", organization.Id)
+	lesson.Set("content", `<p onmouseover="steal()">Watch</p><iframe src="https://videos.acme.com/1"></iframe>`)
+	if err := app.Save(lesson); err != nil {
+		t.Fatalf("Failed to save lesson: %v", err)
+	}
+	if content := lesson.GetString("content"); content != `<p>Watch</p><iframe src="https://videos.acme.com/1" sandbox="`+embedSandbox+`"></iframe>` {
+		t.Errorf("Expected the content to be sanitized, got %q", content)
+	}
+
+	lesson.Set("content", `<iframe src="https://videos.other.com/1"></iframe>`)
+	err = app.Save(lesson)
+	if err == nil || !strings.Contains(err.Error(), "videos.other.com") {
+		t.Errorf("Expected the embed to be rejected, got %v", err)
+	}
+}
+
+func TestInitSanitizeHooks_RequestHost(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	_, users := createTestCollections(t, app)
+	initSanitizeHooks(app)
+
+	admin := core.NewRecord(users)
+	admin.SetEmail("admin@example.com")
+	admin.SetPassword("1234567890")
+	admin.Set("role", RoleOrgAdmin)
+	admin.Set("organization", testOrg1)
+	if err := app.Save(admin); err != nil {
+		t.Fatalf("Failed to save admin: %v", err)
+	}
+	token, err := admin.NewAuthToken()
+	if err != nil {
+		t.Fatalf("Failed to create auth token: %v", err)
+	}
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// without an app URL, the host the API is reached at is the one of the instance
+	update := func(hosts []string) int {
+		t.Helper()
+
+		data, _ := json.Marshal(map[string]any{"embed_hosts": hosts})
+		req, _ := http.NewRequest(http.MethodPatch, server.URL+"/api/collections/organizations/records/"+testOrg1, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", token)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to update the organization: %v", err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	if status := update([]string{"127.0.0.1"}); status != http.StatusBadRequest {
+		t.Errorf("Expected the host of the instance to be rejected, got %d", status)
+	}
+	if status := update([]string{"videos.acme.com"}); status != http.StatusOK {
+		t.Errorf("Expected other embed hosts to be saved, got %d", status)
+	}
+}
@@ -0,0 +1,721 @@
+package hooks
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// SCIM 2.0 schemas (RFC 7643) and messages (RFC 7644).
+const (
+	scimUserSchema           = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimEnterpriseUserSchema = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	scimGroupSchema          = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListResponseSchema   = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema          = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+	scimContentType = "application/scim+json"
+	scimTokenPrefix = "scim_"
+
+	// scimMaxResults is the largest page of a SCIM list request.
+	scimMaxResults = 200
+)
+
+const scimTokenStoreKey = "elesson.scimToken"
+
+// ScimUser is the SCIM representation of a user.
+type ScimUser struct {
+	Schemas     []string            `json:"schemas"`
+	Id          string              `json:"id,omitempty"`
+	ExternalId  string              `json:"externalId,omitempty"`
+	UserName    string              `json:"userName"`
+	Name        *ScimName           `json:"name,omitempty"`
+	DisplayName string              `json:"displayName,omitempty"`
+	Emails      []ScimEmail         `json:"emails,omitempty"`
+	Active      *bool               `json:"active,omitempty"`
+	Groups      []ScimReference     `json:"groups,omitempty"`
+	Enterprise  *ScimEnterpriseUser `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User,omitempty"`
+	Meta        *ScimMeta           `json:"meta,omitempty"`
+}
+
+type ScimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type ScimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type ScimEnterpriseUser struct {
+	Department string         `json:"department,omitempty"`
+	Manager    *ScimReference `json:"manager,omitempty"`
+}
+
+// ScimGroup is the SCIM representation of a group.
+type ScimGroup struct {
+	Schemas     []string        `json:"schemas"`
+	Id          string          `json:"id,omitempty"`
+	ExternalId  string          `json:"externalId,omitempty"`
+	DisplayName string          `json:"displayName"`
+	Members     []ScimReference `json:"members,omitempty"`
+	Meta        *ScimMeta       `json:"meta,omitempty"`
+}
+
+type ScimReference struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+type ScimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+}
+
+type scimListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int64    `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+type scimErrorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// scimUserFilters maps the filterable SCIM user attributes to users fields.
+var scimUserFilters = map[string]string{
+	"username":     "email",
+	"emails.value": "email",
+	"externalid":   "external_id",
+}
+
+// scimGroupFilters maps the filterable SCIM group attributes to groups fields.
+var scimGroupFilters = map[string]string{
+	"displayname": "name",
+	"externalid":  "external_id",
+}
+
+// HashScimToken returns the stored form of a provisioning token.
+func HashScimToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateScimToken issues a provisioning token for the identity provider of an
+// organization. Only its hash is stored, so the token can't be shown again.
+func CreateScimToken(app core.App, organizationID, name string) (string, *core.Record, error) {
+	collection, err := app.FindCollectionByNameOrId("scim_tokens")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to find scim_tokens collection: %w", err)
+	}
+
+	token := scimTokenPrefix + security.RandomString(40)
+
+	record := core.NewRecord(collection)
+	record.Set("name", name)
+	record.Set("organization", organizationID)
+	record.Set("token_hash", HashScimToken(token))
+
+	if err := app.Save(record); err != nil {
+		return "", nil, fmt.Errorf("failed to save SCIM token: %w", err)
+	}
+
+	return token, record, nil
+}
+
+// requireScimToken authenticates the SCIM requests with a provisioning bearer
+// token. The tokens can't be used with any other API.
+func requireScimToken() *hook.Handler[*core.RequestEvent] {
+	return &hook.Handler[*core.RequestEvent]{
+		Id: "elessonRequireScimToken",
+		Func: func(e *core.RequestEvent) error {
+			token, ok := strings.CutPrefix(e.Request.Header.Get("Authorization"), "Bearer ")
+			if !ok || !strings.HasPrefix(token, scimTokenPrefix) {
+				return scimError(e, http.StatusUnauthorized, "", "Missing or invalid provisioning token.")
+			}
+
+			record, err := e.App.FindFirstRecordByData("scim_tokens", "token_hash", HashScimToken(token))
+			if err != nil || !record.GetDateTime("revoked_at").IsZero() {
+				return scimError(e, http.StatusUnauthorized, "", "Missing or invalid provisioning token.")
+			}
+
+			lastUsedAt := record.GetDateTime("last_used_at")
+			if lastUsedAt.IsZero() || time.Since(lastUsedAt.Time()) > time.Minute {
+				record.Set("last_used_at", types.NowDateTime())
+				if err := e.App.Save(record); err != nil {
+					e.App.Logger().Warn("Failed to update SCIM token usage", "error", err)
+				}
+			}
+
+			e.Set(scimTokenStoreKey, record)
+
+			return e.Next()
+		},
+	}
+}
+
+// scimToken returns the provisioning token of the request.
+func scimToken(e *core.RequestEvent) *core.Record {
+	token, _ := e.Get(scimTokenStoreKey).(*core.Record)
+	return token
+}
+
+// scimOrganization returns the organization provisioned by the request token.
+func scimOrganization(e *core.RequestEvent) string {
+	return scimToken(e).GetString("organization")
+}
+
+// scimCourseService attributes the provisioning changes to the request token.
+func scimCourseService(e *core.RequestEvent, courseService *CourseService) *CourseService {
+	return courseService.WithActor(scimToken(e).Id).withApp(e.App)
+}
+
+func bindScimRoutes(r *router.Router[*core.RequestEvent], courseService *CourseService) {
+	scim := r.Group("/scim/v2")
+	scim.Bind(requireScimToken())
+
+	scim.GET("/ServiceProviderConfig", func(e *core.RequestEvent) error {
+		return scimJSON(e, http.StatusOK, map[string]any{
+			"schemas":               []string{scimProviderConfigSchema},
+			"patch":                 map[string]any{"supported": true},
+			"bulk":                  map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+			"filter":                map[string]any{"supported": true, "maxResults": scimMaxResults},
+			"changePassword":        map[string]any{"supported": false},
+			"sort":                  map[string]any{"supported": false},
+			"etag":                  map[string]any{"supported": false},
+			"authenticationSchemes": []map[string]any{{"type": "oauthbearertoken", "name": "Bearer token", "description": "Provisioning token issued with the scim-token command."}},
+		})
+	})
+
+	scim.GET("/Users", func(e *core.RequestEvent) error {
+		users, total, startIndex, err := scimFind(e, "users", scimUserFilters)
+		if err != nil {
+			return scimError(e, http.StatusBadRequest, "invalidFilter", err.Error())
+		}
+
+		resources := make([]any, 0, len(users))
+		for _, user := range users {
+			resource, err := scimUserResource(e.App, user)
+			if err != nil {
+				return scimError(e, http.StatusInternalServerError, "", err.Error())
+			}
+			resources = append(resources, resource)
+		}
+
+		return scimList(e, total, startIndex, resources)
+	})
+
+	scim.GET("/Users/{id}", func(e *core.RequestEvent) error {
+		user, err := scimFindRecord(e, "users")
+		if err != nil {
+			return scimError(e, http.StatusNotFound, "", "User not found.")
+		}
+		return scimUserResponse(e, http.StatusOK, user)
+	})
+
+	scim.POST("/Users", func(e *core.RequestEvent) error {
+		resource := ScimUser{}
+		if err := json.NewDecoder(e.Request.Body).Decode(&resource); err != nil {
+			return scimError(e, http.StatusBadRequest, "invalidSyntax", "Failed to read the user.")
+		}
+
+		collection, err := e.App.FindCollectionByNameOrId("users")
+		if err != nil {
+			return scimError(e, http.StatusInternalServerError, "", err.Error())
+		}
+
+		user := core.NewRecord(collection)
+		user.Set("organization", scimOrganization(e))
+		user.SetPassword(security.RandomString(30))
+		user.SetVerified(true)
+
+		if err := applyScimUser(e.App, user, resource); err != nil {
+			return scimSaveError(e, err)
+		}
+
+		if err := scimCourseService(e, courseService).ProvisionUser(user); err != nil {
+			return scimSaveError(e, err)
+		}
+
+		return scimUserResponse(e, http.StatusCreated, user)
+	})
+
+	scim.PUT("/Users/{id}", func(e *core.RequestEvent) error {
+		user, err := scimFindRecord(e, "users")
+		if err != nil {
+			return scimError(e, http.StatusNotFound, "", "User not found.")
+		}
+
+		resource := ScimUser{}
+		if err := json.NewDecoder(e.Request.Body).Decode(&resource); err != nil {
+			return scimError(e, http.StatusBadRequest, "invalidSyntax", "Failed to read the user.")
+		}
+
+		return scimUpdateUser(e, courseService, user, resource)
+	})
+
+	scim.PATCH("/Users/{id}", func(e *core.RequestEvent) error {
+		user, err := scimFindRecord(e, "users")
+		if err != nil {
+			return scimError(e, http.StatusNotFound, "", "User not found.")
+		}
+
+		current, err := scimUserResource(e.App, user)
+		if err != nil {
+			return scimError(e, http.StatusInternalServerError, "", err.Error())
+		}
+
+		resource := ScimUser{}
+		if err := scimPatch(e, current, &resource); err != nil {
+			return scimError(e, http.StatusBadRequest, "invalidValue", err.Error())
+		}
+
+		return scimUpdateUser(e, courseService, user, resource)
+	})
+
+	scim.DELETE("/Users/{id}", func(e *core.RequestEvent) error {
+		user, err := scimFindRecord(e, "users")
+		if err != nil {
+			return scimError(e, http.StatusNotFound, "", "User not found.")
+		}
+
+		if err := scimCourseService(e, courseService).DeprovisionUser(user); err != nil {
+			return scimError(e, http.StatusInternalServerError, "", err.Error())
+		}
+
+		return e.NoContent(http.StatusNoContent)
+	})
+
+	scim.GET("/Groups", func(e *core.RequestEvent) error {
+		groups, total, startIndex, err := scimFind(e, "groups", scimGroupFilters)
+		if err != nil {
+			return scimError(e, http.StatusBadRequest, "invalidFilter", err.Error())
+		}
+
+		resources := make([]any, 0, len(groups))
+		for _, group := range groups {
+			resource, err := scimGroupResource(e.App, group)
+			if err != nil {
+				return scimError(e, http.StatusInternalServerError, "", err.Error())
+			}
+			resources = append(resources, resource)
+		}
+
+		return scimList(e, total, startIndex, resources)
+	})
+
+	scim.GET("/Groups/{id}", func(e *core.RequestEvent) error {
+		group, err := scimFindRecord(e, "groups")
+		if err != nil {
+			return scimError(e, http.StatusNotFound, "", "Group not found.")
+		}
+		return scimGroupResponse(e, http.StatusOK, group)
+	})
+
+	scim.POST("/Groups", func(e *core.RequestEvent) error {
+		resource := ScimGroup{}
+		if err := json.NewDecoder(e.Request.Body).Decode(&resource); err != nil {
+			return scimError(e, http.StatusBadRequest, "invalidSyntax", "Failed to read the group.")
+		}
+
+		collection, err := e.App.FindCollectionByNameOrId("groups")
+		if err != nil {
+			return scimError(e, http.StatusInternalServerError, "", err.Error())
+		}
+
+		group := core.NewRecord(collection)
+		group.Set("organization", scimOrganization(e))
+
+		return scimSaveGroup(e, courseService, http.StatusCreated, group, resource)
+	})
+
+	scim.PUT("/Groups/{id}", func(e *core.RequestEvent) error {
+		group, err := scimFindRecord(e, "groups")
+		if err != nil {
+			return scimError(e, http.StatusNotFound, "", "Group not found.")
+		}
+
+		resource := ScimGroup{}
+		if err := json.NewDecoder(e.Request.Body).Decode(&resource); err != nil {
+			return scimError(e, http.StatusBadRequest, "invalidSyntax", "Failed to read the group.")
+		}
+
+		return scimSaveGroup(e, courseService, http.StatusOK, group, resource)
+	})
+
+	scim.PATCH("/Groups/{id}", func(e *core.RequestEvent) error {
+		group, err := scimFindRecord(e, "groups")
+		if err != nil {
+			return scimError(e, http.StatusNotFound, "", "Group not found.")
+		}
+
+		current, err := scimGroupResource(e.App, group)
+		if err != nil {
+			return scimError(e, http.StatusInternalServerError, "", err.Error())
+		}
+
+		resource := ScimGroup{}
+		if err := scimPatch(e, current, &resource); err != nil {
+			return scimError(e, http.StatusBadRequest, "invalidValue", err.Error())
+		}
+
+		return scimSaveGroup(e, courseService, http.StatusOK, group, resource)
+	})
+
+	scim.DELETE("/Groups/{id}", func(e *core.RequestEvent) error {
+		group, err := scimFindRecord(e, "groups")
+		if err != nil {
+			return scimError(e, http.StatusNotFound, "", "Group not found.")
+		}
+
+		if err := e.App.Delete(group); err != nil {
+			return scimError(e, http.StatusInternalServerError, "", err.Error())
+		}
+
+		return e.NoContent(http.StatusNoContent)
+	})
+}
+
+// scimFind lists the records of the token organization matching the request
+// filter, paginated with the 1-based startIndex and count query parameters.
+func scimFind(e *core.RequestEvent, collection string, filters map[string]string) ([]*core.Record, int64, int, error) {
+	query := e.Request.URL.Query()
+	exp := dbx.HashExp{"organization": scimOrganization(e)}
+
+	if filter := query.Get("filter"); filter != "" {
+		attribute, value, err := parseScimFilter(filter)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+
+		field, ok := filters[strings.ToLower(attribute)]
+		if !ok {
+			return nil, 0, 0, ErrScimInvalidFilter
+		}
+		if field == "email" {
+			value = strings.ToLower(value)
+		}
+		exp[field] = value
+	}
+
+	startIndex, _ := strconv.Atoi(query.Get("startIndex"))
+	startIndex = max(startIndex, 1)
+
+	count := scimMaxResults
+	if rawCount := query.Get("count"); rawCount != "" {
+		count, _ = strconv.Atoi(rawCount)
+		count = min(max(count, 0), scimMaxResults)
+	}
+
+	total, err := e.App.CountRecords(collection, exp)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	records := []*core.Record{}
+	if count > 0 {
+		err = e.App.RecordQuery(collection).
+			AndWhere(exp).
+			OrderBy("created ASC", "id ASC").
+			Offset(int64(startIndex - 1)).
+			Limit(int64(count)).
+			All(&records)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	return records, total, startIndex, nil
+}
+
+// scimFindRecord finds the record of the path id within the token organization.
+func scimFindRecord(e *core.RequestEvent, collection string) (*core.Record, error) {
+	record, err := e.App.FindRecordById(collection, e.Request.PathValue("id"))
+	if err != nil {
+		return nil, err
+	}
+	if record.GetString("organization") != scimOrganization(e) {
+		return nil, sql.ErrNoRows
+	}
+	return record, nil
+}
+
+// scimPatch applies the PATCH request to the current resource and decodes the result into patched.
+func scimPatch(e *core.RequestEvent, current any, patched any) error {
+	request := ScimPatchRequest{}
+	if err := json.NewDecoder(e.Request.Body).Decode(&request); err != nil {
+		return ErrScimInvalidPatch
+	}
+
+	raw, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+
+	resource := map[string]any{}
+	if err := json.Unmarshal(raw, &resource); err != nil {
+		return err
+	}
+
+	if err := applyScimPatch(resource, request.Operations); err != nil {
+		return err
+	}
+
+	raw, err = json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(raw, patched); err != nil {
+		return ErrScimInvalidPatch
+	}
+	return nil
+}
+
+func scimUpdateUser(e *core.RequestEvent, courseService *CourseService, user *core.Record, resource ScimUser) error {
+	if err := applyScimUser(e.App, user, resource); err != nil {
+		return scimSaveError(e, err)
+	}
+
+	if err := scimCourseService(e, courseService).UpdateProvisionedUser(user); err != nil {
+		return scimSaveError(e, err)
+	}
+
+	return scimUserResponse(e, http.StatusOK, user)
+}
+
+// applyScimUser copies the attributes of a SCIM user into a users record.
+func applyScimUser(app core.App, user *core.Record, resource ScimUser) error {
+	email := resource.UserName
+	for _, resourceEmail := range resource.Emails {
+		if email == "" || resourceEmail.Primary {
+			email = resourceEmail.Value
+		}
+	}
+	if email == "" {
+		return validation.Errors{"userName": validation.ErrRequired}
+	}
+	user.SetEmail(strings.ToLower(strings.TrimSpace(email)))
+
+	name := resource.DisplayName
+	if resource.Name != nil {
+		switch {
+		case resource.Name.Formatted != "":
+			name = resource.Name.Formatted
+		case resource.Name.GivenName != "" || resource.Name.FamilyName != "":
+			name = strings.TrimSpace(resource.Name.GivenName + " " + resource.Name.FamilyName)
+		}
+	}
+	if name != "" {
+		user.Set("name", name)
+	}
+
+	user.Set("external_id", resource.ExternalId)
+
+	switch {
+	case resource.Active == nil || *resource.Active:
+		user.Set("deactivated_at", "")
+	case !IsDeactivated(user):
+		user.Set("deactivated_at", types.NowDateTime())
+	}
+
+	department, managerID := "", ""
+	if resource.Enterprise != nil {
+		department = resource.Enterprise.Department
+		if resource.Enterprise.Manager != nil {
+			managerID = resource.Enterprise.Manager.Value
+		}
+	}
+	user.Set("department", department)
+
+	if managerID != "" {
+		manager, err := app.FindRecordById("users", managerID)
+		if err != nil || manager.GetString("organization") != user.GetString("organization") {
+			return validation.Errors{"manager": validation.NewError("validation_invalid_manager", "The manager must be a user of the organization.")}
+		}
+	}
+	user.Set("manager", managerID)
+
+	return nil
+}
+
+// scimUserResource returns the SCIM representation of a user.
+func scimUserResource(app core.App, user *core.Record) (*ScimUser, error) {
+	active := !IsDeactivated(user)
+
+	resource := &ScimUser{
+		Schemas:     []string{scimUserSchema},
+		Id:          user.Id,
+		ExternalId:  user.GetString("external_id"),
+		UserName:    user.Email(),
+		DisplayName: user.GetString("name"),
+		Emails:      []ScimEmail{{Value: user.Email(), Type: "work", Primary: true}},
+		Active:      &active,
+		Meta:        scimMeta(user, "User", "/scim/v2/Users/"),
+	}
+
+	if name := user.GetString("name"); name != "" {
+		resource.Name = &ScimName{Formatted: name}
+	}
+
+	department, manager := user.GetString("department"), user.GetString("manager")
+	if department != "" || manager != "" {
+		resource.Schemas = append(resource.Schemas, scimEnterpriseUserSchema)
+		resource.Enterprise = &ScimEnterpriseUser{Department: department}
+		if manager != "" {
+			resource.Enterprise.Manager = &ScimReference{Value: manager}
+		}
+	}
+
+	groups, err := app.FindRecordsByFilter("groups", "members.id ?= {:user}", "name", 0, 0, dbx.Params{"user": user.Id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the user groups: %w", err)
+	}
+	for _, group := range groups {
+		resource.Groups = append(resource.Groups, ScimReference{Value: group.Id, Display: group.GetString("name")})
+	}
+
+	return resource, nil
+}
+
+func scimUserResponse(e *core.RequestEvent, status int, user *core.Record) error {
+	resource, err := scimUserResource(e.App, user)
+	if err != nil {
+		return scimError(e, http.StatusInternalServerError, "", err.Error())
+	}
+
+	if status == http.StatusCreated {
+		e.Response.Header().Set("Location", resource.Meta.Location)
+	}
+	return scimJSON(e, status, resource)
+}
+
+func scimSaveGroup(e *core.RequestEvent, courseService *CourseService, status int, group *core.Record, resource ScimGroup) error {
+	if resource.DisplayName == "" {
+		return scimError(e, http.StatusBadRequest, "invalidValue", "The group displayName is required.")
+	}
+
+	group.Set("name", resource.DisplayName)
+	group.Set("external_id", resource.ExternalId)
+
+	memberIDs := make([]string, 0, len(resource.Members))
+	for _, member := range resource.Members {
+		memberIDs = append(memberIDs, member.Value)
+	}
+
+	if err := scimCourseService(e, courseService).SetGroupMembers(group, memberIDs); err != nil {
+		if errors.Is(err, ErrGroupMemberOrganization) {
+			return scimError(e, http.StatusBadRequest, "invalidValue", err.Error())
+		}
+		return scimSaveError(e, err)
+	}
+
+	return scimGroupResponse(e, status, group)
+}
+
+// scimGroupResource returns the SCIM representation of a group.
+func scimGroupResource(app core.App, group *core.Record) (*ScimGroup, error) {
+	resource := &ScimGroup{
+		Schemas:     []string{scimGroupSchema},
+		Id:          group.Id,
+		ExternalId:  group.GetString("external_id"),
+		DisplayName: group.GetString("name"),
+		Meta:        scimMeta(group, "Group", "/scim/v2/Groups/"),
+	}
+
+	members, err := app.FindRecordsByIds("users", group.GetStringSlice("members"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the group members: %w", err)
+	}
+	for _, member := range members {
+		resource.Members = append(resource.Members, ScimReference{Value: member.Id, Display: member.Email()})
+	}
+
+	return resource, nil
+}
+
+func scimGroupResponse(e *core.RequestEvent, status int, group *core.Record) error {
+	resource, err := scimGroupResource(e.App, group)
+	if err != nil {
+		return scimError(e, http.StatusInternalServerError, "", err.Error())
+	}
+
+	if status == http.StatusCreated {
+		e.Response.Header().Set("Location", resource.Meta.Location)
+	}
+	return scimJSON(e, status, resource)
+}
+
+func scimMeta(record *core.Record, resourceType, location string) *ScimMeta {
+	return &ScimMeta{
+		ResourceType: resourceType,
+		Created:      record.GetDateTime("created").Time().Format(time.RFC3339),
+		LastModified: record.GetDateTime("updated").Time().Format(time.RFC3339),
+		Location:     location + record.Id,
+	}
+}
+
+func scimList(e *core.RequestEvent, total int64, startIndex int, resources []any) error {
+	return scimJSON(e, http.StatusOK, scimListResponse{
+		Schemas:      []string{scimListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func scimJSON(e *core.RequestEvent, status int, data any) error {
+	e.Response.Header().Set("Content-Type", scimContentType)
+	return e.JSON(status, data)
+}
+
+// scimError writes a SCIM error response (RFC 7644, section 3.12).
+func scimError(e *core.RequestEvent, status int, scimType, detail string) error {
+	return scimJSON(e, status, scimErrorResponse{
+		Schemas:  []string{scimErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+// scimSaveError converts the validation errors of a provisioning change into SCIM errors.
+func scimSaveError(e *core.RequestEvent, err error) error {
+	var validationErrors validation.Errors
+	if !errors.As(err, &validationErrors) {
+		return scimError(e, http.StatusInternalServerError, "", err.Error())
+	}
+
+	if emailErr, ok := validationErrors["email"].(validation.Error); ok && emailErr.Code() == "validation_not_unique" {
+		return scimError(e, http.StatusConflict, "uniqueness", "A user with this userName already exists.")
+	}
+
+	return scimError(e, http.StatusBadRequest, "invalidValue", validationErrors.Error())
+}
@@ -0,0 +1,265 @@
+package hooks
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrScimInvalidFilter = errors.New("unsupported SCIM filter, only `attribute eq \"value\"` is supported")
+	ErrScimInvalidPath   = errors.New("invalid SCIM attribute path")
+	ErrScimInvalidPatch  = errors.New("invalid SCIM patch operation")
+)
+
+// ScimPatchRequest is the body of a SCIM PATCH request (RFC 7644, section 3.5.2).
+type ScimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations"`
+}
+
+type ScimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// scimPath is a parsed SCIM attribute path, eg. `emails[type eq "work"].value`.
+type scimPath struct {
+	Attribute    string
+	FilterAttr   string
+	FilterValue  string
+	SubAttribute string
+}
+
+var scimFilterPattern = regexp.MustCompile(`(?i)^\s*([\w.:$-]+)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// parseScimFilter parses the only filter supported by the SCIM endpoints, `attribute eq "value"`.
+func parseScimFilter(filter string) (string, string, error) {
+	matches := scimFilterPattern.FindStringSubmatch(filter)
+	if matches == nil {
+		return "", "", ErrScimInvalidFilter
+	}
+
+	value, err := strconv.Unquote(`"` + matches[2] + `"`)
+	if err != nil {
+		return "", "", ErrScimInvalidFilter
+	}
+	return matches[1], value, nil
+}
+
+// parseScimPath parses an attribute path. Paths of the core schemas may be
+// prefixed with their URN, the attributes of an extension are sub attributes
+// of the extension URN.
+func parseScimPath(path string) (scimPath, error) {
+	for _, schema := range []string{scimUserSchema, scimGroupSchema} {
+		if len(path) > len(schema) && strings.EqualFold(path[:len(schema)+1], schema+":") {
+			path = path[len(schema)+1:]
+		}
+	}
+
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		i := strings.LastIndex(path, ":")
+		return scimPath{Attribute: path[:i], SubAttribute: path[i+1:]}, nil
+	}
+
+	var p scimPath
+	if open := strings.Index(path, "["); open >= 0 {
+		end := strings.Index(path, "]")
+		if end < open {
+			return p, ErrScimInvalidPath
+		}
+
+		attr, value, err := parseScimFilter(path[open+1 : end])
+		if err != nil {
+			return p, err
+		}
+
+		p.Attribute, p.FilterAttr, p.FilterValue = path[:open], attr, value
+		p.SubAttribute = strings.TrimPrefix(path[end+1:], ".")
+	} else {
+		p.Attribute, p.SubAttribute, _ = strings.Cut(path, ".")
+	}
+
+	if p.Attribute == "" {
+		return p, ErrScimInvalidPath
+	}
+	return p, nil
+}
+
+// applyScimPatch applies the operations of a PATCH request to the JSON
+// representation of a resource.
+func applyScimPatch(resource map[string]any, operations []ScimPatchOperation) error {
+	for _, operation := range operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return ErrScimInvalidPatch
+		}
+
+		var value any
+		if len(operation.Value) > 0 {
+			if err := json.Unmarshal(operation.Value, &value); err != nil {
+				return ErrScimInvalidPatch
+			}
+		}
+
+		// without a path the value holds the attributes to add or replace
+		if operation.Path == "" {
+			attributes, ok := value.(map[string]any)
+			if !ok || op == "remove" {
+				return ErrScimInvalidPatch
+			}
+
+			for name, attributeValue := range attributes {
+				if err := applyScimPatchPath(resource, op, name, attributeValue); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if err := applyScimPatchPath(resource, op, operation.Path, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyScimPatchPath(resource map[string]any, op, path string, value any) error {
+	p, err := parseScimPath(path)
+	if err != nil {
+		return err
+	}
+
+	// some identity providers send booleans as "True" and "False"
+	if s, ok := value.(string); ok && strings.EqualFold(p.Attribute, "active") {
+		value = strings.EqualFold(s, "true")
+	}
+
+	key := scimKey(resource, p.Attribute)
+
+	switch {
+	case p.FilterAttr != "":
+		items, _ := resource[key].([]any)
+		matched := false
+		kept := make([]any, 0, len(items))
+
+		for _, item := range items {
+			object, ok := item.(map[string]any)
+			if !ok || !strings.EqualFold(scimString(object[scimKey(object, p.FilterAttr)]), p.FilterValue) {
+				kept = append(kept, item)
+				continue
+			}
+
+			matched = true
+			switch {
+			case op == "remove" && p.SubAttribute == "":
+				continue
+			case op == "remove":
+				delete(object, scimKey(object, p.SubAttribute))
+			case p.SubAttribute != "":
+				object[scimKey(object, p.SubAttribute)] = value
+			default:
+				item = value
+			}
+			kept = append(kept, item)
+		}
+
+		if !matched && op != "remove" {
+			item := map[string]any{p.FilterAttr: p.FilterValue}
+			if p.SubAttribute == "" {
+				object, ok := value.(map[string]any)
+				if !ok {
+					return ErrScimInvalidPatch
+				}
+				item = object
+			} else {
+				item[p.SubAttribute] = value
+			}
+			kept = append(kept, item)
+		}
+
+		resource[key] = kept
+	case p.SubAttribute != "":
+		object, _ := resource[key].(map[string]any)
+		if object == nil {
+			if op == "remove" {
+				return nil
+			}
+			object = map[string]any{}
+			resource[key] = object
+		}
+
+		if op == "remove" {
+			delete(object, scimKey(object, p.SubAttribute))
+		} else {
+			object[scimKey(object, p.SubAttribute)] = value
+		}
+	case op == "remove":
+		items, isList := resource[key].([]any)
+		removed, hasValue := value.([]any)
+		if !isList || !hasValue {
+			delete(resource, key)
+			return nil
+		}
+
+		kept := make([]any, 0, len(items))
+		for _, item := range items {
+			if !scimContainsValue(removed, item) {
+				kept = append(kept, item)
+			}
+		}
+		resource[key] = kept
+	case op == "add":
+		items, isList := resource[key].([]any)
+		added, addsList := value.([]any)
+		if isList && addsList {
+			for _, item := range added {
+				if !scimContainsValue(items, item) {
+					items = append(items, item)
+				}
+			}
+			resource[key] = items
+			return nil
+		}
+		resource[key] = value
+	default:
+		resource[key] = value
+	}
+
+	return nil
+}
+
+// scimKey returns the key of object matching the case insensitive SCIM attribute name.
+func scimKey(object map[string]any, name string) string {
+	if _, ok := object[name]; ok {
+		return name
+	}
+	for key := range object {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+	return name
+}
+
+func scimString(value any) string {
+	s, _ := value.(string)
+	return s
+}
+
+// scimContainsValue reports whether a multi-valued attribute has an item with the `value` of item.
+func scimContainsValue(items []any, item any) bool {
+	object, _ := item.(map[string]any)
+	value := scimString(object["value"])
+
+	for _, existing := range items {
+		existingObject, _ := existing.(map[string]any)
+		if value != "" && scimString(existingObject["value"]) == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,298 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+// scimTestClient is a minimal SCIM client talking to the SCIM routes of a test app.
+type scimTestClient struct {
+	t      *testing.T
+	server *httptest.Server
+	token  string
+}
+
+func newScimTestClient(t *testing.T, app *tests.TestApp, organizationID string) *scimTestClient {
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	bindScimRoutes(r, NewCourseService(app))
+
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	token, _, err := CreateScimToken(app, organizationID, "test")
+	if err != nil {
+		t.Fatalf("CreateScimToken failed: %v", err)
+	}
+
+	return &scimTestClient{t: t, server: server, token: token}
+}
+
+// do sends a SCIM request and decodes the response into out, returning the status code.
+func (c *scimTestClient) do(method, path string, body any, out any) int {
+	c.t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			c.t.Fatalf("Failed to encode request: %v", err)
+		}
+	}
+
+	req, err := http.NewRequest(method, c.server.URL+"/scim/v2"+path, &payload)
+	if err != nil {
+		c.t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", scimContentType)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer res.Body.Close()
+
+	if out != nil && res.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			c.t.Fatalf("Failed to decode %s %s response: %v", method, path, err)
+		}
+	}
+	return res.StatusCode
+}
+
+// bindTestOnboarding assigns onboarded users to the courses assigned to everyone,
+// like the course hooks do.
+func bindTestOnboarding(app *tests.TestApp) {
+	Events(app).OnUserOnboarded.BindFunc(func(e *UserOnboardedEvent) error {
+		if err := NewCourseService(e.App).AssignUserToAllEveryCourses(e.User.Id); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+}
+
+func TestParseScimPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected scimPath
+	}{
+		{"active", scimPath{Attribute: "active"}},
+		{"name.givenName", scimPath{Attribute: "name", SubAttribute: "givenName"}},
+		{`members[value eq "u1"]`, scimPath{Attribute: "members", FilterAttr: "value", FilterValue: "u1"}},
+		{`emails[type eq "work"].value`, scimPath{Attribute: "emails", FilterAttr: "type", FilterValue: "work", SubAttribute: "value"}},
+		{"urn:ietf:params:scim:schemas:core:2.0:User:userName", scimPath{Attribute: "userName"}},
+		{scimEnterpriseUserSchema + ":department", scimPath{Attribute: scimEnterpriseUserSchema, SubAttribute: "department"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p, err := parseScimPath(tt.path)
+			if err != nil {
+				t.Fatalf("parseScimPath failed: %v", err)
+			}
+			if p != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, p)
+			}
+		})
+	}
+
+	if _, _, err := parseScimFilter(`userName sw "j"`); err != ErrScimInvalidFilter {
+		t.Errorf("Expected ErrScimInvalidFilter, got %v", err)
+	}
+}
+
+func TestApplyScimPatch(t *testing.T) {
+	resource := map[string]any{
+		"displayName": "Sales",
+		"active":      true,
+		"members":     []any{map[string]any{"value": "u1"}, map[string]any{"value": "u2"}},
+	}
+
+	operations := []ScimPatchOperation{
+		{Op: "Add", Path: "members", Value: json.RawMessage(`[{"value":"u2"},{"value":"u3"}]`)},
+		{Op: "Remove", Path: `members[value eq "u1"]`},
+		{Op: "Replace", Value: json.RawMessage(`{"active":"False","name.givenName":"Jane"}`)},
+	}
+
+	if err := applyScimPatch(resource, operations); err != nil {
+		t.Fatalf("applyScimPatch failed: %v", err)
+	}
+
+	members := []string{}
+	for _, member := range resource["members"].([]any) {
+		members = append(members, member.(map[string]any)["value"].(string))
+	}
+	if !slices.Equal(members, []string{"u2", "u3"}) {
+		t.Errorf("Expected members [u2 u3], got %v", members)
+	}
+
+	if resource["active"] != false {
+		t.Errorf("Expected active to be false, got %v", resource["active"])
+	}
+
+	if name, _ := resource["name"].(map[string]any); name["givenName"] != "Jane" {
+		t.Errorf("Expected name.givenName Jane, got %v", resource["name"])
+	}
+}
+
+func TestScimProvisioning(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	bindTestOnboarding(app)
+
+	everyone := createTestCourse(t, app, courses, "")
+	everyone.Set("assign_to_everyone", true)
+	everyone.Set("organization", testOrg1)
+	if err := app.Save(everyone); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+	groupCourse := createTestCourse(t, app, courses, "")
+	groupCourse.Set("organization", testOrg1)
+	if err := app.Save(groupCourse); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+
+	client := newScimTestClient(t, app, testOrg1)
+
+	// the provisioning token is required
+	anonymous := *client
+	anonymous.token = ""
+	if status := anonymous.do(http.MethodGet, "/Users", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", status)
+	}
+
+	created := ScimUser{}
+	status := client.do(http.MethodPost, "/Users", map[string]any{
+		"schemas":    []string{scimUserSchema},
+		"userName":   "Jane@Example.com",
+		"externalId": "idp-jane",
+		"name":       map[string]any{"givenName": "Jane", "familyName": "Doe"},
+		"active":     true,
+	}, &created)
+	if status != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	if created.UserName != "jane@example.com" || created.DisplayName != "Jane Doe" || created.ExternalId != "idp-jane" {
+		t.Errorf("Unexpected provisioned user %+v", created)
+	}
+
+	if status := client.do(http.MethodPost, "/Users", map[string]any{"userName": "jane@example.com"}, nil); status != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicated userName, got %d", status)
+	}
+
+	user, err := app.FindRecordById("users", created.Id)
+	if err != nil {
+		t.Fatalf("Failed to find provisioned user: %v", err)
+	}
+	if user.GetString("organization") != testOrg1 {
+		t.Errorf("Expected the user to join org1, got %q", user.GetString("organization"))
+	}
+
+	everyone, err = app.FindRecordById("courses", everyone.Id)
+	if err != nil {
+		t.Fatalf("Failed to reload course: %v", err)
+	}
+	if !slices.Contains(everyone.GetStringSlice("assignees"), user.Id) {
+		t.Errorf("Expected the provisioned user to be assigned to the everyone course")
+	}
+
+	list := scimListResponse{}
+	if status := client.do(http.MethodGet, `/Users?filter=userName%20eq%20%22JANE@example.com%22`, nil, &list); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if list.TotalResults != 1 {
+		t.Errorf("Expected 1 user, got %d", list.TotalResults)
+	}
+
+	group := ScimGroup{}
+	status = client.do(http.MethodPost, "/Groups", map[string]any{
+		"schemas":     []string{scimGroupSchema},
+		"displayName": "Sales",
+	}, &group)
+	if status != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+
+	groupRecord, err := app.FindRecordById("groups", group.Id)
+	if err != nil {
+		t.Fatalf("Failed to find group: %v", err)
+	}
+	groupRecord.Set("courses", []string{groupCourse.Id})
+	if err := app.Save(groupRecord); err != nil {
+		t.Fatalf("Failed to save group: %v", err)
+	}
+
+	status = client.do(http.MethodPatch, "/Groups/"+group.Id, map[string]any{
+		"schemas":    []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+		"Operations": []map[string]any{{"op": "add", "path": "members", "value": []map[string]any{{"value": user.Id}}}},
+	}, &group)
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if len(group.Members) != 1 || group.Members[0].Value != user.Id {
+		t.Errorf("Expected %s to be the only member, got %+v", user.Id, group.Members)
+	}
+
+	groupCourse, err = app.FindRecordById("courses", groupCourse.Id)
+	if err != nil {
+		t.Fatalf("Failed to reload course: %v", err)
+	}
+	if !slices.Contains(groupCourse.GetStringSlice("assignees"), user.Id) {
+		t.Errorf("Expected the group member to be assigned to the group course")
+	}
+
+	// deactivation
+	patched := ScimUser{}
+	status = client.do(http.MethodPatch, "/Users/"+user.Id, map[string]any{
+		"schemas":    []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+		"Operations": []map[string]any{{"op": "replace", "path": "active", "value": false}},
+	}, &patched)
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if patched.Active == nil || *patched.Active {
+		t.Errorf("Expected the user to be deactivated")
+	}
+	if len(patched.Groups) != 1 || patched.Groups[0].Display != "Sales" {
+		t.Errorf("Expected the user to be in the Sales group, got %+v", patched.Groups)
+	}
+
+	// the users of other organizations are invisible to the token
+	other := newScimTestClient(t, app, testOrg2)
+	if status := other.do(http.MethodGet, "/Users/"+user.Id, nil, nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for another organization, got %d", status)
+	}
+
+	if status := client.do(http.MethodDelete, "/Users/"+user.Id, nil, nil); status != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", status)
+	}
+	if _, err := app.FindRecordById("users", user.Id); err == nil {
+		t.Errorf("Expected the deprovisioned user to be deleted")
+	}
+
+	progressRecords, err := app.FindAllRecords("progress")
+	if err != nil {
+		t.Fatalf("Failed to find progress records: %v", err)
+	}
+	if len(progressRecords) != 0 {
+		t.Errorf("Expected the progress of the deprovisioned user to be deleted, got %d records", len(progressRecords))
+	}
+}
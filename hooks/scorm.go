@@ -0,0 +1,623 @@
+package hooks
+
+import (
+	"archive/zip"
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// SCORM versions of the lesson packages.
+const (
+	ScormVersion12   = "1.2"
+	ScormVersion2004 = "2004"
+)
+
+const (
+	scormManifestName = "imsmanifest.xml"
+	// limits of the extracted package, the zip itself is limited by the file field
+	scormMaxFiles = 10000
+	scormMaxSize  = 2 << 30
+	// SCO files are served with a session token in their path since the
+	// browser can't add the auth header to the requests of the SCO frame
+	scormSessionTTL       = 12 * time.Hour
+	scormSessionsStoreKey = "elesson.scormSessions"
+)
+
+// packageSandbox isolates the package pages in an opaque origin, so that
+// their scripts can't use the session of the app.
+const packageSandbox = "sandbox allow-scripts allow-forms"
+
+// scormAPIScript is the runtime API installed in the SCO pages.
+//
+//go:embed scorm_api.js
+var scormAPIScript string
+
+var htmlHeadTag = regexp.MustCompile(`(?i)<head(\s[^>]*)?>`)
+
+var (
+	ErrScormInvalidPackage = errors.New("invalid SCORM package")
+	ErrScormInvalidData    = errors.New("invalid SCORM data")
+)
+
+// scormManifest is the part of imsmanifest.xml needed to launch a package.
+// Element and attribute names are matched regardless of their namespace,
+// which covers the adlcp attributes of both SCORM 1.2 and 2004.
+type scormManifest struct {
+	SchemaVersion string `xml:"metadata>schemaversion"`
+	Organizations struct {
+		Default       string              `xml:"default,attr"`
+		Organizations []scormOrganization `xml:"organization"`
+	} `xml:"organizations"`
+	Resources struct {
+		Base      string          `xml:"base,attr"`
+		Resources []scormResource `xml:"resource"`
+	} `xml:"resources"`
+}
+
+type scormOrganization struct {
+	Identifier string      `xml:"identifier,attr"`
+	Title      string      `xml:"title"`
+	Items      []scormItem `xml:"item"`
+}
+
+type scormItem struct {
+	IdentifierRef string      `xml:"identifierref,attr"`
+	Parameters    string      `xml:"parameters,attr"`
+	Items         []scormItem `xml:"item"`
+}
+
+type scormResource struct {
+	Identifier   string `xml:"identifier,attr"`
+	Href         string `xml:"href,attr"`
+	Base         string `xml:"base,attr"`
+	ScormType    string `xml:"scormType,attr"` // SCORM 2004
+	ScormTypeV12 string `xml:"scormtype,attr"` // SCORM 1.2
+}
+
+// ScormPackage is a validated SCORM package.
+type ScormPackage struct {
+	Version string
+	Title   string
+	// Entry is the launch URL of the first SCO, relative to the package root.
+	Entry string
+
+	files []*zip.File
+}
+
+func scormInvalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrScormInvalidPackage, fmt.Sprintf(format, args...))
+}
+
+// packageFilePath cleans the path of a package file, rejecting the paths
+// escaping the package root.
+func packageFilePath(name string) (string, bool) {
+	if name == "" || strings.Contains(name, "\\") || path.IsAbs(name) {
+		return "", false
+	}
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", false
+	}
+	return cleaned, true
+}
+
+// packageArchiveFiles returns the files of a package zip, checking their
+// paths and the limits of the extracted package.
+func packageArchiveFiles(r io.ReaderAt, size int64, maxSize uint64) ([]*zip.File, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.New("not a zip archive")
+	}
+
+	if len(archive.File) > scormMaxFiles {
+		return nil, fmt.Errorf("more than %d files", scormMaxFiles)
+	}
+
+	files := []*zip.File{}
+	var totalSize uint64
+
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		if _, ok := packageFilePath(file.Name); !ok {
+			return nil, fmt.Errorf("invalid file path %q", file.Name)
+		}
+
+		totalSize += file.UncompressedSize64
+		if totalSize > maxSize {
+			return nil, fmt.Errorf("the extracted files exceed %d bytes", maxSize)
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// ParseScormPackage validates a SCORM zip and finds its launch URL.
+//
+// Only the first SCO (or asset) of the default organization is launched,
+// multi-SCO sequencing is not supported.
+func ParseScormPackage(r io.ReaderAt, size int64) (*ScormPackage, error) {
+	files, err := packageArchiveFiles(r, size, scormMaxSize)
+	if err != nil {
+		return nil, scormInvalid("%v", err)
+	}
+
+	pkg := &ScormPackage{files: files}
+	names := map[string]bool{}
+	var manifestFile *zip.File
+
+	for _, file := range files {
+		name, _ := packageFilePath(file.Name)
+		if name == scormManifestName {
+			manifestFile = file
+		}
+		names[name] = true
+	}
+
+	if manifestFile == nil {
+		return nil, scormInvalid("missing %s at the root of the archive", scormManifestName)
+	}
+
+	manifestReader, err := manifestFile.Open()
+	if err != nil {
+		return nil, scormInvalid("unreadable %s", scormManifestName)
+	}
+	defer manifestReader.Close()
+
+	manifest := scormManifest{}
+	if err := xml.NewDecoder(io.LimitReader(manifestReader, 10<<20)).Decode(&manifest); err != nil {
+		return nil, scormInvalid("malformed %s: %v", scormManifestName, err)
+	}
+
+	pkg.Version = scormManifestVersion(manifest)
+	if pkg.Version == "" {
+		return nil, scormInvalid("unsupported schema version %q", manifest.SchemaVersion)
+	}
+
+	organizations := manifest.Organizations.Organizations
+	if len(organizations) == 0 {
+		return nil, scormInvalid("no organization")
+	}
+	organization := organizations[0]
+	for _, candidate := range organizations {
+		if candidate.Identifier == manifest.Organizations.Default {
+			organization = candidate
+			break
+		}
+	}
+	pkg.Title = strings.TrimSpace(organization.Title)
+
+	resources := map[string]scormResource{}
+	for _, resource := range manifest.Resources.Resources {
+		resources[resource.Identifier] = resource
+	}
+
+	item, resource, ok := scormLaunchItem(organization.Items, resources)
+	if !ok {
+		return nil, scormInvalid("no launchable item")
+	}
+
+	href, query, _ := strings.Cut(resource.Href, "?")
+	href = path.Join(manifest.Resources.Base, resource.Base, href)
+	launchPath, ok := packageFilePath(href)
+	if !ok || !names[launchPath] {
+		return nil, scormInvalid("the launch file %q is missing", href)
+	}
+
+	if parameters := strings.TrimLeft(item.Parameters, "?&"); parameters != "" {
+		query = strings.Trim(query+"&"+parameters, "&")
+	}
+	pkg.Entry = launchPath
+	if query != "" {
+		pkg.Entry += "?" + query
+	}
+
+	return pkg, nil
+}
+
+// scormManifestVersion returns the SCORM version of a manifest, guessing it
+// from the adlcp attributes when the schema version isn't declared.
+func scormManifestVersion(manifest scormManifest) string {
+	schemaVersion := strings.TrimSpace(manifest.SchemaVersion)
+	switch {
+	case schemaVersion == "1.2":
+		return ScormVersion12
+	case strings.Contains(schemaVersion, "2004") || schemaVersion == "CAM 1.3":
+		return ScormVersion2004
+	case schemaVersion != "":
+		return ""
+	}
+
+	for _, resource := range manifest.Resources.Resources {
+		if resource.ScormType != "" {
+			return ScormVersion2004
+		}
+	}
+	return ScormVersion12
+}
+
+// scormLaunchItem returns the first item (depth first) referencing a SCO,
+// falling back to the first item referencing any resource with a href.
+func scormLaunchItem(items []scormItem, resources map[string]scormResource) (scormItem, scormResource, bool) {
+	var fallback *scormItem
+	var fallbackResource scormResource
+
+	var walk func(items []scormItem) (scormItem, scormResource, bool)
+	walk = func(items []scormItem) (scormItem, scormResource, bool) {
+		for _, item := range items {
+			if resource, ok := resources[item.IdentifierRef]; ok && resource.Href != "" {
+				scormType := strings.ToLower(resource.ScormType + resource.ScormTypeV12)
+				if scormType == "sco" {
+					return item, resource, true
+				}
+				if fallback == nil {
+					fallback = &item
+					fallbackResource = resource
+				}
+			}
+			if found, resource, ok := walk(item.Items); ok {
+				return found, resource, true
+			}
+		}
+		return scormItem{}, scormResource{}, false
+	}
+
+	if item, resource, ok := walk(items); ok {
+		return item, resource, true
+	}
+	if fallback != nil {
+		return *fallback, fallbackResource, true
+	}
+	return scormItem{}, scormResource{}, false
+}
+
+// parsePackageFile parses an uploaded package file.
+func parsePackageFile[T any](file *filesystem.File, parse func(io.ReaderAt, int64) (T, error)) (T, error) {
+	var zero T
+
+	reader, err := file.Reader.Open()
+	if err != nil {
+		return zero, fmt.Errorf("failed to open the package: %w", err)
+	}
+	defer reader.Close()
+
+	readerAt, ok := reader.(io.ReaderAt)
+	if !ok {
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			return zero, fmt.Errorf("failed to read the package: %w", err)
+		}
+		readerAt = bytes.NewReader(content)
+	}
+
+	return parse(readerAt, file.Size)
+}
+
+// scormFilesPath returns the storage dir of the files extracted from the
+// current package of a lesson (next to the package, like the thumbs of images).
+func scormFilesPath(lesson *core.Record, packageName string) string {
+	return lesson.BaseFilesPath() + "/scorm_" + packageName
+}
+
+// extractScormPackage uploads the files of a package to the storage dir of the lesson.
+func extractScormPackage(app core.App, lesson *core.Record, pkg *ScormPackage) error {
+	return extractPackageFiles(app, scormFilesPath(lesson, lesson.GetString("scorm_package")), pkg.files)
+}
+
+// extractPackageFiles uploads the files of a package zip to a storage dir.
+func extractPackageFiles(app core.App, dir string, files []*zip.File) error {
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return err
+	}
+	defer fsys.Close()
+
+	for _, file := range files {
+		name, _ := packageFilePath(file.Name)
+
+		reader, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", name, err)
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		if err := fsys.Upload(content, dir+"/"+name); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// deletePackageFiles deletes the files extracted from a previous package of a lesson.
+func deletePackageFiles(app core.App, lesson *core.Record, dir string) {
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		app.Logger().Warn("Failed to delete package files", "lesson", lesson.Id, "error", err)
+		return
+	}
+	defer fsys.Close()
+
+	if errs := fsys.DeletePrefix(dir + "/"); len(errs) > 0 {
+		app.Logger().Warn("Failed to delete package files", "lesson", lesson.Id, "errors", errs)
+	}
+}
+
+// servePackageFile serves a file extracted from a lesson package, with head
+// inserted at the start of the HTML pages.
+func servePackageFile(e *core.RequestEvent, dir, name, head string) error {
+	fsys, err := e.App.NewFilesystem()
+	if err != nil {
+		return e.InternalServerError("", err)
+	}
+	defer fsys.Close()
+
+	key := dir + "/" + name
+	if exists, err := fsys.Exists(key); err != nil || !exists {
+		return e.NotFoundError("", err)
+	}
+
+	// the package contents are regular web pages that must run in the lesson
+	// frame, but in a sandbox without access to the app origin
+	header := e.Response.Header()
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("Content-Disposition", "inline")
+	header.Set("Content-Security-Policy", packageSandbox+"; frame-ancestors 'self'")
+	header.Set("Cache-Control", "private, max-age=3600")
+
+	if head == "" || !strings.HasPrefix(contentType, "text/html") {
+		return fsys.Serve(e.Response, e.Request, key, path.Base(name))
+	}
+
+	r, err := fsys.GetReader(key)
+	if err != nil {
+		return e.InternalServerError("", err)
+	}
+	defer r.Close()
+
+	page, err := io.ReadAll(r)
+	if err != nil {
+		return e.InternalServerError("", err)
+	}
+
+	// the page depends on the session values
+	header.Set("Cache-Control", "no-store")
+	return e.Blob(http.StatusOK, contentType, injectHTMLHead(page, head))
+}
+
+// injectHTMLHead inserts head right after the head tag of page, or at its
+// start if it has none, so that it runs before the scripts of the page.
+func injectHTMLHead(page []byte, head string) []byte {
+	at := 0
+	if loc := htmlHeadTag.FindIndex(page); loc != nil {
+		at = loc[1]
+	}
+	return slices.Concat(page[:at], []byte(head), page[at:])
+}
+
+// scormSession is a launched SCO, identified by the token in its files path.
+type scormSession struct {
+	LessonID string
+	UserID   string
+	Version  string
+	CMI      map[string]string
+}
+
+// scormAPIHead returns the script installing the runtime API of session in a SCO page.
+func scormAPIHead(session scormSession) (string, error) {
+	launch, err := json.Marshal(map[string]any{"version": session.Version, "cmi": session.CMI})
+	if err != nil {
+		return "", err
+	}
+	return "<script>window.elessonScorm = " + string(launch) + ";\n" + scormAPIScript + "</script>", nil
+}
+
+// scormContentURL returns the URL of a lesson package file within a session.
+func scormContentURL(lessonID, token, name string) string {
+	return "/api/scorm/" + lessonID + "/content/" + token + "/" + name
+}
+
+func initScormHooks(app core.App) {
+	// validate uploaded packages, then extract them once the lesson is saved
+	prepareScormLesson := func(e *core.RecordEvent) error {
+		// the stored lesson, the original of a record saved more than once is outdated
+		stored := e.Record.Original()
+		if !e.Record.IsNew() {
+			if latest, err := e.App.FindRecordById(e.Record.Collection(), e.Record.Id); err == nil {
+				stored = latest
+			}
+		}
+		oldPackage := stored.GetString("scorm_package")
+
+		var pkg *ScormPackage
+		if files := e.Record.GetUnsavedFiles("scorm_package"); len(files) > 0 {
+			var err error
+			pkg, err = parsePackageFile(files[0], ParseScormPackage)
+			if errors.Is(err, ErrScormInvalidPackage) {
+				return validation.Errors{
+					"scorm_package": validation.NewError("validation_invalid_scorm_package", err.Error()),
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			e.Record.Set("scorm_version", pkg.Version)
+			e.Record.Set("scorm_entry", pkg.Entry)
+		} else if e.Record.GetString("scorm_package") == "" {
+			e.Record.Set("scorm_version", "")
+			e.Record.Set("scorm_entry", "")
+		} else {
+			// the launch settings always come from the package
+			e.Record.Set("scorm_version", stored.GetString("scorm_version"))
+			e.Record.Set("scorm_entry", stored.GetString("scorm_entry"))
+		}
+
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		if pkg != nil {
+			if err := extractScormPackage(e.App, e.Record, pkg); err != nil {
+				return fmt.Errorf("failed to extract the SCORM package: %w", err)
+			}
+		}
+
+		if oldPackage != "" && oldPackage != e.Record.GetString("scorm_package") {
+			deletePackageFiles(e.App, e.Record, scormFilesPath(e.Record, oldPackage))
+		}
+
+		return nil
+	}
+
+	app.OnRecordCreate("lessons").BindFunc(prepareScormLesson)
+	app.OnRecordUpdate("lessons").BindFunc(prepareScormLesson)
+}
+
+func bindScormRoutes(r *router.Router[*core.RequestEvent], courseService *CourseService) {
+	// start a SCO session, tracked for the course assignees and a preview for its managers
+	r.POST("/api/scorm/{lesson}/launch", func(e *core.RequestEvent) error {
+		lesson, course, assigned, err := lessonPackageAccess(e, "scorm_entry")
+		if err != nil {
+			return err
+		}
+
+		launch, err := courseService.WithActor(e.Auth.Id).LaunchScormLesson(lesson, course, e.Auth, !assigned)
+		if err != nil {
+			return e.InternalServerError("Failed to launch the SCORM lesson.", err)
+		}
+
+		token := security.RandomString(32)
+		appExpiringStore(e.App, scormSessionsStoreKey).set(token, scormSession{
+			LessonID: lesson.Id,
+			UserID:   e.Auth.Id,
+			Version:  launch.Version,
+			CMI:      launch.CMI,
+		}, time.Now().Add(scormSessionTTL))
+
+		launch.URL = scormContentURL(lesson.Id, token, lesson.GetString("scorm_entry"))
+		launch.Session = token
+
+		return e.JSON(http.StatusOK, launch)
+	}).Bind(apis.RequireAuth())
+
+	// persist the CMI data set by the SCO through the runtime API
+	r.POST("/api/scorm/{lesson}/commit", func(e *core.RequestEvent) error {
+		data := struct {
+			CMI     map[string]string `json:"cmi"`
+			Session string            `json:"session"`
+		}{}
+		if err := e.BindBody(&data); err != nil {
+			return e.BadRequestError("Failed to read request data.", err)
+		}
+
+		lesson, _, assigned, err := lessonPackageAccess(e, "scorm_entry")
+		if err != nil {
+			return err
+		}
+
+		// previews are not tracked
+		commit := &ScormCommit{}
+		if assigned {
+			commit, err = courseService.WithActor(e.Auth.Id).CommitScormData(lesson.Id, e.Auth.Id, data.CMI)
+			if errors.Is(err, ErrScormInvalidData) {
+				return e.BadRequestError(err.Error(), nil)
+			}
+			if err != nil {
+				return e.InternalServerError("Failed to save the SCORM data.", err)
+			}
+		}
+
+		// the next pages of the SCO start from the committed values
+		sessions := appExpiringStore(e.App, scormSessionsStoreKey)
+		if value, ok := sessions.get(data.Session); ok {
+			session := value.(scormSession)
+			if session.LessonID == lesson.Id && session.UserID == e.Auth.Id {
+				session.CMI = maps.Clone(session.CMI)
+				maps.Copy(session.CMI, data.CMI)
+				sessions.set(data.Session, session, time.Now().Add(scormSessionTTL))
+			}
+		}
+
+		return e.JSON(http.StatusOK, commit)
+	}).Bind(apis.RequireAuth())
+
+	// serve the extracted package files to a launched SCO
+	r.GET("/api/scorm/{lesson}/content/{token}/{path...}", func(e *core.RequestEvent) error {
+		session, ok := appExpiringStore(e.App, scormSessionsStoreKey).get(e.Request.PathValue("token"))
+		if !ok || session.(scormSession).LessonID != e.Request.PathValue("lesson") {
+			return e.NotFoundError("", nil)
+		}
+
+		name, ok := packageFilePath(e.Request.PathValue("path"))
+		if !ok {
+			return e.NotFoundError("", nil)
+		}
+
+		lesson, err := e.App.FindRecordById("lessons", session.(scormSession).LessonID)
+		if err != nil || lesson.GetString("scorm_package") == "" {
+			return e.NotFoundError("", err)
+		}
+
+		head, err := scormAPIHead(session.(scormSession))
+		if err != nil {
+			return e.InternalServerError("", err)
+		}
+
+		return servePackageFile(e, scormFilesPath(lesson, lesson.GetString("scorm_package")), name, head)
+	})
+}
+
+// lessonPackageAccess finds the lesson of the request, which must have the
+// given package field set, and its course, reporting whether the user is
+// assigned to it (the managers of the course can only preview it).
+func lessonPackageAccess(e *core.RequestEvent, field string) (lesson, course *core.Record, assigned bool, err error) {
+	lesson, err = e.App.FindRecordById("lessons", e.Request.PathValue("lesson"))
+	if err != nil || lesson.GetString(field) == "" {
+		return nil, nil, false, e.NotFoundError("", err)
+	}
+
+	course, err = e.App.FindRecordById("courses", lesson.GetString("course"))
+	if err != nil {
+		return nil, nil, false, e.NotFoundError("", err)
+	}
+
+	assigned = slices.Contains(course.GetStringSlice("assignees"), e.Auth.Id) &&
+		course.GetString("organization") == e.Auth.GetString("organization")
+	if !assigned && !CanManageCourse(e.Auth, course) {
+		return nil, nil, false, e.NotFoundError("", nil)
+	}
+
+	return lesson, course, assigned, nil
+}
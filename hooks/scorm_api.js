@@ -0,0 +1,259 @@
+// SCORM runtime API of the SCO frames, installed as window.API for SCORM 1.2
+// and window.API_1484_11 for SCORM 2004. The package pages run sandboxed in an
+// opaque origin, so they can't reach an API of the lesson page: each page gets
+// this script with the values of its session, keeps them in memory and posts
+// the changed ones to the lesson page, which commits them to the backend.
+(function (launch) {
+  const dataModels = {
+    "1.2": {
+      global: "API",
+      methods: {
+        Initialize: "LMSInitialize",
+        Terminate: "LMSFinish",
+        GetValue: "LMSGetValue",
+        SetValue: "LMSSetValue",
+        Commit: "LMSCommit",
+        GetLastError: "LMSGetLastError",
+        GetErrorString: "LMSGetErrorString",
+        GetDiagnostic: "LMSGetDiagnostic",
+      },
+      readOnly: [
+        "cmi.core.student_id",
+        "cmi.core.student_name",
+        "cmi.core.credit",
+        "cmi.core.entry",
+        "cmi.core.total_time",
+        "cmi.core.lesson_mode",
+        "cmi.launch_data",
+        "cmi.comments_from_lms",
+      ],
+      writeOnly: ["cmi.core.exit", "cmi.core.session_time"],
+      vocabularies: {
+        "cmi.core.lesson_status": [
+          "passed",
+          "completed",
+          "failed",
+          "incomplete",
+          "browsed",
+        ],
+        "cmi.core.exit": ["", "time-out", "suspend", "logout"],
+      },
+      children: {
+        "cmi.core._children":
+          "student_id,student_name,lesson_location,credit,lesson_status,entry,score,total_time,lesson_mode,exit,session_time",
+        "cmi.core.score._children": "raw,min,max",
+        "cmi.objectives._children": "id,score,status",
+        "cmi.student_preference._children": "audio,language,speed,text",
+        "cmi.interactions._children":
+          "id,objectives,time,type,correct_responses,weighting,student_response,result,latency",
+      },
+      errors: {
+        general: 101,
+        notInitialized: 301,
+        notImplemented: 401,
+        readOnly: 403,
+        writeOnly: 404,
+        invalidValue: 405,
+      },
+      errorStrings: {
+        0: "No error",
+        101: "General exception",
+        301: "Not initialized",
+        401: "Not implemented error",
+        403: "Element is read only",
+        404: "Element is write only",
+        405: "Incorrect data type",
+      },
+    },
+    "2004": {
+      global: "API_1484_11",
+      methods: {
+        Initialize: "Initialize",
+        Terminate: "Terminate",
+        GetValue: "GetValue",
+        SetValue: "SetValue",
+        Commit: "Commit",
+        GetLastError: "GetLastError",
+        GetErrorString: "GetErrorString",
+        GetDiagnostic: "GetDiagnostic",
+      },
+      readOnly: [
+        "cmi.learner_id",
+        "cmi.learner_name",
+        "cmi.credit",
+        "cmi.entry",
+        "cmi.total_time",
+        "cmi.mode",
+        "cmi.launch_data",
+        "cmi.completion_threshold",
+        "cmi.scaled_passing_score",
+        "cmi.max_time_allowed",
+        "cmi.time_limit_action",
+      ],
+      writeOnly: ["cmi.exit", "cmi.session_time"],
+      vocabularies: {
+        "cmi.completion_status": [
+          "completed",
+          "incomplete",
+          "not attempted",
+          "unknown",
+        ],
+        "cmi.success_status": ["passed", "failed", "unknown"],
+        "cmi.exit": ["", "time-out", "suspend", "logout", "normal"],
+      },
+      children: {
+        "cmi.score._children": "scaled,raw,min,max",
+        "cmi.objectives._children":
+          "id,score,success_status,completion_status,progress_measure,description",
+        "cmi.learner_preference._children":
+          "audio_level,language,delivery_speed,audio_captioning",
+        "cmi.interactions._children":
+          "id,type,objectives,timestamp,correct_responses,weighting,learner_response,result,latency,description",
+        "cmi.comments_from_learner._children": "comment,location,timestamp",
+      },
+      errors: {
+        general: 101,
+        notInitialized: 122,
+        terminated: 123,
+        notImplemented: 401,
+        readOnly: 404,
+        writeOnly: 405,
+        invalidValue: 406,
+      },
+      errorStrings: {
+        0: "No error",
+        101: "General exception",
+        122: "Retrieve data before initialization",
+        123: "Retrieve data after termination",
+        401: "Undefined data model element",
+        404: "Data model element is read only",
+        405: "Data model element is write only",
+        406: "Data model element type mismatch",
+      },
+    },
+  };
+
+  const model = dataModels[launch.version];
+  const values = { ...launch.cmi };
+  let state = "new";
+  let lastError = 0;
+
+  const post = (message) => window.parent.postMessage({ elessonScorm: message }, "*");
+
+  const fail = (error, result) => {
+    lastError = model.errors[error];
+    return result;
+  };
+
+  const api = {
+    Initialize() {
+      if (state !== "new") {
+        return fail("general", "false");
+      }
+      state = "running";
+      lastError = 0;
+      return "true";
+    },
+    Terminate() {
+      if (state !== "running") {
+        return fail("notInitialized", "false");
+      }
+      post({ type: "commit", keepalive: true });
+      state = "terminated";
+      lastError = 0;
+      return "true";
+    },
+    GetValue(element) {
+      if (state !== "running") {
+        return fail(
+          state === "terminated" && model.errors.terminated
+            ? "terminated"
+            : "notInitialized",
+          "",
+        );
+      }
+      lastError = 0;
+      if (model.writeOnly.includes(element)) {
+        return fail("writeOnly", "");
+      }
+      if (element.endsWith("._children")) {
+        return model.children[element] ?? fail("notImplemented", "");
+      }
+      if (element.endsWith("._count")) {
+        const prefix = element.slice(0, -"_count".length);
+        const indexes = Object.keys(values)
+          .filter((key) => key.startsWith(prefix))
+          .map((key) => parseInt(key.slice(prefix.length), 10));
+        return String(indexes.length ? Math.max(...indexes) + 1 : 0);
+      }
+      return values[element] ?? "";
+    },
+    SetValue(element, value) {
+      if (state !== "running") {
+        return fail("notInitialized", "false");
+      }
+      lastError = 0;
+      if (
+        model.readOnly.includes(element) ||
+        element.endsWith("._children") ||
+        element.endsWith("._count")
+      ) {
+        return fail("readOnly", "false");
+      }
+      value = String(value);
+      const vocabulary = model.vocabularies[element];
+      if (vocabulary && !vocabulary.includes(value)) {
+        return fail("invalidValue", "false");
+      }
+      values[element] = value;
+      post({ type: "set", element, value });
+      return "true";
+    },
+    Commit() {
+      if (state !== "running") {
+        return fail("notInitialized", "false");
+      }
+      lastError = 0;
+      post({ type: "commit" });
+      return "true";
+    },
+    GetLastError() {
+      return String(lastError);
+    },
+    GetErrorString(code) {
+      return model.errorStrings[code] ?? "";
+    },
+    GetDiagnostic(code) {
+      return model.errorStrings[code || lastError] ?? "";
+    },
+  };
+
+  // relay the messages of the nested package frames up to the lesson page,
+  // which reports the commits that failed back down
+  window.addEventListener("message", (event) => {
+    const message = event.data?.elessonScorm;
+    if (!message) {
+      return;
+    }
+    if (event.source !== window.parent) {
+      post(message);
+    } else if (message.type === "error") {
+      lastError = model.errors.general;
+      for (let i = 0; i < window.frames.length; i++) {
+        window.frames[i].postMessage(event.data, "*");
+      }
+    }
+  });
+
+  // send the changes before moving to another page of the package
+  window.addEventListener("pagehide", () => {
+    post({ type: "commit", keepalive: true });
+  });
+
+  // expose the methods under the names of the SCORM version
+  const scormAPI = {};
+  for (const [method, name] of Object.entries(model.methods)) {
+    scormAPI[name] = (...args) => api[method](...args);
+  }
+  window[model.global] = scormAPI;
+})(window.elessonScorm);
@@ -0,0 +1,647 @@
+package hooks
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// scormMaxDataSize limits the serialized CMI data of a learner and lesson.
+const scormMaxDataSize = 1000000
+
+// ScormLaunch is the runtime state handed to the SCORM API of a launched SCO.
+type ScormLaunch struct {
+	URL     string            `json:"url"`
+	Session string            `json:"session"`
+	Version string            `json:"version"`
+	Preview bool              `json:"preview"`
+	CMI     map[string]string `json:"cmi"`
+}
+
+// ScormCommit is the outcome of persisting the CMI data of a SCO.
+type ScormCommit struct {
+	LessonCompleted bool   `json:"lesson_completed"`
+	CourseStatus    string `json:"course_status,omitempty"`
+}
+
+// scormElement is a CMI data model element the SCO can set.
+type scormElement struct {
+	pattern *regexp.Regexp
+	valid   func(value string) bool
+}
+
+func scormWritable(pattern string, valid func(value string) bool) scormElement {
+	return scormElement{pattern: regexp.MustCompile(`^` + pattern + `$`), valid: valid}
+}
+
+func scormVocabulary(values ...string) func(string) bool {
+	return func(value string) bool {
+		for _, allowed := range values {
+			if value == allowed {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func scormMaxLength(max int) func(string) bool {
+	return func(value string) bool {
+		return utf8.RuneCountInString(value) <= max
+	}
+}
+
+func scormDecimal(min, max float64) func(string) bool {
+	return func(value string) bool {
+		if value == "" {
+			return true
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		return err == nil && number >= min && number <= max
+	}
+}
+
+var (
+	scorm12Timespan   = regexp.MustCompile(`^(\d{2,4}):([0-5]\d):([0-5]\d(?:\.\d{1,2})?)$`)
+	scorm2004Duration = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(\d+(?:\.\d{1,2})?S)?)?$`)
+)
+
+// parseScormTimespan parses a SCORM 1.2 timespan (HHHH:MM:SS.SS) or a
+// SCORM 2004 ISO 8601 duration (years and months count as 365 and 30 days).
+func parseScormTimespan(version, value string) (time.Duration, bool) {
+	if version == ScormVersion12 {
+		parts := scorm12Timespan.FindStringSubmatch(value)
+		if parts == nil {
+			return 0, false
+		}
+		hours, _ := strconv.Atoi(parts[1])
+		minutes, _ := strconv.Atoi(parts[2])
+		seconds, _ := strconv.ParseFloat(parts[3], 64)
+		return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second)), true
+	}
+
+	parts := scorm2004Duration.FindStringSubmatch(value)
+	if parts == nil || value == "P" || value[len(value)-1] == 'T' {
+		return 0, false
+	}
+	units := []time.Duration{365 * 24 * time.Hour, 30 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute}
+	var duration time.Duration
+	for i, unit := range units {
+		if count, err := strconv.Atoi(parts[i+1]); err == nil {
+			duration += time.Duration(count) * unit
+		}
+	}
+	if parts[6] != "" {
+		seconds, _ := strconv.ParseFloat(parts[6][:len(parts[6])-1], 64)
+		duration += time.Duration(seconds * float64(time.Second))
+	}
+	return duration, true
+}
+
+// formatScormTimespan formats a duration in the timespan format of the SCORM version.
+func formatScormTimespan(version string, duration time.Duration) string {
+	duration = duration.Round(10 * time.Millisecond)
+	hours := int64(duration / time.Hour)
+	minutes := int64(duration % time.Hour / time.Minute)
+	seconds := float64(duration%time.Minute) / float64(time.Second)
+
+	if version == ScormVersion12 {
+		return fmt.Sprintf("%04d:%02d:%05.2f", min(hours, 9999), minutes, seconds)
+	}
+	return fmt.Sprintf("PT%dH%dM%sS", hours, minutes, strconv.FormatFloat(seconds, 'f', -1, 64))
+}
+
+func scormTimespan(version string) func(string) bool {
+	return func(value string) bool {
+		_, ok := parseScormTimespan(version, value)
+		return ok
+	}
+}
+
+// scormDataModel names the CMI elements of a SCORM version that eLesson
+// maintains or reads, and lists the elements SCOs can set.
+type scormDataModel struct {
+	version                                           string
+	learnerID, learnerName, mode, credit, entry, exit string
+	sessionTime, totalTime                            string
+	completionStatus, successStatus                   string
+	scoreRaw, scoreMin, scoreMax, scoreScaled         string
+	suspendData                                       string
+	learnerResponse                                   string
+	writable                                          []scormElement
+}
+
+var scormDataModels = map[string]scormDataModel{
+	ScormVersion12: {
+		version:          ScormVersion12,
+		learnerID:        "cmi.core.student_id",
+		learnerName:      "cmi.core.student_name",
+		mode:             "cmi.core.lesson_mode",
+		credit:           "cmi.core.credit",
+		entry:            "cmi.core.entry",
+		exit:             "cmi.core.exit",
+		sessionTime:      "cmi.core.session_time",
+		totalTime:        "cmi.core.total_time",
+		completionStatus: "cmi.core.lesson_status",
+		scoreRaw:         "cmi.core.score.raw",
+		scoreMin:         "cmi.core.score.min",
+		scoreMax:         "cmi.core.score.max",
+		suspendData:      "cmi.suspend_data",
+		learnerResponse:  "student_response",
+		writable: []scormElement{
+			scormWritable(`cmi\.core\.lesson_status`, scormVocabulary("passed", "completed", "failed", "incomplete", "browsed")),
+			scormWritable(`cmi\.core\.lesson_location`, scormMaxLength(255)),
+			scormWritable(`cmi\.core\.score\.(raw|min|max)`, scormDecimal(0, 100)),
+			scormWritable(`cmi\.core\.exit`, scormVocabulary("", "time-out", "suspend", "logout")),
+			scormWritable(`cmi\.core\.session_time`, scormTimespan(ScormVersion12)),
+			scormWritable(`cmi\.suspend_data`, scormMaxLength(4096)),
+			scormWritable(`cmi\.comments`, scormMaxLength(4096)),
+			scormWritable(`cmi\.student_preference\.(audio|language|speed|text)`, scormMaxLength(255)),
+			scormWritable(`cmi\.objectives\.\d{1,3}\.(id|score\.(raw|min|max)|status)`, scormMaxLength(255)),
+			scormWritable(`cmi\.interactions\.\d{1,3}\.(id|time|type|weighting|student_response|result|latency|objectives\.\d{1,3}\.id|correct_responses\.\d{1,3}\.pattern)`, scormMaxLength(4096)),
+		},
+	},
+	ScormVersion2004: {
+		version:          ScormVersion2004,
+		learnerID:        "cmi.learner_id",
+		learnerName:      "cmi.learner_name",
+		mode:             "cmi.mode",
+		credit:           "cmi.credit",
+		entry:            "cmi.entry",
+		exit:             "cmi.exit",
+		sessionTime:      "cmi.session_time",
+		totalTime:        "cmi.total_time",
+		completionStatus: "cmi.completion_status",
+		successStatus:    "cmi.success_status",
+		scoreRaw:         "cmi.score.raw",
+		scoreMin:         "cmi.score.min",
+		scoreMax:         "cmi.score.max",
+		scoreScaled:      "cmi.score.scaled",
+		suspendData:      "cmi.suspend_data",
+		learnerResponse:  "learner_response",
+		writable: []scormElement{
+			scormWritable(`cmi\.completion_status`, scormVocabulary("completed", "incomplete", "not attempted", "unknown")),
+			scormWritable(`cmi\.success_status`, scormVocabulary("passed", "failed", "unknown")),
+			scormWritable(`cmi\.score\.scaled`, scormDecimal(-1, 1)),
+			scormWritable(`cmi\.score\.(raw|min|max)`, scormDecimal(math.Inf(-1), math.Inf(1))),
+			scormWritable(`cmi\.progress_measure`, scormDecimal(0, 1)),
+			scormWritable(`cmi\.location`, scormMaxLength(1000)),
+			scormWritable(`cmi\.exit`, scormVocabulary("", "time-out", "suspend", "logout", "normal")),
+			scormWritable(`cmi\.session_time`, scormTimespan(ScormVersion2004)),
+			scormWritable(`cmi\.suspend_data`, scormMaxLength(64000)),
+			scormWritable(`cmi\.comments_from_learner\.\d{1,3}\.(comment|location|timestamp)`, scormMaxLength(4000)),
+			scormWritable(`cmi\.learner_preference\.(audio_level|language|delivery_speed|audio_captioning)`, scormMaxLength(250)),
+			scormWritable(`cmi\.objectives\.\d{1,3}\.(id|score\.(scaled|raw|min|max)|success_status|completion_status|progress_measure|description)`, scormMaxLength(4000)),
+			scormWritable(`cmi\.interactions\.\d{1,3}\.(id|type|timestamp|weighting|learner_response|result|latency|description|objectives\.\d{1,3}\.id|correct_responses\.\d{1,3}\.pattern)`, scormMaxLength(4000)),
+			// navigation requests are accepted but ignored, there is no sequencing
+			scormWritable(`adl\.nav\.request`, scormMaxLength(250)),
+		},
+	},
+}
+
+// validate checks the values set by a SCO.
+func (m scormDataModel) validate(values map[string]string) error {
+	for name, value := range values {
+		var element *scormElement
+		for i := range m.writable {
+			if m.writable[i].pattern.MatchString(name) {
+				element = &m.writable[i]
+				break
+			}
+		}
+
+		if element == nil {
+			return fmt.Errorf("%w: %s is not a writable element", ErrScormInvalidData, name)
+		}
+		if !element.valid(value) {
+			return fmt.Errorf("%w: invalid %s value", ErrScormInvalidData, name)
+		}
+	}
+
+	return nil
+}
+
+// completed reports whether the CMI data marks the SCO as completed (or passed).
+func (m scormDataModel) completed(cmi map[string]string) bool {
+	status := cmi[m.completionStatus]
+	if m.successStatus == "" {
+		return status == "completed" || status == "passed"
+	}
+	return status == "completed" || cmi[m.successStatus] == "passed"
+}
+
+// xapiResult returns the xAPI result of a SCO that the learner passed or
+// failed, with its score, or nil when the SCO reported no success status.
+func (m scormDataModel) xapiResult(cmi map[string]string) map[string]any {
+	status := cmi[m.completionStatus]
+	if m.successStatus != "" {
+		status = cmi[m.successStatus]
+	}
+	if status != "passed" && status != "failed" {
+		return nil
+	}
+
+	score := map[string]any{}
+	if scaled, err := strconv.ParseFloat(fmt.Sprint(scormScaledScore(m, cmi)), 64); err == nil {
+		score["scaled"] = scaled
+	}
+	if raw, err := strconv.ParseFloat(cmi[m.scoreRaw], 64); err == nil {
+		score["raw"] = raw
+
+		// xAPI rejects raw scores out of their range
+		if scoreMin, err := strconv.ParseFloat(cmi[m.scoreMin], 64); err == nil && scoreMin <= raw {
+			score["min"] = scoreMin
+		}
+		if scoreMax, err := strconv.ParseFloat(cmi[m.scoreMax], 64); err == nil && scoreMax >= raw {
+			score["max"] = scoreMax
+		}
+	}
+
+	result := map[string]any{"success": status == "passed", "completion": true}
+	if len(score) > 0 {
+		result["score"] = score
+	}
+	return result
+}
+
+// scormInteractionResult matches the result element of an interaction.
+var scormInteractionResult = regexp.MustCompile(`^cmi\.interactions\.(\d{1,3})\.result$`)
+
+// scormAnswer is an interaction of a SCO answered by the learner.
+type scormAnswer struct {
+	id, interactionType string
+	result              map[string]any
+}
+
+// xapiAnswers returns the interactions whose result the SCO set in values,
+// in the order of the interactions, with the response of the learner and
+// whether it was correct.
+func (m scormDataModel) xapiAnswers(cmi, values map[string]string) []scormAnswer {
+	indexes := []int{}
+	for name := range values {
+		if match := scormInteractionResult.FindStringSubmatch(name); match != nil {
+			index, _ := strconv.Atoi(match[1])
+			indexes = append(indexes, index)
+		}
+	}
+	slices.Sort(indexes)
+
+	answers := []scormAnswer{}
+	for _, index := range indexes {
+		prefix := "cmi.interactions." + strconv.Itoa(index) + "."
+		if cmi[prefix+"id"] == "" {
+			continue
+		}
+
+		result := map[string]any{}
+		if response, ok := cmi[prefix+m.learnerResponse]; ok {
+			result["response"] = response
+		}
+		switch cmi[prefix+"result"] {
+		case "correct":
+			result["success"] = true
+		case "wrong", "incorrect":
+			result["success"] = false
+		}
+
+		answers = append(answers, scormAnswer{id: cmi[prefix+"id"], interactionType: cmi[prefix+"type"], result: result})
+	}
+	return answers
+}
+
+// initialCMI returns the data the SCO starts from: the stored data of the
+// learner without the write-only elements, and the elements the LMS maintains.
+func (m scormDataModel) initialCMI(stored map[string]string, user *core.Record, preview bool) map[string]string {
+	cmi := maps.Clone(stored)
+	delete(cmi, m.exit)
+	delete(cmi, m.sessionTime)
+
+	learnerName := user.GetString("name")
+	if learnerName == "" {
+		learnerName = user.Email()
+	}
+	cmi[m.learnerID] = user.Id
+	cmi[m.learnerName] = learnerName
+
+	cmi[m.mode] = "normal"
+	cmi[m.credit] = "credit"
+	if preview {
+		cmi[m.mode] = "browse"
+		cmi[m.credit] = "no-credit"
+	}
+
+	switch {
+	case len(stored) == 0:
+		cmi[m.entry] = "ab-initio"
+	case stored[m.exit] == "suspend":
+		cmi[m.entry] = "resume"
+	default:
+		cmi[m.entry] = ""
+	}
+
+	if cmi[m.totalTime] == "" {
+		cmi[m.totalTime] = formatScormTimespan(m.version, 0)
+	}
+	if cmi[m.completionStatus] == "" {
+		if m.successStatus == "" {
+			cmi[m.completionStatus] = "not attempted"
+		} else {
+			cmi[m.completionStatus] = "unknown"
+			cmi[m.successStatus] = "unknown"
+		}
+	}
+
+	return cmi
+}
+
+// scormStoredCMI returns the stored CMI data of a scorm_data record.
+func scormStoredCMI(data *core.Record) map[string]string {
+	cmi := map[string]string{}
+	if data != nil {
+		_ = data.UnmarshalJSONField("cmi", &cmi)
+	}
+	return cmi
+}
+
+// findOrCreateScormData returns the scorm_data record of a learner and lesson,
+// creating it on the first launch.
+func findOrCreateScormData(app core.App, lesson *core.Record, userID string) (*core.Record, error) {
+	data, err := app.FindFirstRecordByFilter(
+		"scorm_data",
+		"lesson = {:lesson} && assignee = {:assignee}",
+		dbx.Params{"lesson": lesson.Id, "assignee": userID},
+	)
+	if err == nil {
+		return data, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to find SCORM data: %w", err)
+	}
+
+	collection, err := app.FindCollectionByNameOrId("scorm_data")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find scorm_data collection: %w", err)
+	}
+
+	data = core.NewRecord(collection)
+	data.Set("lesson", lesson.Id)
+	data.Set("course", lesson.GetString("course"))
+	data.Set("assignee", userID)
+	data.Set("version", lesson.GetString("scorm_version"))
+	data.Set("cmi", map[string]string{})
+
+	if err := app.Save(data); err != nil {
+		return nil, fmt.Errorf("failed to save SCORM data: %w", err)
+	}
+
+	return data, nil
+}
+
+// LaunchScormLesson prepares the runtime data of a SCORM lesson. Launches of
+// assignees start their course, previews are neither stored nor tracked.
+func (cs *CourseService) LaunchScormLesson(lesson, course, user *core.Record, preview bool) (*ScormLaunch, error) {
+	model, ok := scormDataModels[lesson.GetString("scorm_version")]
+	if !ok {
+		return nil, fmt.Errorf("unsupported SCORM version %q", lesson.GetString("scorm_version"))
+	}
+
+	stored := map[string]string{}
+	if !preview {
+		err := cs.app.RunInTransaction(func(txApp core.App) error {
+			data, err := findOrCreateScormData(txApp, lesson, user.Id)
+			if err != nil {
+				return err
+			}
+			stored = scormStoredCMI(data)
+
+			_, err = cs.withApp(txApp).advancePackageProgress(course.Id, user.Id, StatusInProgress, ProgressSourceScorm)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ScormLaunch{
+		Version: lesson.GetString("scorm_version"),
+		Preview: preview,
+		CMI:     model.initialCMI(stored, user, preview),
+	}, nil
+}
+
+// CommitScormData stores the CMI data set by a SCO and completes the lesson
+// (and the course once all its lessons are) when the SCO is completed or passed.
+func (cs *CourseService) CommitScormData(lessonID, userID string, values map[string]string) (*ScormCommit, error) {
+	commit := &ScormCommit{}
+
+	err := cs.app.RunInTransaction(func(txApp core.App) error {
+		txService := cs.withApp(txApp)
+
+		lesson, err := txApp.FindRecordById("lessons", lessonID)
+		if err != nil {
+			return fmt.Errorf("failed to find lesson: %w", err)
+		}
+
+		model, ok := scormDataModels[lesson.GetString("scorm_version")]
+		if !ok {
+			return fmt.Errorf("%w: the lesson has no SCORM package", ErrScormInvalidData)
+		}
+
+		if err := model.validate(values); err != nil {
+			return err
+		}
+
+		data, err := findOrCreateScormData(txApp, lesson, userID)
+		if err != nil {
+			return err
+		}
+
+		cmi := scormStoredCMI(data)
+		maps.Copy(cmi, values)
+
+		// the LMS accumulates the session times of the SCO
+		if sessionTime, ok := values[model.sessionTime]; ok {
+			total, _ := parseScormTimespan(model.version, cmi[model.totalTime])
+			session, _ := parseScormTimespan(model.version, sessionTime)
+			cmi[model.totalTime] = formatScormTimespan(model.version, total+session)
+		}
+
+		rawCMI, err := json.Marshal(cmi)
+		if err != nil {
+			return fmt.Errorf("failed to serialize SCORM data: %w", err)
+		}
+		if len(rawCMI) > scormMaxDataSize {
+			return fmt.Errorf("%w: the data exceeds %d bytes", ErrScormInvalidData, scormMaxDataSize)
+		}
+
+		data.Set("cmi", cmi)
+		data.Set("completion_status", cmi[model.completionStatus])
+		data.Set("success_status", cmi[model.successStatus])
+		data.Set("score_raw", cmi[model.scoreRaw])
+		data.Set("score_scaled", scormScaledScore(model, cmi))
+		data.Set("suspend_data", cmi[model.suspendData])
+
+		if err := txApp.Save(data); err != nil {
+			return fmt.Errorf("failed to save SCORM data: %w", err)
+		}
+
+		for _, answer := range model.xapiAnswers(cmi, values) {
+			if err := EmitXapiLessonAnswer(txApp, lesson, userID, answer.id, answer.interactionType, answer.result); err != nil {
+				return err
+			}
+		}
+
+		if model.completed(cmi) {
+			commit.LessonCompleted = true
+			if err := txService.completePackageLesson(lesson, userID, model.xapiResult(cmi)); err != nil {
+				return err
+			}
+		}
+
+		commit.CourseStatus, err = txService.advancePackageProgress(lesson.GetString("course"), userID, "", ProgressSourceScorm)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return commit, nil
+}
+
+// scormScaledScore returns the scaled score of the SCO, computed from the
+// raw score for SCORM 1.2.
+func scormScaledScore(model scormDataModel, cmi map[string]string) any {
+	if model.scoreScaled != "" {
+		return cmi[model.scoreScaled]
+	}
+
+	raw, err := strconv.ParseFloat(cmi[model.scoreRaw], 64)
+	if err != nil {
+		return ""
+	}
+	scoreMin, err := strconv.ParseFloat(cmi[model.scoreMin], 64)
+	if err != nil {
+		scoreMin = 0
+	}
+	scoreMax, err := strconv.ParseFloat(cmi[model.scoreMax], 64)
+	if err != nil {
+		scoreMax = 100
+	}
+	if scoreMax <= scoreMin {
+		return ""
+	}
+	return math.Max(-1, math.Min(1, (raw-scoreMin)/(scoreMax-scoreMin)))
+}
+
+// completePackageLesson marks the lesson progress of a learner as completed,
+// recording whether the learner passed or failed it when result is known.
+func (cs *CourseService) completePackageLesson(lesson *core.Record, userID string, result map[string]any) error {
+	lessonProgress, err := cs.app.FindFirstRecordByFilter(
+		"lesson_progress",
+		"lesson = {:lesson} && assignee = {:assignee}",
+		dbx.Params{"lesson": lesson.Id, "assignee": userID},
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		collection, findErr := cs.app.FindCollectionByNameOrId("lesson_progress")
+		if findErr != nil {
+			return fmt.Errorf("failed to find lesson_progress collection: %w", findErr)
+		}
+		lessonProgress = core.NewRecord(collection)
+		lessonProgress.Set("lesson", lesson.Id)
+		lessonProgress.Set("course", lesson.GetString("course"))
+		lessonProgress.Set("assignee", userID)
+	} else if err != nil {
+		return fmt.Errorf("failed to find lesson progress: %w", err)
+	}
+
+	if lessonProgress.GetBool("completed") {
+		return nil
+	}
+
+	lessonProgress.Set("completed", true)
+	if err := cs.app.Save(lessonProgress); err != nil {
+		return fmt.Errorf("failed to save lesson progress: %w", err)
+	}
+
+	if err := cs.HandleLessonProgressChange(lessonProgress, false); err != nil {
+		return err
+	}
+
+	if result == nil {
+		return nil
+	}
+	return EmitXapiLessonResult(cs.app, lesson, userID, result)
+}
+
+// advancePackageProgress moves the course progress of a learner forward to the
+// given status, or to "Completed" when to is empty and all the course lessons
+// are completed, and returns the resulting status.
+func (cs *CourseService) advancePackageProgress(courseID, userID, to, source string) (string, error) {
+	progressRecord, err := cs.app.FindFirstRecordByFilter(
+		"progress",
+		"course = {:course} && assignee = {:assignee}",
+		dbx.Params{"course": courseID, "assignee": userID},
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find progress record: %w", err)
+	}
+
+	from := progressRecord.GetString("status")
+
+	if to == "" {
+		lessons, err := cs.app.CountRecords("lessons", dbx.HashExp{"course": courseID})
+		if err != nil {
+			return "", fmt.Errorf("failed to count course lessons: %w", err)
+		}
+		completed, err := cs.app.CountRecords("lesson_progress", dbx.HashExp{"course": courseID, "assignee": userID, "completed": true})
+		if err != nil {
+			return "", fmt.Errorf("failed to count completed lessons: %w", err)
+		}
+		if lessons == 0 || completed < lessons {
+			return from, nil
+		}
+		to = StatusCompleted
+	}
+
+	steps := []string{to}
+	switch {
+	case from == to || from == StatusCompleted:
+		return from, nil
+	case from == StatusNotStarted && to == StatusCompleted:
+		steps = []string{StatusInProgress, StatusCompleted}
+	}
+
+	for _, step := range steps {
+		from := progressRecord.GetString("status")
+		if err := ValidateStatusTransition(from, step, source); err != nil {
+			return "", err
+		}
+
+		progressRecord.Set("status", step)
+		StampProgressTimestamps(progressRecord, from, step)
+
+		if err := cs.app.Save(progressRecord); err != nil {
+			return "", fmt.Errorf("failed to save progress record: %w", err)
+		}
+
+		if err := cs.RecordProgressEvent(progressRecord, from, step, cs.actor, source); err != nil {
+			return "", err
+		}
+	}
+
+	return to, nil
+}
@@ -0,0 +1,478 @@
+package hooks
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+const testScorm12Manifest = `<?xml version="1.0"?>
+<manifest identifier="course" version="1.0"
+    xmlns="http://www.imsproject.org/xsd/imscp_rootv1p1p2"
+    xmlns:adlcp="http://www.adlnet.org/xsd/adlcp_rootv1p2">
+  <metadata><schema>ADL SCORM</schema><schemaversion>1.2</schemaversion></metadata>
+  <organizations default="org">
+    <organization identifier="org">
+      <title>Safety Basics</title>
+      <item identifier="item1" identifierref="intro"><title>Intro</title></item>
+      <item identifier="item2" identifierref="sco"><title>Lesson</title></item>
+    </organization>
+  </organizations>
+  <resources>
+    <resource identifier="intro" type="webcontent" adlcp:scormtype="asset" href="intro.html"/>
+    <resource identifier="sco" type="webcontent" adlcp:scormtype="sco" href="content/index.html">
+      <file href="content/index.html"/>
+    </resource>
+  </resources>
+</manifest>`
+
+const testScorm2004Manifest = `<?xml version="1.0"?>
+<manifest identifier="course" xmlns="http://www.imsglobal.org/xsd/imscp_v1p1"
+    xmlns:adlcp="http://www.adlnet.org/xsd/adlcp_v1p3">
+  <organizations default="second">
+    <organization identifier="first"><title>Ignored</title></organization>
+    <organization identifier="second">
+      <title>Compliance</title>
+      <item identifier="module"><title>Module</title>
+        <item identifier="item" identifierref="sco" parameters="?lang=en"><title>Lesson</title></item>
+      </item>
+    </organization>
+  </organizations>
+  <resources xml:base="course/">
+    <resource identifier="sco" type="webcontent" adlcp:scormType="sco" href="launch.html?mode=full"/>
+  </resources>
+</manifest>`
+
+// testScormZip builds a zip archive of the given files.
+func testScormZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to add %s to the zip: %v", name, err)
+		}
+		if _, err := io.WriteString(w, content); err != nil {
+			t.Fatalf("Failed to write %s to the zip: %v", name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Failed to close the zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseScormPackage(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		version string
+		entry   string
+		title   string
+	}{
+		{
+			name:    "SCORM 1.2 launches the first SCO",
+			files:   map[string]string{"imsmanifest.xml": testScorm12Manifest, "intro.html": "intro", "content/index.html": "sco"},
+			version: ScormVersion12,
+			entry:   "content/index.html",
+			title:   "Safety Basics",
+		},
+		{
+			name:    "SCORM 2004 with xml:base and parameters",
+			files:   map[string]string{"imsmanifest.xml": testScorm2004Manifest, "course/launch.html": "sco"},
+			version: ScormVersion2004,
+			entry:   "course/launch.html?mode=full&lang=en",
+			title:   "Compliance",
+		},
+		{
+			name:  "missing manifest",
+			files: map[string]string{"index.html": "sco"},
+		},
+		{
+			name:  "missing launch file",
+			files: map[string]string{"imsmanifest.xml": testScorm12Manifest, "intro.html": "intro"},
+		},
+		{
+			name:  "path escaping the package",
+			files: map[string]string{"imsmanifest.xml": testScorm12Manifest, "content/index.html": "sco", "../evil.html": "evil"},
+		},
+		{
+			name:  "unsupported schema version",
+			files: map[string]string{"imsmanifest.xml": strings.Replace(testScorm12Manifest, "<schemaversion>1.2", "<schemaversion>1.1", 1), "content/index.html": "sco"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := testScormZip(t, tt.files)
+			pkg, err := ParseScormPackage(bytes.NewReader(content), int64(len(content)))
+
+			if tt.version == "" {
+				if !errors.Is(err, ErrScormInvalidPackage) {
+					t.Fatalf("Expected ErrScormInvalidPackage, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseScormPackage failed: %v", err)
+			}
+			if pkg.Version != tt.version || pkg.Entry != tt.entry || pkg.Title != tt.title {
+				t.Errorf("Expected %s %q %q, got %s %q %q", tt.version, tt.entry, tt.title, pkg.Version, pkg.Entry, pkg.Title)
+			}
+		})
+	}
+
+	if _, err := ParseScormPackage(strings.NewReader("not a zip"), 9); !errors.Is(err, ErrScormInvalidPackage) {
+		t.Errorf("Expected ErrScormInvalidPackage for a non zip file, got %v", err)
+	}
+}
+
+func TestScormTimespans(t *testing.T) {
+	tests := []struct {
+		version  string
+		value    string
+		duration time.Duration
+		valid    bool
+	}{
+		{ScormVersion12, "0001:30:05.5", time.Hour + 30*time.Minute + 5500*time.Millisecond, true},
+		{ScormVersion12, "00:00:10", 10 * time.Second, true},
+		{ScormVersion12, "1:00:00", 0, false},
+		{ScormVersion2004, "PT1H30M5.5S", time.Hour + 30*time.Minute + 5500*time.Millisecond, true},
+		{ScormVersion2004, "P1DT2M", 24*time.Hour + 2*time.Minute, true},
+		{ScormVersion2004, "P", 0, false},
+		{ScormVersion2004, "PT", 0, false},
+		{ScormVersion2004, "1H", 0, false},
+	}
+
+	for _, tt := range tests {
+		duration, ok := parseScormTimespan(tt.version, tt.value)
+		if ok != tt.valid || duration != tt.duration {
+			t.Errorf("parseScormTimespan(%s, %q) = %v, %v; expected %v, %v", tt.version, tt.value, duration, ok, tt.duration, tt.valid)
+		}
+	}
+
+	if formatted := formatScormTimespan(ScormVersion12, time.Hour+5500*time.Millisecond); formatted != "0001:00:05.50" {
+		t.Errorf("Unexpected SCORM 1.2 timespan %q", formatted)
+	}
+	if formatted := formatScormTimespan(ScormVersion2004, time.Hour+5500*time.Millisecond); formatted != "PT1H0M5.5S" {
+		t.Errorf("Unexpected SCORM 2004 duration %q", formatted)
+	}
+}
+
+func TestScormLesson(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	learner := createTestLearner(t, app)
+	learner.Set("organization", testOrg1)
+	if err := app.Save(learner); err != nil {
+		t.Fatalf("Failed to save learner: %v", err)
+	}
+	initScormHooks(app)
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatalf("Failed to find users collection: %v", err)
+	}
+
+	instructor := core.NewRecord(users)
+	instructor.SetEmail("instructor@example.com")
+	instructor.SetPassword("1234567890")
+	instructor.Set("role", RoleInstructor)
+	instructor.Set("organization", testOrg1)
+	if err := app.Save(instructor); err != nil {
+		t.Fatalf("Failed to save instructor: %v", err)
+	}
+
+	course := createTestCourse(t, app, courses, "")
+	course.Set("owner", instructor.Id)
+	course.Set("organization", testOrg1)
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+	if err := service.EnrollUser(course.Id, learner.Id); err != nil {
+		t.Fatalf("EnrollUser failed: %v", err)
+	}
+
+	lessons, err := app.FindCollectionByNameOrId("lessons")
+	if err != nil {
+		t.Fatalf("Failed to find lessons collection: %v", err)
+	}
+
+	newPackage := func(files map[string]string) *filesystem.File {
+		file, err := filesystem.NewFileFromBytes(testScormZip(t, files), "package.zip")
+		if err != nil {
+			t.Fatalf("Failed to create the package file: %v", err)
+		}
+		return file
+	}
+
+	lesson := core.NewRecord(lessons)
+	lesson.Set("course", course.Id)
+	lesson.Set("title", "Safety Basics")
+	lesson.Set("scorm_package", newPackage(map[string]string{"index.html": "no manifest"}))
+	if err := app.Save(lesson); err == nil {
+		t.Fatal("Expected a package without manifest to be rejected")
+	}
+
+	lesson.Set("scorm_package", newPackage(map[string]string{
+		"imsmanifest.xml":    testScorm12Manifest,
+		"intro.html":         "intro",
+		"content/index.html": "<html><head><title>SCO</title></head></html>",
+		"content/app.js":     "start()",
+	}))
+	lesson.Set("scorm_entry", "intro.html")
+	if err := app.Save(lesson); err != nil {
+		t.Fatalf("Failed to save the SCORM lesson: %v", err)
+	}
+	if lesson.GetString("scorm_version") != ScormVersion12 || lesson.GetString("scorm_entry") != "content/index.html" {
+		t.Fatalf("Expected the launch settings of the package, got %q %q", lesson.GetString("scorm_version"), lesson.GetString("scorm_entry"))
+	}
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	bindScormRoutes(r, service)
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	send := func(user *core.Record, method, path string, body any, out any) int {
+		t.Helper()
+
+		var payload bytes.Buffer
+		if body != nil {
+			if err := json.NewEncoder(&payload).Encode(body); err != nil {
+				t.Fatalf("Failed to encode request: %v", err)
+			}
+		}
+		req, err := http.NewRequest(method, server.URL+path, &payload)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if user != nil {
+			token, err := user.NewAuthToken()
+			if err != nil {
+				t.Fatalf("Failed to create auth token: %v", err)
+			}
+			req.Header.Set("Authorization", token)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer res.Body.Close()
+
+		if out != nil {
+			if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+				t.Fatalf("Failed to decode %s %s response: %v", method, path, err)
+			}
+		}
+		return res.StatusCode
+	}
+
+	launch := ScormLaunch{}
+	if status := send(learner, http.MethodPost, "/api/scorm/"+lesson.Id+"/launch", nil, &launch); status != http.StatusOK {
+		t.Fatalf("Expected the learner to launch the lesson, got %d", status)
+	}
+	if launch.Preview || launch.Version != ScormVersion12 || launch.CMI["cmi.core.student_id"] != learner.Id ||
+		launch.CMI["cmi.core.entry"] != "ab-initio" || launch.CMI["cmi.core.lesson_status"] != "not attempted" {
+		t.Errorf("Unexpected launch %+v", launch)
+	}
+
+	progressRecord, err := app.FindFirstRecordByData("progress", "assignee", learner.Id)
+	if err != nil {
+		t.Fatalf("Failed to find progress record: %v", err)
+	}
+	if status := progressRecord.GetString("status"); status != StatusInProgress {
+		t.Errorf("Expected the launch to start the course, got %q", status)
+	}
+
+	getPackageFile := func(path string) (*http.Response, string) {
+		t.Helper()
+
+		res, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", path, err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		// package pages must not run in the app origin
+		if csp := res.Header.Get("Content-Security-Policy"); !strings.HasPrefix(csp, "sandbox allow-scripts allow-forms;") || strings.Contains(csp, "allow-same-origin") {
+			t.Errorf("Expected %s to be sandboxed, got %q", path, csp)
+		}
+		return res, string(body)
+	}
+
+	res, body := getPackageFile(launch.URL)
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") ||
+		!strings.HasPrefix(body, "<html><head><script>window.elessonScorm = {") || !strings.HasSuffix(body, "</script><title>SCO</title></head></html>") ||
+		!strings.Contains(body, `"cmi.core.entry":"ab-initio"`) {
+		t.Errorf("Expected the SCO page with the runtime API, got %d %q %q", res.StatusCode, res.Header.Get("Content-Type"), body)
+	}
+
+	res, body = getPackageFile(strings.Replace(launch.URL, "index.html", "app.js", 1))
+	if res.StatusCode != http.StatusOK || body != "start()" {
+		t.Errorf("Expected the SCO script as is, got %d %q", res.StatusCode, body)
+	}
+
+	for _, path := range []string{
+		"/api/scorm/" + lesson.Id + "/content/unknown/content/index.html",
+		strings.Replace(launch.URL, "content/index.html", "imsmanifest.xm", 1),
+	} {
+		res, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", path, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected 404 for %s, got %d", path, res.StatusCode)
+		}
+	}
+
+	commitPath := "/api/scorm/" + lesson.Id + "/commit"
+	if status := send(learner, http.MethodPost, commitPath, map[string]any{"cmi": map[string]string{"cmi.core.student_id": "someone"}}, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a read-only element, got %d", status)
+	}
+	if status := send(learner, http.MethodPost, commitPath, map[string]any{"cmi": map[string]string{"cmi.core.lesson_status": "done"}}, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid status, got %d", status)
+	}
+
+	commit := ScormCommit{}
+	status := send(learner, http.MethodPost, commitPath, map[string]any{"cmi": map[string]string{
+		"cmi.core.lesson_status": "incomplete",
+		"cmi.core.exit":          "suspend",
+		"cmi.core.session_time":  "00:10:00",
+		"cmi.suspend_data":       "page=3",
+	}}, &commit)
+	if status != http.StatusOK || commit.LessonCompleted || commit.CourseStatus != StatusInProgress {
+		t.Fatalf("Expected an incomplete commit, got %d %+v", status, commit)
+	}
+
+	// the next pages of the session get the committed values
+	send(learner, http.MethodPost, commitPath, map[string]any{"session": launch.Session, "cmi": map[string]string{"cmi.core.lesson_location": "page4"}}, nil)
+	if _, body := getPackageFile(launch.URL); !strings.Contains(body, `"cmi.core.lesson_location":"page4"`) {
+		t.Errorf("Expected the page to resume from the committed values, got %q", body)
+	}
+
+	launch = ScormLaunch{}
+	send(learner, http.MethodPost, "/api/scorm/"+lesson.Id+"/launch", nil, &launch)
+	if launch.CMI["cmi.core.entry"] != "resume" || launch.CMI["cmi.suspend_data"] != "page=3" ||
+		launch.CMI["cmi.core.total_time"] != "0000:10:00.00" || launch.CMI["cmi.core.exit"] != "" {
+		t.Errorf("Expected the suspended attempt to resume, got %v", launch.CMI)
+	}
+
+	commit = ScormCommit{}
+	status = send(learner, http.MethodPost, commitPath, map[string]any{"cmi": map[string]string{
+		"cmi.core.lesson_status":              "passed",
+		"cmi.core.score.raw":                  "80",
+		"cmi.core.session_time":               "00:05:30",
+		"cmi.interactions.0.id":               "brakes quiz",
+		"cmi.interactions.0.type":             "choice",
+		"cmi.interactions.0.student_response": "b",
+		"cmi.interactions.0.result":           "correct",
+	}}, &commit)
+	if status != http.StatusOK || !commit.LessonCompleted || commit.CourseStatus != StatusCompleted {
+		t.Fatalf("Expected the lesson and course to be completed, got %d %+v", status, commit)
+	}
+
+	data, err := app.FindFirstRecordByData("scorm_data", "assignee", learner.Id)
+	if err != nil {
+		t.Fatalf("Failed to find SCORM data: %v", err)
+	}
+	cmi := scormStoredCMI(data)
+	if data.GetString("completion_status") != "passed" || data.GetFloat("score_raw") != 80 || data.GetFloat("score_scaled") != 0.8 ||
+		data.GetString("suspend_data") != "page=3" || cmi["cmi.core.total_time"] != "0000:15:30.00" {
+		t.Errorf("Unexpected SCORM data %v", data.FieldsData())
+	}
+
+	lessonProgress, err := app.FindFirstRecordByData("lesson_progress", "lesson", lesson.Id)
+	if err != nil || !lessonProgress.GetBool("completed") {
+		t.Errorf("Expected the lesson progress to be completed, got %v", err)
+	}
+
+	// the score of the SCO is recorded in the LRS
+	passed, err := app.FindFirstRecordByData("xapi_statements", "verb", XapiVerbPassed)
+	if err != nil {
+		t.Fatalf("Expected a passed statement: %v", err)
+	}
+	result, _ := xapiStatementOf(passed)["result"].(map[string]any)
+	if score, _ := result["score"].(map[string]any); result["success"] != true || score["scaled"] != 0.8 || score["raw"] != 80.0 {
+		t.Errorf("Unexpected passed result %v", result)
+	}
+
+	// so are the answers to its interactions
+	answered, err := app.FindFirstRecordByData("xapi_statements", "verb", XapiVerbAnswered)
+	if err != nil {
+		t.Fatalf("Expected an answered statement: %v", err)
+	}
+	answer := xapiStatementOf(answered)
+	object, _ := answer["object"].(map[string]any)
+	objectID, _ := object["id"].(string)
+	definition, _ := object["definition"].(map[string]any)
+	result, _ = answer["result"].(map[string]any)
+	if !strings.HasSuffix(objectID, "/lessons/"+lesson.Id+"/interactions/brakes%20quiz") || definition["interactionType"] != "choice" ||
+		result["response"] != "b" || result["success"] != true {
+		t.Errorf("Unexpected answered statement %v", answer)
+	}
+
+	preview := ScormLaunch{}
+	if status := send(instructor, http.MethodPost, "/api/scorm/"+lesson.Id+"/launch", nil, &preview); status != http.StatusOK || !preview.Preview || preview.CMI["cmi.core.lesson_mode"] != "browse" {
+		t.Errorf("Expected the instructor to preview the lesson, got %d %+v", status, preview)
+	}
+	if status := send(instructor, http.MethodPost, commitPath, map[string]any{"cmi": map[string]string{"cmi.core.lesson_status": "failed"}}, nil); status != http.StatusOK {
+		t.Errorf("Expected the preview commit to be accepted, got %d", status)
+	}
+	if count, _ := app.CountRecords("scorm_data"); count != 1 {
+		t.Errorf("Expected previews not to be stored, got %d SCORM data records", count)
+	}
+
+	outsider := core.NewRecord(users)
+	outsider.SetEmail("outsider@example.com")
+	outsider.SetPassword("1234567890")
+	if err := app.Save(outsider); err != nil {
+		t.Fatalf("Failed to save outsider: %v", err)
+	}
+	if status := send(outsider, http.MethodPost, "/api/scorm/"+lesson.Id+"/launch", nil, nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for a user outside the course, got %d", status)
+	}
+
+	// replacing the package removes the previously extracted files
+	oldDir := scormFilesPath(lesson, lesson.GetString("scorm_package"))
+	lesson.Set("scorm_package", newPackage(map[string]string{"imsmanifest.xml": testScorm2004Manifest, "course/launch.html": "v2"}))
+	if err := app.Save(lesson); err != nil {
+		t.Fatalf("Failed to replace the SCORM package: %v", err)
+	}
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		t.Fatalf("Failed to open the filesystem: %v", err)
+	}
+	defer fsys.Close()
+	if exists, _ := fsys.Exists(oldDir + "/content/index.html"); exists {
+		t.Error("Expected the files of the previous package to be deleted")
+	}
+	if exists, _ := fsys.Exists(scormFilesPath(lesson, lesson.GetString("scorm_package")) + "/course/launch.html"); !exists {
+		t.Error("Expected the files of the new package to be extracted")
+	}
+}
@@ -0,0 +1,153 @@
+package hooks
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+var ErrSignupDomainNotAllowed = errors.New("email domain is not allowed to sign up")
+
+// EmailDomain returns the lowercased domain of an email address.
+func EmailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(email[at+1:]))
+}
+
+// FindSignupDomain checks an email against the signup_domains allowlist and
+// returns the allowlisted domain of the email. It returns nil while the
+// allowlist is empty, since registration is then open to every domain.
+func FindSignupDomain(app core.App, email string) (*core.Record, error) {
+	total, err := app.CountRecords("signup_domains")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count signup domains: %w", err)
+	}
+	if total == 0 {
+		return nil, nil
+	}
+
+	domain := EmailDomain(email)
+	if domain == "" {
+		return nil, ErrSignupDomainNotAllowed
+	}
+
+	signupDomain, err := app.FindFirstRecordByData("signup_domains", "domain", domain)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSignupDomainNotAllowed
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find signup domain: %w", err)
+	}
+
+	return signupDomain, nil
+}
+
+// SignupOrganization checks an email against the signup_domains allowlist and
+// returns the organization its domain is mapped to, if any.
+func SignupOrganization(app core.App, email string) (string, error) {
+	signupDomain, err := FindSignupDomain(app, email)
+	if err != nil || signupDomain == nil {
+		return "", err
+	}
+	return signupDomain.GetString("organization"), nil
+}
+
+// JoinSignupGroups adds a newly registered user to the groups its email
+// domain is mapped to, which enrolls the user into the group courses.
+func (cs *CourseService) JoinSignupGroups(signupDomain, user *core.Record) error {
+	return cs.app.RunInTransaction(func(txApp core.App) error {
+		groups, err := txApp.FindRecordsByIds("groups", signupDomain.GetStringSlice("groups"))
+		if err != nil {
+			return fmt.Errorf("failed to find the signup groups: %w", err)
+		}
+
+		for _, group := range groups {
+			members := group.GetStringSlice("members")
+			if slices.Contains(members, user.Id) {
+				continue
+			}
+			if err := cs.withApp(txApp).SetGroupMembers(group, append(members, user.Id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// initSignupHooks restricts self-registration, including OAuth2 sign-ups,
+// to the allowlisted email domains and places the new users in the
+// organization of their domain before they are onboarded, and then in
+// the groups of their domain.
+func initSignupHooks(app core.App) {
+	// the groups of a domain must belong to its organization
+	app.OnRecordValidate("signup_domains").BindFunc(func(e *core.RecordEvent) error {
+		groups, err := e.App.FindRecordsByIds("groups", e.Record.GetStringSlice("groups"))
+		if err != nil {
+			return fmt.Errorf("failed to find the signup groups: %w", err)
+		}
+
+		for _, group := range groups {
+			if group.GetString("organization") != e.Record.GetString("organization") {
+				return validation.Errors{
+					"groups": validation.NewError("validation_group_organization", "The groups must belong to the domain organization."),
+				}
+			}
+		}
+		return e.Next()
+	})
+
+	app.OnRecordCreateRequest("users").BindFunc(func(e *core.RecordRequestEvent) error {
+		// accounts created by admins and registrations with an invite code skip the allowlist
+		if e.Auth != nil {
+			return e.Next()
+		}
+
+		info, err := e.RequestInfo()
+		if err != nil {
+			return err
+		}
+		if code, _ := info.Body[inviteBodyField].(string); code != "" {
+			return e.Next()
+		}
+
+		signupDomain, err := FindSignupDomain(e.App, e.Record.Email())
+		if errors.Is(err, ErrSignupDomainNotAllowed) {
+			return e.BadRequestError("Registration is not open for this email address.", validation.Errors{
+				"email": validation.NewError("validation_email_domain_not_allowed", err.Error()),
+			})
+		}
+		if err != nil {
+			return e.InternalServerError("Failed to check the email domain.", err)
+		}
+
+		if signupDomain == nil {
+			return e.Next()
+		}
+
+		if organizationID := signupDomain.GetString("organization"); organizationID != "" {
+			e.Record.Set("organization", organizationID)
+		}
+
+		if len(signupDomain.GetStringSlice("groups")) == 0 {
+			return e.Next()
+		}
+
+		return e.App.RunInTransaction(func(txApp core.App) error {
+			e.App = txApp
+
+			if err := e.Next(); err != nil {
+				return err
+			}
+
+			return NewCourseService(txApp).WithActor(e.Record.Id).JoinSignupGroups(signupDomain, e.Record)
+		})
+	})
+}
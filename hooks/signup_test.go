@@ -0,0 +1,173 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestEmailDomain(t *testing.T) {
+	tests := []struct {
+		email    string
+		expected string
+	}{
+		{"jane@example.com", "example.com"},
+		{"Jane@Example.COM", "example.com"},
+		{"odd@name@example.org", "example.org"},
+		{"invalid", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			if domain := EmailDomain(tt.email); domain != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, domain)
+			}
+		})
+	}
+}
+
+func TestSignupOrganization(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	createTestCollections(t, app)
+	signupDomains, err := app.FindCollectionByNameOrId("signup_domains")
+	if err != nil {
+		t.Fatalf("Failed to find signup_domains collection: %v", err)
+	}
+
+	// an empty allowlist keeps registration open
+	if organization, err := SignupOrganization(app, "anyone@example.com"); err != nil || organization != "" {
+		t.Errorf("Expected open registration, got %q, %v", organization, err)
+	}
+
+	for domain, organization := range map[string]string{"acme.com": testOrg1, "partner.io": ""} {
+		record := core.NewRecord(signupDomains)
+		record.Set("domain", domain)
+		record.Set("organization", organization)
+		if err := app.Save(record); err != nil {
+			t.Fatalf("Failed to save signup domain: %v", err)
+		}
+	}
+
+	tests := []struct {
+		email        string
+		organization string
+		err          error
+	}{
+		{"jane@acme.com", testOrg1, nil},
+		{"Jane@ACME.com", testOrg1, nil},
+		{"joe@partner.io", "", nil},
+		{"eve@example.com", "", ErrSignupDomainNotAllowed},
+		{"eve@sub.acme.com", "", ErrSignupDomainNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			organization, err := SignupOrganization(app, tt.email)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected %v, got %v", tt.err, err)
+			}
+			if organization != tt.organization {
+				t.Errorf("Expected organization %q, got %q", tt.organization, organization)
+			}
+		})
+	}
+}
+
+func TestSignupGroups(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	initOrganizationHooks(app)
+	initSignupHooks(app)
+
+	course := createTestCourse(t, app, courses, "")
+	course.Set("organization", testOrg1)
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+
+	groups, err := app.FindCollectionByNameOrId("groups")
+	if err != nil {
+		t.Fatalf("Failed to find groups collection: %v", err)
+	}
+	groupIDs := map[string]string{}
+	for _, organization := range []string{testOrg1, testOrg2} {
+		group := core.NewRecord(groups)
+		group.Set("name", "Employees")
+		group.Set("organization", organization)
+		group.Set("courses", []string{course.Id})
+		if err := app.Save(group); err != nil {
+			t.Fatalf("Failed to save group: %v", err)
+		}
+		groupIDs[organization] = group.Id
+	}
+
+	signupDomains, err := app.FindCollectionByNameOrId("signup_domains")
+	if err != nil {
+		t.Fatalf("Failed to find signup_domains collection: %v", err)
+	}
+	signupDomain := core.NewRecord(signupDomains)
+	signupDomain.Set("domain", "acme.com")
+	signupDomain.Set("organization", testOrg1)
+
+	// a domain can only be mapped to the groups of its organization
+	signupDomain.Set("groups", []string{groupIDs[testOrg2]})
+	if err := app.Save(signupDomain); err == nil {
+		t.Error("Expected the groups of another organization to be rejected")
+	}
+	signupDomain.Set("groups", []string{groupIDs[testOrg1]})
+	if err := app.Save(signupDomain); err != nil {
+		t.Fatalf("Failed to save signup domain: %v", err)
+	}
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	body, _ := json.Marshal(map[string]any{
+		"email":           "jane@acme.com",
+		"password":        "1234567890",
+		"passwordConfirm": "1234567890",
+	})
+	res, err := http.Post(server.URL+"/api/collections/users/records", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Registration request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	user := map[string]any{}
+	json.NewDecoder(res.Body).Decode(&user)
+	if res.StatusCode != http.StatusOK || user["organization"] != testOrg1 {
+		t.Fatalf("Expected jane to register into org1, got %d %v", res.StatusCode, user)
+	}
+
+	group, err := app.FindRecordById("groups", groupIDs[testOrg1])
+	if err != nil {
+		t.Fatalf("Failed to reload group: %v", err)
+	}
+	if members := group.GetStringSlice("members"); len(members) != 1 || members[0] != user["id"] {
+		t.Errorf("Expected jane to join the domain group, got %v", members)
+	}
+
+	if _, err := app.FindFirstRecordByFilter("progress", "course = {:course} && assignee = {:assignee}",
+		dbx.Params{"course": course.Id, "assignee": user["id"]}); err != nil {
+		t.Errorf("Expected jane to be assigned the group course: %v", err)
+	}
+}
@@ -0,0 +1,373 @@
+package hooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/pocketbase/pocketbase/tools/routine"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Events that webhooks can subscribe to.
+const (
+	WebhookCourseAssigned   = "course.assigned"
+	WebhookCourseUnassigned = "course.unassigned"
+	WebhookProgressChanged  = "progress.changed"
+	WebhookCourseCompleted  = "course.completed"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Headers sent with every webhook delivery.
+const (
+	WebhookSignatureHeader = "X-ELesson-Signature"
+	WebhookTimestampHeader = "X-ELesson-Timestamp"
+	WebhookEventHeader     = "X-ELesson-Event"
+	WebhookDeliveryHeader  = "X-ELesson-Delivery"
+)
+
+// webhookRetryDelays is the backoff applied after each failed attempt.
+// A delivery is marked as failed once all retries are exhausted.
+var webhookRetryDelays = []time.Duration{
+	1 * time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+	12 * time.Hour,
+}
+
+var webhookClient = newOutboundClient(10 * time.Second)
+
+// ErrWebhookDeliveryClaimed is returned when another attempt already sent or
+// is sending the delivery.
+var ErrWebhookDeliveryClaimed = errors.New("webhook delivery already claimed")
+
+// webhookRetrying prevents overlapping retry runs.
+var webhookRetrying sync.Mutex
+
+// SignWebhookPayload returns the hex encoded HMAC-SHA256 of "timestamp.body".
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// QueueWebhookEvent queues a delivery for every active webhook of the organization subscribed to event.
+// Deliveries are sent once the surrounding transaction (if any) is committed.
+func QueueWebhookEvent(app core.App, event, organizationID string, data map[string]any) error {
+	deliveriesCollection, err := app.FindCollectionByNameOrId("webhook_deliveries")
+	if err != nil {
+		return fmt.Errorf("failed to find webhook_deliveries collection: %w", err)
+	}
+
+	organizationWebhooks, err := app.FindAllRecords("webhooks", dbx.HashExp{
+		"active":       true,
+		"organization": organizationID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find webhooks: %w", err)
+	}
+
+	webhooks := make([]*core.Record, 0, len(organizationWebhooks))
+	for _, webhook := range organizationWebhooks {
+		if slices.Contains(webhook.GetStringSlice("events"), event) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	// the event id is shared by all deliveries (and redeliveries) of the event
+	// so that receivers can deduplicate them
+	payload, err := json.Marshal(map[string]any{
+		"id":      core.GenerateDefaultRandomId(),
+		"event":   event,
+		"created": types.NowDateTime(),
+		"data":    data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to serialize webhook payload: %w", err)
+	}
+
+	for _, webhook := range webhooks {
+		delivery := core.NewRecord(deliveriesCollection)
+		delivery.Set("webhook", webhook.Id)
+		delivery.Set("event", event)
+		delivery.Set("status", DeliveryPending)
+		delivery.Set("attempts", 0)
+		// picked up by the retry job if the immediate attempt never happens
+		delivery.Set("next_attempt_at", types.NowDateTime().Add(webhookRetryDelays[0]))
+		delivery.Set("payload", types.JSONRaw(payload))
+
+		if err := app.Save(delivery); err != nil {
+			return fmt.Errorf("failed to save webhook delivery: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// DeliverWebhook sends a single delivery attempt and stores its outcome.
+func DeliverWebhook(app core.App, delivery *core.Record) error {
+	webhook, err := app.FindRecordById("webhooks", delivery.GetString("webhook"))
+	if err != nil {
+		return fmt.Errorf("failed to find webhook: %w", err)
+	}
+
+	attempts := delivery.GetInt("attempts") + 1
+
+	// claim the attempt first, so that the immediate attempt and the retry
+	// job never send the same delivery twice; the attempt is retried once
+	// the claim expires if it never completes
+	claim, err := app.DB().Update("webhook_deliveries", dbx.Params{
+		"attempts":        attempts,
+		"next_attempt_at": types.NowDateTime().Add(webhookRetryDelays[0]),
+	}, dbx.HashExp{
+		"id":       delivery.Id,
+		"status":   DeliveryPending,
+		"attempts": attempts - 1,
+	}).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to claim webhook delivery: %w", err)
+	}
+	if claimed, err := claim.RowsAffected(); err != nil || claimed == 0 {
+		return ErrWebhookDeliveryClaimed
+	}
+	delivery.Set("attempts", attempts)
+
+	body := []byte(delivery.GetString("payload"))
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, webhook.GetString("url"), bytes.NewReader(body))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(WebhookEventHeader, delivery.GetString("event"))
+		req.Header.Set(WebhookDeliveryHeader, delivery.Id)
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookPayload(webhook.GetString("secret"), timestamp, body))
+
+		var res *http.Response
+		res, err = webhookClient.Do(req)
+		if err == nil {
+			// only the status is kept, the org admins read the delivery log
+			res.Body.Close()
+
+			delivery.Set("response_code", res.StatusCode)
+
+			if res.StatusCode < 200 || res.StatusCode > 299 {
+				err = fmt.Errorf("unexpected response status %d", res.StatusCode)
+			}
+		}
+	}
+
+	if err == nil {
+		delivery.Set("status", DeliverySucceeded)
+		delivery.Set("last_error", "")
+		delivery.Set("next_attempt_at", "")
+		delivery.Set("delivered_at", types.NowDateTime())
+	} else {
+		delivery.Set("last_error", err.Error())
+		if attempts > len(webhookRetryDelays) {
+			delivery.Set("status", DeliveryFailed)
+			delivery.Set("next_attempt_at", "")
+		} else {
+			delivery.Set("status", DeliveryPending)
+			delivery.Set("next_attempt_at", types.NowDateTime().Add(webhookRetryDelays[attempts-1]))
+		}
+	}
+
+	if saveErr := app.Save(delivery); saveErr != nil {
+		return fmt.Errorf("failed to save webhook delivery: %w", saveErr)
+	}
+
+	return err
+}
+
+// RetryPendingWebhooks delivers every pending delivery whose retry time has come.
+func RetryPendingWebhooks(app core.App) error {
+	if !webhookRetrying.TryLock() {
+		return nil
+	}
+	defer webhookRetrying.Unlock()
+
+	deliveries, err := app.FindRecordsByFilter(
+		"webhook_deliveries",
+		"status = {:status} && next_attempt_at <= {:now}",
+		"next_attempt_at",
+		100,
+		0,
+		dbx.Params{"status": DeliveryPending, "now": types.NowDateTime()},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to find pending webhook deliveries: %w", err)
+	}
+
+	for _, delivery := range deliveries {
+		if err := DeliverWebhook(app, delivery); err != nil && !errors.Is(err, ErrWebhookDeliveryClaimed) {
+			app.Logger().Warn("Webhook delivery failed", "delivery", delivery.Id, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// RedeliverWebhook queues a copy of an existing delivery, which is sent right away.
+func RedeliverWebhook(app core.App, original *core.Record) (*core.Record, error) {
+	delivery := core.NewRecord(original.Collection())
+	delivery.Set("webhook", original.GetString("webhook"))
+	delivery.Set("event", original.GetString("event"))
+	delivery.Set("payload", original.Get("payload"))
+	delivery.Set("status", DeliveryPending)
+	delivery.Set("attempts", 0)
+	delivery.Set("next_attempt_at", types.NowDateTime().Add(webhookRetryDelays[0]))
+
+	if err := app.Save(delivery); err != nil {
+		return nil, fmt.Errorf("failed to save webhook delivery: %w", err)
+	}
+
+	return delivery, nil
+}
+
+// bindWebhookSubscribers translates course events into webhook deliveries.
+func bindWebhookSubscribers(events *CourseEvents) {
+	events.OnCourseAssigned.BindFunc(func(e *CourseAssignedEvent) error {
+		organizationID, err := CourseOrganization(e.App, e.CourseId)
+		if err != nil {
+			return err
+		}
+
+		err = QueueWebhookEvent(e.App, WebhookCourseAssigned, organizationID, map[string]any{
+			"course":   e.CourseId,
+			"assignee": e.AssigneeId,
+			"progress": e.ProgressId,
+			"actor":    e.Actor,
+		})
+		if err != nil {
+			return err
+		}
+
+		return e.Next()
+	})
+
+	events.OnAssigneeRemoved.BindFunc(func(e *AssigneeRemovedEvent) error {
+		organizationID, err := CourseOrganization(e.App, e.CourseId)
+		if err != nil {
+			return err
+		}
+
+		err = QueueWebhookEvent(e.App, WebhookCourseUnassigned, organizationID, map[string]any{
+			"course":   e.CourseId,
+			"assignee": e.AssigneeId,
+			"actor":    e.Actor,
+		})
+		if err != nil {
+			return err
+		}
+
+		return e.Next()
+	})
+
+	events.OnProgressStatusChanged.BindFunc(func(e *ProgressStatusChangedEvent) error {
+		organizationID := e.Progress.GetString("organization")
+
+		err := QueueWebhookEvent(e.App, WebhookProgressChanged, organizationID, map[string]any{
+			"progress": e.Progress.Id,
+			"course":   e.Progress.GetString("course"),
+			"assignee": e.Progress.GetString("assignee"),
+			"from":     e.From,
+			"to":       e.To,
+			"source":   e.Source,
+			"actor":    e.Actor,
+		})
+		if err != nil {
+			return err
+		}
+
+		if e.To == StatusCompleted {
+			err := QueueWebhookEvent(e.App, WebhookCourseCompleted, organizationID, map[string]any{
+				"progress":     e.Progress.Id,
+				"course":       e.Progress.GetString("course"),
+				"assignee":     e.Progress.GetString("assignee"),
+				"started_at":   e.Progress.GetDateTime("started_at"),
+				"completed_at": e.Progress.GetDateTime("completed_at"),
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return e.Next()
+	})
+}
+
+func initWebhookHooks(app core.App) {
+	bindWebhookSubscribers(Events(app))
+
+	// send new deliveries right after they are committed
+	app.OnRecordAfterCreateSuccess("webhook_deliveries").BindFunc(func(e *core.RecordEvent) error {
+		deliveryID := e.Record.Id
+		routine.FireAndForget(func() {
+			delivery, err := app.FindRecordById("webhook_deliveries", deliveryID)
+			if err != nil {
+				app.Logger().Warn("Failed to load webhook delivery", "delivery", deliveryID, "error", err)
+				return
+			}
+
+			if err := DeliverWebhook(app, delivery); err != nil && !errors.Is(err, ErrWebhookDeliveryClaimed) {
+				app.Logger().Warn("Webhook delivery failed", "delivery", deliveryID, "error", err)
+			}
+		})
+		return e.Next()
+	})
+
+	app.Cron().MustAdd("webhookRetries", "* * * * *", func() {
+		if err := RetryPendingWebhooks(app); err != nil {
+			app.Logger().Error("Failed to retry webhook deliveries", "error", err)
+		}
+	})
+}
+
+func bindWebhookRoutes(r *router.Router[*core.RequestEvent]) {
+	// queue a new delivery with the same payload as an existing one
+	r.POST("/api/webhooks/deliveries/{id}/redeliver", func(e *core.RequestEvent) error {
+		original, err := e.App.FindRecordById("webhook_deliveries", e.Request.PathValue("id"))
+		if err != nil {
+			return e.NotFoundError("", err)
+		}
+
+		if !e.HasSuperuserAuth() {
+			webhook, err := e.App.FindRecordById("webhooks", original.GetString("webhook"))
+			if err != nil || webhook.GetString("organization") != e.Auth.GetString("organization") {
+				return e.NotFoundError("", err)
+			}
+		}
+
+		delivery, err := RedeliverWebhook(e.App, original)
+		if err != nil {
+			return e.InternalServerError("Failed to redeliver webhook.", err)
+		}
+
+		return e.JSON(http.StatusOK, delivery)
+	}).Bind(RequireRole(RoleOrgAdmin))
+}
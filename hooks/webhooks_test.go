@@ -0,0 +1,182 @@
+package hooks
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+func createTestWebhook(t *testing.T, app *tests.TestApp, url string, events ...string) *core.Record {
+	collection, err := app.FindCollectionByNameOrId("webhooks")
+	if err != nil {
+		t.Fatalf("Failed to find webhooks collection: %v", err)
+	}
+
+	webhook := core.NewRecord(collection)
+	webhook.Set("name", "test")
+	webhook.Set("url", url)
+	webhook.Set("secret", "test_secret")
+	webhook.Set("events", events)
+	webhook.Set("active", true)
+
+	if err := app.Save(webhook); err != nil {
+		t.Fatalf("Failed to save test webhook: %v", err)
+	}
+	return webhook
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	signature := SignWebhookPayload("secret", "1700000000", []byte(`{"event":"course.completed"}`))
+	if len(signature) != 64 {
+		t.Fatalf("Expected a hex encoded SHA-256 signature, got %q", signature)
+	}
+
+	if SignWebhookPayload("other", "1700000000", []byte(`{"event":"course.completed"}`)) == signature {
+		t.Error("Expected the signature to depend on the secret")
+	}
+
+	if SignWebhookPayload("secret", "1700000001", []byte(`{"event":"course.completed"}`)) == signature {
+		t.Error("Expected the signature to depend on the timestamp")
+	}
+}
+
+func TestQueueWebhookEvent(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+
+	createTestCollections(t, app)
+	createTestWebhook(t, app, "http://localhost/completed", WebhookCourseCompleted)
+	createTestWebhook(t, app, "http://localhost/assigned", WebhookCourseAssigned)
+
+	// webhooks of other organizations never receive the event
+	otherOrganization := createTestWebhook(t, app, "http://localhost/other", WebhookCourseCompleted)
+	otherOrganization.Set("organization", testOrg2)
+	if err := app.Save(otherOrganization); err != nil {
+		t.Fatalf("Failed to save webhook: %v", err)
+	}
+
+	err := QueueWebhookEvent(app, WebhookCourseCompleted, "", map[string]any{"course": "course1"})
+	if err != nil {
+		t.Fatalf("QueueWebhookEvent failed: %v", err)
+	}
+
+	deliveries, err := app.FindAllRecords("webhook_deliveries")
+	if err != nil {
+		t.Fatalf("Failed to find webhook deliveries: %v", err)
+	}
+
+	if len(deliveries) != 1 {
+		t.Fatalf("Expected 1 delivery for the subscribed webhook, got %d", len(deliveries))
+	}
+
+	if status := deliveries[0].GetString("status"); status != DeliveryPending {
+		t.Errorf("Expected status %q, got %q", DeliveryPending, status)
+	}
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+	allowTestOutbound(t)
+
+	responseCode := http.StatusInternalServerError
+	var lastSignature, lastTimestamp, lastBody string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lastBody = string(body)
+		lastSignature = r.Header.Get(WebhookSignatureHeader)
+		lastTimestamp = r.Header.Get(WebhookTimestampHeader)
+		w.WriteHeader(responseCode)
+	}))
+	defer server.Close()
+
+	createTestCollections(t, app)
+	createTestWebhook(t, app, server.URL, WebhookCourseAssigned)
+
+	if err := QueueWebhookEvent(app, WebhookCourseAssigned, "", map[string]any{"course": "course1"}); err != nil {
+		t.Fatalf("QueueWebhookEvent failed: %v", err)
+	}
+
+	deliveries, err := app.FindAllRecords("webhook_deliveries")
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("Expected a single queued delivery, got %d (%v)", len(deliveries), err)
+	}
+	delivery := deliveries[0]
+
+	// an attempt is claimed, so a stale copy of the delivery isn't sent again
+	stale, err := app.FindRecordById("webhook_deliveries", delivery.Id)
+	if err != nil {
+		t.Fatalf("Failed to find webhook delivery: %v", err)
+	}
+
+	// failed attempts are retried with backoff
+	if err := DeliverWebhook(app, delivery); err == nil {
+		t.Fatal("Expected the delivery to fail on a 500 response")
+	}
+	if delivery.GetString("status") != DeliveryPending || delivery.GetInt("attempts") != 1 {
+		t.Errorf("Expected a pending retry after the first attempt, got %q (%d attempts)", delivery.GetString("status"), delivery.GetInt("attempts"))
+	}
+	if delivery.GetDateTime("next_attempt_at").IsZero() {
+		t.Error("Expected the next attempt to be scheduled")
+	}
+
+	if err := DeliverWebhook(app, stale); !errors.Is(err, ErrWebhookDeliveryClaimed) {
+		t.Errorf("Expected the stale attempt to be skipped, got %v", err)
+	}
+
+	responseCode = http.StatusOK
+	if err := DeliverWebhook(app, delivery); err != nil {
+		t.Fatalf("Expected the delivery to succeed, got %v", err)
+	}
+	if delivery.GetString("status") != DeliverySucceeded || delivery.GetInt("response_code") != http.StatusOK {
+		t.Errorf("Expected a succeeded delivery, got %q (%d)", delivery.GetString("status"), delivery.GetInt("response_code"))
+	}
+
+	expectedSignature := "sha256=" + SignWebhookPayload("test_secret", lastTimestamp, []byte(lastBody))
+	if lastSignature != expectedSignature {
+		t.Errorf("Expected signature %q, got %q", expectedSignature, lastSignature)
+	}
+
+	if !strings.Contains(lastBody, `"event":"course.assigned"`) {
+		t.Errorf("Expected the payload to contain the event name, got %s", lastBody)
+	}
+}
+
+func TestDeliverWebhook_GivesUpAfterRetries(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+	allowTestOutbound(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	createTestCollections(t, app)
+	createTestWebhook(t, app, server.URL, WebhookCourseUnassigned)
+
+	if err := QueueWebhookEvent(app, WebhookCourseUnassigned, "", nil); err != nil {
+		t.Fatalf("QueueWebhookEvent failed: %v", err)
+	}
+
+	deliveries, err := app.FindAllRecords("webhook_deliveries")
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("Expected a single queued delivery, got %d (%v)", len(deliveries), err)
+	}
+	delivery := deliveries[0]
+
+	for i := 0; i <= len(webhookRetryDelays); i++ {
+		DeliverWebhook(app, delivery)
+	}
+
+	if status := delivery.GetString("status"); status != DeliveryFailed {
+		t.Errorf("Expected status %q after exhausting retries, got %q", DeliveryFailed, status)
+	}
+}
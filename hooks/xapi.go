@@ -0,0 +1,616 @@
+package hooks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// xAPI verbs of the statements eLesson emits.
+const (
+	XapiVerbLaunched   = "http://adlnet.gov/expapi/verbs/launched"
+	XapiVerbProgressed = "http://adlnet.gov/expapi/verbs/progressed"
+	XapiVerbCompleted  = "http://adlnet.gov/expapi/verbs/completed"
+	XapiVerbPassed     = "http://adlnet.gov/expapi/verbs/passed"
+	XapiVerbAnswered   = "http://adlnet.gov/expapi/verbs/answered"
+	XapiVerbVoided     = "http://adlnet.gov/expapi/verbs/voided"
+)
+
+// xAPI activity types of the courses, lessons and their interactions.
+const (
+	XapiActivityCourse      = "http://adlnet.gov/expapi/activities/course"
+	XapiActivityLesson      = "http://adlnet.gov/expapi/activities/lesson"
+	XapiActivityInteraction = "http://adlnet.gov/expapi/activities/cmi.interaction"
+)
+
+// xapiInteractionTypes are the interaction types of xAPI, named like the
+// SCORM ones.
+var xapiInteractionTypes = []string{"true-false", "choice", "fill-in", "long-fill-in", "matching", "performance", "sequencing", "likert", "numeric", "other"}
+
+// xapiProgressExtension is the cmi5 result extension holding the completion percentage.
+const xapiProgressExtension = "https://w3id.org/xapi/cmi5/result/extensions/progress"
+
+var xapiVerbDisplay = map[string]string{
+	XapiVerbLaunched:    "launched",
+	XapiVerbProgressed:  "progressed",
+	XapiVerbCompleted:   "completed",
+	XapiVerbPassed:      "passed",
+	XapiVerbAnswered:    "answered",
+	XapiVerbVoided:      "voided",
+	Cmi5VerbInitialized: "initialized",
+	Cmi5VerbFailed:      "failed",
+	Cmi5VerbTerminated:  "terminated",
+	Cmi5VerbSatisfied:   "satisfied",
+}
+
+var (
+	ErrXapiInvalidStatement = errors.New("invalid xAPI statement")
+	ErrXapiConflict         = errors.New("a different statement with the same id exists")
+	ErrXapiInvalidQuery     = errors.New("invalid xAPI statements query")
+)
+
+// XapiStatement is an xAPI statement as decoded from JSON, kept as a map so
+// that stored statements are returned exactly as they were sent.
+type XapiStatement = map[string]any
+
+// xapiInvalid wraps a validation message into ErrXapiInvalidStatement.
+func xapiInvalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrXapiInvalidStatement, fmt.Sprintf(format, args...))
+}
+
+// isXapiIRI reports whether value is an absolute IRI.
+func isXapiIRI(value any) bool {
+	s, ok := value.(string)
+	if !ok || s == "" {
+		return false
+	}
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != ""
+}
+
+// isXapiUUID reports whether value is a UUID in its canonical form.
+func isXapiUUID(value any) bool {
+	s, ok := value.(string)
+	if !ok || len(s) != 36 {
+		return false
+	}
+	_, err := uuid.Parse(s)
+	return err == nil
+}
+
+// XapiAgentIFI returns the inverse functional identifier of an agent, eg.
+// "mbox:mailto:jane@example.com", or "" for anonymous groups.
+func XapiAgentIFI(agent map[string]any) (string, error) {
+	ifis := []string{}
+
+	if mbox, ok := agent["mbox"]; ok {
+		s, _ := mbox.(string)
+		if !strings.HasPrefix(s, "mailto:") || !strings.Contains(s, "@") {
+			return "", xapiInvalid("mbox must be a mailto IRI")
+		}
+		ifis = append(ifis, "mbox:"+strings.ToLower(s))
+	}
+	if sum, ok := agent["mbox_sha1sum"]; ok {
+		s, _ := sum.(string)
+		if len(s) != 40 {
+			return "", xapiInvalid("mbox_sha1sum must be a SHA1 hex digest")
+		}
+		ifis = append(ifis, "mbox_sha1sum:"+strings.ToLower(s))
+	}
+	if openID, ok := agent["openid"]; ok {
+		if !isXapiIRI(openID) {
+			return "", xapiInvalid("openid must be an IRI")
+		}
+		ifis = append(ifis, "openid:"+openID.(string))
+	}
+	if account, ok := agent["account"]; ok {
+		accountMap, _ := account.(map[string]any)
+		name, _ := accountMap["name"].(string)
+		if !isXapiIRI(accountMap["homePage"]) || name == "" {
+			return "", xapiInvalid("account must have a homePage IRI and a name")
+		}
+		ifis = append(ifis, "account:"+accountMap["homePage"].(string)+"|"+name)
+	}
+
+	if len(ifis) > 1 {
+		return "", xapiInvalid("an agent must have a single identifier")
+	}
+
+	objectType, _ := agent["objectType"].(string)
+	if objectType == "Group" {
+		members, _ := agent["member"].([]any)
+		if len(ifis) == 0 && len(members) == 0 {
+			return "", xapiInvalid("an anonymous group must list its members")
+		}
+		for _, member := range members {
+			memberMap, ok := member.(map[string]any)
+			if !ok {
+				return "", xapiInvalid("group members must be agents")
+			}
+			if _, err := XapiAgentIFI(memberMap); err != nil {
+				return "", err
+			}
+		}
+	} else if objectType != "" && objectType != "Agent" {
+		return "", xapiInvalid("invalid agent objectType %q", objectType)
+	} else if len(ifis) == 0 {
+		return "", xapiInvalid("an agent must have an identifier")
+	}
+
+	if len(ifis) == 0 {
+		return "", nil
+	}
+	return ifis[0], nil
+}
+
+// validateXapiStatement checks the parts of a statement the LRS relies on.
+func validateXapiStatement(statement XapiStatement, sub bool) error {
+	if id, ok := statement["id"]; ok && !isXapiUUID(id) {
+		return xapiInvalid("id must be a UUID")
+	}
+
+	actor, ok := statement["actor"].(map[string]any)
+	if !ok {
+		return xapiInvalid("missing actor")
+	}
+	if _, err := XapiAgentIFI(actor); err != nil {
+		return err
+	}
+
+	verb, ok := statement["verb"].(map[string]any)
+	if !ok || !isXapiIRI(verb["id"]) {
+		return xapiInvalid("verb must have an IRI id")
+	}
+
+	object, ok := statement["object"].(map[string]any)
+	if !ok {
+		return xapiInvalid("missing object")
+	}
+	objectType, _ := object["objectType"].(string)
+	switch objectType {
+	case "", "Activity":
+		if !isXapiIRI(object["id"]) {
+			return xapiInvalid("activity id must be an IRI")
+		}
+	case "Agent", "Group":
+		if _, err := XapiAgentIFI(object); err != nil {
+			return err
+		}
+	case "StatementRef":
+		if !isXapiUUID(object["id"]) {
+			return xapiInvalid("statement reference id must be a UUID")
+		}
+	case "SubStatement":
+		if sub {
+			return xapiInvalid("sub-statements can't be nested")
+		}
+		for _, field := range []string{"id", "stored", "version", "authority"} {
+			if _, ok := object[field]; ok {
+				return xapiInvalid("sub-statements can't have %s", field)
+			}
+		}
+		if err := validateXapiStatement(object, true); err != nil {
+			return err
+		}
+	default:
+		return xapiInvalid("invalid object objectType %q", objectType)
+	}
+
+	if verb["id"] == XapiVerbVoided && objectType != "StatementRef" {
+		return xapiInvalid("voiding statements must reference a statement")
+	}
+
+	if result, ok := statement["result"]; ok {
+		resultMap, ok := result.(map[string]any)
+		if !ok {
+			return xapiInvalid("result must be an object")
+		}
+		if score, ok := resultMap["score"].(map[string]any); ok {
+			if scaled, ok := score["scaled"].(float64); ok && (scaled < -1 || scaled > 1) {
+				return xapiInvalid("score.scaled must be between -1 and 1")
+			}
+			raw, hasRaw := score["raw"].(float64)
+			if min, ok := score["min"].(float64); ok && hasRaw && raw < min {
+				return xapiInvalid("score.raw must not be below score.min")
+			}
+			if max, ok := score["max"].(float64); ok && hasRaw && raw > max {
+				return xapiInvalid("score.raw must not be above score.max")
+			}
+		}
+	}
+
+	if context, ok := statement["context"]; ok {
+		contextMap, ok := context.(map[string]any)
+		if !ok {
+			return xapiInvalid("context must be an object")
+		}
+		if registration, ok := contextMap["registration"]; ok && !isXapiUUID(registration) {
+			return xapiInvalid("context.registration must be a UUID")
+		}
+	}
+
+	if timestamp, ok := statement["timestamp"]; ok {
+		s, _ := timestamp.(string)
+		if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+			return xapiInvalid("timestamp must be an ISO 8601 date")
+		}
+	}
+
+	return nil
+}
+
+// xapiSameStatement reports whether two statements are the same, ignoring the
+// properties set by the LRS.
+func xapiSameStatement(stored, incoming XapiStatement) bool {
+	strip := func(statement XapiStatement) map[string]any {
+		stripped := map[string]any{}
+		for key, value := range statement {
+			switch key {
+			case "stored", "authority", "version":
+			case "timestamp":
+				if _, ok := incoming["timestamp"]; ok {
+					stripped[key] = value
+				}
+			default:
+				stripped[key] = value
+			}
+		}
+		return stripped
+	}
+	return reflect.DeepEqual(strip(stored), strip(incoming))
+}
+
+// StoreXapiStatement validates a statement and stores it in the LRS of an
+// organization, filling in its id, timestamp, stored time and authority. Storing
+// the same statement again is a no-op. It returns the statement id.
+func StoreXapiStatement(app core.App, organizationID string, statement XapiStatement, authority map[string]any) (string, error) {
+	if err := validateXapiStatement(statement, false); err != nil {
+		return "", err
+	}
+
+	statementsCollection, err := app.FindCollectionByNameOrId("xapi_statements")
+	if err != nil {
+		return "", fmt.Errorf("failed to find xapi_statements collection: %w", err)
+	}
+
+	id, _ := statement["id"].(string)
+	id = strings.ToLower(id)
+	if id != "" {
+		existing, err := app.FindFirstRecordByData(statementsCollection, "statement_id", id)
+		if err == nil {
+			stored := XapiStatement{}
+			if err := existing.UnmarshalJSONField("statement", &stored); err != nil {
+				return "", fmt.Errorf("failed to read stored statement: %w", err)
+			}
+			if existing.GetString("organization") != organizationID || !xapiSameStatement(stored, statement) {
+				return "", ErrXapiConflict
+			}
+			return id, nil
+		}
+	} else {
+		id = uuid.NewString()
+	}
+
+	now := types.NowDateTime()
+	statement["id"] = id
+	statement["stored"] = now.Time().Format(time.RFC3339Nano)
+	if _, ok := statement["timestamp"]; !ok {
+		statement["timestamp"] = statement["stored"]
+	}
+	if _, ok := statement["authority"]; !ok && authority != nil {
+		statement["authority"] = authority
+	}
+	if _, ok := statement["version"]; !ok {
+		statement["version"] = xapiVersion
+	}
+
+	actor := statement["actor"].(map[string]any)
+	actorIFI, _ := XapiAgentIFI(actor)
+	verb := statement["verb"].(map[string]any)
+	object := statement["object"].(map[string]any)
+
+	record := core.NewRecord(statementsCollection)
+	record.Set("statement_id", id)
+	record.Set("organization", organizationID)
+	record.Set("actor_ifi", actorIFI)
+	record.Set("verb", verb["id"])
+	if objectType, _ := object["objectType"].(string); objectType == "" || objectType == "Activity" {
+		record.Set("activity", object["id"])
+	}
+	if context, ok := statement["context"].(map[string]any); ok {
+		record.Set("registration", context["registration"])
+	}
+	timestamp, _ := time.Parse(time.RFC3339Nano, statement["timestamp"].(string))
+	record.Set("timestamp", timestamp)
+	record.Set("stored", now)
+	record.Set("statement", statement)
+
+	// statements about a learner of the organization are linked to its user,
+	// identified by its email or by its eLesson account (cmi5 actors)
+	var user *core.Record
+	if email, ok := strings.CutPrefix(actorIFI, "mbox:mailto:"); ok {
+		user, _ = app.FindAuthRecordByEmail("users", email)
+	} else if id, ok := strings.CutPrefix(actorIFI, "account:"+strings.TrimRight(app.Settings().Meta.AppURL, "/")+"|"); ok {
+		user, _ = app.FindRecordById("users", id)
+	}
+	if user != nil && user.GetString("organization") == organizationID {
+		record.Set("user", user.Id)
+	}
+
+	return id, app.RunInTransaction(func(txApp core.App) error {
+		if verb["id"] == XapiVerbVoided {
+			voided, err := txApp.FindFirstRecordByFilter(
+				statementsCollection,
+				"statement_id = {:id} && organization = {:organization}",
+				dbx.Params{"id": strings.ToLower(object["id"].(string)), "organization": organizationID},
+			)
+			if err == nil {
+				if voided.GetString("verb") == XapiVerbVoided {
+					return xapiInvalid("voiding statements can't be voided")
+				}
+				voided.Set("voided", true)
+				if err := txApp.Save(voided); err != nil {
+					return fmt.Errorf("failed to void statement: %w", err)
+				}
+			}
+		}
+
+		if err := txApp.Save(record); err != nil {
+			return fmt.Errorf("failed to save xAPI statement: %w", err)
+		}
+		return nil
+	})
+}
+
+// xapiAuthority is the agent eLesson emits its own statements as.
+func xapiAuthority(app core.App) map[string]any {
+	return map[string]any{
+		"objectType": "Agent",
+		"name":       "eLesson",
+		"account": map[string]any{
+			"homePage": strings.TrimRight(app.Settings().Meta.AppURL, "/"),
+			"name":     "elesson",
+		},
+	}
+}
+
+// xapiLearner returns the agent of a user, identified by its email.
+func xapiLearner(user *core.Record) map[string]any {
+	name := user.GetString("name")
+	if name == "" {
+		name = user.Email()
+	}
+	return map[string]any{
+		"objectType": "Agent",
+		"name":       name,
+		"mbox":       "mailto:" + user.Email(),
+	}
+}
+
+// xapiActivity returns the activity of a course or lesson record.
+func xapiActivity(app core.App, record *core.Record, activityType string) map[string]any {
+	return map[string]any{
+		"objectType": "Activity",
+		"id":         strings.TrimRight(app.Settings().Meta.AppURL, "/") + "/xapi/activities/" + record.Collection().Name + "/" + record.Id,
+		"definition": map[string]any{
+			"name": map[string]string{"en-US": record.GetString("title")},
+			"type": activityType,
+		},
+	}
+}
+
+// xapiRegistration derives the registration of the statements about an
+// enrollment from its progress record.
+func xapiRegistration(progressID string) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("elesson:progress:"+progressID)).String()
+}
+
+// EmitXapiStatement stores a statement by a user of the organization of a course.
+func EmitXapiStatement(app core.App, course, user *core.Record, verb string, object map[string]any, result, context map[string]any) error {
+	organizationID := course.GetString("organization")
+	if organizationID == "" {
+		return nil
+	}
+
+	statement := XapiStatement{
+		"actor": xapiLearner(user),
+		"verb": map[string]any{
+			"id":      verb,
+			"display": map[string]string{"en-US": xapiVerbDisplay[verb]},
+		},
+		"object": object,
+	}
+	if result != nil {
+		statement["result"] = result
+	}
+	if context != nil {
+		statement["context"] = context
+	}
+
+	// round trip through JSON so that emitted statements are stored like received ones
+	raw, err := json.Marshal(statement)
+	if err != nil {
+		return fmt.Errorf("failed to serialize xAPI statement: %w", err)
+	}
+	statement = XapiStatement{}
+	if err := json.Unmarshal(raw, &statement); err != nil {
+		return fmt.Errorf("failed to serialize xAPI statement: %w", err)
+	}
+
+	_, err = StoreXapiStatement(app, organizationID, statement, xapiAuthority(app))
+	return err
+}
+
+// xapiLessonContext returns the context of the statements about a lesson of
+// course: the course as parent activity and the registration of the learner.
+func xapiLessonContext(app core.App, course *core.Record, userID string) map[string]any {
+	context := map[string]any{
+		"contextActivities": map[string]any{"parent": []any{xapiActivity(app, course, XapiActivityCourse)}},
+	}
+	if progress, err := app.FindFirstRecordByFilter(
+		"progress",
+		"course = {:course} && assignee = {:user}",
+		dbx.Params{"course": course.Id, "user": userID},
+	); err == nil {
+		context["registration"] = xapiRegistration(progress.Id)
+	}
+	return context
+}
+
+// EmitXapiLessonResult records that a learner passed or failed a lesson,
+// according to the success of the xAPI result.
+func EmitXapiLessonResult(app core.App, lesson *core.Record, userID string, result map[string]any) error {
+	course, err := app.FindRecordById("courses", lesson.GetString("course"))
+	if err != nil {
+		return fmt.Errorf("failed to find course: %w", err)
+	}
+	user, err := app.FindRecordById("users", userID)
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	verb := Cmi5VerbFailed
+	if success, _ := result["success"].(bool); success {
+		verb = XapiVerbPassed
+	}
+
+	return EmitXapiStatement(app, course, user, verb, xapiActivity(app, lesson, XapiActivityLesson), result, xapiLessonContext(app, course, user.Id))
+}
+
+// EmitXapiLessonAnswer records the answer of a learner to an interaction of a
+// lesson, like a quiz question of a SCORM package.
+func EmitXapiLessonAnswer(app core.App, lesson *core.Record, userID, interactionID, interactionType string, result map[string]any) error {
+	course, err := app.FindRecordById("courses", lesson.GetString("course"))
+	if err != nil {
+		return fmt.Errorf("failed to find course: %w", err)
+	}
+	user, err := app.FindRecordById("users", userID)
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	lessonActivity := xapiActivity(app, lesson, XapiActivityLesson)
+	definition := map[string]any{"type": XapiActivityInteraction}
+	if slices.Contains(xapiInteractionTypes, interactionType) {
+		definition["interactionType"] = interactionType
+	}
+	object := map[string]any{
+		"objectType": "Activity",
+		"id":         lessonActivity["id"].(string) + "/interactions/" + url.PathEscape(interactionID),
+		"definition": definition,
+	}
+
+	context := xapiLessonContext(app, course, user.Id)
+	context["contextActivities"] = map[string]any{
+		"parent":   []any{lessonActivity},
+		"grouping": []any{xapiActivity(app, course, XapiActivityCourse)},
+	}
+
+	return EmitXapiStatement(app, course, user, XapiVerbAnswered, object, result, context)
+}
+
+// xapiCourseProgress returns the percentage of the course lessons a user completed.
+func xapiCourseProgress(app core.App, courseID, userID string) (int, error) {
+	lessons, err := app.CountRecords("lessons", dbx.HashExp{"course": courseID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count lessons: %w", err)
+	}
+	if lessons == 0 {
+		return 0, nil
+	}
+
+	completed, err := app.CountRecords("lesson_progress", dbx.HashExp{"course": courseID, "assignee": userID, "completed": true})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count completed lessons: %w", err)
+	}
+
+	return min(100, int(math.Round(float64(completed)*100/float64(lessons)))), nil
+}
+
+// bindXapiSubscribers emits the xAPI statements of the course and lesson events.
+func bindXapiSubscribers(events *CourseEvents) {
+	events.OnProgressStatusChanged.BindFunc(func(e *ProgressStatusChangedEvent) error {
+		if e.To != StatusCompleted && !(e.From == StatusNotStarted && e.To == StatusInProgress) {
+			return e.Next()
+		}
+
+		course, err := e.App.FindRecordById("courses", e.Progress.GetString("course"))
+		if err != nil {
+			return fmt.Errorf("failed to find course: %w", err)
+		}
+		user, err := e.App.FindRecordById("users", e.Progress.GetString("assignee"))
+		if err != nil {
+			return fmt.Errorf("failed to find user: %w", err)
+		}
+
+		context := map[string]any{"registration": xapiRegistration(e.Progress.Id)}
+
+		if e.To == StatusCompleted {
+			err = EmitXapiStatement(e.App, course, user, XapiVerbCompleted, xapiActivity(e.App, course, XapiActivityCourse), map[string]any{
+				"completion": true,
+				"extensions": map[string]any{xapiProgressExtension: 100},
+			}, context)
+		} else {
+			err = EmitXapiStatement(e.App, course, user, XapiVerbLaunched, xapiActivity(e.App, course, XapiActivityCourse), nil, context)
+		}
+		if err != nil {
+			return err
+		}
+
+		return e.Next()
+	})
+
+	events.OnLessonCompleted.BindFunc(func(e *LessonCompletedEvent) error {
+		lesson, err := e.App.FindRecordById("lessons", e.LessonProgress.GetString("lesson"))
+		if err != nil {
+			return fmt.Errorf("failed to find lesson: %w", err)
+		}
+		course, err := e.App.FindRecordById("courses", lesson.GetString("course"))
+		if err != nil {
+			return fmt.Errorf("failed to find course: %w", err)
+		}
+		user, err := e.App.FindRecordById("users", e.LessonProgress.GetString("assignee"))
+		if err != nil {
+			return fmt.Errorf("failed to find user: %w", err)
+		}
+
+		courseActivity := xapiActivity(e.App, course, XapiActivityCourse)
+		context := xapiLessonContext(e.App, course, user.Id)
+
+		err = EmitXapiStatement(e.App, course, user, XapiVerbCompleted, xapiActivity(e.App, lesson, XapiActivityLesson), map[string]any{
+			"completion": true,
+		}, context)
+		if err != nil {
+			return err
+		}
+
+		percentage, err := xapiCourseProgress(e.App, course.Id, user.Id)
+		if err != nil {
+			return err
+		}
+
+		courseContext := map[string]any{}
+		if registration, ok := context["registration"]; ok {
+			courseContext["registration"] = registration
+		}
+		err = EmitXapiStatement(e.App, course, user, XapiVerbProgressed, courseActivity, map[string]any{
+			"extensions": map[string]any{xapiProgressExtension: percentage},
+		}, courseContext)
+		if err != nil {
+			return err
+		}
+
+		return e.Next()
+	})
+}
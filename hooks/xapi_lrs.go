@@ -0,0 +1,553 @@
+package hooks
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	xapiVersion             = "1.0.3"
+	xapiVersionHeader       = "X-Experience-API-Version"
+	xapiConsistentHeader    = "X-Experience-API-Consistent-Through"
+	xapiMaxResults          = 100
+	xapiForwardBatchSize    = 50
+	xapiForwardMaxBatches   = 20
+	xapiForwardDelay        = 5 * time.Second
+	xapiCredentialsStoreKey = "elesson.xapiCredentials"
+)
+
+var xapiClient = newOutboundClient(10 * time.Second)
+
+// HashXapiSecret returns the hex encoded SHA-256 of an LRS credentials secret.
+func HashXapiSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateXapiCredentials issues Basic auth credentials for the LRS of an
+// organization: the key is the record id and only the hash of the secret is
+// stored, so the secret can't be shown again.
+func CreateXapiCredentials(app core.App, organizationID, name string, readOnly bool) (string, string, error) {
+	collection, err := app.FindCollectionByNameOrId("xapi_credentials")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to find xapi_credentials collection: %w", err)
+	}
+
+	secret := security.RandomString(40)
+
+	record := core.NewRecord(collection)
+	record.Set("name", name)
+	record.Set("organization", organizationID)
+	record.Set("secret_hash", HashXapiSecret(secret))
+	record.Set("read_only", readOnly)
+
+	if err := app.Save(record); err != nil {
+		return "", "", fmt.Errorf("failed to save xAPI credentials: %w", err)
+	}
+
+	return record.Id, secret, nil
+}
+
+// requireXapiCredentials checks the xAPI version header and authenticates the
+// LRS requests with the Basic auth credentials of an organization, or with the
+// auth token of a cmi5 AU session.
+func requireXapiCredentials() *hook.Handler[*core.RequestEvent] {
+	return &hook.Handler[*core.RequestEvent]{
+		Id: "elessonRequireXapiCredentials",
+		Func: func(e *core.RequestEvent) error {
+			e.Response.Header().Set(xapiVersionHeader, xapiVersion)
+
+			if !strings.HasPrefix(e.Request.Header.Get(xapiVersionHeader), "1.0") {
+				return e.BadRequestError("Missing or unsupported "+xapiVersionHeader+" header.", nil)
+			}
+
+			key, secret, ok := e.Request.BasicAuth()
+			if !ok {
+				return e.UnauthorizedError("Missing or invalid LRS credentials.", nil)
+			}
+
+			record, err := e.App.FindRecordById("xapi_credentials", key)
+			if err != nil {
+				session, err := findCmi5SessionCredentials(e.App, key, secret)
+				if err != nil {
+					return e.UnauthorizedError("Missing or invalid LRS credentials.", nil)
+				}
+				e.Set(cmi5SessionStoreKey, session)
+				return e.Next()
+			}
+			if !record.GetDateTime("revoked_at").IsZero() || record.GetString("secret_hash") != HashXapiSecret(secret) {
+				return e.UnauthorizedError("Missing or invalid LRS credentials.", nil)
+			}
+
+			lastUsedAt := record.GetDateTime("last_used_at")
+			if lastUsedAt.IsZero() || time.Since(lastUsedAt.Time()) > time.Minute {
+				record.Set("last_used_at", types.NowDateTime())
+				if err := e.App.Save(record); err != nil {
+					e.App.Logger().Warn("Failed to update xAPI credentials usage", "error", err)
+				}
+			}
+
+			e.Set(xapiCredentialsStoreKey, record)
+
+			return e.Next()
+		},
+	}
+}
+
+// xapiCredentials returns the LRS credentials of the request, nil for cmi5 sessions.
+func xapiCredentials(e *core.RequestEvent) *core.Record {
+	credentials, _ := e.Get(xapiCredentialsStoreKey).(*core.Record)
+	return credentials
+}
+
+// cmi5Session returns the cmi5 AU session of the request, nil for LRS credentials.
+func cmi5Session(e *core.RequestEvent) *core.Record {
+	session, _ := e.Get(cmi5SessionStoreKey).(*core.Record)
+	return session
+}
+
+// xapiOrganization returns the organization whose LRS the request accesses.
+func xapiOrganization(e *core.RequestEvent) string {
+	if session := cmi5Session(e); session != nil {
+		return session.GetString("organization")
+	}
+	return xapiCredentials(e).GetString("organization")
+}
+
+// xapiCredentialsAuthority is the agent the statements stored with credentials are attributed to.
+func xapiCredentialsAuthority(e *core.RequestEvent) map[string]any {
+	credentials := xapiCredentials(e)
+	return map[string]any{
+		"objectType": "Agent",
+		"name":       credentials.GetString("name"),
+		"account": map[string]any{
+			"homePage": strings.TrimRight(e.App.Settings().Meta.AppURL, "/"),
+			"name":     credentials.Id,
+		},
+	}
+}
+
+// xapiStoreError maps the statement storage errors to LRS responses.
+func xapiStoreError(e *core.RequestEvent, err error) error {
+	switch {
+	case errors.Is(err, ErrXapiInvalidStatement):
+		return e.BadRequestError(err.Error(), nil)
+	case errors.Is(err, ErrXapiConflict):
+		return e.Error(http.StatusConflict, err.Error(), nil)
+	case errors.Is(err, ErrCmi5Rejected):
+		return e.ForbiddenError(err.Error(), nil)
+	default:
+		return e.InternalServerError("Failed to store the statements.", err)
+	}
+}
+
+// xapiCursor encodes the position after a statement for the "more" link.
+func xapiCursor(record *core.Record) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(record.GetDateTime("stored").String() + "|" + record.Id))
+}
+
+// queryXapiStatements returns a page of the statements of the organization
+// matching the LRS query parameters, and the cursor of the next page.
+func queryXapiStatements(app core.App, organizationID string, params url.Values) ([]*core.Record, string, error) {
+	for _, related := range []string{"related_activities", "related_agents"} {
+		if params.Get(related) == "true" {
+			return nil, "", xapiInvalidQuery("%s is not supported", related)
+		}
+	}
+
+	query := app.RecordQuery("xapi_statements").AndWhere(dbx.HashExp{
+		"organization": organizationID,
+		"voided":       false,
+	})
+
+	if agent := params.Get("agent"); agent != "" {
+		agentMap := map[string]any{}
+		if err := json.Unmarshal([]byte(agent), &agentMap); err != nil {
+			return nil, "", xapiInvalidQuery("agent must be a JSON agent")
+		}
+		ifi, err := XapiAgentIFI(agentMap)
+		if err != nil || ifi == "" {
+			return nil, "", xapiInvalidQuery("agent must be an identified agent")
+		}
+		query.AndWhere(dbx.HashExp{"actor_ifi": ifi})
+	}
+	if verb := params.Get("verb"); verb != "" {
+		query.AndWhere(dbx.HashExp{"verb": verb})
+	}
+	if activity := params.Get("activity"); activity != "" {
+		query.AndWhere(dbx.HashExp{"activity": activity})
+	}
+	if registration := params.Get("registration"); registration != "" {
+		query.AndWhere(dbx.HashExp{"registration": strings.ToLower(registration)})
+	}
+	for param, operator := range map[string]string{"since": ">", "until": "<="} {
+		if value := params.Get(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return nil, "", xapiInvalidQuery("%s must be an ISO 8601 date", param)
+			}
+			date, _ := types.ParseDateTime(parsed)
+			query.AndWhere(dbx.NewExp("[[stored]] "+operator+" {:"+param+"}", dbx.Params{param: date.String()}))
+		}
+	}
+
+	ascending := params.Get("ascending") == "true"
+	order, comparison := "DESC", "<"
+	if ascending {
+		order, comparison = "ASC", ">"
+	}
+
+	if cursor := params.Get("cursor"); cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(cursor)
+		stored, id, ok := strings.Cut(string(raw), "|")
+		if err != nil || !ok {
+			return nil, "", xapiInvalidQuery("invalid cursor")
+		}
+		query.AndWhere(dbx.NewExp(
+			"([[stored]] "+comparison+" {:cursorStored} OR ([[stored]] = {:cursorStored} AND [[id]] "+comparison+" {:cursorId}))",
+			dbx.Params{"cursorStored": stored, "cursorId": id},
+		))
+	}
+
+	limit := xapiMaxResults
+	if value := params.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return nil, "", xapiInvalidQuery("limit must be a positive number")
+		}
+		if parsed > 0 && parsed < limit {
+			limit = parsed
+		}
+	}
+
+	records := []*core.Record{}
+	err := query.OrderBy("stored "+order, "id "+order).Limit(int64(limit + 1)).All(&records)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query statements: %w", err)
+	}
+
+	more := ""
+	if len(records) > limit {
+		records = records[:limit]
+		more = xapiCursor(records[len(records)-1])
+	}
+
+	return records, more, nil
+}
+
+// xapiInvalidQuery wraps a query parameter error into ErrXapiInvalidQuery.
+func xapiInvalidQuery(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrXapiInvalidQuery, fmt.Sprintf(format, args...))
+}
+
+// xapiStatementOf decodes the statement of an xapi_statements record.
+func xapiStatementOf(record *core.Record) XapiStatement {
+	statement := XapiStatement{}
+	record.UnmarshalJSONField("statement", &statement)
+	return statement
+}
+
+func bindXapiRoutes(r *router.Router[*core.RequestEvent], courseService *CourseService) {
+	r.GET("/xapi/about", func(e *core.RequestEvent) error {
+		e.Response.Header().Set(xapiVersionHeader, xapiVersion)
+		return e.JSON(http.StatusOK, map[string]any{"version": []string{xapiVersion}})
+	})
+
+	statements := r.Group("/xapi/statements")
+	statements.Bind(requireXapiCredentials())
+
+	readBody := func(e *core.RequestEvent) (any, error) {
+		if contentType := e.Request.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+			return nil, e.BadRequestError("Statements must be sent as application/json.", nil)
+		}
+		if credentials := xapiCredentials(e); credentials != nil && credentials.GetBool("read_only") {
+			return nil, e.ForbiddenError("The LRS credentials are read-only.", nil)
+		}
+
+		var body any
+		if err := json.NewDecoder(e.Request.Body).Decode(&body); err != nil {
+			return nil, e.BadRequestError("Invalid JSON.", err)
+		}
+		return body, nil
+	}
+
+	// the statements of AU sessions are checked against the cmi5 rules and
+	// update the progress of their learner
+	storeStatement := func(e *core.RequestEvent, app core.App, statement XapiStatement) (string, error) {
+		if session := cmi5Session(e); session != nil {
+			return courseService.withApp(app).StoreCmi5Statement(session, statement)
+		}
+		return StoreXapiStatement(app, xapiCredentials(e).GetString("organization"), statement, xapiCredentialsAuthority(e))
+	}
+
+	// store a single statement with the given id
+	statements.PUT("", func(e *core.RequestEvent) error {
+		body, err := readBody(e)
+		if err != nil {
+			return err
+		}
+
+		statement, ok := body.(map[string]any)
+		statementID := e.Request.URL.Query().Get("statementId")
+		if !ok || !isXapiUUID(statementID) {
+			return e.BadRequestError("A statement and its statementId are required.", nil)
+		}
+		if id, ok := statement["id"]; ok && !strings.EqualFold(fmt.Sprint(id), statementID) {
+			return e.BadRequestError("The statement id doesn't match statementId.", nil)
+		}
+		statement["id"] = strings.ToLower(statementID)
+
+		if _, err := storeStatement(e, e.App, statement); err != nil {
+			return xapiStoreError(e, err)
+		}
+
+		return e.NoContent(http.StatusNoContent)
+	})
+
+	// store one or several statements, returning their ids
+	statements.POST("", func(e *core.RequestEvent) error {
+		body, err := readBody(e)
+		if err != nil {
+			return err
+		}
+
+		batch := []any{body}
+		if list, ok := body.([]any); ok {
+			batch = list
+		}
+
+		ids := make([]string, 0, len(batch))
+		err = e.App.RunInTransaction(func(txApp core.App) error {
+			seen := map[string]bool{}
+			for _, item := range batch {
+				statement, ok := item.(map[string]any)
+				if !ok {
+					return xapiInvalid("statements must be objects")
+				}
+				if id, ok := statement["id"].(string); ok {
+					if seen[strings.ToLower(id)] {
+						return xapiInvalid("duplicate statement id %s", id)
+					}
+					seen[strings.ToLower(id)] = true
+				}
+
+				id, err := storeStatement(e, txApp, statement)
+				if err != nil {
+					return err
+				}
+				ids = append(ids, id)
+			}
+			return nil
+		})
+		if err != nil {
+			return xapiStoreError(e, err)
+		}
+
+		return e.JSON(http.StatusOK, ids)
+	})
+
+	// get a statement by id, or query the statements
+	statements.GET("", func(e *core.RequestEvent) error {
+		if cmi5Session(e) != nil {
+			return e.ForbiddenError("cmi5 sessions can only send statements.", nil)
+		}
+
+		organizationID := xapiCredentials(e).GetString("organization")
+		params := e.Request.URL.Query()
+
+		e.Response.Header().Set(xapiConsistentHeader, time.Now().UTC().Format(time.RFC3339Nano))
+
+		statementID, voided := params.Get("statementId"), false
+		if id := params.Get("voidedStatementId"); id != "" {
+			statementID, voided = id, true
+		}
+		if statementID != "" {
+			record, err := e.App.FindFirstRecordByFilter(
+				"xapi_statements",
+				"statement_id = {:id} && organization = {:organization}",
+				dbx.Params{"id": strings.ToLower(statementID), "organization": organizationID},
+			)
+			if err != nil || record.GetBool("voided") != voided {
+				return e.NotFoundError("", err)
+			}
+			return e.JSON(http.StatusOK, xapiStatementOf(record))
+		}
+
+		records, cursor, err := queryXapiStatements(e.App, organizationID, params)
+		if err != nil {
+			if errors.Is(err, ErrXapiInvalidQuery) {
+				return e.BadRequestError(err.Error(), nil)
+			}
+			return e.InternalServerError("Failed to query the statements.", err)
+		}
+
+		result := make([]XapiStatement, 0, len(records))
+		for _, record := range records {
+			result = append(result, xapiStatementOf(record))
+		}
+
+		more := ""
+		if cursor != "" {
+			params.Set("cursor", cursor)
+			more = "/xapi/statements?" + params.Encode()
+		}
+
+		return e.JSON(http.StatusOK, map[string]any{
+			"statements": result,
+			"more":       more,
+		})
+	})
+
+	bindXapiStateRoutes(r)
+}
+
+// ForwardXapiStatements sends the statements of the organization stored since
+// the forwarder cursor to its external LRS, in batches, advancing the cursor
+// after each accepted batch.
+func ForwardXapiStatements(app core.App, forwarder *core.Record) error {
+	endpoint := strings.TrimRight(forwarder.GetString("endpoint"), "/") + "/statements"
+
+	for range xapiForwardMaxBatches {
+		// statements stored within the same millisecond are ordered by their random id,
+		// so the latest ones are left for the next run to never skip one with the cursor
+		query := app.RecordQuery("xapi_statements").
+			AndWhere(dbx.HashExp{"organization": forwarder.GetString("organization")}).
+			AndWhere(dbx.NewExp("[[stored]] < {:settled}", dbx.Params{"settled": types.NowDateTime().Add(-xapiForwardDelay).String()}))
+		if cursor := forwarder.GetDateTime("cursor"); !cursor.IsZero() {
+			query.AndWhere(dbx.NewExp(
+				"([[stored]] > {:cursor} OR ([[stored]] = {:cursor} AND [[id]] > {:cursorId}))",
+				dbx.Params{"cursor": cursor.String(), "cursorId": forwarder.GetString("cursor_id")},
+			))
+		}
+
+		records := []*core.Record{}
+		if err := query.OrderBy("stored ASC", "id ASC").Limit(xapiForwardBatchSize).All(&records); err != nil {
+			return fmt.Errorf("failed to find statements to forward: %w", err)
+		}
+		if len(records) == 0 {
+			return nil
+		}
+
+		batch := make([]XapiStatement, 0, len(records))
+		for _, record := range records {
+			batch = append(batch, xapiStatementOf(record))
+		}
+
+		err := sendXapiStatements(forwarder, http.MethodPost, endpoint, batch)
+		if errors.Is(err, ErrXapiConflict) {
+			// some statements were forwarded already, send the others one by one
+			err = nil
+			for _, statement := range batch {
+				statementURL := endpoint + "?statementId=" + url.QueryEscape(fmt.Sprint(statement["id"]))
+				if sendErr := sendXapiStatements(forwarder, http.MethodPut, statementURL, statement); sendErr != nil && !errors.Is(sendErr, ErrXapiConflict) {
+					err = sendErr
+					break
+				}
+			}
+		}
+
+		if err != nil {
+			forwarder.Set("last_error", err.Error())
+			if saveErr := app.Save(forwarder); saveErr != nil {
+				return fmt.Errorf("failed to save xAPI forwarder: %w", saveErr)
+			}
+			return err
+		}
+
+		last := records[len(records)-1]
+		forwarder.Set("cursor", last.GetDateTime("stored"))
+		forwarder.Set("cursor_id", last.Id)
+		forwarder.Set("last_forwarded_at", types.NowDateTime())
+		forwarder.Set("last_error", "")
+		if err := app.Save(forwarder); err != nil {
+			return fmt.Errorf("failed to save xAPI forwarder: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// sendXapiStatements sends statements to an external LRS with the forwarder credentials.
+func sendXapiStatements(forwarder *core.Record, method, endpoint string, statements any) error {
+	body, err := json.Marshal(statements)
+	if err != nil {
+		return fmt.Errorf("failed to serialize statements: %w", err)
+	}
+
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(xapiVersionHeader, xapiVersion)
+	if username := forwarder.GetString("username"); username != "" {
+		req.SetBasicAuth(username, forwarder.GetString("password"))
+	}
+
+	res, err := xapiClient.Do(req)
+	if err != nil {
+		return err
+	}
+	// only the status is kept, the org admins read the forwarder errors
+	res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusConflict:
+		return ErrXapiConflict
+	case res.StatusCode < 200 || res.StatusCode > 299:
+		return fmt.Errorf("unexpected response status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// xapiForwarding prevents overlapping forwarding runs.
+var xapiForwarding sync.Mutex
+
+// ForwardAllXapiStatements runs every active forwarder.
+func ForwardAllXapiStatements(app core.App) error {
+	if !xapiForwarding.TryLock() {
+		return nil
+	}
+	defer xapiForwarding.Unlock()
+
+	forwarders, err := app.FindAllRecords("xapi_forwarders", dbx.HashExp{"active": true})
+	if err != nil {
+		return fmt.Errorf("failed to find xAPI forwarders: %w", err)
+	}
+
+	for _, forwarder := range forwarders {
+		if err := ForwardXapiStatements(app, forwarder); err != nil {
+			app.Logger().Warn("xAPI forwarding failed", "forwarder", forwarder.Id, "error", err)
+		}
+	}
+
+	return nil
+}
+
+func initXapiHooks(app core.App) {
+	bindXapiSubscribers(Events(app))
+
+	app.Cron().MustAdd("xapiForwarding", "* * * * *", func() {
+		if err := ForwardAllXapiStatements(app); err != nil {
+			app.Logger().Error("Failed to forward xAPI statements", "error", err)
+		}
+	})
+}
@@ -0,0 +1,283 @@
+package hooks
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// xapiMaxStateSize limits the documents of the State API.
+const xapiMaxStateSize = 1 << 20
+
+// xapiStateKey identifies the documents of an activity state. A document is
+// selected by its StateID, an empty one selects all the documents.
+type xapiStateKey struct {
+	Organization string
+	ActivityID   string
+	AgentIFI     string
+	Registration string
+	StateID      string
+}
+
+// xapiStateQuery returns the query of the state documents matching key.
+func xapiStateQuery(app core.App, key xapiStateKey) *dbx.SelectQuery {
+	query := app.RecordQuery("xapi_states").AndWhere(dbx.HashExp{
+		"organization": key.Organization,
+		"activity_id":  key.ActivityID,
+		"agent_ifi":    key.AgentIFI,
+		"registration": key.Registration,
+	})
+	if key.StateID != "" {
+		query.AndWhere(dbx.HashExp{"state_id": key.StateID})
+	}
+	return query
+}
+
+// findXapiState returns the state document of key.
+func findXapiState(app core.App, key xapiStateKey) (*core.Record, error) {
+	record := &core.Record{}
+	if err := xapiStateQuery(app, key).Limit(1).One(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// saveXapiState creates or replaces the state document of key.
+func saveXapiState(app core.App, key xapiStateKey, contentType string, content []byte) error {
+	record, err := findXapiState(app, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		collection, findErr := app.FindCollectionByNameOrId("xapi_states")
+		if findErr != nil {
+			return fmt.Errorf("failed to find xapi_states collection: %w", findErr)
+		}
+		record = core.NewRecord(collection)
+		record.Set("organization", key.Organization)
+		record.Set("activity_id", key.ActivityID)
+		record.Set("agent_ifi", key.AgentIFI)
+		record.Set("registration", key.Registration)
+		record.Set("state_id", key.StateID)
+	} else if err != nil {
+		return fmt.Errorf("failed to find state document: %w", err)
+	}
+
+	record.Set("content_type", contentType)
+	record.Set("content", string(content))
+
+	if err := app.Save(record); err != nil {
+		return fmt.Errorf("failed to save state document: %w", err)
+	}
+	return nil
+}
+
+// xapiStateRequestKey reads the state document parameters of a request.
+func xapiStateRequestKey(e *core.RequestEvent, requireStateID bool) (xapiStateKey, error) {
+	params := e.Request.URL.Query()
+
+	key := xapiStateKey{
+		Organization: xapiOrganization(e),
+		ActivityID:   params.Get("activityId"),
+		Registration: strings.ToLower(params.Get("registration")),
+		StateID:      params.Get("stateId"),
+	}
+	if !isXapiIRI(key.ActivityID) {
+		return key, e.BadRequestError("activityId must be an IRI.", nil)
+	}
+	if key.Registration != "" && !isXapiUUID(key.Registration) {
+		return key, e.BadRequestError("registration must be a UUID.", nil)
+	}
+	if requireStateID && key.StateID == "" {
+		return key, e.BadRequestError("stateId is required.", nil)
+	}
+
+	agent := map[string]any{}
+	if err := json.Unmarshal([]byte(params.Get("agent")), &agent); err != nil {
+		return key, e.BadRequestError("agent must be a JSON agent.", nil)
+	}
+	ifi, err := XapiAgentIFI(agent)
+	if err != nil || ifi == "" {
+		return key, e.BadRequestError("agent must be an identified agent.", nil)
+	}
+	key.AgentIFI = ifi
+
+	// AU sessions can only access the state of their AU and learner
+	if session := cmi5Session(e); session != nil {
+		if err := cmi5StateAllowed(e.App, session, key, e.Request.Method != http.MethodGet); err != nil {
+			return key, e.ForbiddenError(err.Error(), nil)
+		}
+	}
+
+	return key, nil
+}
+
+// readXapiStateBody reads the document sent to the State API.
+func readXapiStateBody(e *core.RequestEvent) (string, []byte, error) {
+	if credentials := xapiCredentials(e); credentials != nil && credentials.GetBool("read_only") {
+		return "", nil, e.ForbiddenError("The LRS credentials are read-only.", nil)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(e.Request.Body, xapiMaxStateSize+1))
+	if err != nil {
+		return "", nil, e.BadRequestError("Failed to read the document.", err)
+	}
+	if len(content) > xapiMaxStateSize {
+		return "", nil, e.Error(http.StatusRequestEntityTooLarge, fmt.Sprintf("Documents are limited to %d bytes.", xapiMaxStateSize), nil)
+	}
+
+	contentType := e.Request.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return contentType, content, nil
+}
+
+// isJSONContentType reports whether a document content type is JSON.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/json"
+}
+
+func bindXapiStateRoutes(r *router.Router[*core.RequestEvent]) {
+	state := r.Group("/xapi/activities/state")
+	state.Bind(requireXapiCredentials())
+
+	// get a document, or the ids of the documents of the activity state
+	state.GET("", func(e *core.RequestEvent) error {
+		key, err := xapiStateRequestKey(e, false)
+		if err != nil {
+			return err
+		}
+
+		if key.StateID != "" {
+			record, err := findXapiState(e.App, key)
+			if err != nil {
+				return e.NotFoundError("", err)
+			}
+			e.Response.Header().Set("Last-Modified", record.GetDateTime("updated").Time().UTC().Format(http.TimeFormat))
+			return e.Blob(http.StatusOK, record.GetString("content_type"), []byte(record.GetString("content")))
+		}
+
+		query := xapiStateQuery(e.App, key)
+		if since := e.Request.URL.Query().Get("since"); since != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, since)
+			if err != nil {
+				return e.BadRequestError("since must be an ISO 8601 date.", nil)
+			}
+			date, _ := types.ParseDateTime(parsed)
+			query.AndWhere(dbx.NewExp("[[updated]] > {:since}", dbx.Params{"since": date.String()}))
+		}
+
+		records := []*core.Record{}
+		if err := query.OrderBy("state_id ASC").All(&records); err != nil {
+			return e.InternalServerError("Failed to find the state documents.", err)
+		}
+
+		ids := make([]string, 0, len(records))
+		for _, record := range records {
+			ids = append(ids, record.GetString("state_id"))
+		}
+		return e.JSON(http.StatusOK, ids)
+	})
+
+	// store a document
+	state.PUT("", func(e *core.RequestEvent) error {
+		key, err := xapiStateRequestKey(e, true)
+		if err != nil {
+			return err
+		}
+		contentType, content, err := readXapiStateBody(e)
+		if err != nil {
+			return err
+		}
+
+		if err := saveXapiState(e.App, key, contentType, content); err != nil {
+			return e.InternalServerError("Failed to store the document.", err)
+		}
+		return e.NoContent(http.StatusNoContent)
+	})
+
+	// store a document, merging the properties of JSON objects into the stored one
+	state.POST("", func(e *core.RequestEvent) error {
+		key, err := xapiStateRequestKey(e, true)
+		if err != nil {
+			return err
+		}
+		contentType, content, err := readXapiStateBody(e)
+		if err != nil {
+			return err
+		}
+
+		err = e.App.RunInTransaction(func(txApp core.App) error {
+			record, err := findXapiState(txApp, key)
+			if err == nil {
+				stored, incoming := map[string]any{}, map[string]any{}
+				if !isJSONContentType(record.GetString("content_type")) || !isJSONContentType(contentType) ||
+					json.Unmarshal([]byte(record.GetString("content")), &stored) != nil ||
+					json.Unmarshal(content, &incoming) != nil {
+					return e.BadRequestError("Only JSON objects can be merged.", nil)
+				}
+				maps.Copy(stored, incoming)
+				if content, err = json.Marshal(stored); err != nil {
+					return err
+				}
+			} else if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+
+			return saveXapiState(txApp, key, contentType, content)
+		})
+		var apiErr *router.ApiError
+		if errors.As(err, &apiErr) {
+			return apiErr
+		}
+		if err != nil {
+			return e.InternalServerError("Failed to store the document.", err)
+		}
+		return e.NoContent(http.StatusNoContent)
+	})
+
+	// delete a document, or all the documents of the activity state
+	state.DELETE("", func(e *core.RequestEvent) error {
+		key, err := xapiStateRequestKey(e, false)
+		if err != nil {
+			return err
+		}
+		if credentials := xapiCredentials(e); credentials != nil && credentials.GetBool("read_only") {
+			return e.ForbiddenError("The LRS credentials are read-only.", nil)
+		}
+
+		records := []*core.Record{}
+		if err := xapiStateQuery(e.App, key).All(&records); err != nil {
+			return e.InternalServerError("Failed to find the state documents.", err)
+		}
+		err = e.App.RunInTransaction(func(txApp core.App) error {
+			for _, record := range records {
+				if err := txApp.Delete(record); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return e.InternalServerError("Failed to delete the state documents.", err)
+		}
+		return e.NoContent(http.StatusNoContent)
+	})
+
+	// learner preferences aren't managed, the AUs fall back to their defaults
+	r.GET("/xapi/agents/profile", func(e *core.RequestEvent) error {
+		return e.NotFoundError("", nil)
+	}).Bind(requireXapiCredentials())
+}
@@ -0,0 +1,447 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// testXapiStatement returns a statement of verb about an activity by the agent with the email.
+func testXapiStatement(email, verb, activity string) XapiStatement {
+	return XapiStatement{
+		"actor":  map[string]any{"mbox": "mailto:" + email},
+		"verb":   map[string]any{"id": verb},
+		"object": map[string]any{"id": activity},
+	}
+}
+
+// xapiTestClient calls the LRS endpoints with Basic auth credentials.
+type xapiTestClient struct {
+	t           *testing.T
+	url         string
+	key, secret string
+}
+
+func (c *xapiTestClient) do(method, path string, body any, out any) int {
+	var reader *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatalf("Failed to marshal request: %v", err)
+		}
+		reader = bytes.NewReader(raw)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, c.url+path, reader)
+	if err != nil {
+		c.t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(xapiVersionHeader, xapiVersion)
+	req.SetBasicAuth(c.key, c.secret)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer res.Body.Close()
+
+	if out != nil && res.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			c.t.Fatalf("Failed to decode %s %s response: %v", method, path, err)
+		}
+	}
+	return res.StatusCode
+}
+
+func TestValidateXapiStatement(t *testing.T) {
+	tests := []struct {
+		name      string
+		statement XapiStatement
+		valid     bool
+	}{
+		{"valid", testXapiStatement("a@example.com", XapiVerbCompleted, "https://example.com/a"), true},
+		{"account actor", XapiStatement{
+			"actor":  map[string]any{"account": map[string]any{"homePage": "https://example.com", "name": "a"}},
+			"verb":   map[string]any{"id": XapiVerbLaunched},
+			"object": map[string]any{"id": "https://example.com/a"},
+		}, true},
+		{"no actor identifier", XapiStatement{
+			"actor":  map[string]any{"name": "a"},
+			"verb":   map[string]any{"id": XapiVerbLaunched},
+			"object": map[string]any{"id": "https://example.com/a"},
+		}, false},
+		{"two actor identifiers", XapiStatement{
+			"actor":  map[string]any{"mbox": "mailto:a@example.com", "openid": "https://example.com/a"},
+			"verb":   map[string]any{"id": XapiVerbLaunched},
+			"object": map[string]any{"id": "https://example.com/a"},
+		}, false},
+		{"relative verb", testXapiStatement("a@example.com", "completed", "https://example.com/a"), false},
+		{"invalid id", func() XapiStatement {
+			s := testXapiStatement("a@example.com", XapiVerbCompleted, "https://example.com/a")
+			s["id"] = "not-a-uuid"
+			return s
+		}(), false},
+		{"scaled score out of range", func() XapiStatement {
+			s := testXapiStatement("a@example.com", XapiVerbPassed, "https://example.com/a")
+			s["result"] = map[string]any{"score": map[string]any{"scaled": 1.5}}
+			return s
+		}(), false},
+		{"voiding an activity", testXapiStatement("a@example.com", XapiVerbVoided, "https://example.com/a"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateXapiStatement(tt.statement, false)
+			if (err == nil) != tt.valid {
+				t.Errorf("Expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestXapiLRS(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	createTestCollections(t, app)
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	bindXapiRoutes(r, service)
+	mux, err := r.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	newClient := func(organization string, readOnly bool) *xapiTestClient {
+		key, secret, err := CreateXapiCredentials(app, organization, "analytics", readOnly)
+		if err != nil {
+			t.Fatalf("CreateXapiCredentials failed: %v", err)
+		}
+		return &xapiTestClient{t: t, url: server.URL, key: key, secret: secret}
+	}
+	client := newClient(testOrg1, false)
+
+	// the version header and valid credentials are required
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/xapi/statements", nil)
+	req.SetBasicAuth(client.key, client.secret)
+	if res, err := http.DefaultClient.Do(req); err != nil || res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without the version header, got %v %v", res, err)
+	}
+	if status := (&xapiTestClient{t: t, url: server.URL, key: client.key, secret: "wrong"}).do(http.MethodGet, "/xapi/statements", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong secret, got %d", status)
+	}
+
+	var ids []string
+	if status := client.do(http.MethodPost, "/xapi/statements", testXapiStatement("jane@example.com", XapiVerbLaunched, "https://example.com/a"), &ids); status != http.StatusOK || len(ids) != 1 {
+		t.Fatalf("Expected the statement to be stored, got %d %v", status, ids)
+	}
+	first := ids[0]
+
+	batch := []XapiStatement{
+		testXapiStatement("jane@example.com", XapiVerbCompleted, "https://example.com/a"),
+		testXapiStatement("john@example.com", XapiVerbCompleted, "https://example.com/b"),
+	}
+	if status := client.do(http.MethodPost, "/xapi/statements", batch, &ids); status != http.StatusOK || len(ids) != 2 {
+		t.Fatalf("Expected the batch to be stored, got %d %v", status, ids)
+	}
+
+	putID := "3f2b1c4e-9a7d-4e1f-8b6a-2c5d7e9f0a1b"
+	put := testXapiStatement("jane@example.com", XapiVerbPassed, "https://example.com/a")
+	if status := client.do(http.MethodPut, "/xapi/statements?statementId="+putID, put, nil); status != http.StatusNoContent {
+		t.Fatalf("Expected 204 for PUT, got %d", status)
+	}
+	if status := client.do(http.MethodPut, "/xapi/statements?statementId="+putID, put, nil); status != http.StatusNoContent {
+		t.Errorf("Expected storing the same statement again to be accepted, got %d", status)
+	}
+	if status := client.do(http.MethodPut, "/xapi/statements?statementId="+putID, testXapiStatement("jane@example.com", "http://adlnet.gov/expapi/verbs/answered", "https://example.com/a"), nil); status != http.StatusConflict {
+		t.Errorf("Expected 409 for a different statement with the same id, got %d", status)
+	}
+	if status := client.do(http.MethodPost, "/xapi/statements", XapiStatement{"actor": map[string]any{"name": "x"}}, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid statement, got %d", status)
+	}
+
+	stored := XapiStatement{}
+	if status := client.do(http.MethodGet, "/xapi/statements?statementId="+putID, nil, &stored); status != http.StatusOK {
+		t.Fatalf("Expected the statement, got %d", status)
+	}
+	if stored["id"] != putID || stored["stored"] == nil || stored["authority"] == nil || stored["version"] != xapiVersion {
+		t.Errorf("Expected the LRS properties to be set, got %v", stored)
+	}
+
+	type statementResult struct {
+		Statements []XapiStatement `json:"statements"`
+		More       string          `json:"more"`
+	}
+	query := func(params url.Values) statementResult {
+		result := statementResult{}
+		if status := client.do(http.MethodGet, "/xapi/statements?"+params.Encode(), nil, &result); status != http.StatusOK {
+			t.Fatalf("Query %v failed with %d", params, status)
+		}
+		return result
+	}
+
+	if result := query(url.Values{"agent": {`{"mbox": "mailto:jane@example.com"}`}}); len(result.Statements) != 3 {
+		t.Errorf("Expected 3 statements by jane, got %d", len(result.Statements))
+	}
+	if result := query(url.Values{"verb": {XapiVerbCompleted}, "activity": {"https://example.com/b"}}); len(result.Statements) != 1 {
+		t.Errorf("Expected 1 completion of b, got %d", len(result.Statements))
+	}
+
+	// pages follow each other through the more link, newest first
+	page := query(url.Values{"limit": {"3"}})
+	if len(page.Statements) != 3 || page.More == "" {
+		t.Fatalf("Unexpected first page %v", page)
+	}
+	next := statementResult{}
+	if status := client.do(http.MethodGet, page.More, nil, &next); status != http.StatusOK || len(next.Statements) != 1 || next.More != "" {
+		t.Fatalf("Unexpected second page %d %v", status, next)
+	}
+	seen := map[any]bool{}
+	for _, statement := range append(page.Statements, next.Statements...) {
+		seen[statement["id"]] = true
+	}
+	if len(seen) != 4 || !seen[first] || !seen[putID] {
+		t.Errorf("Expected the pages to hold every statement once, got %v", seen)
+	}
+
+	voiding := testXapiStatement("admin@example.com", XapiVerbVoided, "")
+	voiding["object"] = map[string]any{"objectType": "StatementRef", "id": first}
+	if status := client.do(http.MethodPost, "/xapi/statements", voiding, nil); status != http.StatusOK {
+		t.Fatalf("Expected the voiding statement to be stored, got %d", status)
+	}
+	if status := client.do(http.MethodGet, "/xapi/statements?statementId="+first, nil, nil); status != http.StatusNotFound {
+		t.Errorf("Expected the voided statement to be hidden, got %d", status)
+	}
+	if status := client.do(http.MethodGet, "/xapi/statements?voidedStatementId="+first, nil, nil); status != http.StatusOK {
+		t.Errorf("Expected the voided statement to be found by voidedStatementId, got %d", status)
+	}
+
+	readOnly := newClient(testOrg1, true)
+	if status := readOnly.do(http.MethodPost, "/xapi/statements", testXapiStatement("jane@example.com", XapiVerbLaunched, "https://example.com/a"), nil); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for read-only credentials, got %d", status)
+	}
+	if status := readOnly.do(http.MethodGet, "/xapi/statements?statementId="+putID, nil, nil); status != http.StatusOK {
+		t.Errorf("Expected read-only credentials to query, got %d", status)
+	}
+
+	if status := newClient(testOrg2, false).do(http.MethodGet, "/xapi/statements?statementId="+putID, nil, nil); status != http.StatusNotFound {
+		t.Errorf("Expected the statements of another organization to be hidden, got %d", status)
+	}
+}
+
+func TestXapiSubscribers(t *testing.T) {
+	service, app := createTestCourseService()
+	defer app.Cleanup()
+
+	courses, _ := createTestCollections(t, app)
+	user := createTestLearner(t, app)
+	bindXapiSubscribers(Events(app))
+
+	course := createTestCourse(t, app, courses, "")
+	course.Set("organization", testOrg1)
+	if err := app.Save(course); err != nil {
+		t.Fatalf("Failed to save course: %v", err)
+	}
+	user.Set("organization", testOrg1)
+	if err := app.Save(user); err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	lessons, err := app.FindCollectionByNameOrId("lessons")
+	if err != nil {
+		t.Fatalf("Failed to find lessons collection: %v", err)
+	}
+	var lesson *core.Record
+	for _, title := range []string{"Intro", "Basics"} {
+		lesson = core.NewRecord(lessons)
+		lesson.Set("course", course.Id)
+		lesson.Set("title", title)
+		if err := app.Save(lesson); err != nil {
+			t.Fatalf("Failed to save lesson: %v", err)
+		}
+	}
+
+	if err := service.EnrollUser(course.Id, user.Id); err != nil {
+		t.Fatalf("EnrollUser failed: %v", err)
+	}
+	progress, err := app.FindFirstRecordByFilter("progress", "course = {:course} && assignee = {:user}", dbx.Params{"course": course.Id, "user": user.Id})
+	if err != nil {
+		t.Fatalf("Failed to find progress: %v", err)
+	}
+
+	if err := service.RecordProgressEvent(progress, StatusNotStarted, StatusInProgress, user.Id, ProgressSourceAPI); err != nil {
+		t.Fatalf("RecordProgressEvent failed: %v", err)
+	}
+
+	lessonProgressCollection, err := app.FindCollectionByNameOrId("lesson_progress")
+	if err != nil {
+		t.Fatalf("Failed to find lesson_progress collection: %v", err)
+	}
+	lessonProgress := core.NewRecord(lessonProgressCollection)
+	lessonProgress.Set("lesson", lesson.Id)
+	lessonProgress.Set("course", course.Id)
+	lessonProgress.Set("assignee", user.Id)
+	lessonProgress.Set("completed", true)
+	if err := app.Save(lessonProgress); err != nil {
+		t.Fatalf("Failed to save lesson progress: %v", err)
+	}
+	if err := service.HandleLessonProgressChange(lessonProgress, false); err != nil {
+		t.Fatalf("HandleLessonProgressChange failed: %v", err)
+	}
+
+	if err := service.RecordProgressEvent(progress, StatusInProgress, StatusCompleted, user.Id, ProgressSourceAPI); err != nil {
+		t.Fatalf("RecordProgressEvent failed: %v", err)
+	}
+
+	records, err := app.FindRecordsByFilter("xapi_statements", "organization = '"+testOrg1+"'", "stored,id", 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to find statements: %v", err)
+	}
+
+	courseActivity := app.Settings().Meta.AppURL + "/xapi/activities/courses/" + course.Id
+	expected := []struct{ verb, activity string }{
+		{XapiVerbLaunched, courseActivity},
+		{XapiVerbCompleted, app.Settings().Meta.AppURL + "/xapi/activities/lessons/" + lesson.Id},
+		{XapiVerbProgressed, courseActivity},
+		{XapiVerbCompleted, courseActivity},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d statements, got %d", len(expected), len(records))
+	}
+
+	// statements stored within the same millisecond have no defined order
+	registration := xapiRegistration(progress.Id)
+	var progressed XapiStatement
+	for i, want := range expected {
+		index := slices.IndexFunc(records, func(record *core.Record) bool {
+			return record.GetString("verb") == want.verb && record.GetString("activity") == want.activity
+		})
+		if index < 0 {
+			t.Errorf("Statement %d: expected %s %s to be recorded", i, want.verb, want.activity)
+			continue
+		}
+		record := records[index]
+		records = slices.Delete(records, index, index+1)
+
+		if record.GetString("user") != user.Id || record.GetString("registration") != registration {
+			t.Errorf("Statement %d: expected the learner and its registration, got %q %q", i, record.GetString("user"), record.GetString("registration"))
+		}
+		if want.verb == XapiVerbProgressed {
+			progressed = xapiStatementOf(record)
+		}
+	}
+	if progressed == nil {
+		t.FailNow()
+	}
+
+	extensions := progressed["result"].(map[string]any)["extensions"].(map[string]any)
+	if extensions[xapiProgressExtension] != 50.0 {
+		t.Errorf("Expected 50%% progress after one of two lessons, got %v", extensions[xapiProgressExtension])
+	}
+}
+
+func TestForwardXapiStatements(t *testing.T) {
+	_, app := createTestCourseService()
+	defer app.Cleanup()
+	allowTestOutbound(t)
+
+	createTestCollections(t, app)
+
+	var mu sync.Mutex
+	received := []string{}
+	failing := false
+	lrs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		if failing || r.URL.Path != "/xapi/statements" || r.Header.Get(xapiVersionHeader) == "" || user != "lrs" || password != "secret" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		statements := []XapiStatement{}
+		json.NewDecoder(r.Body).Decode(&statements)
+
+		mu.Lock()
+		for _, statement := range statements {
+			received = append(received, statement["id"].(string))
+		}
+		mu.Unlock()
+	}))
+	defer lrs.Close()
+
+	forwardersCollection, err := app.FindCollectionByNameOrId("xapi_forwarders")
+	if err != nil {
+		t.Fatalf("Failed to find xapi_forwarders collection: %v", err)
+	}
+	forwarder := core.NewRecord(forwardersCollection)
+	forwarder.Set("name", "Analytics LRS")
+	forwarder.Set("organization", testOrg1)
+	forwarder.Set("endpoint", lrs.URL+"/xapi/")
+	forwarder.Set("username", "lrs")
+	forwarder.Set("password", "secret")
+	forwarder.Set("active", true)
+	if err := app.Save(forwarder); err != nil {
+		t.Fatalf("Failed to save forwarder: %v", err)
+	}
+
+	// statements are only forwarded once they settled for a few seconds
+	store := func(organization, activity string, age time.Duration) string {
+		id, err := StoreXapiStatement(app, organization, testXapiStatement("jane@example.com", XapiVerbLaunched, activity), nil)
+		if err != nil {
+			t.Fatalf("StoreXapiStatement failed: %v", err)
+		}
+		record, err := app.FindFirstRecordByData("xapi_statements", "statement_id", id)
+		if err != nil {
+			t.Fatalf("Failed to find statement: %v", err)
+		}
+		record.Set("stored", types.NowDateTime().Add(-age))
+		if err := app.Save(record); err != nil {
+			t.Fatalf("Failed to save statement: %v", err)
+		}
+		return id
+	}
+
+	first := store(testOrg1, "https://example.com/a", 2*time.Minute)
+	store(testOrg2, "https://example.com/other", 2*time.Minute)
+	recent := store(testOrg1, "https://example.com/recent", 0)
+
+	if err := ForwardXapiStatements(app, forwarder); err != nil {
+		t.Fatalf("ForwardXapiStatements failed: %v", err)
+	}
+	if len(received) != 1 || received[0] != first {
+		t.Fatalf("Expected only the organization statement to be forwarded, got %v", received)
+	}
+
+	// failures keep the cursor, so the statement is sent by the next run
+	second := store(testOrg1, "https://example.com/b", time.Minute)
+	failing = true
+	if err := ForwardXapiStatements(app, forwarder); err == nil || forwarder.GetString("last_error") == "" {
+		t.Errorf("Expected the forwarding to fail, got %v", err)
+	}
+
+	failing = false
+	if err := ForwardXapiStatements(app, forwarder); err != nil {
+		t.Fatalf("ForwardXapiStatements failed: %v", err)
+	}
+	if strings.Join(received, ",") != first+","+second || forwarder.GetString("last_error") != "" {
+		t.Errorf("Expected each settled statement to be forwarded once, got %v (recent %s)", received, recent)
+	}
+}
@@ -61,6 +61,9 @@ func main() {
 		Dir:          migrationsDir,
 	})
 
+	// custom eLesson commands
+	hooks.InitCommands(app)
+
 	app.OnServe().Bind(&hook.Handler[*core.ServeEvent]{
 		Func: func(e *core.ServeEvent) error {
 
@@ -70,6 +73,7 @@ func main() {
 			}
 
 			hooks.InitHooks(app)
+			hooks.InitRoutes(app, e.Router)
 
 			return e.Next()
 		},
@@ -0,0 +1,42 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_1649388127")
+
+  // add field
+  collection.fields.addAt(4, new Field({
+    "hidden": false,
+    "id": "date222754019",
+    "max": "",
+    "min": "",
+    "name": "started_at",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "date"
+  }))
+
+  // add field
+  collection.fields.addAt(5, new Field({
+    "hidden": false,
+    "id": "date1410257210",
+    "max": "",
+    "min": "",
+    "name": "completed_at",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "date"
+  }))
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_1649388127")
+
+  // remove field
+  collection.fields.removeById("date222754019")
+
+  // remove field
+  collection.fields.removeById("date1410257210")
+
+  return app.save(collection)
+})
@@ -0,0 +1,119 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = new Collection({
+    "createRule": "@request.auth.id != \"\" && assignee = @request.auth.id && course = lesson.course && course.assignees.id ?= @request.auth.id",
+    "deleteRule": null,
+    "fields": [
+      {
+        "autogeneratePattern": "[a-z0-9]{15}",
+        "hidden": false,
+        "id": "text3208210256",
+        "max": 15,
+        "min": 15,
+        "name": "id",
+        "pattern": "^[a-z0-9]+$",
+        "presentable": false,
+        "primaryKey": true,
+        "required": true,
+        "system": true,
+        "type": "text"
+      },
+      {
+        "cascadeDelete": true,
+        "collectionId": "pbc_2920376115",
+        "hidden": false,
+        "id": "relation4168381683",
+        "maxSelect": 1,
+        "minSelect": 0,
+        "name": "lesson",
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "cascadeDelete": true,
+        "collectionId": "pbc_955655590",
+        "hidden": false,
+        "id": "relation379482041",
+        "maxSelect": 1,
+        "minSelect": 0,
+        "name": "course",
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "cascadeDelete": true,
+        "collectionId": "_pb_users_auth_",
+        "hidden": false,
+        "id": "relation2090728460",
+        "maxSelect": 1,
+        "minSelect": 0,
+        "name": "assignee",
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "hidden": false,
+        "id": "bool989355118",
+        "name": "completed",
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "bool"
+      },
+      {
+        "hidden": false,
+        "id": "number4004435529",
+        "max": null,
+        "min": 0,
+        "name": "video_position",
+        "onlyInt": false,
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "number"
+      },
+      {
+        "hidden": false,
+        "id": "autodate2990389176",
+        "name": "created",
+        "onCreate": true,
+        "onUpdate": false,
+        "presentable": false,
+        "system": false,
+        "type": "autodate"
+      },
+      {
+        "hidden": false,
+        "id": "autodate3332085495",
+        "name": "updated",
+        "onCreate": true,
+        "onUpdate": true,
+        "presentable": false,
+        "system": false,
+        "type": "autodate"
+      }
+    ],
+    "id": "pbc_67786189",
+    "indexes": [
+      "CREATE UNIQUE INDEX `idx_lesson_progress_lesson_assignee` ON `lesson_progress` (\n  `lesson`,\n  `assignee`\n)"
+    ],
+    "listRule": "@request.auth.id != \"\" && assignee = @request.auth.id",
+    "name": "lesson_progress",
+    "system": false,
+    "type": "base",
+    "updateRule": "@request.auth.id != \"\" && assignee = @request.auth.id && @request.body.lesson:isset = false && @request.body.course:isset = false && @request.body.assignee:isset = false",
+    "viewRule": "@request.auth.id != \"\" && assignee = @request.auth.id"
+  });
+
+  return app.save(collection);
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_67786189");
+
+  return app.delete(collection);
+})
@@ -0,0 +1,100 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("_pb_users_auth_")
+
+  // update collection data
+  unmarshal({
+    "createRule": "@request.body.role:isset = false && @request.body.manager:isset = false && @request.body.managers:isset = false && @request.body.department:isset = false",
+    "listRule": "id = @request.auth.id || (@request.auth.role = \"manager\" && managers.id ?= @request.auth.id)",
+    "updateRule": "id = @request.auth.id && @request.body.role:isset = false && @request.body.manager:isset = false && @request.body.managers:isset = false && @request.body.department:isset = false",
+    "viewRule": "id = @request.auth.id || (@request.auth.role = \"manager\" && managers.id ?= @request.auth.id)"
+  }, collection)
+
+  // add field
+  collection.fields.addAt(8, new Field({
+    "cascadeDelete": false,
+    "collectionId": "_pb_users_auth_",
+    "hidden": false,
+    "id": "relation4196672953",
+    "maxSelect": 1,
+    "minSelect": 0,
+    "name": "manager",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "relation"
+  }))
+
+  // add field
+  collection.fields.addAt(9, new Field({
+    "cascadeDelete": false,
+    "collectionId": "_pb_users_auth_",
+    "hidden": false,
+    "id": "relation2840190982",
+    "maxSelect": 999,
+    "minSelect": 0,
+    "name": "managers",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "relation"
+  }))
+
+  // add field
+  collection.fields.addAt(10, new Field({
+    "autogeneratePattern": "",
+    "hidden": false,
+    "id": "text3441287562",
+    "max": 0,
+    "min": 0,
+    "name": "department",
+    "pattern": "",
+    "presentable": false,
+    "primaryKey": false,
+    "required": false,
+    "system": false,
+    "type": "text"
+  }))
+
+  // add field
+  collection.fields.addAt(11, new Field({
+    "hidden": false,
+    "id": "select1466534506",
+    "maxSelect": 1,
+    "name": "role",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "select",
+    "values": [
+      "learner",
+      "manager"
+    ]
+  }))
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("_pb_users_auth_")
+
+  // update collection data
+  unmarshal({
+    "createRule": "",
+    "listRule": "id = @request.auth.id",
+    "updateRule": "id = @request.auth.id",
+    "viewRule": "id = @request.auth.id"
+  }, collection)
+
+  // remove field
+  collection.fields.removeById("relation4196672953")
+
+  // remove field
+  collection.fields.removeById("relation2840190982")
+
+  // remove field
+  collection.fields.removeById("text3441287562")
+
+  // remove field
+  collection.fields.removeById("select1466534506")
+
+  return app.save(collection)
+})
@@ -0,0 +1,22 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2351098639")
+
+  // update collection data
+  unmarshal({
+    "listRule": "@request.auth.id != \"\" && (assignee = @request.auth.id || (@request.auth.role = \"manager\" && assignee.managers.id ?= @request.auth.id))",
+    "viewRule": "@request.auth.id != \"\" && (assignee = @request.auth.id || (@request.auth.role = \"manager\" && assignee.managers.id ?= @request.auth.id))"
+  }, collection)
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2351098639")
+
+  // update collection data
+  unmarshal({
+    "listRule": "@request.auth.id != \"\" && assignee = @request.auth.id",
+    "viewRule": "@request.auth.id != \"\" && assignee = @request.auth.id"
+  }, collection)
+
+  return app.save(collection)
+})
@@ -0,0 +1,22 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_955655590")
+
+  // update collection data
+  unmarshal({
+    "listRule": "@request.auth.id != \"\" && ((assignees.id ?= @request.auth.id && id ?= @collection.lessons.course.id) || (@request.auth.role = \"manager\" && assignees.managers.id ?= @request.auth.id))",
+    "viewRule": "@request.auth.id != \"\" && ((assignees.id ?= @request.auth.id && id ?= @collection.lessons.course.id) || (@request.auth.role = \"manager\" && assignees.managers.id ?= @request.auth.id))"
+  }, collection)
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_955655590")
+
+  // update collection data
+  unmarshal({
+    "listRule": "@request.auth.id != \"\" && assignees.id ?= @request.auth.id && id ?= @collection.lessons.course.id",
+    "viewRule": "@request.auth.id != \"\" && assignees.id ?= @request.auth.id && id ?= @collection.lessons.course.id"
+  }, collection)
+
+  return app.save(collection)
+})
@@ -0,0 +1,60 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("_pb_users_auth_")
+
+  // update collection data
+  unmarshal({
+    "deleteRule": "id = @request.auth.id || @request.auth.role = \"org_admin\"",
+    "listRule": "id = @request.auth.id || @request.auth.role = \"org_admin\" || @request.auth.role = \"instructor\" || (@request.auth.role = \"manager\" && managers.id ?= @request.auth.id)",
+    "updateRule": "(id = @request.auth.id && @request.body.role:isset = false && @request.body.manager:isset = false && @request.body.managers:isset = false && @request.body.department:isset = false) || @request.auth.role = \"org_admin\"",
+    "viewRule": "id = @request.auth.id || @request.auth.role = \"org_admin\" || @request.auth.role = \"instructor\" || (@request.auth.role = \"manager\" && managers.id ?= @request.auth.id)"
+  }, collection)
+
+  // update field
+  collection.fields.addAt(11, new Field({
+    "hidden": false,
+    "id": "select1466534506",
+    "maxSelect": 1,
+    "name": "role",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "select",
+    "values": [
+      "learner",
+      "instructor",
+      "manager",
+      "org_admin"
+    ]
+  }))
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("_pb_users_auth_")
+
+  // update collection data
+  unmarshal({
+    "deleteRule": "id = @request.auth.id",
+    "listRule": "id = @request.auth.id || (@request.auth.role = \"manager\" && managers.id ?= @request.auth.id)",
+    "updateRule": "id = @request.auth.id && @request.body.role:isset = false && @request.body.manager:isset = false && @request.body.managers:isset = false && @request.body.department:isset = false",
+    "viewRule": "id = @request.auth.id || (@request.auth.role = \"manager\" && managers.id ?= @request.auth.id)"
+  }, collection)
+
+  // update field
+  collection.fields.addAt(11, new Field({
+    "hidden": false,
+    "id": "select1466534506",
+    "maxSelect": 1,
+    "name": "role",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "select",
+    "values": [
+      "learner",
+      "manager"
+    ]
+  }))
+
+  return app.save(collection)
+})
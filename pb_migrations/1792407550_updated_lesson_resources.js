@@ -0,0 +1,28 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2502605473")
+
+  // update collection data
+  unmarshal({
+    "createRule": "@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && lesson.course.owner = @request.auth.id) || @request.auth.role = \"org_admin\")",
+    "deleteRule": "@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && lesson.course.owner = @request.auth.id) || @request.auth.role = \"org_admin\")",
+    "listRule": "@request.auth.id != \"\" && (lesson.course.assignees.id ?= @request.auth.id || (@request.auth.role = \"instructor\" && lesson.course.owner = @request.auth.id) || @request.auth.role = \"org_admin\")",
+    "updateRule": "@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && lesson.course.owner = @request.auth.id && @request.body.lesson:isset = false) || @request.auth.role = \"org_admin\")",
+    "viewRule": "@request.auth.id != \"\" && (lesson.course.assignees.id ?= @request.auth.id || (@request.auth.role = \"instructor\" && lesson.course.owner = @request.auth.id) || @request.auth.role = \"org_admin\")"
+  }, collection)
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2502605473")
+
+  // update collection data
+  unmarshal({
+    "createRule": null,
+    "deleteRule": null,
+    "listRule": "@request.auth.id != \"\" && lesson.course.assignees.id ?= @request.auth.id",
+    "updateRule": null,
+    "viewRule": "@request.auth.id != \"\" && lesson.course.assignees.id ?= @request.auth.id"
+  }, collection)
+
+  return app.save(collection)
+})
@@ -0,0 +1,24 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2337082678")
+
+  // update collection data
+  unmarshal({
+    "createRule": "@request.auth.role = \"org_admin\"",
+    "deleteRule": "@request.auth.role = \"org_admin\"",
+    "updateRule": "@request.auth.role = \"org_admin\""
+  }, collection)
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2337082678")
+
+  // update collection data
+  unmarshal({
+    "createRule": null,
+    "deleteRule": null,
+    "updateRule": null
+  }, collection)
+
+  return app.save(collection)
+})
@@ -0,0 +1,26 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_1649388127")
+
+  // update collection data
+  unmarshal({
+    "createRule": "@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\")",
+    "deleteRule": "@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\")",
+    "listRule": "@request.auth.id != \"\" && (assignee = @request.auth.id || (@request.auth.role = \"manager\" && assignee.managers.id ?= @request.auth.id) || (@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\")",
+    "viewRule": "@request.auth.id != \"\" && (assignee = @request.auth.id || (@request.auth.role = \"manager\" && assignee.managers.id ?= @request.auth.id) || (@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\")"
+  }, collection)
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_1649388127")
+
+  // update collection data
+  unmarshal({
+    "createRule": null,
+    "deleteRule": null,
+    "listRule": "@request.auth.id != \"\" && (assignee = @request.auth.id || (@request.auth.role = \"manager\" && assignee.managers.id ?= @request.auth.id))",
+    "viewRule": "@request.auth.id != \"\" && (assignee = @request.auth.id || (@request.auth.role = \"manager\" && assignee.managers.id ?= @request.auth.id))"
+  }, collection)
+
+  return app.save(collection)
+})
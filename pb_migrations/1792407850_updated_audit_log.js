@@ -0,0 +1,22 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2462721645")
+
+  // update collection data
+  unmarshal({
+    "listRule": "@request.auth.role = \"org_admin\"",
+    "viewRule": "@request.auth.role = \"org_admin\""
+  }, collection)
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2462721645")
+
+  // update collection data
+  unmarshal({
+    "listRule": null,
+    "viewRule": null
+  }, collection)
+
+  return app.save(collection)
+})
@@ -0,0 +1,28 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_3653375940")
+
+  // update collection data
+  unmarshal({
+    "createRule": "@request.auth.role = \"org_admin\"",
+    "deleteRule": "@request.auth.role = \"org_admin\"",
+    "listRule": "@request.auth.role = \"org_admin\"",
+    "updateRule": "@request.auth.role = \"org_admin\"",
+    "viewRule": "@request.auth.role = \"org_admin\""
+  }, collection)
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_3653375940")
+
+  // update collection data
+  unmarshal({
+    "createRule": null,
+    "deleteRule": null,
+    "listRule": null,
+    "updateRule": null,
+    "viewRule": null
+  }, collection)
+
+  return app.save(collection)
+})
@@ -0,0 +1,46 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("_pb_users_auth_")
+
+  // update collection data
+  unmarshal({
+    "createRule": "(@request.body.role:isset = false && @request.body.manager:isset = false && @request.body.managers:isset = false && @request.body.department:isset = false && @request.body.organization:isset = false) || @request.auth.role = \"org_admin\"",
+    "deleteRule": "organization = @request.auth.organization && (id = @request.auth.id || @request.auth.role = \"org_admin\")",
+    "listRule": "organization = @request.auth.organization && (id = @request.auth.id || @request.auth.role = \"org_admin\" || @request.auth.role = \"instructor\" || (@request.auth.role = \"manager\" && managers.id ?= @request.auth.id))",
+    "updateRule": "organization = @request.auth.organization && @request.body.organization:isset = false && ((id = @request.auth.id && @request.body.role:isset = false && @request.body.manager:isset = false && @request.body.managers:isset = false && @request.body.department:isset = false) || @request.auth.role = \"org_admin\")",
+    "viewRule": "organization = @request.auth.organization && (id = @request.auth.id || @request.auth.role = \"org_admin\" || @request.auth.role = \"instructor\" || (@request.auth.role = \"manager\" && managers.id ?= @request.auth.id))"
+  }, collection)
+
+  // add field
+  collection.fields.addAt(12, new Field({
+    "cascadeDelete": false,
+    "collectionId": "pbc_2873630990",
+    "hidden": false,
+    "id": "relation3253625724",
+    "maxSelect": 1,
+    "minSelect": 0,
+    "name": "organization",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "relation"
+  }))
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("_pb_users_auth_")
+
+  // update collection data
+  unmarshal({
+    "createRule": "@request.body.role:isset = false && @request.body.manager:isset = false && @request.body.managers:isset = false && @request.body.department:isset = false",
+    "deleteRule": "id = @request.auth.id || @request.auth.role = \"org_admin\"",
+    "listRule": "id = @request.auth.id || @request.auth.role = \"org_admin\" || @request.auth.role = \"instructor\" || (@request.auth.role = \"manager\" && managers.id ?= @request.auth.id)",
+    "updateRule": "(id = @request.auth.id && @request.body.role:isset = false && @request.body.manager:isset = false && @request.body.managers:isset = false && @request.body.department:isset = false) || @request.auth.role = \"org_admin\"",
+    "viewRule": "id = @request.auth.id || @request.auth.role = \"org_admin\" || @request.auth.role = \"instructor\" || (@request.auth.role = \"manager\" && managers.id ?= @request.auth.id)"
+  }, collection)
+
+  // remove field
+  collection.fields.removeById("relation3253625724")
+
+  return app.save(collection)
+})
@@ -0,0 +1,46 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_955655590")
+
+  // update collection data
+  unmarshal({
+    "createRule": "@request.body.organization:isset = false && (@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && (owner = \"\" || owner = @request.auth.id)) || @request.auth.role = \"org_admin\"))",
+    "deleteRule": "organization = @request.auth.organization && (@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && owner = @request.auth.id) || @request.auth.role = \"org_admin\"))",
+    "listRule": "organization = @request.auth.organization && (@request.auth.id != \"\" && ((assignees.id ?= @request.auth.id && id ?= @collection.lessons.course.id) || (@request.auth.role = \"manager\" && assignees.managers.id ?= @request.auth.id) || (@request.auth.role = \"instructor\" && owner = @request.auth.id) || @request.auth.role = \"org_admin\"))",
+    "updateRule": "organization = @request.auth.organization && @request.body.organization:isset = false && (@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && owner = @request.auth.id && @request.body.owner:isset = false) || @request.auth.role = \"org_admin\"))",
+    "viewRule": "organization = @request.auth.organization && (@request.auth.id != \"\" && ((assignees.id ?= @request.auth.id && id ?= @collection.lessons.course.id) || (@request.auth.role = \"manager\" && assignees.managers.id ?= @request.auth.id) || (@request.auth.role = \"instructor\" && owner = @request.auth.id) || @request.auth.role = \"org_admin\"))"
+  }, collection)
+
+  // add field
+  collection.fields.addAt(6, new Field({
+    "cascadeDelete": false,
+    "collectionId": "pbc_2873630990",
+    "hidden": false,
+    "id": "relation3253625724",
+    "maxSelect": 1,
+    "minSelect": 0,
+    "name": "organization",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "relation"
+  }))
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_955655590")
+
+  // update collection data
+  unmarshal({
+    "createRule": "@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && (owner = \"\" || owner = @request.auth.id)) || @request.auth.role = \"org_admin\")",
+    "deleteRule": "@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && owner = @request.auth.id) || @request.auth.role = \"org_admin\")",
+    "listRule": "@request.auth.id != \"\" && ((assignees.id ?= @request.auth.id && id ?= @collection.lessons.course.id) || (@request.auth.role = \"manager\" && assignees.managers.id ?= @request.auth.id) || (@request.auth.role = \"instructor\" && owner = @request.auth.id) || @request.auth.role = \"org_admin\")",
+    "updateRule": "@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && owner = @request.auth.id && @request.body.owner:isset = false) || @request.auth.role = \"org_admin\")",
+    "viewRule": "@request.auth.id != \"\" && ((assignees.id ?= @request.auth.id && id ?= @collection.lessons.course.id) || (@request.auth.role = \"manager\" && assignees.managers.id ?= @request.auth.id) || (@request.auth.role = \"instructor\" && owner = @request.auth.id) || @request.auth.role = \"org_admin\")"
+  }, collection)
+
+  // remove field
+  collection.fields.removeById("relation3253625724")
+
+  return app.save(collection)
+})
@@ -0,0 +1,46 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2920376115")
+
+  // update collection data
+  unmarshal({
+    "createRule": "course.organization = @request.auth.organization && (@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\"))",
+    "deleteRule": "organization = @request.auth.organization && (@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\"))",
+    "listRule": "organization = @request.auth.organization && (@request.auth.id != \"\" && (course.assignees.id ?= @request.auth.id || (@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\"))",
+    "updateRule": "organization = @request.auth.organization && (@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && course.owner = @request.auth.id && @request.body.course:isset = false) || @request.auth.role = \"org_admin\"))",
+    "viewRule": "organization = @request.auth.organization && (@request.auth.id != \"\" && (course.assignees.id ?= @request.auth.id || (@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\"))"
+  }, collection)
+
+  // add field
+  collection.fields.addAt(9, new Field({
+    "cascadeDelete": false,
+    "collectionId": "pbc_2873630990",
+    "hidden": false,
+    "id": "relation3253625724",
+    "maxSelect": 1,
+    "minSelect": 0,
+    "name": "organization",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "relation"
+  }))
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2920376115")
+
+  // update collection data
+  unmarshal({
+    "createRule": "@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\")",
+    "deleteRule": "@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\")",
+    "listRule": "@request.auth.id != \"\" && (course.assignees.id ?= @request.auth.id || (@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\")",
+    "updateRule": "@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && course.owner = @request.auth.id && @request.body.course:isset = false) || @request.auth.role = \"org_admin\")",
+    "viewRule": "@request.auth.id != \"\" && (course.assignees.id ?= @request.auth.id || (@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\")"
+  }, collection)
+
+  // remove field
+  collection.fields.removeById("relation3253625724")
+
+  return app.save(collection)
+})
@@ -0,0 +1,44 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2337082678")
+
+  // update collection data
+  unmarshal({
+    "deleteRule": "organization = @request.auth.organization && (@request.auth.role = \"org_admin\")",
+    "listRule": "organization = @request.auth.organization && (@request.auth.id != \"\")",
+    "updateRule": "organization = @request.auth.organization && @request.body.organization:isset = false && (@request.auth.role = \"org_admin\")",
+    "viewRule": "organization = @request.auth.organization && (@request.auth.id != \"\")"
+  }, collection)
+
+  // add field
+  collection.fields.addAt(3, new Field({
+    "cascadeDelete": false,
+    "collectionId": "pbc_2873630990",
+    "hidden": false,
+    "id": "relation3253625724",
+    "maxSelect": 1,
+    "minSelect": 0,
+    "name": "organization",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "relation"
+  }))
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2337082678")
+
+  // update collection data
+  unmarshal({
+    "deleteRule": "@request.auth.role = \"org_admin\"",
+    "listRule": "@request.auth.id != \"\"",
+    "updateRule": "@request.auth.role = \"org_admin\"",
+    "viewRule": "@request.auth.id != \"\""
+  }, collection)
+
+  // remove field
+  collection.fields.removeById("relation3253625724")
+
+  return app.save(collection)
+})
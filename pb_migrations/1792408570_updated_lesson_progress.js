@@ -0,0 +1,26 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_67786189")
+
+  // update collection data
+  unmarshal({
+    "createRule": "course.organization = @request.auth.organization && (@request.auth.id != \"\" && assignee = @request.auth.id && course = lesson.course && course.assignees.id ?= @request.auth.id)",
+    "listRule": "course.organization = @request.auth.organization && (@request.auth.id != \"\" && (assignee = @request.auth.id || (@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\"))",
+    "updateRule": "course.organization = @request.auth.organization && (@request.auth.id != \"\" && assignee = @request.auth.id && @request.body.lesson:isset = false && @request.body.course:isset = false && @request.body.assignee:isset = false)",
+    "viewRule": "course.organization = @request.auth.organization && (@request.auth.id != \"\" && (assignee = @request.auth.id || (@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\"))"
+  }, collection)
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_67786189")
+
+  // update collection data
+  unmarshal({
+    "createRule": "@request.auth.id != \"\" && assignee = @request.auth.id && course = lesson.course && course.assignees.id ?= @request.auth.id",
+    "listRule": "@request.auth.id != \"\" && (assignee = @request.auth.id || (@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\")",
+    "updateRule": "@request.auth.id != \"\" && assignee = @request.auth.id && @request.body.lesson:isset = false && @request.body.course:isset = false && @request.body.assignee:isset = false",
+    "viewRule": "@request.auth.id != \"\" && (assignee = @request.auth.id || (@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\")"
+  }, collection)
+
+  return app.save(collection)
+})
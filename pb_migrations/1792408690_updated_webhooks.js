@@ -0,0 +1,46 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_3653375940")
+
+  // update collection data
+  unmarshal({
+    "createRule": "@request.body.organization:isset = false && (@request.auth.role = \"org_admin\")",
+    "deleteRule": "organization = @request.auth.organization && (@request.auth.role = \"org_admin\")",
+    "listRule": "organization = @request.auth.organization && (@request.auth.role = \"org_admin\")",
+    "updateRule": "organization = @request.auth.organization && @request.body.organization:isset = false && (@request.auth.role = \"org_admin\")",
+    "viewRule": "organization = @request.auth.organization && (@request.auth.role = \"org_admin\")"
+  }, collection)
+
+  // add field
+  collection.fields.addAt(6, new Field({
+    "cascadeDelete": false,
+    "collectionId": "pbc_2873630990",
+    "hidden": false,
+    "id": "relation3253625724",
+    "maxSelect": 1,
+    "minSelect": 0,
+    "name": "organization",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "relation"
+  }))
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_3653375940")
+
+  // update collection data
+  unmarshal({
+    "createRule": "@request.auth.role = \"org_admin\"",
+    "deleteRule": "@request.auth.role = \"org_admin\"",
+    "listRule": "@request.auth.role = \"org_admin\"",
+    "updateRule": "@request.auth.role = \"org_admin\"",
+    "viewRule": "@request.auth.role = \"org_admin\""
+  }, collection)
+
+  // remove field
+  collection.fields.removeById("relation3253625724")
+
+  return app.save(collection)
+})
@@ -0,0 +1,42 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_955655590")
+
+  // update collection data
+  unmarshal({
+    "listRule": "organization = @request.auth.organization && (@request.auth.id != \"\" && ((assignees.id ?= @request.auth.id && id ?= @collection.lessons.course.id) || (@request.auth.role = \"manager\" && assignees.managers.id ?= @request.auth.id) || (@request.auth.role = \"instructor\" && owner = @request.auth.id) || @request.auth.role = \"org_admin\" || enrollment = \"open\" || enrollment = \"approval\"))",
+    "viewRule": "organization = @request.auth.organization && (@request.auth.id != \"\" && ((assignees.id ?= @request.auth.id && id ?= @collection.lessons.course.id) || (@request.auth.role = \"manager\" && assignees.managers.id ?= @request.auth.id) || (@request.auth.role = \"instructor\" && owner = @request.auth.id) || @request.auth.role = \"org_admin\" || enrollment = \"open\" || enrollment = \"approval\"))"
+  }, collection)
+
+  // add field
+  collection.fields.addAt(7, new Field({
+    "hidden": false,
+    "id": "select3688683489",
+    "maxSelect": 1,
+    "name": "enrollment",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "select",
+    "values": [
+      "assigned",
+      "open",
+      "approval"
+    ]
+  }))
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_955655590")
+
+  // update collection data
+  unmarshal({
+    "listRule": "organization = @request.auth.organization && (@request.auth.id != \"\" && ((assignees.id ?= @request.auth.id && id ?= @collection.lessons.course.id) || (@request.auth.role = \"manager\" && assignees.managers.id ?= @request.auth.id) || (@request.auth.role = \"instructor\" && owner = @request.auth.id) || @request.auth.role = \"org_admin\"))",
+    "viewRule": "organization = @request.auth.organization && (@request.auth.id != \"\" && ((assignees.id ?= @request.auth.id && id ?= @collection.lessons.course.id) || (@request.auth.role = \"manager\" && assignees.managers.id ?= @request.auth.id) || (@request.auth.role = \"instructor\" && owner = @request.auth.id) || @request.auth.role = \"org_admin\"))"
+  }, collection)
+
+  // remove field
+  collection.fields.removeById("select3688683489")
+
+  return app.save(collection)
+})
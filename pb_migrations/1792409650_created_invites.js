@@ -0,0 +1,159 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = new Collection({
+    "createRule": "@request.auth.id != \"\" && (@request.auth.role = \"org_admin\" || @request.auth.role = \"instructor\") && @request.body.uses:isset = false && @request.body.revoked_at:isset = false && @request.body.created_by:isset = false && @request.body.organization:isset = false",
+    "deleteRule": null,
+    "fields": [
+      {
+        "autogeneratePattern": "[a-z0-9]{15}",
+        "hidden": false,
+        "id": "text3208210256",
+        "max": 15,
+        "min": 15,
+        "name": "id",
+        "pattern": "^[a-z0-9]+$",
+        "presentable": false,
+        "primaryKey": true,
+        "required": true,
+        "system": true,
+        "type": "text"
+      },
+      {
+        "autogeneratePattern": "[A-Z0-9]{10}",
+        "hidden": false,
+        "id": "text1997877400",
+        "max": 32,
+        "min": 0,
+        "name": "code",
+        "pattern": "^[A-Za-z0-9_-]+$",
+        "presentable": false,
+        "primaryKey": false,
+        "required": true,
+        "system": false,
+        "type": "text"
+      },
+      {
+        "cascadeDelete": false,
+        "collectionId": "pbc_955655590",
+        "hidden": false,
+        "id": "relation2846186060",
+        "maxSelect": 99,
+        "minSelect": 0,
+        "name": "courses",
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "cascadeDelete": false,
+        "collectionId": "pbc_2873630990",
+        "hidden": false,
+        "id": "relation3253625724",
+        "maxSelect": 1,
+        "minSelect": 0,
+        "name": "organization",
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "hidden": false,
+        "id": "date261981154",
+        "max": "",
+        "min": "",
+        "name": "expires_at",
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "date"
+      },
+      {
+        "hidden": false,
+        "id": "number2247082791",
+        "max": null,
+        "min": 0,
+        "name": "max_uses",
+        "onlyInt": true,
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "number"
+      },
+      {
+        "hidden": false,
+        "id": "number4204062431",
+        "max": null,
+        "min": 0,
+        "name": "uses",
+        "onlyInt": true,
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "number"
+      },
+      {
+        "hidden": false,
+        "id": "date3687365789",
+        "max": "",
+        "min": "",
+        "name": "revoked_at",
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "date"
+      },
+      {
+        "autogeneratePattern": "",
+        "hidden": false,
+        "id": "text3725765462",
+        "max": 0,
+        "min": 0,
+        "name": "created_by",
+        "pattern": "",
+        "presentable": false,
+        "primaryKey": false,
+        "required": false,
+        "system": false,
+        "type": "text"
+      },
+      {
+        "hidden": false,
+        "id": "autodate2990389176",
+        "name": "created",
+        "onCreate": true,
+        "onUpdate": false,
+        "presentable": false,
+        "system": false,
+        "type": "autodate"
+      },
+      {
+        "hidden": false,
+        "id": "autodate3332085495",
+        "name": "updated",
+        "onCreate": true,
+        "onUpdate": true,
+        "presentable": false,
+        "system": false,
+        "type": "autodate"
+      }
+    ],
+    "id": "pbc_2452428166",
+    "indexes": [
+      "CREATE UNIQUE INDEX `idx_invites_code` ON `invites` (`code`)"
+    ],
+    "listRule": "organization = @request.auth.organization && (@request.auth.role = \"org_admin\" || (@request.auth.role = \"instructor\" && created_by = @request.auth.id))",
+    "name": "invites",
+    "system": false,
+    "type": "base",
+    "updateRule": "organization = @request.auth.organization && (@request.auth.role = \"org_admin\" || (@request.auth.role = \"instructor\" && created_by = @request.auth.id)) && @request.body.uses:isset = false && @request.body.revoked_at:isset = false && @request.body.created_by:isset = false && @request.body.organization:isset = false && @request.body.code:isset = false && @request.body.courses:isset = false",
+    "viewRule": "organization = @request.auth.organization && (@request.auth.role = \"org_admin\" || (@request.auth.role = \"instructor\" && created_by = @request.auth.id))"
+  });
+
+  return app.save(collection);
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2452428166");
+
+  return app.delete(collection);
+})
@@ -0,0 +1,88 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = new Collection({
+    "createRule": null,
+    "deleteRule": null,
+    "fields": [
+      {
+        "autogeneratePattern": "[a-z0-9]{15}",
+        "hidden": false,
+        "id": "text3208210256",
+        "max": 15,
+        "min": 15,
+        "name": "id",
+        "pattern": "^[a-z0-9]+$",
+        "presentable": false,
+        "primaryKey": true,
+        "required": true,
+        "system": true,
+        "type": "text"
+      },
+      {
+        "cascadeDelete": false,
+        "collectionId": "pbc_2452428166",
+        "hidden": false,
+        "id": "relation3353481431",
+        "maxSelect": 1,
+        "minSelect": 0,
+        "name": "invite",
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "cascadeDelete": true,
+        "collectionId": "_pb_users_auth_",
+        "hidden": false,
+        "id": "relation2375276105",
+        "maxSelect": 1,
+        "minSelect": 0,
+        "name": "user",
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "cascadeDelete": false,
+        "collectionId": "pbc_955655590",
+        "hidden": false,
+        "id": "relation2846186060",
+        "maxSelect": 99,
+        "minSelect": 0,
+        "name": "courses",
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "hidden": false,
+        "id": "autodate2990389176",
+        "name": "created",
+        "onCreate": true,
+        "onUpdate": false,
+        "presentable": false,
+        "system": false,
+        "type": "autodate"
+      }
+    ],
+    "id": "pbc_3837143612",
+    "indexes": [
+      "CREATE UNIQUE INDEX `idx_invite_redemptions_invite_user` ON `invite_redemptions` (\n  `invite`,\n  `user`\n)"
+    ],
+    "listRule": "invite.organization = @request.auth.organization && (user = @request.auth.id || @request.auth.role = \"org_admin\" || (@request.auth.role = \"instructor\" && invite.created_by = @request.auth.id))",
+    "name": "invite_redemptions",
+    "system": false,
+    "type": "base",
+    "updateRule": null,
+    "viewRule": "invite.organization = @request.auth.organization && (user = @request.auth.id || @request.auth.role = \"org_admin\" || (@request.auth.role = \"instructor\" && invite.created_by = @request.auth.id))"
+  });
+
+  return app.save(collection);
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_3837143612");
+
+  return app.delete(collection);
+})
@@ -0,0 +1,86 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = new Collection({
+    "createRule": null,
+    "deleteRule": null,
+    "fields": [
+      {
+        "autogeneratePattern": "[a-z0-9]{15}",
+        "hidden": false,
+        "id": "text3208210256",
+        "max": 15,
+        "min": 15,
+        "name": "id",
+        "pattern": "^[a-z0-9]+$",
+        "presentable": false,
+        "primaryKey": true,
+        "required": true,
+        "system": true,
+        "type": "text"
+      },
+      {
+        "autogeneratePattern": "",
+        "hidden": false,
+        "id": "text2812878347",
+        "max": 0,
+        "min": 0,
+        "name": "domain",
+        "pattern": "^[a-z0-9.-]+\\.[a-z]{2,}$",
+        "presentable": false,
+        "primaryKey": false,
+        "required": true,
+        "system": false,
+        "type": "text"
+      },
+      {
+        "cascadeDelete": false,
+        "collectionId": "pbc_2873630990",
+        "hidden": false,
+        "id": "relation3253625724",
+        "maxSelect": 1,
+        "minSelect": 0,
+        "name": "organization",
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "hidden": false,
+        "id": "autodate2990389176",
+        "name": "created",
+        "onCreate": true,
+        "onUpdate": false,
+        "presentable": false,
+        "system": false,
+        "type": "autodate"
+      },
+      {
+        "hidden": false,
+        "id": "autodate3332085495",
+        "name": "updated",
+        "onCreate": true,
+        "onUpdate": true,
+        "presentable": false,
+        "system": false,
+        "type": "autodate"
+      }
+    ],
+    "id": "pbc_3397549633",
+    "indexes": [
+      "CREATE UNIQUE INDEX `idx_signup_domains_domain` ON `signup_domains` (`domain`)"
+    ],
+    "listRule": "@request.auth.role = \"org_admin\" && organization = @request.auth.organization",
+    "name": "signup_domains",
+    "system": false,
+    "type": "base",
+    "updateRule": null,
+    "viewRule": "@request.auth.role = \"org_admin\" && organization = @request.auth.organization"
+  });
+
+  return app.save(collection);
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_3397549633");
+
+  return app.delete(collection);
+})
@@ -0,0 +1,57 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("_pb_users_auth_")
+
+  // update collection data
+  unmarshal({
+    "createRule": "(@request.body.role:isset = false && @request.body.manager:isset = false && @request.body.managers:isset = false && @request.body.department:isset = false && @request.body.organization:isset = false && @request.body.external_id:isset = false && @request.body.deactivated_at:isset = false) || @request.auth.role = \"org_admin\"",
+    "updateRule": "organization = @request.auth.organization && @request.body.organization:isset = false && ((id = @request.auth.id && @request.body.role:isset = false && @request.body.manager:isset = false && @request.body.managers:isset = false && @request.body.department:isset = false && @request.body.external_id:isset = false && @request.body.deactivated_at:isset = false) || @request.auth.role = \"org_admin\")"
+  }, collection)
+
+  // add field
+  collection.fields.addAt(13, new Field({
+    "autogeneratePattern": "",
+    "hidden": false,
+    "id": "text2675300272",
+    "max": 0,
+    "min": 0,
+    "name": "external_id",
+    "pattern": "",
+    "presentable": false,
+    "primaryKey": false,
+    "required": false,
+    "system": false,
+    "type": "text"
+  }))
+
+  // add field
+  collection.fields.addAt(14, new Field({
+    "hidden": false,
+    "id": "date1543527501",
+    "max": "",
+    "min": "",
+    "name": "deactivated_at",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "date"
+  }))
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("_pb_users_auth_")
+
+  // update collection data
+  unmarshal({
+    "createRule": "(@request.body.role:isset = false && @request.body.manager:isset = false && @request.body.managers:isset = false && @request.body.department:isset = false && @request.body.organization:isset = false) || @request.auth.role = \"org_admin\"",
+    "updateRule": "organization = @request.auth.organization && @request.body.organization:isset = false && ((id = @request.auth.id && @request.body.role:isset = false && @request.body.manager:isset = false && @request.body.managers:isset = false && @request.body.department:isset = false) || @request.auth.role = \"org_admin\")"
+  }, collection)
+
+  // remove field
+  collection.fields.removeById("text2675300272")
+
+  // remove field
+  collection.fields.removeById("date1543527501")
+
+  return app.save(collection)
+})
@@ -0,0 +1,171 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = new Collection({
+    "createRule": "@request.auth.role = \"org_admin\" && @request.body.organization:isset = false && @request.body.tool_key:isset = false",
+    "deleteRule": "organization = @request.auth.organization && @request.auth.role = \"org_admin\"",
+    "fields": [
+      {
+        "autogeneratePattern": "[a-z0-9]{15}",
+        "hidden": false,
+        "id": "text3208210256",
+        "max": 15,
+        "min": 15,
+        "name": "id",
+        "pattern": "^[a-z0-9]+$",
+        "presentable": false,
+        "primaryKey": true,
+        "required": true,
+        "system": true,
+        "type": "text"
+      },
+      {
+        "autogeneratePattern": "",
+        "hidden": false,
+        "id": "text1579384326",
+        "max": 0,
+        "min": 0,
+        "name": "name",
+        "pattern": "",
+        "presentable": false,
+        "primaryKey": false,
+        "required": true,
+        "system": false,
+        "type": "text"
+      },
+      {
+        "cascadeDelete": true,
+        "collectionId": "pbc_2873630990",
+        "hidden": false,
+        "id": "relation3253625724",
+        "maxSelect": 1,
+        "minSelect": 0,
+        "name": "organization",
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "autogeneratePattern": "",
+        "hidden": false,
+        "id": "text2910474005",
+        "max": 0,
+        "min": 0,
+        "name": "issuer",
+        "pattern": "",
+        "presentable": false,
+        "primaryKey": false,
+        "required": true,
+        "system": false,
+        "type": "text"
+      },
+      {
+        "autogeneratePattern": "",
+        "hidden": false,
+        "id": "text434858273",
+        "max": 0,
+        "min": 0,
+        "name": "client_id",
+        "pattern": "",
+        "presentable": false,
+        "primaryKey": false,
+        "required": true,
+        "system": false,
+        "type": "text"
+      },
+      {
+        "hidden": false,
+        "id": "json3846643891",
+        "maxSize": 0,
+        "name": "deployment_ids",
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "json"
+      },
+      {
+        "exceptDomains": [],
+        "hidden": false,
+        "id": "url2396745222",
+        "name": "auth_login_url",
+        "onlyDomains": [],
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "url"
+      },
+      {
+        "exceptDomains": [],
+        "hidden": false,
+        "id": "url698426464",
+        "name": "auth_token_url",
+        "onlyDomains": [],
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "url"
+      },
+      {
+        "exceptDomains": [],
+        "hidden": false,
+        "id": "url1239313265",
+        "name": "jwks_url",
+        "onlyDomains": [],
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "url"
+      },
+      {
+        "autogeneratePattern": "",
+        "hidden": true,
+        "id": "text1931032195",
+        "max": 10000,
+        "min": 0,
+        "name": "tool_key",
+        "pattern": "",
+        "presentable": false,
+        "primaryKey": false,
+        "required": false,
+        "system": false,
+        "type": "text"
+      },
+      {
+        "hidden": false,
+        "id": "autodate2990389176",
+        "name": "created",
+        "onCreate": true,
+        "onUpdate": false,
+        "presentable": false,
+        "system": false,
+        "type": "autodate"
+      },
+      {
+        "hidden": false,
+        "id": "autodate3332085495",
+        "name": "updated",
+        "onCreate": true,
+        "onUpdate": true,
+        "presentable": false,
+        "system": false,
+        "type": "autodate"
+      }
+    ],
+    "id": "pbc_3343599080",
+    "indexes": [
+      "CREATE UNIQUE INDEX `idx_lti_platforms_client` ON `lti_platforms` (\n  `issuer`,\n  `client_id`\n)"
+    ],
+    "listRule": "organization = @request.auth.organization && @request.auth.role = \"org_admin\"",
+    "name": "lti_platforms",
+    "system": false,
+    "type": "base",
+    "updateRule": "organization = @request.auth.organization && @request.auth.role = \"org_admin\" && @request.body.organization:isset = false && @request.body.tool_key:isset = false",
+    "viewRule": "organization = @request.auth.organization && @request.auth.role = \"org_admin\""
+  });
+
+  return app.save(collection);
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_3343599080");
+
+  return app.delete(collection);
+})
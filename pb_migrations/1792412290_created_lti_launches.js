@@ -0,0 +1,152 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = new Collection({
+    "createRule": null,
+    "deleteRule": null,
+    "fields": [
+      {
+        "autogeneratePattern": "[a-z0-9]{15}",
+        "hidden": false,
+        "id": "text3208210256",
+        "max": 15,
+        "min": 15,
+        "name": "id",
+        "pattern": "^[a-z0-9]+$",
+        "presentable": false,
+        "primaryKey": true,
+        "required": true,
+        "system": true,
+        "type": "text"
+      },
+      {
+        "cascadeDelete": true,
+        "collectionId": "pbc_3343599080",
+        "hidden": false,
+        "id": "relation961728715",
+        "maxSelect": 1,
+        "minSelect": 0,
+        "name": "platform",
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "autogeneratePattern": "",
+        "hidden": false,
+        "id": "text1476559580",
+        "max": 0,
+        "min": 0,
+        "name": "sub",
+        "pattern": "",
+        "presentable": false,
+        "primaryKey": false,
+        "required": true,
+        "system": false,
+        "type": "text"
+      },
+      {
+        "cascadeDelete": true,
+        "collectionId": "_pb_users_auth_",
+        "hidden": false,
+        "id": "relation2375276105",
+        "maxSelect": 1,
+        "minSelect": 0,
+        "name": "user",
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "cascadeDelete": true,
+        "collectionId": "pbc_955655590",
+        "hidden": false,
+        "id": "relation379482041",
+        "maxSelect": 1,
+        "minSelect": 0,
+        "name": "course",
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "autogeneratePattern": "",
+        "hidden": false,
+        "id": "text2650066584",
+        "max": 0,
+        "min": 0,
+        "name": "deployment_id",
+        "pattern": "",
+        "presentable": false,
+        "primaryKey": false,
+        "required": false,
+        "system": false,
+        "type": "text"
+      },
+      {
+        "autogeneratePattern": "",
+        "hidden": false,
+        "id": "text4026852761",
+        "max": 0,
+        "min": 0,
+        "name": "resource_link_id",
+        "pattern": "",
+        "presentable": false,
+        "primaryKey": false,
+        "required": false,
+        "system": false,
+        "type": "text"
+      },
+      {
+        "exceptDomains": [],
+        "hidden": false,
+        "id": "url2705002430",
+        "name": "lineitem",
+        "onlyDomains": [],
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "url"
+      },
+      {
+        "hidden": false,
+        "id": "autodate2990389176",
+        "name": "created",
+        "onCreate": true,
+        "onUpdate": false,
+        "presentable": false,
+        "system": false,
+        "type": "autodate"
+      },
+      {
+        "hidden": false,
+        "id": "autodate3332085495",
+        "name": "updated",
+        "onCreate": true,
+        "onUpdate": true,
+        "presentable": false,
+        "system": false,
+        "type": "autodate"
+      }
+    ],
+    "id": "pbc_2790193510",
+    "indexes": [
+      "CREATE INDEX `idx_lti_launches_sub` ON `lti_launches` (\n  `platform`,\n  `sub`\n)",
+      "CREATE UNIQUE INDEX `idx_lti_launches_link` ON `lti_launches` (\n  `platform`,\n  `sub`,\n  `resource_link_id`\n)"
+    ],
+    "listRule": "platform.organization = @request.auth.organization && @request.auth.role = \"org_admin\"",
+    "name": "lti_launches",
+    "system": false,
+    "type": "base",
+    "updateRule": null,
+    "viewRule": "platform.organization = @request.auth.organization && @request.auth.role = \"org_admin\""
+  });
+
+  return app.save(collection);
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2790193510");
+
+  return app.delete(collection);
+})
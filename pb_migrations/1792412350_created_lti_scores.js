@@ -0,0 +1,184 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = new Collection({
+    "createRule": null,
+    "deleteRule": null,
+    "fields": [
+      {
+        "autogeneratePattern": "[a-z0-9]{15}",
+        "hidden": false,
+        "id": "text3208210256",
+        "max": 15,
+        "min": 15,
+        "name": "id",
+        "pattern": "^[a-z0-9]+$",
+        "presentable": false,
+        "primaryKey": true,
+        "required": true,
+        "system": true,
+        "type": "text"
+      },
+      {
+        "cascadeDelete": true,
+        "collectionId": "pbc_2790193510",
+        "hidden": false,
+        "id": "relation2042058741",
+        "maxSelect": 1,
+        "minSelect": 0,
+        "name": "launch",
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "cascadeDelete": false,
+        "collectionId": "pbc_1649388127",
+        "hidden": false,
+        "id": "relation570552902",
+        "maxSelect": 1,
+        "minSelect": 0,
+        "name": "progress",
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "hidden": false,
+        "id": "select2063623452",
+        "maxSelect": 1,
+        "name": "status",
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "select",
+        "values": [
+          "pending",
+          "succeeded",
+          "failed"
+        ]
+      },
+      {
+        "hidden": false,
+        "id": "number3217549156",
+        "max": null,
+        "min": 0,
+        "name": "attempts",
+        "onlyInt": true,
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "number"
+      },
+      {
+        "hidden": false,
+        "id": "date3681079236",
+        "max": "",
+        "min": "",
+        "name": "next_attempt_at",
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "date"
+      },
+      {
+        "autogeneratePattern": "",
+        "hidden": false,
+        "id": "text1066830442",
+        "max": 0,
+        "min": 0,
+        "name": "last_error",
+        "pattern": "",
+        "presentable": false,
+        "primaryKey": false,
+        "required": false,
+        "system": false,
+        "type": "text"
+      },
+      {
+        "hidden": false,
+        "id": "number3686021634",
+        "max": null,
+        "min": null,
+        "name": "response_code",
+        "onlyInt": true,
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "number"
+      },
+      {
+        "autogeneratePattern": "",
+        "hidden": false,
+        "id": "text1997078824",
+        "max": 0,
+        "min": 0,
+        "name": "response_body",
+        "pattern": "",
+        "presentable": false,
+        "primaryKey": false,
+        "required": false,
+        "system": false,
+        "type": "text"
+      },
+      {
+        "hidden": false,
+        "id": "json1110206997",
+        "maxSize": 0,
+        "name": "payload",
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "json"
+      },
+      {
+        "hidden": false,
+        "id": "date381301211",
+        "max": "",
+        "min": "",
+        "name": "delivered_at",
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "date"
+      },
+      {
+        "hidden": false,
+        "id": "autodate2990389176",
+        "name": "created",
+        "onCreate": true,
+        "onUpdate": false,
+        "presentable": false,
+        "system": false,
+        "type": "autodate"
+      },
+      {
+        "hidden": false,
+        "id": "autodate3332085495",
+        "name": "updated",
+        "onCreate": true,
+        "onUpdate": true,
+        "presentable": false,
+        "system": false,
+        "type": "autodate"
+      }
+    ],
+    "id": "pbc_3607468786",
+    "indexes": [
+      "CREATE INDEX `idx_lti_scores_status` ON `lti_scores` (\n  `status`,\n  `next_attempt_at`\n)"
+    ],
+    "listRule": "launch.platform.organization = @request.auth.organization && @request.auth.role = \"org_admin\"",
+    "name": "lti_scores",
+    "system": false,
+    "type": "base",
+    "updateRule": null,
+    "viewRule": "launch.platform.organization = @request.auth.organization && @request.auth.role = \"org_admin\""
+  });
+
+  return app.save(collection);
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_3607468786");
+
+  return app.delete(collection);
+})
@@ -0,0 +1,69 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2920376115")
+
+  // add field
+  collection.fields.addAt(10, new Field({
+    "hidden": false,
+    "id": "file70836249",
+    "maxSelect": 1,
+    "maxSize": 1073741824,
+    "mimeTypes": [
+      "application/zip"
+    ],
+    "name": "scorm_package",
+    "presentable": false,
+    "protected": true,
+    "required": false,
+    "system": false,
+    "thumbs": [],
+    "type": "file"
+  }))
+
+  // add field
+  collection.fields.addAt(11, new Field({
+    "hidden": false,
+    "id": "select1699501135",
+    "maxSelect": 1,
+    "name": "scorm_version",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "select",
+    "values": [
+      "1.2",
+      "2004"
+    ]
+  }))
+
+  // add field
+  collection.fields.addAt(12, new Field({
+    "autogeneratePattern": "",
+    "hidden": false,
+    "id": "text2709659551",
+    "max": 2000,
+    "min": 0,
+    "name": "scorm_entry",
+    "pattern": "",
+    "presentable": false,
+    "primaryKey": false,
+    "required": false,
+    "system": false,
+    "type": "text"
+  }))
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2920376115")
+
+  // remove field
+  collection.fields.removeById("file70836249")
+
+  // remove field
+  collection.fields.removeById("select1699501135")
+
+  // remove field
+  collection.fields.removeById("text2709659551")
+
+  return app.save(collection)
+})
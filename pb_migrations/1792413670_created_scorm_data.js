@@ -0,0 +1,189 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = new Collection({
+    "createRule": null,
+    "deleteRule": null,
+    "fields": [
+      {
+        "autogeneratePattern": "[a-z0-9]{15}",
+        "hidden": false,
+        "id": "text3208210256",
+        "max": 15,
+        "min": 15,
+        "name": "id",
+        "pattern": "^[a-z0-9]+$",
+        "presentable": false,
+        "primaryKey": true,
+        "required": true,
+        "system": true,
+        "type": "text"
+      },
+      {
+        "cascadeDelete": true,
+        "collectionId": "pbc_2920376115",
+        "hidden": false,
+        "id": "relation4168381683",
+        "maxSelect": 1,
+        "minSelect": 0,
+        "name": "lesson",
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "cascadeDelete": true,
+        "collectionId": "pbc_955655590",
+        "hidden": false,
+        "id": "relation379482041",
+        "maxSelect": 1,
+        "minSelect": 0,
+        "name": "course",
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "cascadeDelete": true,
+        "collectionId": "_pb_users_auth_",
+        "hidden": false,
+        "id": "relation2090728460",
+        "maxSelect": 1,
+        "minSelect": 0,
+        "name": "assignee",
+        "presentable": false,
+        "required": true,
+        "system": false,
+        "type": "relation"
+      },
+      {
+        "hidden": false,
+        "id": "select3206337475",
+        "maxSelect": 1,
+        "name": "version",
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "select",
+        "values": [
+          "1.2",
+          "2004"
+        ]
+      },
+      {
+        "autogeneratePattern": "",
+        "hidden": false,
+        "id": "text338773067",
+        "max": 0,
+        "min": 0,
+        "name": "completion_status",
+        "pattern": "",
+        "presentable": false,
+        "primaryKey": false,
+        "required": false,
+        "system": false,
+        "type": "text"
+      },
+      {
+        "autogeneratePattern": "",
+        "hidden": false,
+        "id": "text3052705209",
+        "max": 0,
+        "min": 0,
+        "name": "success_status",
+        "pattern": "",
+        "presentable": false,
+        "primaryKey": false,
+        "required": false,
+        "system": false,
+        "type": "text"
+      },
+      {
+        "hidden": false,
+        "id": "number1830369710",
+        "max": null,
+        "min": null,
+        "name": "score_raw",
+        "onlyInt": false,
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "number"
+      },
+      {
+        "hidden": false,
+        "id": "number2436762638",
+        "max": 1,
+        "min": -1,
+        "name": "score_scaled",
+        "onlyInt": false,
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "number"
+      },
+      {
+        "autogeneratePattern": "",
+        "hidden": false,
+        "id": "text2897884890",
+        "max": 64000,
+        "min": 0,
+        "name": "suspend_data",
+        "pattern": "",
+        "presentable": false,
+        "primaryKey": false,
+        "required": false,
+        "system": false,
+        "type": "text"
+      },
+      {
+        "hidden": false,
+        "id": "json1374511229",
+        "maxSize": 1000000,
+        "name": "cmi",
+        "presentable": false,
+        "required": false,
+        "system": false,
+        "type": "json"
+      },
+      {
+        "hidden": false,
+        "id": "autodate2990389176",
+        "name": "created",
+        "onCreate": true,
+        "onUpdate": false,
+        "presentable": false,
+        "system": false,
+        "type": "autodate"
+      },
+      {
+        "hidden": false,
+        "id": "autodate3332085495",
+        "name": "updated",
+        "onCreate": true,
+        "onUpdate": true,
+        "presentable": false,
+        "system": false,
+        "type": "autodate"
+      }
+    ],
+    "id": "pbc_2500378856",
+    "indexes": [
+      "CREATE UNIQUE INDEX `idx_scorm_data_lesson_assignee` ON `scorm_data` (\n  `lesson`,\n  `assignee`\n)",
+      "CREATE INDEX `idx_scorm_data_course_assignee` ON `scorm_data` (\n  `course`,\n  `assignee`\n)"
+    ],
+    "listRule": "course.organization = @request.auth.organization && (@request.auth.id != \"\" && (assignee = @request.auth.id || ((@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\")))",
+    "name": "scorm_data",
+    "system": false,
+    "type": "base",
+    "updateRule": null,
+    "viewRule": "course.organization = @request.auth.organization && (@request.auth.id != \"\" && (assignee = @request.auth.id || ((@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\")))"
+  });
+
+  return app.save(collection);
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2500378856");
+
+  return app.delete(collection);
+})
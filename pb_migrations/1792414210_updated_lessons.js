@@ -0,0 +1,48 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2920376115")
+
+  // add field
+  collection.fields.addAt(13, new Field({
+    "hidden": false,
+    "id": "file957304846",
+    "maxSelect": 1,
+    "maxSize": 1073741824,
+    "mimeTypes": [
+      "application/zip",
+      "text/xml",
+      "application/xml"
+    ],
+    "name": "cmi5_package",
+    "presentable": false,
+    "protected": true,
+    "required": false,
+    "system": false,
+    "thumbs": [],
+    "type": "file"
+  }))
+
+  // add field
+  collection.fields.addAt(14, new Field({
+    "hidden": false,
+    "id": "json1158227539",
+    "maxSize": 1000000,
+    "name": "cmi5_structure",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "json"
+  }))
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2920376115")
+
+  // remove field
+  collection.fields.removeById("file957304846")
+
+  // remove field
+  collection.fields.removeById("json1158227539")
+
+  return app.save(collection)
+})
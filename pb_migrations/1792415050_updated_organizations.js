@@ -0,0 +1,25 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2873630990")
+
+  // add field
+  collection.fields.addAt(2, new Field({
+    "hidden": false,
+    "id": "json407716059",
+    "maxSize": 100000,
+    "name": "embed_hosts",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "json"
+  }))
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2873630990")
+
+  // remove field
+  collection.fields.removeById("json407716059")
+
+  return app.save(collection)
+})
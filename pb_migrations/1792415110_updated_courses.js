@@ -0,0 +1,22 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_955655590")
+
+  // update collection data
+  unmarshal({
+    "createRule": "@request.body.organization:isset = false && (@request.body.assignees:length = 0 || (@request.body.assignees.organization ?= @request.auth.organization && @request.body.assignees.organization = @request.auth.organization)) && (@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && (owner = \"\" || owner = @request.auth.id)) || @request.auth.role = \"org_admin\"))",
+    "updateRule": "organization = @request.auth.organization && @request.body.organization:isset = false && (@request.body.assignees:length = 0 || (@request.body.assignees.organization ?= @request.auth.organization && @request.body.assignees.organization = @request.auth.organization)) && (@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && owner = @request.auth.id && @request.body.owner:isset = false) || @request.auth.role = \"org_admin\"))"
+  }, collection)
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_955655590")
+
+  // update collection data
+  unmarshal({
+    "createRule": "@request.body.organization:isset = false && (@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && (owner = \"\" || owner = @request.auth.id)) || @request.auth.role = \"org_admin\"))",
+    "updateRule": "organization = @request.auth.organization && @request.body.organization:isset = false && (@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && owner = @request.auth.id && @request.body.owner:isset = false) || @request.auth.role = \"org_admin\"))"
+  }, collection)
+
+  return app.save(collection)
+})
@@ -0,0 +1,20 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_1649388127")
+
+  // update collection data
+  unmarshal({
+    "createRule": "course.organization = @request.auth.organization && assignee.organization = @request.auth.organization && (@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\"))"
+  }, collection)
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_1649388127")
+
+  // update collection data
+  unmarshal({
+    "createRule": "course.organization = @request.auth.organization && (@request.auth.id != \"\" && ((@request.auth.role = \"instructor\" && course.owner = @request.auth.id) || @request.auth.role = \"org_admin\"))"
+  }, collection)
+
+  return app.save(collection)
+})
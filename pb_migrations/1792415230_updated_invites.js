@@ -0,0 +1,68 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2452428166")
+
+  // update collection data
+  unmarshal({
+    "updateRule": "organization = @request.auth.organization && (@request.auth.role = \"org_admin\" || (@request.auth.role = \"instructor\" && created_by = @request.auth.id)) && @request.body.uses:isset = false && @request.body.revoked_at:isset = false && @request.body.created_by:isset = false && @request.body.organization:isset = false && @request.body.code:isset = false && @request.body.courses:isset = false && @request.body.groups:isset = false"
+  }, collection)
+
+  // add field
+  collection.fields.addAt(3, new Field({
+    "cascadeDelete": false,
+    "collectionId": "pbc_3346940990",
+    "hidden": false,
+    "id": "relation4033689968",
+    "maxSelect": 99,
+    "minSelect": 0,
+    "name": "groups",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "relation"
+  }))
+
+  // update field
+  collection.fields.addAt(2, new Field({
+    "cascadeDelete": false,
+    "collectionId": "pbc_955655590",
+    "hidden": false,
+    "id": "relation2846186060",
+    "maxSelect": 99,
+    "minSelect": 0,
+    "name": "courses",
+    "presentable": false,
+    "required": false,
+    "system": false,
+    "type": "relation"
+  }))
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2452428166")
+
+  // update collection data
+  unmarshal({
+    "updateRule": "organization = @request.auth.organization && (@request.auth.role = \"org_admin\" || (@request.auth.role = \"instructor\" && created_by = @request.auth.id)) && @request.body.uses:isset = false && @request.body.revoked_at:isset = false && @request.body.created_by:isset = false && @request.body.organization:isset = false && @request.body.code:isset = false && @request.body.courses:isset = false"
+  }, collection)
+
+  // remove field
+  collection.fields.removeById("relation4033689968")
+
+  // update field
+  collection.fields.addAt(2, new Field({
+    "cascadeDelete": false,
+    "collectionId": "pbc_955655590",
+    "hidden": false,
+    "id": "relation2846186060",
+    "maxSelect": 99,
+    "minSelect": 0,
+    "name": "courses",
+    "presentable": false,
+    "required": true,
+    "system": false,
+    "type": "relation"
+  }))
+
+  return app.save(collection)
+})
@@ -0,0 +1,52 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2452428166")
+
+  // update collection data
+  unmarshal({
+    "createRule": "@request.auth.id != \"\" && (@request.auth.role = \"org_admin\" || @request.auth.role = \"instructor\") && @request.body.uses:isset = false && @request.body.revoked_at:isset = false && @request.body.created_by:isset = false && @request.body.organization:isset = false && @request.body.code:isset = false"
+  }, collection)
+
+  // update field
+  collection.fields.addAt(1, new Field({
+    "autogeneratePattern": "[A-Z0-9]{10}",
+    "hidden": false,
+    "id": "text1997877400",
+    "max": 32,
+    "min": 10,
+    "name": "code",
+    "pattern": "^[A-Za-z0-9_-]+$",
+    "presentable": false,
+    "primaryKey": false,
+    "required": true,
+    "system": false,
+    "type": "text"
+  }))
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_2452428166")
+
+  // update collection data
+  unmarshal({
+    "createRule": "@request.auth.id != \"\" && (@request.auth.role = \"org_admin\" || @request.auth.role = \"instructor\") && @request.body.uses:isset = false && @request.body.revoked_at:isset = false && @request.body.created_by:isset = false && @request.body.organization:isset = false"
+  }, collection)
+
+  // update field
+  collection.fields.addAt(1, new Field({
+    "autogeneratePattern": "[A-Z0-9]{10}",
+    "hidden": false,
+    "id": "text1997877400",
+    "max": 32,
+    "min": 0,
+    "name": "code",
+    "pattern": "^[A-Za-z0-9_-]+$",
+    "presentable": false,
+    "primaryKey": false,
+    "required": true,
+    "system": false,
+    "type": "text"
+  }))
+
+  return app.save(collection)
+})
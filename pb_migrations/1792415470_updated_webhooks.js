@@ -0,0 +1,61 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_3653375940")
+
+  // unsubscribe the webhooks from the removed event
+  const webhooks = app.findRecordsByFilter("pbc_3653375940", "events ~ 'certificate.issued'", "", 0, 0)
+  for (const webhook of webhooks) {
+    const current = webhook.getStringSlice("events")
+    const events = []
+    for (let i = 0; i < current.length; i++) {
+      if (current[i] !== "certificate.issued") {
+        events.push(current[i])
+      }
+    }
+    webhook.set("events", events)
+    app.saveNoValidate(webhook)
+  }
+
+  // update field
+  collection.fields.addAt(4, new Field({
+    "hidden": false,
+    "id": "select1401378634",
+    "maxSelect": 4,
+    "name": "events",
+    "presentable": false,
+    "required": true,
+    "system": false,
+    "type": "select",
+    "values": [
+      "course.assigned",
+      "course.unassigned",
+      "progress.changed",
+      "course.completed"
+    ]
+  }))
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_3653375940")
+
+  // update field
+  collection.fields.addAt(4, new Field({
+    "hidden": false,
+    "id": "select1401378634",
+    "maxSelect": 5,
+    "name": "events",
+    "presentable": false,
+    "required": true,
+    "system": false,
+    "type": "select",
+    "values": [
+      "course.assigned",
+      "course.unassigned",
+      "progress.changed",
+      "course.completed",
+      "certificate.issued"
+    ]
+  }))
+
+  return app.save(collection)
+})
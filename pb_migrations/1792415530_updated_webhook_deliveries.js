@@ -0,0 +1,47 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_1554784199")
+
+  // update field
+  collection.fields.addAt(2, new Field({
+    "hidden": false,
+    "id": "select1001261735",
+    "maxSelect": 1,
+    "name": "event",
+    "presentable": false,
+    "required": true,
+    "system": false,
+    "type": "select",
+    "values": [
+      "course.assigned",
+      "course.unassigned",
+      "progress.changed",
+      "course.completed"
+    ]
+  }))
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_1554784199")
+
+  // update field
+  collection.fields.addAt(2, new Field({
+    "hidden": false,
+    "id": "select1001261735",
+    "maxSelect": 1,
+    "name": "event",
+    "presentable": false,
+    "required": true,
+    "system": false,
+    "type": "select",
+    "values": [
+      "course.assigned",
+      "course.unassigned",
+      "progress.changed",
+      "course.completed",
+      "certificate.issued"
+    ]
+  }))
+
+  return app.save(collection)
+})
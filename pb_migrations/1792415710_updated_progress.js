@@ -0,0 +1,20 @@
+/// <reference path="../pb_data/types.d.ts" />
+migrate((app) => {
+  const collection = app.findCollectionByNameOrId("pbc_1649388127")
+
+  // update collection data
+  unmarshal({
+    "updateRule": "organization = @request.auth.organization && (@request.auth.id != \"\" && assignee = @request.auth.id && @request.body.course:isset = false && @request.body.assignee:isset = false && @request.body.started_at:isset = false && @request.body.completed_at:isset = false)"
+  }, collection)
+
+  return app.save(collection)
+}, (app) => {
+  const collection = app.findCollectionByNameOrId("pbc_1649388127")
+
+  // update collection data
+  unmarshal({
+    "updateRule": "organization = @request.auth.organization && (@request.auth.id != \"\" && assignee = @request.auth.id && @request.body.course:isset = false && @request.body.assignee:isset = false)"
+  }, collection)
+
+  return app.save(collection)
+})
@@ -21,8 +21,12 @@ pb.authStore.onChange(() => {
 // function to fetch all the records from PocketBase
 export const fetchRecords = async () => {
   try {
+    // catalog courses are listable too, so only keep the assigned ones
     const courseRecords = await pb.collection("courses").getFullList({
       sort: "created",
+      filter: pb.filter("assignees.id ?= {:user}", {
+        user: pb.authStore.model?.id,
+      }),
     });
 
     const lessonRecords = await pb.collection("lessons").getFullList({
@@ -72,3 +76,103 @@ export const updateProgressStatus = async (progressRecordId, newStatus) => {
     showAlert("Failed to update course status. Please try again", "fail");
   }
 };
+
+// function to reset the progress of a course back to "Not Started"
+export const resetProgressStatus = async (progressRecordId) => {
+  try {
+    const progressRecord = await pb.send(
+      `/api/progress/${progressRecordId}/reset`,
+      { method: "POST" },
+    );
+    return progressRecord;
+  } catch (error) {
+    showAlert("Failed to reset course progress. Please try again", "fail");
+  }
+};
+
+// function to fetch the open and approval-required courses of the catalog
+export const fetchCatalog = async () => {
+  try {
+    const catalogRecords = await pb.collection("courses").getFullList({
+      sort: "title",
+      filter: 'enrollment = "open" || enrollment = "approval"',
+    });
+    return catalogRecords.filter(
+      (course) => !course.assignees.includes(pb.authStore.model.id),
+    );
+  } catch (error) {
+    showAlert("Failed to load the course catalog. Please try again", "fail");
+  }
+};
+
+// function to enroll the current user into a catalog course
+export const enrollInCourse = async (courseId) => {
+  try {
+    return await pb.send(`/api/courses/${courseId}/enroll`, {
+      method: "POST",
+    });
+  } catch (error) {
+    showAlert("Failed to enroll in the course. Please try again", "fail");
+  }
+};
+
+// function to redeem a course invite code for the current user
+export const redeemInvite = async (code) => {
+  try {
+    return await pb.send("/api/invites/redeem", {
+      method: "POST",
+      body: { code },
+    });
+  } catch (error) {
+    showAlert("Invalid or expired invite code", "fail");
+  }
+};
+
+// function to launch a SCORM lesson, returning the SCO URL and its runtime data
+export const launchScormLesson = async (lessonId) => {
+  try {
+    return await pb.send(`/api/scorm/${lessonId}/launch`, { method: "POST" });
+  } catch (error) {
+    showAlert("Failed to load the lesson. Please try again", "fail");
+  }
+};
+
+// function to save the runtime data set by a SCORM lesson
+export const commitScormData = async (
+  lessonId,
+  cmi,
+  keepalive = false,
+  session = "",
+) => {
+  try {
+    return await pb.send(`/api/scorm/${lessonId}/commit`, {
+      method: "POST",
+      body: { cmi, session },
+      keepalive,
+      requestKey: null,
+    });
+  } catch (error) {
+    showAlert("Failed to save the lesson progress", "fail");
+  }
+};
+
+// function to get the AUs of a cmi5 lesson with the learner's moveOn status
+export const getCmi5Lesson = async (lessonId) => {
+  try {
+    return await pb.send(`/api/cmi5/${lessonId}`, { method: "GET" });
+  } catch (error) {
+    showAlert("Failed to load the lesson. Please try again", "fail");
+  }
+};
+
+// function to launch an AU of a cmi5 lesson, returning its launch URL
+export const launchCmi5AU = async (lessonId, au, returnUrl) => {
+  try {
+    return await pb.send(`/api/cmi5/${lessonId}/launch`, {
+      method: "POST",
+      body: { au, return_url: returnUrl },
+    });
+  } catch (error) {
+    showAlert("Failed to launch the activity. Please try again", "fail");
+  }
+};
@@ -0,0 +1,47 @@
+// Bridge between a lesson page and the SCORM runtime API of its SCO frame.
+// The package pages run sandboxed in an opaque origin with their own copy of
+// the API (see hooks/scorm_api.js), which posts the values the SCO sets and
+// asks to commit them. The changed values are sent to the backend on commit.
+
+// createScormBridge listens to the API of the SCO in frame. commit(values,
+// keepalive) sends the changed values and resolves to whether they were saved.
+export function createScormBridge(frame, commit) {
+  let changed = {};
+
+  const send = (keepalive = false) => {
+    if (Object.keys(changed).length === 0) {
+      return;
+    }
+    const pending = changed;
+    changed = {};
+    commit(pending, keepalive).then((saved) => {
+      if (!saved) {
+        frame.contentWindow?.postMessage(
+          { elessonScorm: { type: "error" } },
+          "*",
+        );
+      }
+    });
+  };
+
+  const onMessage = (event) => {
+    const message = event.data?.elessonScorm;
+    if (!message || event.source !== frame.contentWindow) {
+      return;
+    }
+    if (message.type === "set") {
+      changed[message.element] = String(message.value);
+    } else if (message.type === "commit") {
+      send(message.keepalive);
+    }
+  };
+  window.addEventListener("message", onMessage);
+
+  return {
+    // send the values changed since the last commit, eg. when leaving the lesson
+    flush: () => send(true),
+    uninstall: () => {
+      window.removeEventListener("message", onMessage);
+    },
+  };
+}
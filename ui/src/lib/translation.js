@@ -42,6 +42,7 @@ export default {
     previousLesson: "Previous Lesson",
     resources: "Resources",
     notStarted: "Not Started",
+    launch: "Launch",
   },
   es: {
     welcomeTo: "Bienvenido a",
@@ -87,5 +88,6 @@ export default {
     previousLesson: "Lección anterior",
     resources: "Recursos",
     notStarted: "No iniciado",
+    launch: "Iniciar",
   },
 };